@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bgoldovsky/shortener/internal/app/generator"
+	urlsRepository "github.com/bgoldovsky/shortener/internal/app/repositories/urls"
+	"github.com/bgoldovsky/shortener/internal/config"
+)
+
+// urlIDSequence Имя счетчика идентификаторов сокращенных URL
+const urlIDSequence = "urls"
+
+type idGenerator interface {
+	RandomString(n int64) (string, error)
+}
+
+// sequenceLeaser Хранилище, умеющее резервировать диапазоны счетчика
+type sequenceLeaser interface {
+	Lease(ctx context.Context, name string, size int64) (int64, error)
+}
+
+// newURLIDGenerator Выбирает генератор идентификаторов сокращенных URL, записывающий их символами alphabet
+func newURLIDGenerator(kind string, nodeID int64, alphabet string, storageURL string, repo urlsRepository.Repository, random idGenerator) (idGenerator, error) {
+	switch kind {
+	case config.IDGeneratorSequence:
+		leaser, ok := repo.(sequenceLeaser)
+		if !ok {
+			return nil, fmt.Errorf("storage %s does not support sequence ids, use %s generator", storageURL, config.IDGeneratorSnowflake)
+		}
+		return generator.NewSequence(leaser, urlIDSequence, generator.DefaultLeaseSize, alphabet)
+	case config.IDGeneratorSnowflake:
+		return generator.NewSnowflake(nodeID, alphabet)
+	default:
+		return random, nil
+	}
+}
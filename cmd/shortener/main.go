@@ -1,51 +1,114 @@
 package main
 
 import (
+	"encoding/json"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/sirupsen/logrus"
 
+	"github.com/bgoldovsky/shortener/internal/app/bots"
 	"github.com/bgoldovsky/shortener/internal/app/generator"
+	"github.com/bgoldovsky/shortener/internal/app/geoip"
 	"github.com/bgoldovsky/shortener/internal/app/hasher"
 	"github.com/bgoldovsky/shortener/internal/app/models"
+	"github.com/bgoldovsky/shortener/internal/app/pages"
 	urlsRepository "github.com/bgoldovsky/shortener/internal/app/repositories/urls"
+	_ "github.com/bgoldovsky/shortener/internal/app/repositories/urls/bolt"
+	"github.com/bgoldovsky/shortener/internal/app/repositories/urls/cache"
+	_ "github.com/bgoldovsky/shortener/internal/app/repositories/urls/file"
+	_ "github.com/bgoldovsky/shortener/internal/app/repositories/urls/inmemory"
+	_ "github.com/bgoldovsky/shortener/internal/app/repositories/urls/postgres"
 	authService "github.com/bgoldovsky/shortener/internal/app/services/auth"
 	cleanerService "github.com/bgoldovsky/shortener/internal/app/services/cleaner"
+	clicksService "github.com/bgoldovsky/shortener/internal/app/services/clicks"
 	infraService "github.com/bgoldovsky/shortener/internal/app/services/infra"
+	passwordsService "github.com/bgoldovsky/shortener/internal/app/services/passwords"
 	urlsService "github.com/bgoldovsky/shortener/internal/app/services/urls"
+	variantsService "github.com/bgoldovsky/shortener/internal/app/services/variants"
 	"github.com/bgoldovsky/shortener/internal/config"
 	"github.com/bgoldovsky/shortener/internal/handlers"
 	"github.com/bgoldovsky/shortener/internal/middlewares"
 )
 
-const deleteQueueSize = 100
+const (
+	deleteQueueSize = 100
+	clicksQueueSize = 10_000
+)
 
 func main() {
 	// Config
 	cfg, err := config.NewConfig()
 	panicOnError(err)
 
+	// Migrations
+	if len(cfg.Args) > 0 && cfg.Args[0] == "migrate" {
+		panicOnError(migrate(cfg.StorageURL, cfg.Args[1:]))
+		return
+	}
+
 	// Channels
 	deleteCh := make(chan models.UserCollection, deleteQueueSize)
+	clicksCh := make(chan models.Click, clicksQueueSize)
 	doneCh := make(chan struct{})
-	defer func() { doneCh <- struct{}{} }()
+	defer close(doneCh)
 
 	// Repositories
-	urlsRepo, err := urlsRepository.Factory(cfg.FileStoragePath, cfg.DatabaseDSN)
+	urlsRepo, err := urlsRepository.Factory(cfg.StorageURL)
 	panicOnError(err)
 	defer func(urlsRepo urlsRepository.Repository) {
 		_ = urlsRepo.Close()
 	}(urlsRepo)
 
+	// Generators
+	// Генератор идентификаторов может резервировать диапазоны в самом хранилище, поэтому создается до кэша
+	urlIDRandom, err := generator.NewGenerator(cfg.IDAlphabet)
+	panicOnError(err)
+	urlIDGen, err := newURLIDGenerator(cfg.IDGenerator, cfg.NodeID, cfg.IDAlphabet, cfg.StorageURL, urlsRepo, urlIDRandom)
+	panicOnError(err)
+	if cfg.IDDenyList != "" {
+		denyList, err := generator.LoadDenyList(cfg.IDDenyList)
+		panicOnError(err)
+		urlIDGen = generator.NewFiltered(urlIDGen, denyList)
+	}
+
+	// Алфавит идентификаторов пользователей не настраивается, чтобы не сломать проверку выданных токенов
+	userIDGen, err := generator.NewGenerator(generator.AlphabetLetters)
+	panicOnError(err)
+
+	if cfg.CacheSize > 0 {
+		cached := cache.NewRepository(urlsRepo, cfg.CacheSize, cfg.CacheTTL, cfg.CacheNegativeTTL)
+		if cfg.AdminAddress != "" {
+			go serveAdmin(cfg.AdminAddress, cached.Stats)
+		}
+		urlsRepo = cached
+	}
+
 	// Services
-	gen := generator.NewGenerator()
 	hash := hasher.NewHasher(cfg.Secret)
-	urlsSrv := urlsService.NewService(urlsRepo, gen, cfg.BaseURL)
-	authSrv := authService.NewService(gen, hash)
+	urlsSrv := urlsService.NewService(urlsRepo, urlIDGen, cfg.BaseURL, cfg.IDLength, cfg.RedirectType)
+	authSrv := authService.NewService(userIDGen, hash, cfg.UserIDLength)
 	infraSrv := infraService.NewService(urlsRepo)
+	passwordsSrv := passwordsService.NewService(cfg.Secret)
+	variantsSrv := variantsService.NewService(cfg.Secret)
 	cleanerSrv := cleanerService.NewService(urlsRepo, deleteCh, doneCh)
 	cleanerSrv.Run()
+	geoResolver, err := geoip.NewResolver(cfg.GeoIPDatabase)
+	panicOnError(err)
+	defer func() {
+		_ = geoResolver.Close()
+	}()
+	clicksSrv := clicksService.NewService(urlsRepo, geoResolver, clicksCh, doneCh)
+	clicksSrv.Run()
+
+	// Classifiers
+	botsClassifier, err := bots.NewClassifier(cfg.BotPatterns)
+	panicOnError(err)
+	reloadOnHangup(botsClassifier, doneCh)
+
+	// Pages
+	renderer, err := pages.NewRenderer(cfg.TemplatesDir)
+	panicOnError(err)
 
 	// Router
 	r := chi.NewRouter()
@@ -54,20 +117,40 @@ func main() {
 	compress, err := middlewares.NewCompressor()
 	panicOnError(err)
 	auth := middlewares.NewAuthenticator(authSrv)
+	realIP, err := middlewares.NewRealIP(cfg.TrustedProxies)
+	panicOnError(err)
 
+	r.Use(realIP.RealIP)
 	r.Use(middlewares.Logging)
 	r.Use(middlewares.Recovering)
 	r.Use(middlewares.Decompressing)
 	r.Use(compress.Compressing)
 	r.Use(auth.Auth)
 
-	r.Post("/", handlers.New(urlsSrv, auth, infraSrv, cleanerSrv).ShortenV1)
-	r.Post("/api/shorten", handlers.New(urlsSrv, auth, infraSrv, cleanerSrv).ShortenV2)
-	r.Post("/api/shorten/batch", handlers.New(urlsSrv, auth, infraSrv, cleanerSrv).ShortenBatch)
-	r.Get("/{id}", handlers.New(urlsSrv, auth, infraSrv, cleanerSrv).Expand)
-	r.Get("/api/user/urls", handlers.New(urlsSrv, auth, infraSrv, cleanerSrv).GetUrls)
-	r.Delete("/api/user/urls", handlers.New(urlsSrv, auth, infraSrv, cleanerSrv).DeleteUrls)
-	r.Get("/ping", handlers.New(urlsSrv, auth, infraSrv, cleanerSrv).Ping)
+	r.Post("/", handlers.New(urlsSrv, auth, infraSrv, cleanerSrv, clicksSrv, botsClassifier, renderer, passwordsSrv, variantsSrv).ShortenV1)
+	r.Post("/api/shorten", handlers.New(urlsSrv, auth, infraSrv, cleanerSrv, clicksSrv, botsClassifier, renderer, passwordsSrv, variantsSrv).ShortenV2)
+	r.Post("/api/shorten/batch", handlers.New(urlsSrv, auth, infraSrv, cleanerSrv, clicksSrv, botsClassifier, renderer, passwordsSrv, variantsSrv).ShortenBatch)
+	r.Get("/{id}", handlers.New(urlsSrv, auth, infraSrv, cleanerSrv, clicksSrv, botsClassifier, renderer, passwordsSrv, variantsSrv).Expand)
+	r.Head("/{id}", handlers.New(urlsSrv, auth, infraSrv, cleanerSrv, clicksSrv, botsClassifier, renderer, passwordsSrv, variantsSrv).Expand)
+	r.Get("/{id}/*", handlers.New(urlsSrv, auth, infraSrv, cleanerSrv, clicksSrv, botsClassifier, renderer, passwordsSrv, variantsSrv).Expand)
+	r.Head("/{id}/*", handlers.New(urlsSrv, auth, infraSrv, cleanerSrv, clicksSrv, botsClassifier, renderer, passwordsSrv, variantsSrv).Expand)
+	r.Get("/{id}+", handlers.New(urlsSrv, auth, infraSrv, cleanerSrv, clicksSrv, botsClassifier, renderer, passwordsSrv, variantsSrv).Preview)
+	r.Head("/{id}+", handlers.New(urlsSrv, auth, infraSrv, cleanerSrv, clicksSrv, botsClassifier, renderer, passwordsSrv, variantsSrv).Preview)
+	r.Post("/{id}", handlers.New(urlsSrv, auth, infraSrv, cleanerSrv, clicksSrv, botsClassifier, renderer, passwordsSrv, variantsSrv).Unlock)
+	r.Post("/{id}+", handlers.New(urlsSrv, auth, infraSrv, cleanerSrv, clicksSrv, botsClassifier, renderer, passwordsSrv, variantsSrv).Unlock)
+	r.Post("/{id}/*", handlers.New(urlsSrv, auth, infraSrv, cleanerSrv, clicksSrv, botsClassifier, renderer, passwordsSrv, variantsSrv).Unlock)
+	r.Get("/api/user/urls", handlers.New(urlsSrv, auth, infraSrv, cleanerSrv, clicksSrv, botsClassifier, renderer, passwordsSrv, variantsSrv).GetUrls)
+	r.Get("/api/user/urls/{id}/stats", handlers.New(urlsSrv, auth, infraSrv, cleanerSrv, clicksSrv, botsClassifier, renderer, passwordsSrv, variantsSrv).GetStats)
+	r.Post("/api/user/urls/{id}/dry-run", handlers.New(urlsSrv, auth, infraSrv, cleanerSrv, clicksSrv, botsClassifier, renderer, passwordsSrv, variantsSrv).DryRun)
+	r.Delete("/api/user/urls", handlers.New(urlsSrv, auth, infraSrv, cleanerSrv, clicksSrv, botsClassifier, renderer, passwordsSrv, variantsSrv).DeleteUrls)
+	r.Get("/api/user/utm", handlers.New(urlsSrv, auth, infraSrv, cleanerSrv, clicksSrv, botsClassifier, renderer, passwordsSrv, variantsSrv).GetUTMTemplate)
+	r.Put("/api/user/utm", handlers.New(urlsSrv, auth, infraSrv, cleanerSrv, clicksSrv, botsClassifier, renderer, passwordsSrv, variantsSrv).SetUTMTemplate)
+	r.Delete("/api/user/utm", handlers.New(urlsSrv, auth, infraSrv, cleanerSrv, clicksSrv, botsClassifier, renderer, passwordsSrv, variantsSrv).DeleteUTMTemplate)
+	r.Get("/ping", handlers.New(urlsSrv, auth, infraSrv, cleanerSrv, clicksSrv, botsClassifier, renderer, passwordsSrv, variantsSrv).Ping)
+
+	// Служебные префиксы не должны попадать в /{id}/* ссылок с передачей пути
+	r.HandleFunc("/api/*", http.NotFound)
+	r.HandleFunc("/debug/*", http.NotFound)
 
 	// Start service
 	address := cfg.ServerAddress
@@ -75,6 +158,20 @@ func main() {
 	logrus.Fatal(http.ListenAndServe(address, r))
 }
 
+// serveAdmin Отдает счетчики кэша на отдельном адресе, который не публикуется наружу
+func serveAdmin(address string, stats func() cache.Stats) {
+	r := chi.NewRouter()
+	r.Get("/debug/cache", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("content-type", "application/json")
+		if err := json.NewEncoder(w).Encode(stats()); err != nil {
+			logrus.WithError(err).Error("write cache stats error")
+		}
+	})
+
+	logrus.WithField("address", address).Info("admin server starts")
+	logrus.Fatal(http.ListenAndServe(address, r))
+}
+
 func panicOnError(err error) {
 	if err != nil {
 		logrus.WithError(err).Error("fatal error")
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	_ "github.com/lib/pq"
+
+	changelog "github.com/bgoldovsky/shortener/db"
+	"github.com/bgoldovsky/shortener/internal/app/migrations"
+)
+
+var errMigrateUsage = errors.New("usage: shortener -storage postgres://... migrate up|down|status")
+
+// migrate Применяет, откатывает миграции или выводит их состояние
+func migrate(storageURL string, args []string) error {
+	if !strings.HasPrefix(storageURL, "postgres://") && !strings.HasPrefix(storageURL, "postgresql://") {
+		return errors.New("migrations require postgres storage url")
+	}
+
+	if len(args) != 1 {
+		return errMigrateUsage
+	}
+
+	db, err := sql.Open("postgres", storageURL)
+	if err != nil {
+		return err
+	}
+
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+
+	migrator, err := migrations.NewMigrator(db, changelog.Changelog)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		return migrator.Up(ctx)
+	case "down":
+		return migrator.Down(ctx)
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.AppliedAt != nil {
+				appliedAt = status.AppliedAt.Format("2006-01-02 15:04:05 MST")
+			}
+			_, _ = fmt.Fprintf(w, "%04d\t%s\t%s\n", status.Version, status.Name, appliedAt)
+		}
+
+		return w.Flush()
+	}
+
+	return errMigrateUsage
+}
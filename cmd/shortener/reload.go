@@ -0,0 +1,36 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+)
+
+type reloader interface {
+	Reload() error
+}
+
+// reloadOnHangup Перечитывает настройки из файлов по сигналу SIGHUP
+func reloadOnHangup(r reloader, doneCh <-chan struct{}) {
+	hupCh := make(chan os.Signal, 1)
+	signal.Notify(hupCh, syscall.SIGHUP)
+
+	go func() {
+		defer signal.Stop(hupCh)
+
+		for {
+			select {
+			case <-hupCh:
+				if err := r.Reload(); err != nil {
+					logrus.WithError(err).Error("reload error")
+					continue
+				}
+				logrus.Info("reloaded")
+			case <-doneCh:
+				return
+			}
+		}
+	}()
+}
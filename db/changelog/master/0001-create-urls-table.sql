@@ -1,4 +1,4 @@
--- drop table if exists urls;
+-- +migrate Up
 create table if not exists urls
 (
     id varchar(10) not null primary key,
@@ -8,4 +8,7 @@ create table if not exists urls
     ---
     created_at timestamp with time zone default now() not null,
     deleted_at  timestamp with time zone default null
-);
\ No newline at end of file
+);
+
+-- +migrate Down
+drop table if exists urls;
@@ -0,0 +1,9 @@
+-- +migrate Up
+-- Уникальность URL проверяется только среди неудаленных ссылок,
+-- чтобы удаленный URL можно было сократить повторно
+alter table urls drop constraint if exists urls_url_key;
+create unique index if not exists urls_url_active_idx on urls (url) where deleted_at is null;
+
+-- +migrate Down
+drop index if exists urls_url_active_idx;
+alter table urls add constraint urls_url_key unique (url);
@@ -0,0 +1,6 @@
+-- +migrate Up
+-- Время, после которого ссылка перестает раскрываться
+alter table urls add column if not exists expires_at timestamp with time zone null;
+
+-- +migrate Down
+alter table urls drop column if exists expires_at;
@@ -0,0 +1,6 @@
+-- +migrate Up
+-- Идентификатором ссылки может быть пользовательский псевдоним
+alter table urls alter column id type varchar(64);
+
+-- +migrate Down
+alter table urls alter column id type varchar(10);
@@ -0,0 +1,10 @@
+-- +migrate Up
+-- Счетчики, из которых экземпляры сервиса резервируют диапазоны идентификаторов
+create table if not exists id_sequences
+(
+    name varchar(64) not null primary key,
+    next bigint not null
+);
+
+-- +migrate Down
+drop table if exists id_sequences;
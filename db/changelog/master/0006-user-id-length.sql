@@ -0,0 +1,6 @@
+-- +migrate Up
+-- Длина идентификатора пользователя настраивается
+alter table urls alter column user_id type varchar(64);
+
+-- +migrate Down
+alter table urls alter column user_id type varchar(10);
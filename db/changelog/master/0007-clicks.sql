@@ -0,0 +1,17 @@
+-- +migrate Up
+create table if not exists clicks
+(
+    id bigserial not null primary key,
+    url_id varchar(64) not null,
+    clicked_at timestamp with time zone not null,
+    ---
+    referrer text not null default '',
+    user_agent text not null default '',
+    ip varchar(45) not null default '',
+    accept_language text not null default ''
+);
+
+create index if not exists clicks_url_id_clicked_at_idx on clicks (url_id, clicked_at);
+
+-- +migrate Down
+drop table if exists clicks;
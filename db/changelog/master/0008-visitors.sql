@@ -0,0 +1,12 @@
+-- +migrate Up
+-- Суточные оценки уникальных посетителей ссылок в формате HyperLogLog
+create table if not exists visitors
+(
+    url_id varchar(64) not null,
+    day timestamp with time zone not null,
+    sketch bytea not null,
+    primary key (url_id, day)
+);
+
+-- +migrate Down
+drop table if exists visitors;
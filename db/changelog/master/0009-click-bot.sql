@@ -0,0 +1,6 @@
+-- +migrate Up
+-- Переходы ботов и сервисов превью ссылок учитываются отдельно
+alter table clicks add column if not exists bot boolean not null default false;
+
+-- +migrate Down
+alter table clicks drop column if exists bot;
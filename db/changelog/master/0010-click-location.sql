@@ -0,0 +1,8 @@
+-- +migrate Up
+-- Местоположение клиента по локальной базе GeoIP
+alter table clicks add column if not exists country varchar(2) not null default '';
+alter table clicks add column if not exists city text not null default '';
+
+-- +migrate Down
+alter table clicks drop column if exists city;
+alter table clicks drop column if exists country;
@@ -0,0 +1,6 @@
+-- +migrate Up
+-- Ноль означает код перенаправления по умолчанию из настроек сервиса
+alter table urls add column if not exists redirect_type smallint not null default 0;
+
+-- +migrate Down
+alter table urls drop column if exists redirect_type;
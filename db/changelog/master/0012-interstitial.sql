@@ -0,0 +1,6 @@
+-- +migrate Up
+-- Владелец может требовать страницу предпросмотра перед каждым переходом
+alter table urls add column if not exists interstitial boolean not null default false;
+
+-- +migrate Down
+alter table urls drop column if exists interstitial;
@@ -0,0 +1,6 @@
+-- +migrate Up
+-- Хэш bcrypt пароля, null для открытой ссылки
+alter table urls add column if not exists password_hash varchar(60) null;
+
+-- +migrate Down
+alter table urls drop column if exists password_hash;
@@ -0,0 +1,11 @@
+-- +migrate Up
+-- Время начала работы ссылки, null - работает сразу
+alter table urls add column if not exists not_before timestamp with time zone null;
+-- Лимит переходов, 0 - без ограничения
+alter table urls add column if not exists max_clicks bigint not null default 0;
+alter table urls add column if not exists click_count bigint not null default 0;
+
+-- +migrate Down
+alter table urls drop column if exists click_count;
+alter table urls drop column if exists max_clicks;
+alter table urls drop column if exists not_before;
@@ -0,0 +1,12 @@
+-- +migrate Up
+-- Адреса назначения с весами, null для ссылки с одним адресом
+alter table urls add column if not exists targets jsonb null;
+-- Посетитель всегда попадает на однажды выбранный адрес
+alter table urls add column if not exists sticky boolean not null default false;
+-- Выбранный адрес ссылки с несколькими адресами
+alter table clicks add column if not exists target text not null default '';
+
+-- +migrate Down
+alter table clicks drop column if exists target;
+alter table urls drop column if exists sticky;
+alter table urls drop column if exists targets;
@@ -0,0 +1,6 @@
+-- +migrate Up
+-- Правила перенаправления по признакам запроса, null для ссылки без правил
+alter table urls add column if not exists rules jsonb null;
+
+-- +migrate Down
+alter table urls drop column if exists rules;
@@ -0,0 +1,6 @@
+-- +migrate Up
+-- Дописывать путь и параметры запроса к адресу назначения
+alter table urls add column if not exists passthrough boolean not null default false;
+
+-- +migrate Down
+alter table urls drop column if exists passthrough;
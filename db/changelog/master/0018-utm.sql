@@ -0,0 +1,14 @@
+-- +migrate Up
+-- Метки кампании хранятся отдельно от адреса назначения, null для ссылки без меток
+alter table urls add column if not exists utm jsonb null;
+
+-- Шаблоны меток, которыми дополняются метки новых ссылок пользователя
+create table if not exists utm_templates
+(
+    user_id varchar(64) not null primary key,
+    utm     jsonb       not null
+);
+
+-- +migrate Down
+drop table if exists utm_templates;
+alter table urls drop column if exists utm;
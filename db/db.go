@@ -0,0 +1,8 @@
+package db
+
+import "embed"
+
+// Changelog Версионированные SQL миграции
+//
+//go:embed changelog/master/*.sql
+var Changelog embed.FS
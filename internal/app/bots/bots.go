@@ -0,0 +1,104 @@
+package bots
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync/atomic"
+)
+
+// defaultPatterns Шаблоны, которые используются, если файл не задан
+//
+//go:embed patterns.txt
+var defaultPatterns string
+
+type classifier struct {
+	filePath string
+	pattern  atomic.Value // *regexp.Regexp
+}
+
+// NewClassifier Создает классификатор с шаблонами User-Agent из файла filePath,
+// либо со встроенными шаблонами, если путь пустой
+func NewClassifier(filePath string) (*classifier, error) {
+	c := &classifier{filePath: filePath}
+	if err := c.Reload(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Reload Перечитывает шаблоны. При ошибке продолжают действовать прежние шаблоны
+func (c *classifier) Reload() error {
+	source := io.Reader(strings.NewReader(defaultPatterns))
+	if c.filePath != "" {
+		file, err := os.Open(c.filePath)
+		if err != nil {
+			return fmt.Errorf("open bot patterns error: %w", err)
+		}
+
+		defer func(file *os.File) {
+			_ = file.Close()
+		}(file)
+
+		source = file
+	}
+
+	pattern, err := compile(source)
+	if err != nil {
+		return err
+	}
+
+	c.pattern.Store(pattern)
+
+	return nil
+}
+
+// compile Объединяет шаблоны в одно выражение: по шаблону в строке, строки с # пропускаются
+func compile(r io.Reader) (*regexp.Regexp, error) {
+	var patterns []string
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// Проверяем шаблоны по одному, чтобы в ошибке был виден виновник
+		if _, err := regexp.Compile(line); err != nil {
+			return nil, fmt.Errorf("invalid bot pattern %q: %w", line, err)
+		}
+		patterns = append(patterns, "(?:"+line+")")
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read bot patterns error: %w", err)
+	}
+
+	// Пустой список не должен совпадать ни с чем
+	if len(patterns) == 0 {
+		return regexp.MustCompile(`^\b$`), nil
+	}
+
+	return regexp.Compile("(?i)" + strings.Join(patterns, "|"))
+}
+
+// IsBot Определяет, что запрос сделан ботом: по User-Agent, а также по HEAD запросу
+// и отсутствию заголовка Accept, который отправляют все браузеры
+func (c *classifier) IsBot(r *http.Request) bool {
+	if r.Method == http.MethodHead {
+		return true
+	}
+
+	userAgent := r.UserAgent()
+	if userAgent == "" || r.Header.Get("Accept") == "" {
+		return true
+	}
+
+	return c.pattern.Load().(*regexp.Regexp).MatchString(userAgent)
+}
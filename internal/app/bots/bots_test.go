@@ -0,0 +1,103 @@
+package bots
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const chromeUserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/101.0.4951.67 Safari/537.36"
+
+func TestClassifier_IsBot(t *testing.T) {
+	tests := []struct {
+		name      string
+		method    string
+		userAgent string
+		accept    string
+		exp       bool
+	}{
+		{
+			name:      "browser",
+			method:    http.MethodGet,
+			userAgent: chromeUserAgent,
+			accept:    "text/html",
+		},
+		{
+			name:      "search crawler",
+			method:    http.MethodGet,
+			userAgent: "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+			accept:    "*/*",
+			exp:       true,
+		},
+		{
+			name:      "chat unfurler",
+			method:    http.MethodGet,
+			userAgent: "TelegramBot (like TwitterBot)",
+			accept:    "*/*",
+			exp:       true,
+		},
+		{
+			name:      "head request",
+			method:    http.MethodHead,
+			userAgent: chromeUserAgent,
+			accept:    "text/html",
+			exp:       true,
+		},
+		{
+			name:      "missing accept",
+			method:    http.MethodGet,
+			userAgent: chromeUserAgent,
+			exp:       true,
+		},
+		{
+			name:   "missing user agent",
+			method: http.MethodGet,
+			accept: "text/html",
+			exp:    true,
+		},
+	}
+
+	c, err := NewClassifier("")
+	require.NoError(t, err)
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, "/qwerty", nil)
+		r.Header.Set("User-Agent", tt.userAgent)
+		if tt.accept != "" {
+			r.Header.Set("Accept", tt.accept)
+		}
+
+		assert.Equal(t, tt.exp, c.IsBot(r), tt.name)
+	}
+}
+
+func TestClassifier_Reload(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "bots.txt")
+	require.NoError(t, os.WriteFile(filePath, []byte("# свои шаблоны\nmonitor\n"), 0600))
+
+	c, err := NewClassifier(filePath)
+	require.NoError(t, err)
+
+	r := httptest.NewRequest(http.MethodGet, "/qwerty", nil)
+	r.Header.Set("Accept", "*/*")
+	r.Header.Set("User-Agent", "Googlebot/2.1")
+	assert.False(t, c.IsBot(r))
+
+	r.Header.Set("User-Agent", "Site Monitor/1.0")
+	assert.True(t, c.IsBot(r))
+
+	require.NoError(t, os.WriteFile(filePath, []byte("googlebot\n"), 0600))
+	require.NoError(t, c.Reload())
+	assert.False(t, c.IsBot(r))
+
+	// Ошибочный файл не сбрасывает действующие шаблоны
+	require.NoError(t, os.WriteFile(filePath, []byte("(unclosed\n"), 0600))
+	assert.Error(t, c.Reload())
+	r.Header.Set("User-Agent", "Googlebot/2.1")
+	assert.True(t, c.IsBot(r))
+}
@@ -0,0 +1,113 @@
+package generator
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// maxFilterAttempts Сколько идентификаторов пробуем сгенерировать, прежде чем сдаться
+const maxFilterAttempts = 100
+
+var ErrFilterExhausted = errors.New("no allowed id generated")
+
+type source interface {
+	RandomString(n int64) (string, error)
+}
+
+type filter interface {
+	Allowed(id string) bool
+}
+
+type filtered struct {
+	source source
+	filter filter
+}
+
+// NewFiltered Пропускает только идентификаторы source, разрешенные filter
+func NewFiltered(source source, filter filter) *filtered {
+	return &filtered{
+		source: source,
+		filter: filter,
+	}
+}
+
+// RandomString Генерирует идентификаторы, пока filter не разрешит очередной
+func (g *filtered) RandomString(n int64) (string, error) {
+	for attempt := 0; attempt < maxFilterAttempts; attempt++ {
+		id, err := g.source.RandomString(n)
+		if err != nil {
+			return "", err
+		}
+		if g.filter.Allowed(id) {
+			return id, nil
+		}
+	}
+
+	return "", ErrFilterExhausted
+}
+
+// leet Замены цифр на похожие буквы, которыми обходят запрещенные слова
+var leet = strings.NewReplacer("0", "o", "1", "i", "3", "e", "4", "a", "5", "s", "7", "t", "8", "b")
+
+type denyList struct {
+	words []string
+}
+
+// NewDenyList Запрещает идентификаторы, содержащие любое из words без учета регистра и цифровых замен букв
+func NewDenyList(words []string) *denyList {
+	list := &denyList{}
+	for _, word := range words {
+		word = normalize(strings.TrimSpace(word))
+		if word != "" {
+			list.words = append(list.words, word)
+		}
+	}
+
+	return list
+}
+
+// LoadDenyList Читает запрещенные слова из файла: по слову в строке, строки с # пропускаются
+func LoadDenyList(filePath string) (*denyList, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("open deny list error: %w", err)
+	}
+
+	defer func(file *os.File) {
+		_ = file.Close()
+	}(file)
+
+	var words []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		words = append(words, line)
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read deny list error: %w", err)
+	}
+
+	return NewDenyList(words), nil
+}
+
+// Allowed Проверяет, что идентификатор не содержит запрещенных слов
+func (l *denyList) Allowed(id string) bool {
+	id = normalize(id)
+	for _, word := range l.words {
+		if strings.Contains(id, word) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func normalize(s string) string {
+	return leet.Replace(strings.ToLower(s))
+}
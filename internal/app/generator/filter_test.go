@@ -0,0 +1,66 @@
+package generator
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fixedSource struct {
+	ids []string
+}
+
+func (s *fixedSource) RandomString(_ int64) (string, error) {
+	id := s.ids[0]
+	if len(s.ids) > 1 {
+		s.ids = s.ids[1:]
+	}
+	return id, nil
+}
+
+func TestDenyList_Allowed(t *testing.T) {
+	list := NewDenyList([]string{"Bad", " evil ", ""})
+
+	tests := []struct {
+		id  string
+		exp bool
+	}{
+		{id: "qwerty", exp: true},
+		{id: "xBADx", exp: false},
+		{id: "b4dxy", exp: false},
+		{id: "3v1lq", exp: false},
+		{id: "e-v-i-l", exp: true},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.exp, list.Allowed(tt.id), tt.id)
+	}
+}
+
+func TestLoadDenyList(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "deny.txt")
+	require.NoError(t, os.WriteFile(filePath, []byte("# offensive words\nbad\n\n  evil\n"), 0600))
+
+	list, err := LoadDenyList(filePath)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"bad", "evil"}, list.words)
+
+	_, err = LoadDenyList(filepath.Join(t.TempDir(), "missing.txt"))
+	assert.Error(t, err)
+}
+
+func TestFiltered_RandomString(t *testing.T) {
+	deny := NewDenyList([]string{"bad"})
+
+	gen := NewFiltered(&fixedSource{ids: []string{"xbadx", "b4dxx", "good1"}}, deny)
+	act, err := gen.RandomString(5)
+	require.NoError(t, err)
+	assert.Equal(t, "good1", act)
+
+	gen = NewFiltered(&fixedSource{ids: []string{"xbadx"}}, deny)
+	_, err = gen.RandomString(5)
+	assert.Equal(t, ErrFilterExhausted, err)
+}
@@ -2,30 +2,98 @@ package generator
 
 import (
 	crypto "crypto/rand"
+	"errors"
 	"fmt"
-	math "math/rand"
-	"time"
+	"strings"
 )
 
-const chars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+// Наборы символов, которые можно задать по имени
+const (
+	AlphabetLetters      = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	AlphabetAlphanumeric = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	AlphabetLowercase    = "0123456789abcdefghijklmnopqrstuvwxyz"
+	// AlphabetUnambiguous Без символов, которые легко спутать при чтении: 0/O, 1/l/I
+	AlphabetUnambiguous = "23456789abcdefghijkmnopqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ"
+)
+
+var alphabets = map[string]string{
+	"letters":      AlphabetLetters,
+	"alphanumeric": AlphabetAlphanumeric,
+	"lowercase":    AlphabetLowercase,
+	"unambiguous":  AlphabetUnambiguous,
+}
+
+type generator struct {
+	chars string
+	// limit Наибольшее кратное длине алфавита значение байта; байты не меньше него отбрасываются,
+	// чтобы все символы выпадали равновероятно
+	limit int
+}
+
+// NewGenerator Генерирует случайные строки из символов alphabet: имени набора или самих символов
+func NewGenerator(alphabet string) (*generator, error) {
+	chars, err := Alphabet(alphabet)
+	if err != nil {
+		return nil, err
+	}
+
+	return &generator{
+		chars: chars,
+		limit: 256 - 256%len(chars),
+	}, nil
+}
+
+// Alphabet Возвращает символы набора по имени, либо проверяет переданные символы
+func Alphabet(value string) (string, error) {
+	if chars, ok := alphabets[value]; ok {
+		return chars, nil
+	}
+
+	if len(value) < 2 {
+		return "", fmt.Errorf("unknown alphabet %q, use one of letters, alphanumeric, lowercase, unambiguous or at least 2 characters", value)
+	}
 
-type generator struct{}
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if c <= ' ' || c > '~' || c == '/' || c == '?' || c == '#' || c == '%' {
+			return "", fmt.Errorf("alphabet character %q is not allowed in url path", c)
+		}
+		// Плюс в конце идентификатора открывает страницу предпросмотра
+		if c == '+' {
+			return "", fmt.Errorf("alphabet character %q is reserved for link preview", c)
+		}
+		if strings.IndexByte(value[i+1:], c) >= 0 {
+			return "", fmt.Errorf("alphabet character %q is repeated", c)
+		}
+	}
 
-func NewGenerator() *generator {
-	math.Seed(time.Now().Unix())
-	return &generator{}
+	return value, nil
 }
 
 // RandomString генерирует строку случайных символов
 func (g *generator) RandomString(n int64) (string, error) {
-	bytes := make([]byte, n)
-	if _, err := crypto.Read(bytes); err != nil {
-		return "", fmt.Errorf("random string generation error: %w", err)
+	if n < 0 {
+		return "", errors.New("random string length must not be negative")
 	}
 
-	for i, b := range bytes {
-		bytes[i] = chars[b%byte(len(chars))]
+	res := make([]byte, 0, n)
+	buf := make([]byte, n+n/4+1)
+
+	for int64(len(res)) < n {
+		if _, err := crypto.Read(buf); err != nil {
+			return "", fmt.Errorf("random string generation error: %w", err)
+		}
+
+		for _, b := range buf {
+			if int(b) >= g.limit {
+				continue
+			}
+			res = append(res, g.chars[int(b)%len(g.chars)])
+			if int64(len(res)) == n {
+				break
+			}
+		}
 	}
 
-	return string(bytes), nil
+	return string(res), nil
 }
@@ -1,6 +1,7 @@
 package generator
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -9,7 +10,8 @@ import (
 
 func TestGenerator_Letters(t *testing.T) {
 	tests := []int64{0, 1, 2, 20}
-	gen := NewGenerator()
+	gen, err := NewGenerator("letters")
+	require.NoError(t, err)
 
 	for _, tt := range tests {
 		act, err := gen.RandomString(tt)
@@ -18,3 +20,55 @@ func TestGenerator_Letters(t *testing.T) {
 		assert.Len(t, act, int(tt))
 	}
 }
+
+func TestGenerator_Alphabet(t *testing.T) {
+	tests := []struct {
+		alphabet string
+		chars    string
+		wantErr  bool
+	}{
+		{alphabet: "lowercase", chars: AlphabetLowercase},
+		{alphabet: "unambiguous", chars: AlphabetUnambiguous},
+		{alphabet: "abc", chars: "abc"},
+		{alphabet: "a", wantErr: true},
+		{alphabet: "aba", wantErr: true},
+		{alphabet: "ab/", wantErr: true},
+		{alphabet: "ab+", wantErr: true},
+		{alphabet: "ab ", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		gen, err := NewGenerator(tt.alphabet)
+		if tt.wantErr {
+			assert.Error(t, err, tt.alphabet)
+			continue
+		}
+		require.NoError(t, err, tt.alphabet)
+
+		act, err := gen.RandomString(100)
+		require.NoError(t, err)
+		for _, c := range act {
+			assert.True(t, strings.ContainsRune(tt.chars, c), "unexpected %q in %s", c, tt.alphabet)
+		}
+	}
+}
+
+func TestGenerator_Unbiased(t *testing.T) {
+	// 256 не делится на 36, поэтому при взятии по модулю первые символы выпадали бы чаще
+	gen, err := NewGenerator("lowercase")
+	require.NoError(t, err)
+
+	act, err := gen.RandomString(360_000)
+	require.NoError(t, err)
+
+	counts := map[rune]int{}
+	for _, c := range act {
+		counts[c]++
+	}
+
+	require.Len(t, counts, len(AlphabetLowercase))
+	for c, count := range counts {
+		// Ожидаем 10000 на символ; смещение b%36 дало бы ~14000 для первых четырех символов
+		assert.True(t, count > 9_000 && count < 11_000, "%q occurred %d times", c, count)
+	}
+}
@@ -0,0 +1,114 @@
+package generator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultLeaseSize Сколько значений счетчика экземпляр резервирует за одно обращение к хранилищу
+	DefaultLeaseSize int64 = 1000
+
+	leaseTimeout = time.Second * 3
+)
+
+// leaser Хранилище счетчиков, выдающее экземплярам сервиса непересекающиеся диапазоны значений
+type leaser interface {
+	Lease(ctx context.Context, name string, size int64) (int64, error)
+}
+
+type sequence struct {
+	ma     sync.Mutex
+	leaser leaser
+	name   string
+	size   int64
+	chars  string
+	next   int64
+	end    int64
+}
+
+// NewSequence Генерирует идентификаторы из монотонно растущего счетчика name в символах alphabet,
+// резервируя в хранилище диапазоны по size значений
+func NewSequence(leaser leaser, name string, size int64, alphabet string) (*sequence, error) {
+	if size <= 0 {
+		return nil, errors.New("lease size must be positive")
+	}
+
+	chars, err := sortedAlphabet(alphabet)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sequence{
+		leaser: leaser,
+		name:   name,
+		size:   size,
+		chars:  chars,
+	}, nil
+}
+
+// RandomString Возвращает следующее значение счетчика, дополненное нулями алфавита слева до n символов.
+// Значения не переиспользуются: неизрасходованный остаток диапазона теряется при перезапуске
+func (g *sequence) RandomString(n int64) (string, error) {
+	g.ma.Lock()
+	defer g.ma.Unlock()
+
+	if g.next >= g.end {
+		ctx, cancel := context.WithTimeout(context.Background(), leaseTimeout)
+		defer cancel()
+
+		start, err := g.leaser.Lease(ctx, g.name, g.size)
+		if err != nil {
+			return "", fmt.Errorf("lease id range error: %w", err)
+		}
+		g.next, g.end = start, start+g.size
+	}
+
+	value := g.next
+	g.next++
+
+	return encode(g.chars, uint64(value), n), nil
+}
+
+// sortedAlphabet Возвращает символы алфавита в порядке ASCII, чтобы идентификаторы одной длины
+// сортировались как значения
+func sortedAlphabet(alphabet string) (string, error) {
+	chars, err := Alphabet(alphabet)
+	if err != nil {
+		return "", err
+	}
+
+	sorted := []byte(chars)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	return string(sorted), nil
+}
+
+// encode Кодирует значение в системе счисления с основанием len(chars),
+// дополняя первым символом алфавита слева до n символов
+func encode(chars string, value uint64, n int64) string {
+	// Самое длинное представление uint64 получается в двоичной системе
+	var buf [64]byte
+	radix := uint64(len(chars))
+	idx := len(buf)
+	for {
+		idx--
+		buf[idx] = chars[value%radix]
+		value /= radix
+		if value == 0 {
+			break
+		}
+	}
+
+	s := string(buf[idx:])
+	if pad := int(n) - len(s); pad > 0 {
+		s = strings.Repeat(string(chars[0]), pad) + s
+	}
+
+	return s
+}
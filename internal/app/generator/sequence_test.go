@@ -0,0 +1,109 @@
+package generator
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeLeaser struct {
+	next   int64
+	leases int
+	err    error
+}
+
+func (l *fakeLeaser) Lease(_ context.Context, _ string, size int64) (int64, error) {
+	if l.err != nil {
+		return 0, l.err
+	}
+
+	l.leases++
+	start := l.next
+	l.next += size
+
+	return start, nil
+}
+
+func TestSequence_RandomString(t *testing.T) {
+	leaser := &fakeLeaser{next: 61}
+	gen, err := NewSequence(leaser, "urls", 2, "alphanumeric")
+	require.NoError(t, err)
+
+	var act []string
+	for i := 0; i < 3; i++ {
+		id, err := gen.RandomString(3)
+		require.NoError(t, err)
+		act = append(act, id)
+	}
+
+	assert.Equal(t, []string{"00z", "010", "011"}, act)
+	assert.Equal(t, 2, leaser.leases)
+}
+
+func TestSequence_LeaseError(t *testing.T) {
+	leaseErr := errors.New("connection refused")
+	gen, err := NewSequence(&fakeLeaser{err: leaseErr}, "urls", 10, "alphanumeric")
+	require.NoError(t, err)
+
+	_, err = gen.RandomString(5)
+	assert.True(t, errors.Is(err, leaseErr))
+}
+
+func TestSequence_Alphabet(t *testing.T) {
+	tests := []struct {
+		alphabet string
+		start    int64
+		exp      []string
+	}{
+		{alphabet: "lowercase", start: 35, exp: []string{"00z", "010", "011"}},
+		{alphabet: "letters", start: 51, exp: []string{"AAz", "ABA", "ABB"}},
+		{alphabet: "ba", start: 31, exp: []string{"aabbbbb", "abaaaaa", "abaaaab"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.alphabet, func(t *testing.T) {
+			gen, err := NewSequence(&fakeLeaser{next: tt.start}, "urls", 10, tt.alphabet)
+			require.NoError(t, err)
+
+			var act []string
+			for i := 0; i < len(tt.exp); i++ {
+				id, err := gen.RandomString(int64(len(tt.exp[0])))
+				require.NoError(t, err)
+				act = append(act, id)
+			}
+
+			assert.Equal(t, tt.exp, act)
+		})
+	}
+}
+
+func TestSequence_UnknownAlphabet(t *testing.T) {
+	_, err := NewSequence(&fakeLeaser{}, "urls", 10, "x")
+	assert.Error(t, err)
+}
+
+func TestEncode(t *testing.T) {
+	base62, err := sortedAlphabet("alphanumeric")
+	require.NoError(t, err)
+
+	tests := []struct {
+		chars string
+		value uint64
+		n     int64
+		exp   string
+	}{
+		{chars: base62, value: 0, n: 0, exp: "0"},
+		{chars: base62, value: 61, n: 0, exp: "z"},
+		{chars: base62, value: 62, n: 5, exp: "00010"},
+		{chars: base62, value: 1<<63 - 1, n: 5, exp: "AzL8n0Y58m7"},
+		{chars: "01", value: 1<<64 - 1, n: 0, exp: strings.Repeat("1", 64)},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.exp, encode(tt.chars, tt.value, tt.n))
+	}
+}
@@ -0,0 +1,72 @@
+package generator
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	nodeBits     = 10
+	sequenceBits = 12
+
+	MaxNodeID   = 1<<nodeBits - 1
+	maxSequence = 1<<sequenceBits - 1
+)
+
+// snowflakeEpoch Начало отсчета времени идентификаторов
+var snowflakeEpoch = time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+type snowflake struct {
+	ma       sync.Mutex
+	node     int64
+	lastTime int64
+	sequence int64
+	chars    string
+	now      func() time.Time
+}
+
+// NewSnowflake Генерирует идентификаторы из времени в миллисекундах, номера экземпляра и счетчика внутри миллисекунды.
+// Идентификатор записывается символами alphabet. Экземпляры сервиса, пишущие в одно хранилище, должны иметь разные node
+func NewSnowflake(node int64, alphabet string) (*snowflake, error) {
+	if node < 0 || node > MaxNodeID {
+		return nil, fmt.Errorf("node id must be from 0 to %d", MaxNodeID)
+	}
+
+	chars, err := sortedAlphabet(alphabet)
+	if err != nil {
+		return nil, err
+	}
+
+	return &snowflake{
+		node:  node,
+		chars: chars,
+		now:   time.Now,
+	}, nil
+}
+
+// RandomString Возвращает следующий идентификатор, дополненный нулями алфавита слева до n символов
+func (g *snowflake) RandomString(n int64) (string, error) {
+	g.ma.Lock()
+	defer g.ma.Unlock()
+
+	ts := g.now().Sub(snowflakeEpoch).Milliseconds()
+
+	// Если часы отстали или счетчик миллисекунды исчерпан, занимаем следующую миллисекунду,
+	// чтобы значения оставались монотонными
+	switch {
+	case ts > g.lastTime:
+		g.sequence = 0
+	case g.sequence < maxSequence:
+		ts = g.lastTime
+		g.sequence++
+	default:
+		ts = g.lastTime + 1
+		g.sequence = 0
+	}
+	g.lastTime = ts
+
+	value := ts<<(nodeBits+sequenceBits) | g.node<<sequenceBits | g.sequence
+
+	return encode(g.chars, uint64(value), n), nil
+}
@@ -0,0 +1,70 @@
+package generator
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnowflake_Monotonic(t *testing.T) {
+	now := snowflakeEpoch.Add(time.Hour)
+	gen, err := NewSnowflake(7, "alphanumeric")
+	require.NoError(t, err)
+	gen.now = func() time.Time { return now }
+
+	seen := map[string]struct{}{}
+	prev := ""
+
+	// Исчерпываем счетчик миллисекунды и переводим часы назад
+	for i := 0; i < maxSequence+10; i++ {
+		if i == maxSequence {
+			now = now.Add(-time.Second)
+		}
+
+		id, err := gen.RandomString(11)
+		require.NoError(t, err)
+
+		_, ok := seen[id]
+		assert.False(t, ok, "duplicate id %s", id)
+		assert.True(t, id > prev, "id %s is not greater than %s", id, prev)
+
+		seen[id] = struct{}{}
+		prev = id
+	}
+}
+
+func TestSnowflake_NodeID(t *testing.T) {
+	tests := []struct {
+		node    int64
+		wantErr bool
+	}{
+		{node: 0},
+		{node: MaxNodeID},
+		{node: -1, wantErr: true},
+		{node: MaxNodeID + 1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		_, err := NewSnowflake(tt.node, "alphanumeric")
+		assert.Equal(t, tt.wantErr, err != nil, "node %d", tt.node)
+	}
+}
+
+func TestSnowflake_Alphabet(t *testing.T) {
+	gen, err := NewSnowflake(7, "unambiguous")
+	require.NoError(t, err)
+	gen.now = func() time.Time { return snowflakeEpoch.Add(time.Hour) }
+
+	prev := ""
+	for i := 0; i < 100; i++ {
+		id, err := gen.RandomString(11)
+		require.NoError(t, err)
+
+		assert.Empty(t, strings.Trim(id, AlphabetUnambiguous), "id %s has characters outside alphabet", id)
+		assert.True(t, id > prev, "id %s is not greater than %s", id, prev)
+		prev = id
+	}
+}
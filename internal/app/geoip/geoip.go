@@ -0,0 +1,76 @@
+package geoip
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/oschwald/maxminddb-golang"
+	"github.com/sirupsen/logrus"
+
+	"github.com/bgoldovsky/shortener/internal/app/models"
+)
+
+// record Поля базы формата GeoIP2/GeoLite2 City, которые нужны статистике
+type record struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+}
+
+type resolver struct {
+	db *maxminddb.Reader
+}
+
+// NewResolver Открывает локальную базу MMDB. Если путь не задан или файла нет,
+// возвращает выключенный резолвер, который не определяет местоположение
+func NewResolver(filePath string) (*resolver, error) {
+	if filePath == "" {
+		return &resolver{}, nil
+	}
+
+	db, err := maxminddb.Open(filePath)
+	if errors.Is(err, os.ErrNotExist) {
+		logrus.WithField("filePath", filePath).Warn("geoip database not found, geo enrichment disabled")
+		return &resolver{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open geoip database error: %w", err)
+	}
+
+	return &resolver{
+		db: db,
+	}, nil
+}
+
+// Resolve Возвращает страну и город адреса, либо пустое местоположение, если его не удалось определить
+func (r *resolver) Resolve(ip string) models.Location {
+	parsed := net.ParseIP(ip)
+	if r.db == nil || parsed == nil {
+		return models.Location{}
+	}
+
+	var rec record
+	if err := r.db.Lookup(parsed, &rec); err != nil {
+		logrus.WithError(err).WithField("ip", ip).Error("geoip lookup error")
+		return models.Location{}
+	}
+
+	return models.Location{
+		Country: rec.Country.ISOCode,
+		City:    rec.City.Names["en"],
+	}
+}
+
+// Close Закрывает базу
+func (r *resolver) Close() error {
+	if r.db == nil {
+		return nil
+	}
+
+	return r.db.Close()
+}
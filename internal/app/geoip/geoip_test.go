@@ -0,0 +1,195 @@
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bgoldovsky/shortener/internal/app/models"
+)
+
+func TestResolver_Resolve(t *testing.T) {
+	filePath := writeTestDatabase(t, map[string]models.Location{
+		"81.2.69.0/24":   {Country: "GB", City: "London"},
+		"89.160.20.0/24": {Country: "SE", City: "Linköping"},
+		"5.255.255.0/24": {Country: "RU"},
+	})
+
+	r, err := NewResolver(filePath)
+	require.NoError(t, err)
+
+	defer func() {
+		_ = r.Close()
+	}()
+
+	tests := []struct {
+		ip  string
+		exp models.Location
+	}{
+		{ip: "81.2.69.142", exp: models.Location{Country: "GB", City: "London"}},
+		{ip: "89.160.20.112", exp: models.Location{Country: "SE", City: "Linköping"}},
+		{ip: "5.255.255.5", exp: models.Location{Country: "RU"}},
+		{ip: "10.0.0.1", exp: models.Location{}},
+		{ip: "not an ip", exp: models.Location{}},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.exp, r.Resolve(tt.ip), tt.ip)
+	}
+}
+
+func TestResolver_Disabled(t *testing.T) {
+	for _, filePath := range []string{"", filepath.Join(t.TempDir(), "missing.mmdb")} {
+		r, err := NewResolver(filePath)
+		require.NoError(t, err)
+
+		assert.Equal(t, models.Location{}, r.Resolve("81.2.69.142"))
+		assert.NoError(t, r.Close())
+	}
+}
+
+func TestResolver_Corrupted(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "corrupted.mmdb")
+	require.NoError(t, os.WriteFile(filePath, []byte("not a database"), 0600))
+
+	_, err := NewResolver(filePath)
+	assert.Error(t, err)
+}
+
+// writeTestDatabase Записывает минимальную базу MMDB для IPv4 с размером записи 24 бита
+func writeTestDatabase(t *testing.T, networks map[string]models.Location) string {
+	type treeNode struct {
+		children [2]*treeNode
+		data     [2]int // Смещение данных + 1, ноль - данных нет
+		id       int
+	}
+
+	root := &treeNode{}
+	var data bytes.Buffer
+
+	for cidr, location := range networks {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		require.NoError(t, err)
+
+		offset := data.Len()
+		data.Write(encodeMap(
+			"country", encodeMap("iso_code", encodeString(location.Country)),
+			"city", encodeMap("names", encodeMap("en", encodeString(location.City))),
+		))
+
+		ones, _ := ipNet.Mask.Size()
+		n := root
+		for i := 0; i < ones; i++ {
+			bit := ipNet.IP.To4()[i/8] >> (7 - i%8) & 1
+			if i == ones-1 {
+				n.data[bit] = offset + 1
+				break
+			}
+			if n.children[bit] == nil {
+				n.children[bit] = &treeNode{}
+			}
+			n = n.children[bit]
+		}
+	}
+
+	var nodes []*treeNode
+	queue := []*treeNode{root}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		n.id = len(nodes)
+		nodes = append(nodes, n)
+		for _, child := range n.children {
+			if child != nil {
+				queue = append(queue, child)
+			}
+		}
+	}
+
+	nodeCount := len(nodes)
+	var file bytes.Buffer
+	for _, n := range nodes {
+		for bit := 0; bit < 2; bit++ {
+			value := nodeCount
+			switch {
+			case n.children[bit] != nil:
+				value = n.children[bit].id
+			case n.data[bit] != 0:
+				value = nodeCount + 16 + n.data[bit] - 1
+			}
+			file.Write([]byte{byte(value >> 16), byte(value >> 8), byte(value)})
+		}
+	}
+
+	file.Write(make([]byte, 16))
+	file.Write(data.Bytes())
+	file.WriteString("\xAB\xCD\xEFMaxMind.com")
+	file.Write(encodeMap(
+		"binary_format_major_version", encodeUint(5, 2),
+		"binary_format_minor_version", encodeUint(5, 0),
+		"build_epoch", encodeUint(9, 1651363200),
+		"database_type", encodeString("GeoIP2-City"),
+		"description", encodeMap("en", encodeString("test database")),
+		"ip_version", encodeUint(5, 4),
+		"languages", append(encodeControl(11, 1), encodeString("en")...),
+		"node_count", encodeUint(6, uint64(nodeCount)),
+		"record_size", encodeUint(5, 24),
+	))
+
+	filePath := filepath.Join(t.TempDir(), "city.mmdb")
+	require.NoError(t, os.WriteFile(filePath, file.Bytes(), 0600))
+
+	return filePath
+}
+
+// encodeControl Кодирует управляющий байт поля: тип и размер
+func encodeControl(typ, size int) []byte {
+	var res []byte
+	if typ <= 7 {
+		res = []byte{byte(typ << 5)}
+	} else {
+		res = []byte{0, byte(typ - 7)}
+	}
+
+	switch {
+	case size < 29:
+		res[0] |= byte(size)
+	case size < 29+256:
+		res[0] |= 29
+		res = append(res, byte(size-29))
+	default:
+		res[0] |= 30
+		res = append(res, byte((size-285)>>8), byte(size-285))
+	}
+
+	return res
+}
+
+func encodeString(s string) []byte {
+	return append(encodeControl(2, len(s)), s...)
+}
+
+func encodeUint(typ int, value uint64) []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, value)
+	buf = bytes.TrimLeft(buf, "\x00")
+
+	return append(encodeControl(typ, len(buf)), buf...)
+}
+
+// encodeMap Кодирует словарь из чередующихся ключей и закодированных значений
+func encodeMap(pairs ...interface{}) []byte {
+	res := encodeControl(7, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		res = append(res, encodeString(pairs[i].(string))...)
+		res = append(res, pairs[i+1].([]byte)...)
+	}
+
+	return res
+}
@@ -0,0 +1,136 @@
+package hll
+
+import (
+	"errors"
+	"hash/fnv"
+	"math"
+	"math/bits"
+)
+
+// Точность 12 дает 4096 регистров по байту и стандартную ошибку около 1.6%
+const (
+	precision = 12
+	registers = 1 << precision
+	version   = 1
+)
+
+var ErrInvalidSketch = errors.New("invalid hyperloglog sketch")
+
+// Sketch Оценка количества уникальных значений в памяти фиксированного размера.
+// Не потокобезопасен
+type Sketch struct {
+	registers [registers]uint8
+}
+
+func New() *Sketch {
+	return &Sketch{}
+}
+
+// Hash Возвращает стабильный между запусками хэш значения для Add
+func Hash(value string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(value))
+
+	// У FNV плохо перемешаны старшие биты коротких строк, а по ним выбирается регистр
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+
+	return x
+}
+
+// Add Учитывает значение по его хэшу
+func (s *Sketch) Add(hash uint64) {
+	idx := hash >> (64 - precision)
+
+	// Сторожевой бит ограничивает ранг, когда оставшиеся биты нулевые
+	rank := uint8(bits.LeadingZeros64(hash<<precision|1<<(precision-1))) + 1
+	if rank > s.registers[idx] {
+		s.registers[idx] = rank
+	}
+}
+
+// Merge Объединяет оценку с other. Операция идемпотентна: повторное объединение ничего не меняет
+func (s *Sketch) Merge(other *Sketch) {
+	for idx, rank := range other.registers {
+		if rank > s.registers[idx] {
+			s.registers[idx] = rank
+		}
+	}
+}
+
+// Register Значение одного регистра оценки
+type Register struct {
+	Index uint16
+	Rank  uint8
+}
+
+// Diff Возвращает регистры other, которые больше регистров оценки.
+// Применение их через Apply равносильно Merge с other
+func (s *Sketch) Diff(other *Sketch) []Register {
+	res := make([]Register, 0)
+	for idx, rank := range other.registers {
+		if rank > s.registers[idx] {
+			res = append(res, Register{Index: uint16(idx), Rank: rank})
+		}
+	}
+
+	return res
+}
+
+// Apply Поднимает регистры оценки до переданных значений. Операция идемпотентна
+func (s *Sketch) Apply(regs []Register) {
+	for _, reg := range regs {
+		if int(reg.Index) < registers && reg.Rank > s.registers[reg.Index] {
+			s.registers[reg.Index] = reg.Rank
+		}
+	}
+}
+
+// Count Возвращает оценку количества уникальных значений
+func (s *Sketch) Count() uint64 {
+	m := float64(registers)
+	alpha := 0.7213 / (1 + 1.079/m)
+
+	sum := 0.0
+	zeros := 0
+	for _, rank := range s.registers {
+		sum += math.Ldexp(1, -int(rank))
+		if rank == 0 {
+			zeros++
+		}
+	}
+
+	estimate := alpha * m * m / sum
+
+	// На малых количествах точнее линейный подсчет по пустым регистрам
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+
+	return uint64(estimate + 0.5)
+}
+
+// MarshalBinary Кодирует оценку: версия, точность и регистры
+func (s *Sketch) MarshalBinary() ([]byte, error) {
+	data := make([]byte, 2+registers)
+	data[0] = version
+	data[1] = precision
+	copy(data[2:], s.registers[:])
+
+	return data, nil
+}
+
+// UnmarshalBinary Декодирует оценку, закодированную MarshalBinary
+func (s *Sketch) UnmarshalBinary(data []byte) error {
+	if len(data) != 2+registers || data[0] != version || data[1] != precision {
+		return ErrInvalidSketch
+	}
+
+	copy(s.registers[:], data[2:])
+
+	return nil
+}
@@ -0,0 +1,85 @@
+package hll
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSketch_Count(t *testing.T) {
+	tests := []int{0, 1, 100, 10_000, 200_000}
+
+	for _, tt := range tests {
+		s := New()
+		for i := 0; i < tt; i++ {
+			// Каждое значение добавляем дважды: повторы не должны влиять на оценку
+			s.Add(Hash(fmt.Sprintf("10.0.%d.%d\x00curl/7.79", i/256, i%256)))
+			s.Add(Hash(fmt.Sprintf("10.0.%d.%d\x00curl/7.79", i/256, i%256)))
+		}
+
+		act := float64(s.Count())
+		assert.True(t, math.Abs(act-float64(tt)) <= float64(tt)*0.05+1, "expected ~%d, got %v", tt, act)
+	}
+}
+
+func TestSketch_Merge(t *testing.T) {
+	a, b, all := New(), New(), New()
+	for i := 0; i < 10_000; i++ {
+		h := Hash(fmt.Sprint(i))
+		all.Add(h)
+		if i < 6_000 {
+			a.Add(h)
+		}
+		if i >= 4_000 {
+			b.Add(h)
+		}
+	}
+
+	a.Merge(b)
+	assert.Equal(t, all.Count(), a.Count())
+
+	// Повторное объединение ничего не меняет
+	a.Merge(b)
+	assert.Equal(t, all.Count(), a.Count())
+}
+
+func TestSketch_Diff(t *testing.T) {
+	a, b := New(), New()
+	for i := 0; i < 1000; i++ {
+		a.Add(Hash(fmt.Sprint(i)))
+	}
+	for i := 500; i < 1100; i++ {
+		b.Add(Hash(fmt.Sprint(i)))
+	}
+
+	merged := New()
+	merged.Merge(a)
+	merged.Merge(b)
+
+	// Разница содержит только выросшие регистры и дает тот же результат, что и объединение
+	diff := a.Diff(b)
+	assert.True(t, len(diff) < 600)
+	a.Apply(diff)
+	assert.Equal(t, merged.registers, a.registers)
+
+	assert.Empty(t, a.Diff(b))
+}
+
+func TestSketch_MarshalBinary(t *testing.T) {
+	s := New()
+	for i := 0; i < 1000; i++ {
+		s.Add(Hash(fmt.Sprint(i)))
+	}
+
+	data, err := s.MarshalBinary()
+	require.NoError(t, err)
+
+	act := New()
+	require.NoError(t, act.UnmarshalBinary(data))
+	assert.Equal(t, s.Count(), act.Count())
+
+	assert.Equal(t, ErrInvalidSketch, act.UnmarshalBinary(data[:10]))
+}
@@ -0,0 +1,284 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	upMarker   = "-- +migrate Up"
+	downMarker = "-- +migrate Down"
+
+	// lockKey Ключ advisory lock, под которым миграции применяются одним экземпляром за раз
+	lockKey int64 = 7_305_221_590_424
+
+	schemaTableQuery = `create table if not exists schema_migrations
+(
+    version integer not null primary key,
+    name varchar(255) not null,
+    applied_at timestamp with time zone default now() not null
+);`
+)
+
+var ErrNoDownMigration = errors.New("down migration not specified")
+
+// Migration Версионированная миграция схемы
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status Состояние миграции в базе данных
+type Status struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+}
+
+type migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+// NewMigrator Инициализирует мигратор файлами вида 0001-name.sql из fsys
+func NewMigrator(db *sql.DB, fsys fs.FS) (*migrator, error) {
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, fmt.Errorf("load migrations error: %w", err)
+	}
+
+	return &migrator{
+		db:         db,
+		migrations: migrations,
+	}, nil
+}
+
+// Load Читает миграции из всех .sql файлов fsys и сортирует их по версии
+func Load(fsys fs.FS) ([]Migration, error) {
+	var migrations []Migration
+	versions := map[int]string{}
+
+	err := fs.WalkDir(fsys, ".", func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || path.Ext(filePath) != ".sql" {
+			return nil
+		}
+
+		data, err := fs.ReadFile(fsys, filePath)
+		if err != nil {
+			return err
+		}
+
+		migration, err := parse(path.Base(filePath), string(data))
+		if err != nil {
+			return fmt.Errorf("parse migration %s error: %w", filePath, err)
+		}
+
+		if prev, ok := versions[migration.Version]; ok {
+			return fmt.Errorf("duplicate migration version %d: %s and %s", migration.Version, prev, filePath)
+		}
+		versions[migration.Version] = filePath
+
+		migrations = append(migrations, migration)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+func parse(fileName, data string) (Migration, error) {
+	name := strings.TrimSuffix(fileName, ".sql")
+
+	sep := strings.IndexAny(name, "-_")
+	if sep <= 0 {
+		return Migration{}, errors.New("file name must start with version")
+	}
+
+	version, err := strconv.Atoi(name[:sep])
+	if err != nil {
+		return Migration{}, fmt.Errorf("parse version error: %w", err)
+	}
+
+	upIdx := strings.Index(data, upMarker)
+	if upIdx < 0 {
+		return Migration{}, fmt.Errorf("%q marker not found", upMarker)
+	}
+
+	up := data[upIdx+len(upMarker):]
+	down := ""
+	if downIdx := strings.Index(up, downMarker); downIdx >= 0 {
+		down = up[downIdx+len(downMarker):]
+		up = up[:downIdx]
+	}
+
+	return Migration{
+		Version: version,
+		Name:    name[sep+1:],
+		Up:      strings.TrimSpace(up),
+		Down:    strings.TrimSpace(down),
+	}, nil
+}
+
+// Up Применяет все неприменённые миграции по порядку
+func (m *migrator) Up(ctx context.Context) error {
+	return m.locked(ctx, func(conn *sql.Conn, applied map[int]time.Time) error {
+		for _, migration := range m.migrations {
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+
+			err := m.apply(ctx, conn, migration.Up, `insert into schema_migrations(version, name) values ($1, $2);`, migration.Version, migration.Name)
+			if err != nil {
+				return fmt.Errorf("apply migration %d %s error: %w", migration.Version, migration.Name, err)
+			}
+
+			logrus.WithField("version", migration.Version).WithField("name", migration.Name).Info("migration applied")
+		}
+
+		return nil
+	})
+}
+
+// Down Откатывает последнюю применённую миграцию
+func (m *migrator) Down(ctx context.Context) error {
+	return m.locked(ctx, func(conn *sql.Conn, applied map[int]time.Time) error {
+		for idx := len(m.migrations) - 1; idx >= 0; idx-- {
+			migration := m.migrations[idx]
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+
+			if migration.Down == "" {
+				return fmt.Errorf("rollback migration %d %s error: %w", migration.Version, migration.Name, ErrNoDownMigration)
+			}
+
+			err := m.apply(ctx, conn, migration.Down, `delete from schema_migrations where version = $1;`, migration.Version)
+			if err != nil {
+				return fmt.Errorf("rollback migration %d %s error: %w", migration.Version, migration.Name, err)
+			}
+
+			logrus.WithField("version", migration.Version).WithField("name", migration.Name).Info("migration rolled back")
+			return nil
+		}
+
+		return nil
+	})
+}
+
+// Status Возвращает состояние всех известных миграций
+func (m *migrator) Status(ctx context.Context) ([]Status, error) {
+	var res []Status
+
+	err := m.locked(ctx, func(_ *sql.Conn, applied map[int]time.Time) error {
+		res = make([]Status, len(m.migrations))
+		for idx, migration := range m.migrations {
+			res[idx] = Status{Version: migration.Version, Name: migration.Name}
+			if appliedAt, ok := applied[migration.Version]; ok {
+				res[idx].AppliedAt = &appliedAt
+			}
+		}
+
+		return nil
+	})
+
+	return res, err
+}
+
+// locked Выполняет fn на отдельном соединении под advisory lock
+func (m *migrator) locked(ctx context.Context, fn func(conn *sql.Conn, applied map[int]time.Time) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("get connection error: %w", err)
+	}
+
+	defer func(conn *sql.Conn) {
+		_ = conn.Close()
+	}(conn)
+
+	if _, err = conn.ExecContext(ctx, `select pg_advisory_lock($1);`, lockKey); err != nil {
+		return fmt.Errorf("acquire migrations lock error: %w", err)
+	}
+
+	defer func(conn *sql.Conn) {
+		_, _ = conn.ExecContext(context.Background(), `select pg_advisory_unlock($1);`, lockKey)
+	}(conn)
+
+	if _, err = conn.ExecContext(ctx, schemaTableQuery); err != nil {
+		return fmt.Errorf("create schema table error: %w", err)
+	}
+
+	applied, err := m.applied(ctx, conn)
+	if err != nil {
+		return fmt.Errorf("get applied migrations error: %w", err)
+	}
+
+	return fn(conn, applied)
+}
+
+func (m *migrator) applied(ctx context.Context, conn *sql.Conn) (map[int]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, `select version, applied_at from schema_migrations;`)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func(rows *sql.Rows) {
+		_ = rows.Close()
+	}(rows)
+
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var (
+			version   int
+			appliedAt time.Time
+		)
+		if err = rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+
+	return applied, rows.Err()
+}
+
+// apply Выполняет скрипт и обновляет schema_migrations в одной транзакции
+func (m *migrator) apply(ctx context.Context, conn *sql.Conn, script, query string, args ...interface{}) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	if _, err = tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx, query, args...); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
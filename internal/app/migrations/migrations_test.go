@@ -0,0 +1,69 @@
+package migrations
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	changelog "github.com/bgoldovsky/shortener/db"
+)
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"master/0002-add-index.sql": {Data: []byte("-- +migrate Up\ncreate index idx on urls (user_id);\n\n-- +migrate Down\ndrop index idx;\n")},
+		"master/0001-create.sql":    {Data: []byte("-- +migrate Up\ncreate table urls (id varchar(10));\n")},
+		"master/readme.md":          {Data: []byte("not a migration")},
+	}
+
+	act, err := Load(fsys)
+	require.NoError(t, err)
+
+	assert.Equal(t, []Migration{
+		{Version: 1, Name: "create", Up: "create table urls (id varchar(10));"},
+		{Version: 2, Name: "add-index", Up: "create index idx on urls (user_id);", Down: "drop index idx;"},
+	}, act)
+}
+
+func TestLoad_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		fsys fstest.MapFS
+	}{
+		{
+			name: "no version",
+			fsys: fstest.MapFS{"create.sql": {Data: []byte("-- +migrate Up\nselect 1;")}},
+		},
+		{
+			name: "no up marker",
+			fsys: fstest.MapFS{"0001-create.sql": {Data: []byte("select 1;")}},
+		},
+		{
+			name: "duplicate version",
+			fsys: fstest.MapFS{
+				"0001-create.sql": {Data: []byte("-- +migrate Up\nselect 1;")},
+				"0001-other.sql":  {Data: []byte("-- +migrate Up\nselect 2;")},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(tt.fsys)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestLoad_Changelog(t *testing.T) {
+	act, err := Load(changelog.Changelog)
+	require.NoError(t, err)
+	require.NotEmpty(t, act)
+
+	for idx, migration := range act {
+		assert.Equal(t, idx+1, migration.Version)
+		assert.NotEmpty(t, migration.Up)
+		assert.NotEmpty(t, migration.Down)
+	}
+}
@@ -1,17 +1,175 @@
 package models
 
+import (
+	"time"
+
+	"github.com/bgoldovsky/shortener/internal/app/hll"
+)
+
 type OriginalURL struct {
-	CorrelationID string // Строковый идентификатор для пакетного запроса
-	URL           string // Исходный URL
+	CorrelationID string     // Строковый идентификатор для пакетного запроса
+	URL           string     // Исходный URL
+	Alias         string     // Желаемый идентификатор сокращенного URL, пустой для случайного
+	ExpiresAt     *time.Time // Время, после которого ссылка перестает работать
+	RedirectType  int        // Код ответа перенаправления, ноль - код по умолчанию
+	Interstitial  bool       // Всегда показывать страницу предпросмотра перед переходом
+	Password      string     // Пароль для перехода, пустой для открытой ссылки
+	NotBefore     *time.Time // Время, до которого ссылка еще не работает
+	MaxClicks     int64      // Сколько переходов разрешено, ноль - без ограничения
+	Targets       []Target   // Адреса назначения с весами, пустой для ссылки с одним адресом URL
+	Sticky        bool       // Посетитель всегда попадает на однажды выбранный адрес
+	Rules         []Rule     // Правила перенаправления, проверяются по порядку до адресов ссылки
+	Passthrough   bool       // Дописывать путь и параметры запроса к адресу назначения
+	UTM           *UTM       // Метки кампании, nil для ссылки без меток
+}
+
+// UTM Метки кампании. Хранятся отдельно от адреса назначения и дописываются к нему при переходе
+type UTM struct {
+	Source   string // utm_source
+	Medium   string // utm_medium
+	Campaign string // utm_campaign
+	Term     string // utm_term
+	Content  string // utm_content
+}
+
+// Rule Правило перенаправления. Подходит, если запрос удовлетворяет всем заданным условиям
+type Rule struct {
+	Platforms []string          // ios, android или desktop, пустой - любая платформа
+	Languages []string          // Основной язык из Accept-Language, например ru, пустой - любой
+	Query     map[string]string // Параметры запроса, которые должны совпасть все
+	Hours     *TimeWindow       // Время суток по UTC, nil - любое
+	Target    string            // Адрес назначения
+}
+
+// TimeWindow Интервал времени суток [From, To) в минутах от полуночи, переходит через полночь, если From > To
+type TimeWindow struct {
+	From int
+	To   int
+}
+
+// Target Адрес назначения ссылки с несколькими адресами
+type Target struct {
+	URL    string // Адрес назначения
+	Weight int    // Доля переходов относительно суммы весов всех адресов
 }
 
 type URL struct {
-	CorrelationID string // Строковый идентификатор для пакетного запроса
-	ShortURL      string // Сокращенный URL
-	OriginalURL   string // Исходный URL
+	CorrelationID string     // Строковый идентификатор для пакетного запроса
+	ShortURL      string     // Сокращенный URL
+	OriginalURL   string     // Исходный URL
+	ExpiresAt     *time.Time // Время, после которого ссылка перестает работать
+	RedirectType  int        // Код ответа перенаправления, ноль - код по умолчанию
+	Interstitial  bool       // Всегда показывать страницу предпросмотра перед переходом
+	CreatedAt     time.Time  // Время создания, заполняется хранилищем
+	PasswordHash  string     // Медленный хэш пароля, пустой для открытой ссылки
+	NotBefore     *time.Time // Время, до которого ссылка еще не работает
+	MaxClicks     int64      // Сколько переходов разрешено, ноль - без ограничения
+	ClickCount    int64      // Сколько переходов учтено для ограничения
+	// Адреса назначения с весами, пустой для ссылки с одним адресом.
+	// OriginalURL такой ссылки совпадает с первым адресом
+	Targets []Target
+	Sticky  bool   // Посетитель всегда попадает на однажды выбранный адрес
+	Rules   []Rule // Правила перенаправления, проверяются по порядку до адресов ссылки
+	// Дописывать путь после идентификатора и параметры запроса к адресу назначения
+	Passthrough bool
+	UTM         *UTM // Метки кампании, nil для ссылки без меток
+}
+
+// Split Проверяет, распределяет ли ссылка переходы между несколькими адресами
+func (u *URL) Split() bool {
+	return len(u.Targets) > 0
+}
+
+// Started Проверяет, начала ли ссылка работать к моменту now
+func (u *URL) Started(now time.Time) bool {
+	return u.NotBefore == nil || !now.Before(*u.NotBefore)
+}
+
+// Limited Проверяет, ограничено ли число переходов по ссылке
+func (u *URL) Limited() bool {
+	return u.MaxClicks > 0
+}
+
+// Protected Проверяет, закрыта ли ссылка паролем
+func (u *URL) Protected() bool {
+	return u.PasswordHash != ""
+}
+
+// Expired Проверяет, истек ли срок действия ссылки к моменту now
+func (u *URL) Expired(now time.Time) bool {
+	return u.ExpiresAt != nil && !now.Before(*u.ExpiresAt)
 }
 
 type UserCollection struct {
 	UserID string   // Идентификатор пользователя
 	URLIDs []string // Идентификаторы URL пользователя
 }
+
+type Click struct {
+	URLID          string    // Идентификатор сокращенного URL
+	Time           time.Time // Время перехода
+	Referrer       string    // Заголовок Referer
+	UserAgent      string    // Заголовок User-Agent
+	IP             string    // Адрес клиента
+	AcceptLanguage string    // Заголовок Accept-Language
+	Bot            bool      // Переход сделан ботом или сервисом превью ссылок
+	Country        string    // Код страны клиента, пустой, если не определен
+	City           string    // Город клиента, пустой, если не определен
+	Target         string    // Выбранный адрес ссылки с несколькими адресами, иначе пустой
+}
+
+// ClickCount Количество переходов по ссылке за минуту с одинаковыми признаками
+type ClickCount struct {
+	URLID   string    // Идентификатор сокращенного URL
+	Minute  time.Time // Начало минуты в UTC
+	Bot     bool      // Переходы сделаны ботами
+	Country string    // Код страны, пустой, если не определен
+	City    string    // Город, пустой, если не определен
+	Target  string    // Выбранный адрес ссылки с несколькими адресами, иначе пустой
+	Count   int64     // Количество переходов
+}
+
+type Location struct {
+	Country string // Код страны ISO 3166-1
+	City    string // Название города на английском
+}
+
+type ClickStats struct {
+	Total     int64         // Количество переходов за период
+	Humans    int64         // Количество переходов людей
+	Bots      int64         // Количество переходов ботов
+	Visitors  int64         // Оценка уникальных посетителей-людей за сутки, затронутые периодом
+	Buckets   []ClickBucket // Количество переходов по интервалам периода
+	Countries []GeoCount    // Количество переходов по странам
+	Cities    []GeoCount    // Количество переходов по городам
+	Targets   []TargetCount // Количество переходов по адресам ссылки с несколькими адресами
+}
+
+type TargetCount struct {
+	URL    string // Адрес назначения
+	Weight int    // Вес адреса
+	Count  int64  // Количество переходов
+	Humans int64  // Количество переходов людей
+	Bots   int64  // Количество переходов ботов
+}
+
+type GeoCount struct {
+	Country string // Код страны, пустой для неопределенного местоположения
+	City    string // Город, пустой в разбивке по странам
+	Count   int64  // Количество переходов
+}
+
+type ClickBucket struct {
+	Start  time.Time // Начало интервала
+	Count  int64     // Количество переходов за интервал
+	Humans int64     // Количество переходов людей
+	Bots   int64     // Количество переходов ботов
+	// Оценка уникальных посетителей, заполняется только для суточных интервалов
+	Visitors int64
+}
+
+type DailyVisitors struct {
+	URLID  string      // Идентификатор сокращенного URL
+	Day    time.Time   // Начало суток в UTC
+	Sketch *hll.Sketch // Оценка уникальных посетителей за сутки
+}
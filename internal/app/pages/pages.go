@@ -0,0 +1,89 @@
+package pages
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+const (
+	Preview  = "preview.html"  // Страница предпросмотра ссылки
+	Password = "password.html" // Форма пароля закрытой ссылки
+)
+
+// embedded Встроенные шаблоны, которые используются, если каталог не задан или в нем нет шаблона
+//
+//go:embed templates/*.html
+var embedded embed.FS
+
+type renderer struct {
+	templates map[string]*template.Template
+}
+
+// NewRenderer Загружает встроенные шаблоны страниц. Если задан каталог dir,
+// шаблоны из него с теми же именами файлов заменяют встроенные
+func NewRenderer(dir string) (*renderer, error) {
+	names, err := fs.Glob(embedded, "templates/*.html")
+	if err != nil {
+		return nil, fmt.Errorf("list embedded templates error: %w", err)
+	}
+
+	templates := make(map[string]*template.Template, len(names))
+	for _, name := range names {
+		name = filepath.Base(name)
+
+		tmpl, err := parse(dir, name)
+		if err != nil {
+			return nil, err
+		}
+		templates[name] = tmpl
+	}
+
+	return &renderer{
+		templates: templates,
+	}, nil
+}
+
+// parse Читает шаблон name из каталога dir, либо встроенный, если в каталоге его нет
+func parse(dir, name string) (*template.Template, error) {
+	if dir != "" {
+		filePath := filepath.Join(dir, name)
+		tmpl, err := template.ParseFiles(filePath)
+		if err == nil {
+			return tmpl, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("parse template %q error: %w", filePath, err)
+		}
+	}
+
+	tmpl, err := template.ParseFS(embedded, "templates/"+name)
+	if err != nil {
+		return nil, fmt.Errorf("parse embedded template %q error: %w", name, err)
+	}
+
+	return tmpl, nil
+}
+
+// Render Заполняет шаблон name данными data. Страница собирается целиком до записи в w,
+// чтобы ошибка в шаблоне не оставила клиенту половину страницы
+func (r *renderer) Render(w io.Writer, name string, data interface{}) error {
+	tmpl, ok := r.templates[name]
+	if !ok {
+		return fmt.Errorf("unknown page %q", name)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return fmt.Errorf("execute template %q error: %w", name, err)
+	}
+
+	_, err := buf.WriteTo(w)
+	return err
+}
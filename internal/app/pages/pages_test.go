@@ -0,0 +1,100 @@
+package pages
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type previewData struct {
+	Destination string
+	Host        string
+	CreatedAt   time.Time
+	ContinueURL string
+}
+
+func TestRenderer_Preview(t *testing.T) {
+	r, err := NewRenderer("")
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	err = r.Render(&buf, Preview, previewData{
+		Destination: "https://avito.ru/moskva?q=<script>",
+		Host:        "avito.ru",
+		CreatedAt:   time.Date(2022, 5, 1, 12, 0, 0, 0, time.UTC),
+		ContinueURL: "/qwerty?continue=1",
+	})
+	require.NoError(t, err)
+
+	page := buf.String()
+	assert.Contains(t, page, "avito.ru")
+	assert.Contains(t, page, "https://avito.ru/moskva?q=&lt;script&gt;")
+	assert.Contains(t, page, "1 May 2022")
+	assert.Contains(t, page, `href="/qwerty?continue=1"`)
+	assert.NotContains(t, page, "<script>")
+}
+
+func TestRenderer_Password(t *testing.T) {
+	r, err := NewRenderer("")
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	err = r.Render(&buf, Password, struct {
+		Action string
+		Error  string
+	}{
+		Action: "/qwerty?continue=1",
+		Error:  "Wrong password",
+	})
+	require.NoError(t, err)
+
+	page := buf.String()
+	assert.Contains(t, page, `action="/qwerty?continue=1"`)
+	assert.Contains(t, page, `name="password"`)
+	assert.Contains(t, page, "Wrong password")
+}
+
+func TestRenderer_Override(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, Preview), []byte("custom {{.Host}}"), 0600))
+
+	r, err := NewRenderer(dir)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, r.Render(&buf, Preview, previewData{Host: "avito.ru"}))
+	assert.Equal(t, "custom avito.ru", buf.String())
+}
+
+func TestRenderer_MissingOverride(t *testing.T) {
+	// Шаблоны, которых нет в каталоге, берутся из встроенных
+	r, err := NewRenderer(t.TempDir())
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, r.Render(&buf, Preview, previewData{Host: "avito.ru"}))
+	assert.Contains(t, buf.String(), "<!DOCTYPE html>")
+}
+
+func TestRenderer_Errors(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, Preview), []byte("{{.Host"), 0600))
+
+	_, err := NewRenderer(dir)
+	assert.Error(t, err)
+
+	r, err := NewRenderer("")
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	assert.Error(t, r.Render(&buf, "missing.html", nil))
+
+	// Ошибка выполнения не оставляет в ответе половину страницы
+	assert.Error(t, r.Render(&buf, Preview, struct{}{}))
+	assert.Zero(t, buf.Len())
+}
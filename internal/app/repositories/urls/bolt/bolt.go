@@ -0,0 +1,752 @@
+package bolt
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+
+	bbolt "go.etcd.io/bbolt"
+
+	"github.com/bgoldovsky/shortener/internal/app/hll"
+	"github.com/bgoldovsky/shortener/internal/app/models"
+	"github.com/bgoldovsky/shortener/internal/app/repositories/urls"
+	internalErrors "github.com/bgoldovsky/shortener/internal/app/repositories/urls/errors"
+)
+
+const openTimeout = time.Second * 3
+
+var (
+	linksBucket     = []byte("links")     // urlID -> ссылка
+	urlsBucket      = []byte("urls")      // originalURL -> urlID неудаленной ссылки
+	usersBucket     = []byte("users")     // userID -> вложенный бакет urlID -> пусто
+	sequencesBucket = []byte("sequences") // имя счетчика -> следующее свободное значение
+	clicksBucket    = []byte("clicks")    // urlID -> вложенный бакет [время][номер] -> переход
+	visitorsBucket  = []byte("visitors")  // urlID -> вложенный бакет [начало суток] -> оценка посетителей
+	utmBucket       = []byte("utm")       // userID -> шаблон UTM-меток
+)
+
+type link struct {
+	OriginalURL  string     `json:"original_url"`
+	UserID       string     `json:"user_id"`
+	CreatedAt    time.Time  `json:"created_at"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	DeletedAt    *time.Time `json:"deleted_at,omitempty"`
+	RedirectType int        `json:"redirect_type,omitempty"`
+	Interstitial bool       `json:"interstitial,omitempty"`
+	PasswordHash string     `json:"password_hash,omitempty"`
+	NotBefore    *time.Time `json:"not_before,omitempty"`
+	MaxClicks    int64      `json:"max_clicks,omitempty"`
+	ClickCount   int64      `json:"click_count,omitempty"`
+	Targets      []target   `json:"targets,omitempty"`
+	Sticky       bool       `json:"sticky,omitempty"`
+	Rules        []rule     `json:"rules,omitempty"`
+	Passthrough  bool       `json:"passthrough,omitempty"`
+	UTM          *utm       `json:"utm,omitempty"`
+}
+
+type target struct {
+	URL    string `json:"url"`
+	Weight int    `json:"weight"`
+}
+
+type rule struct {
+	Platforms []string          `json:"platforms,omitempty"`
+	Languages []string          `json:"languages,omitempty"`
+	Query     map[string]string `json:"query,omitempty"`
+	Hours     *timeWindow       `json:"hours,omitempty"`
+	Target    string            `json:"target"`
+}
+
+type utm struct {
+	Source   string `json:"source,omitempty"`
+	Medium   string `json:"medium,omitempty"`
+	Campaign string `json:"campaign,omitempty"`
+	Term     string `json:"term,omitempty"`
+	Content  string `json:"content,omitempty"`
+}
+
+type timeWindow struct {
+	From int `json:"from"`
+	To   int `json:"to"`
+}
+
+type click struct {
+	Time           time.Time `json:"time"`
+	Referrer       string    `json:"referrer,omitempty"`
+	UserAgent      string    `json:"user_agent,omitempty"`
+	IP             string    `json:"ip,omitempty"`
+	AcceptLanguage string    `json:"accept_language,omitempty"`
+	Bot            bool      `json:"bot,omitempty"`
+	Country        string    `json:"country,omitempty"`
+	City           string    `json:"city,omitempty"`
+	Target         string    `json:"target,omitempty"`
+}
+
+type boltRepository struct {
+	db *bbolt.DB
+}
+
+func init() {
+	urls.Register("bolt", func(storageURL *url.URL) (urls.Repository, error) {
+		filePath, err := urls.StoragePath(storageURL)
+		if err != nil {
+			return nil, err
+		}
+		return NewRepository(filePath)
+	})
+}
+
+// NewRepository Открывает встроенное key-value хранилище
+func NewRepository(filePath string) (*boltRepository, error) {
+	db, err := bbolt.Open(filePath, 0600, &bbolt.Options{Timeout: openTimeout})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bbolt.Tx) error {
+		for _, name := range [][]byte{linksBucket, urlsBucket, usersBucket, sequencesBucket, clicksBucket, visitorsBucket, utmBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return fmt.Errorf("create bucket %s error: %w", name, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	return &boltRepository{
+		db: db,
+	}, nil
+}
+
+// Add Сохраняет URL
+func (r *boltRepository) Add(_ context.Context, url models.URL, userID string) error {
+	return r.db.Update(func(tx *bbolt.Tx) error {
+		// Проверяем не содержится ли в репозитории такой URL
+		if lastURLID := tx.Bucket(urlsBucket).Get([]byte(url.OriginalURL)); lastURLID != nil {
+			return internalErrors.NewNotUniqueURLErr(string(lastURLID), url.OriginalURL, nil)
+		}
+
+		if tx.Bucket(linksBucket).Get([]byte(url.ShortURL)) != nil {
+			return internalErrors.NewNotUniqueURLIDErr(url.ShortURL, nil)
+		}
+
+		return put(tx, url, userID, time.Now())
+	})
+}
+
+// AddBatch Сохраняет список URL
+func (r *boltRepository) AddBatch(_ context.Context, urls []models.URL, userID string) error {
+	return r.db.Update(func(tx *bbolt.Tx) error {
+		urlsIdx := tx.Bucket(urlsBucket)
+		links := tx.Bucket(linksBucket)
+		batch := make(map[string]string, len(urls))
+		batchIDs := make(map[string]struct{}, len(urls))
+
+		// Пакет сохраняется целиком, либо не сохраняется вовсе
+		for idx := range urls {
+			url := urls[idx].OriginalURL
+			if lastURLID := urlsIdx.Get([]byte(url)); lastURLID != nil {
+				return internalErrors.NewNotUniqueURLErr(string(lastURLID), url, nil)
+			}
+			if lastURLID, ok := batch[url]; ok {
+				return internalErrors.NewNotUniqueURLErr(lastURLID, url, nil)
+			}
+			batch[url] = urls[idx].ShortURL
+		}
+
+		// Удаленные ссылки продолжают занимать свой идентификатор
+		for idx := range urls {
+			urlID := urls[idx].ShortURL
+			if links.Get([]byte(urlID)) != nil {
+				return internalErrors.NewNotUniqueURLIDErr(urlID, nil)
+			}
+			if _, ok := batchIDs[urlID]; ok {
+				return internalErrors.NewNotUniqueURLIDErr(urlID, nil)
+			}
+			batchIDs[urlID] = struct{}{}
+		}
+
+		now := time.Now()
+		for idx := range urls {
+			if err := put(tx, urls[idx], userID, now); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func put(tx *bbolt.Tx, url models.URL, userID string, createdAt time.Time) error {
+	urlID := url.ShortURL
+
+	data, err := json.Marshal(link{
+		OriginalURL:  url.OriginalURL,
+		UserID:       userID,
+		CreatedAt:    createdAt,
+		ExpiresAt:    url.ExpiresAt,
+		RedirectType: url.RedirectType,
+		Interstitial: url.Interstitial,
+		PasswordHash: url.PasswordHash,
+		NotBefore:    url.NotBefore,
+		MaxClicks:    url.MaxClicks,
+		Targets:      toTargets(url.Targets),
+		Sticky:       url.Sticky,
+		Rules:        toRules(url.Rules),
+		Passthrough:  url.Passthrough,
+		UTM:          toUTM(url.UTM),
+	})
+	if err != nil {
+		return fmt.Errorf("serialize url error: %w", err)
+	}
+
+	if err = tx.Bucket(linksBucket).Put([]byte(urlID), data); err != nil {
+		return err
+	}
+
+	if err = tx.Bucket(urlsBucket).Put([]byte(url.OriginalURL), []byte(urlID)); err != nil {
+		return err
+	}
+
+	userLinks, err := tx.Bucket(usersBucket).CreateBucketIfNotExists([]byte(userID))
+	if err != nil {
+		return err
+	}
+
+	return userLinks.Put([]byte(urlID), nil)
+}
+
+func (l *link) url(urlID string) models.URL {
+	return models.URL{
+		ShortURL:     urlID,
+		OriginalURL:  l.OriginalURL,
+		ExpiresAt:    l.ExpiresAt,
+		RedirectType: l.RedirectType,
+		Interstitial: l.Interstitial,
+		CreatedAt:    l.CreatedAt,
+		PasswordHash: l.PasswordHash,
+		NotBefore:    l.NotBefore,
+		MaxClicks:    l.MaxClicks,
+		ClickCount:   l.ClickCount,
+		Targets:      fromTargets(l.Targets),
+		Sticky:       l.Sticky,
+		Rules:        fromRules(l.Rules),
+		Passthrough:  l.Passthrough,
+		UTM:          fromUTM(l.UTM),
+	}
+}
+
+func toTargets(targets []models.Target) []target {
+	if len(targets) == 0 {
+		return nil
+	}
+
+	res := make([]target, len(targets))
+	for idx := range targets {
+		res[idx] = target{URL: targets[idx].URL, Weight: targets[idx].Weight}
+	}
+
+	return res
+}
+
+func fromTargets(targets []target) []models.Target {
+	if len(targets) == 0 {
+		return nil
+	}
+
+	res := make([]models.Target, len(targets))
+	for idx := range targets {
+		res[idx] = models.Target{URL: targets[idx].URL, Weight: targets[idx].Weight}
+	}
+
+	return res
+}
+
+func toRules(rules []models.Rule) []rule {
+	if len(rules) == 0 {
+		return nil
+	}
+
+	res := make([]rule, len(rules))
+	for idx := range rules {
+		res[idx] = rule{
+			Platforms: rules[idx].Platforms,
+			Languages: rules[idx].Languages,
+			Query:     rules[idx].Query,
+			Target:    rules[idx].Target,
+		}
+		if hours := rules[idx].Hours; hours != nil {
+			res[idx].Hours = &timeWindow{From: hours.From, To: hours.To}
+		}
+	}
+
+	return res
+}
+
+func fromRules(rules []rule) []models.Rule {
+	if len(rules) == 0 {
+		return nil
+	}
+
+	res := make([]models.Rule, len(rules))
+	for idx := range rules {
+		res[idx] = models.Rule{
+			Platforms: rules[idx].Platforms,
+			Languages: rules[idx].Languages,
+			Query:     rules[idx].Query,
+			Target:    rules[idx].Target,
+		}
+		if hours := rules[idx].Hours; hours != nil {
+			res[idx].Hours = &models.TimeWindow{From: hours.From, To: hours.To}
+		}
+	}
+
+	return res
+}
+
+func toUTM(model *models.UTM) *utm {
+	if model == nil {
+		return nil
+	}
+
+	return &utm{
+		Source:   model.Source,
+		Medium:   model.Medium,
+		Campaign: model.Campaign,
+		Term:     model.Term,
+		Content:  model.Content,
+	}
+}
+
+func fromUTM(u *utm) *models.UTM {
+	if u == nil {
+		return nil
+	}
+
+	return &models.UTM{
+		Source:   u.Source,
+		Medium:   u.Medium,
+		Campaign: u.Campaign,
+		Term:     u.Term,
+		Content:  u.Content,
+	}
+}
+
+func get(tx *bbolt.Tx, urlID string) (*link, error) {
+	data := tx.Bucket(linksBucket).Get([]byte(urlID))
+	if data == nil {
+		return nil, internalErrors.ErrURLNotFound
+	}
+
+	var l link
+	if err := json.Unmarshal(data, &l); err != nil {
+		return nil, fmt.Errorf("deserialize url error: %w", err)
+	}
+
+	return &l, nil
+}
+
+// Get Возвращает URL
+func (r *boltRepository) Get(_ context.Context, urlID string) (models.URL, error) {
+	var url models.URL
+
+	err := r.db.View(func(tx *bbolt.Tx) error {
+		l, err := get(tx, urlID)
+		if err != nil {
+			return err
+		}
+		if l.DeletedAt != nil {
+			return internalErrors.ErrURLDeleted
+		}
+
+		url = l.url(urlID)
+		return nil
+	})
+	if err != nil {
+		return models.URL{}, err
+	}
+
+	return url, nil
+}
+
+// GetList Возвращает список всех сокращенных URL
+func (r *boltRepository) GetList(_ context.Context, userID string) ([]models.URL, error) {
+	urls := make([]models.URL, 0)
+
+	err := r.db.View(func(tx *bbolt.Tx) error {
+		userLinks := tx.Bucket(usersBucket).Bucket([]byte(userID))
+		if userLinks == nil {
+			return nil
+		}
+
+		return userLinks.ForEach(func(urlID, _ []byte) error {
+			l, err := get(tx, string(urlID))
+			if err != nil {
+				return err
+			}
+			if l.DeletedAt != nil {
+				return nil
+			}
+
+			urls = append(urls, l.url(string(urlID)))
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return urls, nil
+}
+
+// GetByUser Возвращает действующую ссылку пользователя
+func (r *boltRepository) GetByUser(_ context.Context, urlID, userID string) (models.URL, error) {
+	var url models.URL
+
+	err := r.db.View(func(tx *bbolt.Tx) error {
+		userLinks := tx.Bucket(usersBucket).Bucket([]byte(userID))
+		if userLinks == nil || userLinks.Get([]byte(urlID)) == nil {
+			return internalErrors.ErrURLNotFound
+		}
+
+		l, err := get(tx, urlID)
+		if err != nil {
+			return err
+		}
+		if l.DeletedAt != nil {
+			return internalErrors.ErrURLNotFound
+		}
+
+		url = l.url(urlID)
+		return nil
+	})
+	if err != nil {
+		return models.URL{}, err
+	}
+
+	return url, nil
+}
+
+// CountClick Учитывает переход по ссылке, если лимит переходов не исчерпан.
+// Проверка и запись идут в одной транзакции, а bolt не допускает параллельных записей
+func (r *boltRepository) CountClick(_ context.Context, urlID string) error {
+	return r.db.Update(func(tx *bbolt.Tx) error {
+		l, err := get(tx, urlID)
+		if err != nil {
+			return err
+		}
+		if l.DeletedAt != nil {
+			return internalErrors.ErrURLDeleted
+		}
+		if l.MaxClicks > 0 && l.ClickCount >= l.MaxClicks {
+			return internalErrors.ErrClickLimit
+		}
+
+		l.ClickCount++
+		data, err := json.Marshal(l)
+		if err != nil {
+			return fmt.Errorf("serialize url error: %w", err)
+		}
+
+		return tx.Bucket(linksBucket).Put([]byte(urlID), data)
+	})
+}
+
+// SetUTMTemplate Сохраняет шаблон UTM-меток пользователя, nil удаляет шаблон
+func (r *boltRepository) SetUTMTemplate(_ context.Context, userID string, template *models.UTM) error {
+	return r.db.Update(func(tx *bbolt.Tx) error {
+		if template == nil {
+			return tx.Bucket(utmBucket).Delete([]byte(userID))
+		}
+
+		data, err := json.Marshal(toUTM(template))
+		if err != nil {
+			return fmt.Errorf("serialize utm template error: %w", err)
+		}
+
+		return tx.Bucket(utmBucket).Put([]byte(userID), data)
+	})
+}
+
+// GetUTMTemplate Возвращает шаблон UTM-меток пользователя, nil если шаблона нет
+func (r *boltRepository) GetUTMTemplate(_ context.Context, userID string) (*models.UTM, error) {
+	var template *utm
+
+	err := r.db.View(func(tx *bbolt.Tx) error {
+		data := tx.Bucket(utmBucket).Get([]byte(userID))
+		if data == nil {
+			return nil
+		}
+
+		template = &utm{}
+		if err := json.Unmarshal(data, template); err != nil {
+			return fmt.Errorf("deserialize utm template error: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return fromUTM(template), nil
+}
+
+// Delete Удаляет список URL указанного пользователя
+func (r *boltRepository) Delete(_ context.Context, urlsBatch []models.UserCollection) error {
+	now := time.Now()
+
+	return r.db.Update(func(tx *bbolt.Tx) error {
+		for _, collection := range urlsBatch {
+			for _, urlID := range collection.URLIDs {
+				l, err := get(tx, urlID)
+				if err == internalErrors.ErrURLNotFound {
+					continue
+				}
+				if err != nil {
+					return err
+				}
+
+				// Помечаем удаленными только URL, принадлежащие пользователю
+				if l.UserID != collection.UserID || l.DeletedAt != nil {
+					continue
+				}
+
+				l.DeletedAt = &now
+				data, err := json.Marshal(l)
+				if err != nil {
+					return fmt.Errorf("serialize url error: %w", err)
+				}
+				if err = tx.Bucket(linksBucket).Put([]byte(urlID), data); err != nil {
+					return err
+				}
+
+				// Освобождаем URL для повторного сокращения
+				urlsIdx := tx.Bucket(urlsBucket)
+				if string(urlsIdx.Get([]byte(l.OriginalURL))) == urlID {
+					if err = urlsIdx.Delete([]byte(l.OriginalURL)); err != nil {
+						return err
+					}
+				}
+			}
+		}
+
+		return nil
+	})
+}
+
+// AddClicks Сохраняет переходы по ссылкам
+func (r *boltRepository) AddClicks(_ context.Context, clicks []models.Click) error {
+	return r.db.Update(func(tx *bbolt.Tx) error {
+		for idx := range clicks {
+			urlClicks, err := tx.Bucket(clicksBucket).CreateBucketIfNotExists([]byte(clicks[idx].URLID))
+			if err != nil {
+				return err
+			}
+
+			// Номер в ключе различает переходы, случившиеся в одну наносекунду
+			seq, err := urlClicks.NextSequence()
+			if err != nil {
+				return err
+			}
+
+			data, err := json.Marshal(click{
+				Time:           clicks[idx].Time,
+				Referrer:       clicks[idx].Referrer,
+				UserAgent:      clicks[idx].UserAgent,
+				IP:             clicks[idx].IP,
+				AcceptLanguage: clicks[idx].AcceptLanguage,
+				Bot:            clicks[idx].Bot,
+				Country:        clicks[idx].Country,
+				City:           clicks[idx].City,
+				Target:         clicks[idx].Target,
+			})
+			if err != nil {
+				return fmt.Errorf("serialize click error: %w", err)
+			}
+
+			key := make([]byte, 16)
+			copy(key, clickTimeKey(clicks[idx].Time))
+			binary.BigEndian.PutUint64(key[8:], seq)
+
+			if err = urlClicks.Put(key, data); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// GetClickCounts Возвращает количества переходов по ссылке за минуты, начавшиеся в [from, to).
+// Переходы складываются по минутам при чтении, не попадая в память по одному
+func (r *boltRepository) GetClickCounts(_ context.Context, urlID string, from, to time.Time) ([]models.ClickCount, error) {
+	counts := make([]models.ClickCount, 0)
+
+	err := r.db.View(func(tx *bbolt.Tx) error {
+		urlClicks := tx.Bucket(clicksBucket).Bucket([]byte(urlID))
+		if urlClicks == nil {
+			return nil
+		}
+
+		// Переходы читаются по порядку, поэтому складывать есть смысл только в пределах текущей минуты
+		var minute time.Time
+		start := 0
+
+		end := clickTimeKey(to)
+		c := urlClicks.Cursor()
+		for k, v := c.Seek(clickTimeKey(from)); k != nil && bytes.Compare(k[:8], end) < 0; k, v = c.Next() {
+			var cl click
+			if err := json.Unmarshal(v, &cl); err != nil {
+				return fmt.Errorf("deserialize click error: %w", err)
+			}
+
+			count := models.ClickCount{
+				URLID:   urlID,
+				Minute:  cl.Time.UTC().Truncate(time.Minute),
+				Bot:     cl.Bot,
+				Country: cl.Country,
+				City:    cl.City,
+				Target:  cl.Target,
+				Count:   1,
+			}
+			if !count.Minute.Equal(minute) {
+				minute = count.Minute
+				start = len(counts)
+			}
+
+			counts = addClickCount(counts, start, count)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
+
+// addClickCount Прибавляет переход к количеству с теми же признаками среди counts[start:]
+func addClickCount(counts []models.ClickCount, start int, count models.ClickCount) []models.ClickCount {
+	for idx := start; idx < len(counts); idx++ {
+		if counts[idx].Bot == count.Bot && counts[idx].Country == count.Country &&
+			counts[idx].City == count.City && counts[idx].Target == count.Target {
+			counts[idx].Count += count.Count
+			return counts
+		}
+	}
+
+	return append(counts, count)
+}
+
+// MergeVisitors Объединяет суточные оценки посетителей с сохраненными
+func (r *boltRepository) MergeVisitors(_ context.Context, visitors []models.DailyVisitors) error {
+	return r.db.Update(func(tx *bbolt.Tx) error {
+		for _, v := range visitors {
+			urlVisitors, err := tx.Bucket(visitorsBucket).CreateBucketIfNotExists([]byte(v.URLID))
+			if err != nil {
+				return err
+			}
+
+			key := clickTimeKey(v.Day)
+			sketch := hll.New()
+			if data := urlVisitors.Get(key); data != nil {
+				if err = sketch.UnmarshalBinary(data); err != nil {
+					return fmt.Errorf("deserialize visitors error: %w", err)
+				}
+			}
+			sketch.Merge(v.Sketch)
+
+			data, err := sketch.MarshalBinary()
+			if err != nil {
+				return fmt.Errorf("serialize visitors error: %w", err)
+			}
+			if err = urlVisitors.Put(key, data); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// GetVisitors Возвращает суточные оценки посетителей ссылки за сутки, начавшиеся в [from, to)
+func (r *boltRepository) GetVisitors(_ context.Context, urlID string, from, to time.Time) ([]models.DailyVisitors, error) {
+	visitors := make([]models.DailyVisitors, 0)
+
+	err := r.db.View(func(tx *bbolt.Tx) error {
+		urlVisitors := tx.Bucket(visitorsBucket).Bucket([]byte(urlID))
+		if urlVisitors == nil {
+			return nil
+		}
+
+		end := clickTimeKey(to)
+		c := urlVisitors.Cursor()
+		for k, v := c.Seek(clickTimeKey(from)); k != nil && bytes.Compare(k, end) < 0; k, v = c.Next() {
+			sketch := hll.New()
+			if err := sketch.UnmarshalBinary(v); err != nil {
+				return fmt.Errorf("deserialize visitors error: %w", err)
+			}
+
+			day := time.Unix(0, int64(binary.BigEndian.Uint64(k)^(1<<63))).UTC()
+			visitors = append(visitors, models.DailyVisitors{URLID: urlID, Day: day, Sketch: sketch})
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return visitors, nil
+}
+
+// clickTimeKey Кодирует время так, чтобы порядок ключей совпадал с порядком времени
+func clickTimeKey(t time.Time) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(t.UnixNano())^(1<<63))
+
+	return key
+}
+
+// Lease Резервирует диапазон [start, start+size) счетчика name
+func (r *boltRepository) Lease(_ context.Context, name string, size int64) (int64, error) {
+	var start int64
+
+	err := r.db.Update(func(tx *bbolt.Tx) error {
+		sequences := tx.Bucket(sequencesBucket)
+		if data := sequences.Get([]byte(name)); data != nil {
+			start = int64(binary.BigEndian.Uint64(data))
+		}
+
+		next := make([]byte, 8)
+		binary.BigEndian.PutUint64(next, uint64(start+size))
+
+		return sequences.Put([]byte(name), next)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return start, nil
+}
+
+// Ping Проверяет доступность базы данных
+func (r *boltRepository) Ping(_ context.Context) error {
+	return r.db.View(func(tx *bbolt.Tx) error {
+		return nil
+	})
+}
+
+// Close Закрывает соединение
+func (r *boltRepository) Close() error {
+	return r.db.Close()
+}
@@ -0,0 +1,111 @@
+package bolt
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bgoldovsky/shortener/internal/app/models"
+	internalErrors "github.com/bgoldovsky/shortener/internal/app/repositories/urls/errors"
+)
+
+const defaultUserID = "user123"
+
+func TestBoltRepo_RestoreData(t *testing.T) {
+	ctx := context.Background()
+	filePath := filepath.Join(t.TempDir(), "store.db")
+
+	repo, err := NewRepository(filePath)
+	require.NoError(t, err)
+
+	err = repo.AddBatch(ctx, []models.URL{
+		{ShortURL: "qwerty", OriginalURL: "avito.ru"},
+		{ShortURL: "ytrewq", OriginalURL: "yandex.ru"},
+	}, defaultUserID)
+	require.NoError(t, err)
+
+	err = repo.Delete(ctx, []models.UserCollection{{UserID: defaultUserID, URLIDs: []string{"qwerty"}}})
+	require.NoError(t, err)
+	require.NoError(t, repo.Close())
+
+	repo, err = NewRepository(filePath)
+	require.NoError(t, err)
+
+	defer func() {
+		_ = repo.Close()
+	}()
+
+	_, err = repo.Get(ctx, "qwerty")
+	assert.Equal(t, internalErrors.ErrURLDeleted, err)
+
+	act, err := repo.GetList(ctx, defaultUserID)
+	require.NoError(t, err)
+	require.Len(t, act, 1)
+	assert.Equal(t, "ytrewq", act[0].ShortURL)
+	assert.Equal(t, "yandex.ru", act[0].OriginalURL)
+	assert.False(t, act[0].CreatedAt.IsZero())
+}
+
+func TestBoltRepo_Add_TakenID(t *testing.T) {
+	ctx := context.Background()
+
+	repo, err := NewRepository(filepath.Join(t.TempDir(), "store.db"))
+	require.NoError(t, err)
+
+	defer func() {
+		_ = repo.Close()
+	}()
+
+	err = repo.Add(ctx, models.URL{ShortURL: "qwerty", OriginalURL: "avito.ru"}, defaultUserID)
+	require.NoError(t, err)
+
+	err = repo.Delete(ctx, []models.UserCollection{{UserID: defaultUserID, URLIDs: []string{"qwerty"}}})
+	require.NoError(t, err)
+
+	// Идентификатор удаленной ссылки не переиспользуется
+	err = repo.Add(ctx, models.URL{ShortURL: "qwerty", OriginalURL: "yandex.ru"}, "user456")
+	var idErr *internalErrors.NotUniqueURLIDErr
+	require.True(t, errors.As(err, &idErr))
+	assert.Equal(t, "qwerty", idErr.URLID)
+
+	act, err := repo.GetList(ctx, "user456")
+	require.NoError(t, err)
+	assert.Empty(t, act)
+}
+
+func TestBoltRepo_Lease(t *testing.T) {
+	ctx := context.Background()
+	filePath := filepath.Join(t.TempDir(), "store.db")
+
+	repo, err := NewRepository(filePath)
+	require.NoError(t, err)
+
+	start, err := repo.Lease(ctx, "urls", 100)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), start)
+
+	start, err = repo.Lease(ctx, "urls", 100)
+	require.NoError(t, err)
+	assert.Equal(t, int64(100), start)
+	require.NoError(t, repo.Close())
+
+	// Выданные диапазоны не переиспользуются после перезапуска
+	repo, err = NewRepository(filePath)
+	require.NoError(t, err)
+
+	defer func() {
+		_ = repo.Close()
+	}()
+
+	start, err = repo.Lease(ctx, "urls", 100)
+	require.NoError(t, err)
+	assert.Equal(t, int64(200), start)
+
+	start, err = repo.Lease(ctx, "other", 10)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), start)
+}
@@ -0,0 +1,235 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bgoldovsky/shortener/internal/app/models"
+	"github.com/bgoldovsky/shortener/internal/app/repositories/urls"
+	internalErrors "github.com/bgoldovsky/shortener/internal/app/repositories/urls/errors"
+)
+
+// loadTimeout Ограничение общей загрузки, которая не отменяется вместе с запросом первого клиента
+const loadTimeout = time.Second * 5
+
+// Stats Счетчики кэша
+type Stats struct {
+	Hits      int64 `json:"hits"`
+	Misses    int64 `json:"misses"`
+	Evictions int64 `json:"evictions"`
+	Size      int   `json:"size"`
+	Capacity  int   `json:"capacity"`
+}
+
+type entry struct {
+	urlID   string
+	url     models.URL
+	err     error
+	expires time.Time
+}
+
+// call Загрузка, которую ждут все конкурентные промахи по одному urlID
+type call struct {
+	wg  sync.WaitGroup
+	url models.URL
+	err error
+}
+
+type cacheRepository struct {
+	// Счетчики идут первыми ради выравнивания атомарных операций на 32-битных платформах
+	hits      int64
+	misses    int64
+	evictions int64
+
+	urls.Repository
+
+	capacity    int
+	ttl         time.Duration
+	negativeTTL time.Duration
+
+	ma       sync.Mutex
+	items    map[string]*list.Element
+	lru      *list.List
+	inflight map[string]*call
+	epoch    uint64
+}
+
+// NewRepository Оборачивает репозиторий ограниченным LRU кэшем для Get.
+// Найденные URL хранятся ttl, удаленные и ненайденные - negativeTTL
+func NewRepository(repo urls.Repository, capacity int, ttl, negativeTTL time.Duration) *cacheRepository {
+	return &cacheRepository{
+		Repository:  repo,
+		capacity:    capacity,
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+		items:       map[string]*list.Element{},
+		lru:         list.New(),
+		inflight:    map[string]*call{},
+	}
+}
+
+// Get Возвращает URL из кэша, при промахе загружает его из репозитория один раз на все конкурентные запросы
+func (r *cacheRepository) Get(ctx context.Context, urlID string) (models.URL, error) {
+	r.ma.Lock()
+	if el, ok := r.items[urlID]; ok {
+		e := el.Value.(*entry)
+		if time.Now().Before(e.expires) {
+			r.lru.MoveToFront(el)
+			r.ma.Unlock()
+
+			atomic.AddInt64(&r.hits, 1)
+			return e.url, e.err
+		}
+		r.remove(el)
+	}
+
+	atomic.AddInt64(&r.misses, 1)
+
+	if c, ok := r.inflight[urlID]; ok {
+		r.ma.Unlock()
+		c.wg.Wait()
+		return c.url, c.err
+	}
+
+	c := &call{}
+	c.wg.Add(1)
+	r.inflight[urlID] = c
+	epoch := r.epoch
+	r.ma.Unlock()
+
+	// Результат ждут и другие запросы, поэтому отключение первого клиента не должно прерывать загрузку
+	loadCtx, cancel := context.WithTimeout(detachedContext{ctx}, loadTimeout)
+	c.url, c.err = r.Repository.Get(loadCtx, urlID)
+	cancel()
+
+	r.ma.Lock()
+	delete(r.inflight, urlID)
+	// Если за время загрузки кэш инвалидировали, результат может быть устаревшим
+	if epoch == r.epoch {
+		r.store(urlID, c.url, c.err)
+	}
+	r.ma.Unlock()
+	c.wg.Done()
+
+	return c.url, c.err
+}
+
+// detachedContext Сохраняет значения контекста запроса, но не его отмену и срок
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (detachedContext) Err() error {
+	return nil
+}
+
+func (c detachedContext) Value(key interface{}) interface{} {
+	return c.parent.Value(key)
+}
+
+// Add Сохраняет URL и сбрасывает закэшированный отрицательный результат по urlID
+func (r *cacheRepository) Add(ctx context.Context, url models.URL, userID string) error {
+	err := r.Repository.Add(ctx, url, userID)
+	r.invalidate(url.ShortURL)
+
+	return err
+}
+
+// AddBatch Сохраняет список URL и сбрасывает закэшированные результаты по их urlID
+func (r *cacheRepository) AddBatch(ctx context.Context, batch []models.URL, userID string) error {
+	err := r.Repository.AddBatch(ctx, batch, userID)
+
+	urlIDs := make([]string, len(batch))
+	for idx := range batch {
+		urlIDs[idx] = batch[idx].ShortURL
+	}
+	r.invalidate(urlIDs...)
+
+	return err
+}
+
+// Delete Удаляет список URL и сбрасывает их из кэша
+func (r *cacheRepository) Delete(ctx context.Context, urlsBatch []models.UserCollection) error {
+	err := r.Repository.Delete(ctx, urlsBatch)
+
+	for _, collection := range urlsBatch {
+		r.invalidate(collection.URLIDs...)
+	}
+
+	return err
+}
+
+// Stats Возвращает счетчики кэша
+func (r *cacheRepository) Stats() Stats {
+	r.ma.Lock()
+	size := r.lru.Len()
+	r.ma.Unlock()
+
+	return Stats{
+		Hits:      atomic.LoadInt64(&r.hits),
+		Misses:    atomic.LoadInt64(&r.misses),
+		Evictions: atomic.LoadInt64(&r.evictions),
+		Size:      size,
+		Capacity:  r.capacity,
+	}
+}
+
+func (r *cacheRepository) invalidate(urlIDs ...string) {
+	r.ma.Lock()
+	defer r.ma.Unlock()
+
+	r.epoch++
+	for _, urlID := range urlIDs {
+		if el, ok := r.items[urlID]; ok {
+			r.remove(el)
+		}
+	}
+}
+
+// store Кэширует результат загрузки. Вызывается под блокировкой
+func (r *cacheRepository) store(urlID string, url models.URL, err error) {
+	ttl := r.ttl
+	if err != nil {
+		// Временные ошибки репозитория не кэшируются
+		if !errors.Is(err, internalErrors.ErrURLNotFound) && !errors.Is(err, internalErrors.ErrURLDeleted) {
+			return
+		}
+		ttl = r.negativeTTL
+	}
+	if ttl <= 0 || r.capacity <= 0 {
+		return
+	}
+
+	if el, ok := r.items[urlID]; ok {
+		r.remove(el)
+	}
+
+	r.items[urlID] = r.lru.PushFront(&entry{
+		urlID:   urlID,
+		url:     url,
+		err:     err,
+		expires: time.Now().Add(ttl),
+	})
+
+	for r.lru.Len() > r.capacity {
+		r.remove(r.lru.Back())
+		atomic.AddInt64(&r.evictions, 1)
+	}
+}
+
+func (r *cacheRepository) remove(el *list.Element) {
+	r.lru.Remove(el)
+	delete(r.items, el.Value.(*entry).urlID)
+}
@@ -0,0 +1,241 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bgoldovsky/shortener/internal/app/models"
+	"github.com/bgoldovsky/shortener/internal/app/repositories/urls"
+	internalErrors "github.com/bgoldovsky/shortener/internal/app/repositories/urls/errors"
+	"github.com/bgoldovsky/shortener/internal/app/repositories/urls/inmemory"
+)
+
+const defaultUserID = "user123"
+
+// countingRepository Считает обращения к Get и может задерживать их
+type countingRepository struct {
+	urls.Repository
+	gets    int64
+	release chan struct{}
+}
+
+func (r *countingRepository) Get(ctx context.Context, urlID string) (models.URL, error) {
+	atomic.AddInt64(&r.gets, 1)
+	if r.release != nil {
+		<-r.release
+	}
+	// Как настоящая база, не выполняет запрос с отмененным контекстом
+	if err := ctx.Err(); err != nil {
+		return models.URL{}, err
+	}
+
+	return r.Repository.Get(ctx, urlID)
+}
+
+func newCountingRepository() *countingRepository {
+	return &countingRepository{Repository: inmemory.NewRepository()}
+}
+
+func TestCache_Get_Hit(t *testing.T) {
+	ctx := context.Background()
+	repo := newCountingRepository()
+	require.NoError(t, repo.Add(ctx, models.URL{ShortURL: "qwerty", OriginalURL: "avito.ru"}, defaultUserID))
+
+	c := NewRepository(repo, 10, time.Minute, time.Minute)
+
+	for i := 0; i < 3; i++ {
+		act, err := c.Get(ctx, "qwerty")
+		require.NoError(t, err)
+		assert.Equal(t, "avito.ru", act.OriginalURL)
+	}
+
+	assert.Equal(t, int64(1), atomic.LoadInt64(&repo.gets))
+	assert.Equal(t, Stats{Hits: 2, Misses: 1, Size: 1, Capacity: 10}, c.Stats())
+}
+
+func TestCache_Get_Negative(t *testing.T) {
+	ctx := context.Background()
+	repo := newCountingRepository()
+	require.NoError(t, repo.Add(ctx, models.URL{ShortURL: "qwerty", OriginalURL: "avito.ru"}, defaultUserID))
+	require.NoError(t, repo.Delete(ctx, []models.UserCollection{{UserID: defaultUserID, URLIDs: []string{"qwerty"}}}))
+
+	c := NewRepository(repo, 10, time.Minute, time.Minute)
+
+	for i := 0; i < 2; i++ {
+		_, err := c.Get(ctx, "qwerty")
+		assert.Equal(t, internalErrors.ErrURLDeleted, err)
+
+		_, err = c.Get(ctx, "fake")
+		assert.Equal(t, internalErrors.ErrURLNotFound, err)
+	}
+
+	assert.Equal(t, int64(2), atomic.LoadInt64(&repo.gets))
+
+	// Добавление ссылки сбрасывает отрицательный результат
+	require.NoError(t, c.Add(ctx, models.URL{ShortURL: "fake", OriginalURL: "yandex.ru"}, defaultUserID))
+
+	act, err := c.Get(ctx, "fake")
+	require.NoError(t, err)
+	assert.Equal(t, "yandex.ru", act.OriginalURL)
+}
+
+func TestCache_Get_Expired(t *testing.T) {
+	ctx := context.Background()
+	repo := newCountingRepository()
+	require.NoError(t, repo.Add(ctx, models.URL{ShortURL: "qwerty", OriginalURL: "avito.ru"}, defaultUserID))
+
+	c := NewRepository(repo, 10, time.Millisecond, time.Millisecond)
+
+	_, err := c.Get(ctx, "qwerty")
+	require.NoError(t, err)
+
+	time.Sleep(time.Millisecond * 5)
+
+	_, err = c.Get(ctx, "qwerty")
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(2), atomic.LoadInt64(&repo.gets))
+}
+
+func TestCache_Get_Evict(t *testing.T) {
+	ctx := context.Background()
+	repo := newCountingRepository()
+	require.NoError(t, repo.Add(ctx, models.URL{ShortURL: "a", OriginalURL: "avito.ru"}, defaultUserID))
+	require.NoError(t, repo.Add(ctx, models.URL{ShortURL: "b", OriginalURL: "yandex.ru"}, defaultUserID))
+	require.NoError(t, repo.Add(ctx, models.URL{ShortURL: "c", OriginalURL: "ozon.ru"}, defaultUserID))
+
+	c := NewRepository(repo, 2, time.Minute, time.Minute)
+
+	for _, urlID := range []string{"a", "b", "a", "c"} {
+		_, err := c.Get(ctx, urlID)
+		require.NoError(t, err)
+	}
+
+	// "b" использовался давнее всех и вытеснен
+	_, err := c.Get(ctx, "a")
+	require.NoError(t, err)
+	_, err = c.Get(ctx, "b")
+	require.NoError(t, err)
+
+	stats := c.Stats()
+	assert.Equal(t, int64(4), atomic.LoadInt64(&repo.gets))
+	assert.Equal(t, int64(2), stats.Evictions)
+	assert.Equal(t, 2, stats.Size)
+}
+
+func TestCache_Delete_Invalidates(t *testing.T) {
+	ctx := context.Background()
+	repo := newCountingRepository()
+	require.NoError(t, repo.Add(ctx, models.URL{ShortURL: "qwerty", OriginalURL: "avito.ru"}, defaultUserID))
+
+	c := NewRepository(repo, 10, time.Minute, time.Minute)
+
+	_, err := c.Get(ctx, "qwerty")
+	require.NoError(t, err)
+
+	err = c.Delete(ctx, []models.UserCollection{{UserID: defaultUserID, URLIDs: []string{"qwerty"}}})
+	require.NoError(t, err)
+
+	_, err = c.Get(ctx, "qwerty")
+	assert.Equal(t, internalErrors.ErrURLDeleted, err)
+}
+
+func TestCache_Get_CollapseConcurrentMisses(t *testing.T) {
+	ctx := context.Background()
+	repo := newCountingRepository()
+	require.NoError(t, repo.Add(ctx, models.URL{ShortURL: "qwerty", OriginalURL: "avito.ru"}, defaultUserID))
+	repo.release = make(chan struct{})
+
+	c := NewRepository(repo, 10, time.Minute, time.Minute)
+
+	workers := 10
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+
+			act, err := c.Get(ctx, "qwerty")
+			assert.NoError(t, err)
+			assert.Equal(t, "avito.ru", act.OriginalURL)
+		}()
+	}
+
+	// Ждем, пока все запросы дойдут до кэша, и отпускаем единственную загрузку
+	for deadline := time.Now().Add(time.Second); c.Stats().Misses < int64(workers) && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	close(repo.release)
+	wg.Wait()
+
+	assert.Equal(t, int64(1), atomic.LoadInt64(&repo.gets))
+}
+
+func TestCache_Get_LeaderCanceled(t *testing.T) {
+	repo := newCountingRepository()
+	require.NoError(t, repo.Add(context.Background(), models.URL{ShortURL: "qwerty", OriginalURL: "avito.ru"}, defaultUserID))
+	repo.release = make(chan struct{})
+
+	c := NewRepository(repo, 10, time.Minute, time.Minute)
+
+	waitMisses := func(misses int64) {
+		for deadline := time.Now().Add(time.Second); c.Stats().Misses < misses && time.Now().Before(deadline); {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	leaderCtx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		_, _ = c.Get(leaderCtx, "qwerty")
+	}()
+	waitMisses(1)
+
+	go func() {
+		defer wg.Done()
+
+		act, err := c.Get(context.Background(), "qwerty")
+		assert.NoError(t, err)
+		assert.Equal(t, "avito.ru", act.OriginalURL)
+	}()
+	waitMisses(2)
+
+	// Первый клиент отключается, пока загрузка ждет базу
+	cancel()
+	close(repo.release)
+	wg.Wait()
+
+	assert.Equal(t, int64(1), atomic.LoadInt64(&repo.gets))
+}
+
+func TestCache_Get_ErrorNotCached(t *testing.T) {
+	ctx := context.Background()
+	repoErr := errors.New("connection refused")
+
+	c := NewRepository(&failingRepository{err: repoErr}, 10, time.Minute, time.Minute)
+
+	for i := 0; i < 2; i++ {
+		_, err := c.Get(ctx, "qwerty")
+		assert.Equal(t, repoErr, err)
+	}
+
+	assert.Equal(t, 0, c.Stats().Size)
+}
+
+type failingRepository struct {
+	countingRepository
+	err error
+}
+
+func (r *failingRepository) Get(_ context.Context, _ string) (models.URL, error) {
+	return models.URL{}, r.err
+}
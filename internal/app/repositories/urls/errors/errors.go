@@ -8,6 +8,7 @@ import (
 var (
 	ErrURLNotFound = errors.New("url not found")
 	ErrURLDeleted  = errors.New("url has been deleted error")
+	ErrClickLimit  = errors.New("url click limit reached error")
 )
 
 type NotUniqueURLErr struct {
@@ -27,3 +28,20 @@ func NewNotUniqueURLErr(urlID, originalURL string, err error) error {
 func (e *NotUniqueURLErr) Error() string {
 	return fmt.Sprintf("url not unique: urlID %v, originalURL: %v, error: %v ", e.URLID, e.OriginalURL, e.Err)
 }
+
+// NotUniqueURLIDErr Идентификатор уже занят другой ссылкой, в том числе удаленной
+type NotUniqueURLIDErr struct {
+	URLID string
+	Err   error
+}
+
+func NewNotUniqueURLIDErr(urlID string, err error) error {
+	return &NotUniqueURLIDErr{
+		URLID: urlID,
+		Err:   err,
+	}
+}
+
+func (e *NotUniqueURLIDErr) Error() string {
+	return fmt.Sprintf("url id not unique: urlID %v, error: %v ", e.URLID, e.Err)
+}
@@ -3,39 +3,115 @@ package urls
 import (
 	"context"
 	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/bgoldovsky/shortener/internal/app/models"
-	"github.com/bgoldovsky/shortener/internal/app/repositories/urls/file"
-	"github.com/bgoldovsky/shortener/internal/app/repositories/urls/inmemory"
-	"github.com/bgoldovsky/shortener/internal/app/repositories/urls/postgres"
 )
 
 type Repository interface {
-	Add(ctx context.Context, urlID, url, userID string) error
+	Add(ctx context.Context, url models.URL, userID string) error
 	AddBatch(ctx context.Context, urls []models.URL, userID string) error
-	Get(ctx context.Context, urlID string) (string, error)
+	Get(ctx context.Context, urlID string) (models.URL, error)
 	GetList(ctx context.Context, userID string) ([]models.URL, error)
+	// GetByUser Возвращает действующую ссылку пользователя. Удаленные и чужие ссылки
+	// неотличимы от несуществующих: для них возвращается ErrURLNotFound
+	GetByUser(ctx context.Context, urlID, userID string) (models.URL, error)
+	// CountClick Атомарно учитывает переход по ссылке с ограничением числа переходов,
+	// возвращает ErrClickLimit, если лимит уже исчерпан
+	CountClick(ctx context.Context, urlID string) error
+	// SetUTMTemplate Сохраняет шаблон UTM-меток пользователя, nil удаляет шаблон
+	SetUTMTemplate(ctx context.Context, userID string, utm *models.UTM) error
+	// GetUTMTemplate Возвращает шаблон UTM-меток пользователя, nil если шаблона нет
+	GetUTMTemplate(ctx context.Context, userID string) (*models.UTM, error)
 	Delete(ctx context.Context, urlsBatch []models.UserCollection) error
+	AddClicks(ctx context.Context, clicks []models.Click) error
+	// GetClickCounts Возвращает количества переходов по ссылке за минуты, начавшиеся в [from, to),
+	// в порядке времени. Границы периода кратны минуте
+	GetClickCounts(ctx context.Context, urlID string, from, to time.Time) ([]models.ClickCount, error)
+	MergeVisitors(ctx context.Context, visitors []models.DailyVisitors) error
+	GetVisitors(ctx context.Context, urlID string, from, to time.Time) ([]models.DailyVisitors, error)
 	Ping(ctx context.Context) error
 	Close() error
 }
 
-// Factory Инициализирует новый репозиторий
-func Factory(filePath, databaseDSN string) (Repository, error) {
-	switch {
-	case databaseDSN != "":
-		r, err := postgres.NewRepository(databaseDSN)
-		if err != nil {
-			return nil, fmt.Errorf("initialize postgres repo error: %w", err)
-		}
-		return r, nil
-	case filePath != "":
-		r, err := file.NewRepository(filePath)
-		if err != nil {
-			return nil, fmt.Errorf("initialize file repo error: %w", err)
+// Opener Открывает репозиторий по адресу хранилища
+type Opener func(storageURL *url.URL) (Repository, error)
+
+var (
+	openersMu sync.RWMutex
+	openers   = map[string]Opener{}
+)
+
+// Register Регистрирует репозиторий для схемы адреса хранилища.
+// Вызывается из init пакета репозитория
+func Register(scheme string, opener Opener) {
+	openersMu.Lock()
+	defer openersMu.Unlock()
+
+	if opener == nil {
+		panic("urls: register opener is nil")
+	}
+	if _, dup := openers[scheme]; dup {
+		panic("urls: register called twice for scheme " + scheme)
+	}
+
+	openers[scheme] = opener
+}
+
+// Schemes Возвращает отсортированный список зарегистрированных схем
+func Schemes() []string {
+	openersMu.RLock()
+	defer openersMu.RUnlock()
+
+	schemes := make([]string, 0, len(openers))
+	for scheme := range openers {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+
+	return schemes
+}
+
+// Factory Инициализирует новый репозиторий по схеме адреса хранилища
+func Factory(storageURL string) (Repository, error) {
+	u, err := url.Parse(storageURL)
+	if err != nil {
+		return nil, fmt.Errorf("parse storage url error: %w", err)
+	}
+
+	openersMu.RLock()
+	opener, ok := openers[u.Scheme]
+	openersMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown storage scheme %q, supported: %s", u.Scheme, strings.Join(Schemes(), ", "))
+	}
+
+	r, err := opener(u)
+	if err != nil {
+		return nil, fmt.Errorf("initialize %s repo error: %w", u.Scheme, err)
+	}
+
+	return r, nil
+}
+
+// StoragePath Возвращает путь к файлу из адреса хранилища вида file:///var/lib/shortener.db или file:store.dat
+func StoragePath(u *url.URL) (string, error) {
+	path := u.Host + u.Path
+	if u.Opaque != "" {
+		var err error
+		if path, err = url.PathUnescape(u.Opaque); err != nil {
+			return "", err
 		}
-		return r, nil
 	}
 
-	return inmemory.NewRepository(), nil
+	if path == "" {
+		return "", fmt.Errorf("storage path not specified in %q", u.Redacted())
+	}
+
+	return path, nil
 }
@@ -0,0 +1,58 @@
+package urls
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFactory_UnknownScheme(t *testing.T) {
+	_, err := Factory("redis://localhost:6379")
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `unknown storage scheme "redis"`)
+}
+
+func TestStoragePath(t *testing.T) {
+	tests := []struct {
+		name       string
+		storageURL string
+		path       string
+		err        bool
+	}{
+		{
+			name:       "absolute",
+			storageURL: "file:///var/lib/shortener.db",
+			path:       "/var/lib/shortener.db",
+		},
+		{
+			name:       "relative",
+			storageURL: "file:store.dat",
+			path:       "store.dat",
+		},
+		{
+			name:       "relative with host form",
+			storageURL: "bolt://data/store.db",
+			path:       "data/store.db",
+		},
+		{
+			name:       "empty",
+			storageURL: "file://",
+			err:        true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := url.Parse(tt.storageURL)
+			require.NoError(t, err)
+
+			act, err := StoragePath(u)
+
+			assert.Equal(t, tt.err, err != nil)
+			assert.Equal(t, tt.path, act)
+		})
+	}
+}
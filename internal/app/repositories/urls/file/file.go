@@ -1,153 +1,334 @@
 package file
 
 import (
-	"bufio"
 	"bytes"
 	"context"
 	"encoding/gob"
+	"errors"
 	"fmt"
+	"io"
+	"net/url"
 	"os"
 	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
 
 	"github.com/bgoldovsky/shortener/internal/app/models"
+	"github.com/bgoldovsky/shortener/internal/app/repositories/urls"
 	internalErrors "github.com/bgoldovsky/shortener/internal/app/repositories/urls/errors"
+	"github.com/bgoldovsky/shortener/internal/app/repositories/urls/index"
+)
+
+const (
+	compactInterval  = time.Second * 10
+	compactThreshold = 1000
+
+	// snapshotClicksSize Сколько количеств переходов по одной ссылке пишется в одну запись снимка
+	snapshotClicksSize = 10_000
 )
 
 type fileRepository struct {
-	store    map[string]map[string]string
+	store    *index.Index
+	clicks   *index.Clicks
 	ma       sync.RWMutex
 	filePath string
+	file     *os.File
+	offset   int64
+	garbage  int
+	doneCh   chan struct{}
+
+	closeOnce sync.Once
+	closed    bool
 }
 
-// NewRepository Инициализирует репозиторий данными из файла
+var errClosed = errors.New("repository closed")
+
+func init() {
+	urls.Register("file", func(storageURL *url.URL) (urls.Repository, error) {
+		filePath, err := urls.StoragePath(storageURL)
+		if err != nil {
+			return nil, err
+		}
+		return NewRepository(filePath)
+	})
+}
+
+// NewRepository Инициализирует репозиторий данными из журнала
 func NewRepository(filePath string) (*fileRepository, error) {
-	store, err := readLines(filePath)
+	store, clicks, records, legacy, err := readLines(filePath)
 	if err != nil {
 		return nil, fmt.Errorf("read urls from file error: %w", err)
 	}
 
-	return &fileRepository{
+	r := &fileRepository{
 		store:    store,
+		clicks:   clicks,
 		filePath: filePath,
-	}, nil
+		garbage:  records,
+		doneCh:   make(chan struct{}),
+	}
+
+	// Файл старого формата сразу переписываем снимком в формате журнала
+	if legacy {
+		err = r.compact()
+	} else {
+		err = r.openLog()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open log file error: %w", err)
+	}
+
+	go r.compacting()
+
+	return r, nil
 }
 
-func readLines(filePath string) (map[string]map[string]string, error) {
-	file, err := os.OpenFile(filePath, os.O_CREATE, 0600)
+// readLines Восстанавливает состояние хранилища из журнала.
+// Оборванная концом файла последняя запись отбрасывается, файл обрезается до последней целой записи.
+// Испорченная запись не обрезается: за ней могут идти целые записи, поэтому открытие завершается ошибкой,
+// а файл остается нетронутым
+func readLines(filePath string) (*index.Index, *index.Clicks, int, bool, error) {
+	file, err := os.OpenFile(filePath, os.O_RDWR|os.O_CREATE, 0600)
 	if err != nil {
-		return nil, err
+		return nil, nil, 0, false, err
 	}
 
 	defer func(file *os.File) {
 		_ = file.Close()
 	}(file)
 
-	scanner := bufio.NewScanner(file)
-	res := make(map[string]map[string]string)
+	store := index.New()
+	clicks := index.NewClicks()
+
+	magic := make([]byte, len(logMagic))
+	n, err := io.ReadFull(file, magic)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, nil, 0, false, err
+	}
+
+	// Новый файл, либо падение во время записи заголовка
+	if bytes.HasPrefix([]byte(logMagic), magic[:n]) && n < len(logMagic) {
+		if err = file.Truncate(0); err != nil {
+			return nil, nil, 0, false, err
+		}
+		if _, err = file.WriteAt([]byte(logMagic), 0); err != nil {
+			return nil, nil, 0, false, err
+		}
+		return store, clicks, 0, false, nil
+	}
+
+	// Файл старого формата, целиком закодированный gob
+	if string(magic) != logMagic {
+		if _, err = file.Seek(0, io.SeekStart); err != nil {
+			return nil, nil, 0, false, err
+		}
+
+		data, err := io.ReadAll(file)
+		if err != nil {
+			return nil, nil, 0, false, err
+		}
+
+		store, err = unmarshal(data)
+		if err != nil {
+			return nil, nil, 0, false, err
+		}
 
-	if ok := scanner.Scan(); !ok {
-		return res, nil
+		return store, clicks, 0, true, nil
 	}
 
-	res, err = unmarshal(scanner.Bytes())
+	records, offset, err := replay(file, func(rec record) {
+		applyRecord(store, clicks, rec)
+	})
+	if errors.Is(err, errTornRecord) {
+		logrus.WithError(err).
+			WithField("filePath", filePath).
+			WithField("offset", offset).
+			Warn("torn log record discarded")
+
+		if err = file.Truncate(offset); err != nil {
+			return nil, nil, 0, false, err
+		}
+	}
 	if err != nil {
-		return nil, err
+		return nil, nil, 0, false, fmt.Errorf("read log record at offset %d error: %w", offset, err)
 	}
 
-	return res, nil
+	return store, clicks, records, false, nil
+}
+
+func applyRecord(store *index.Index, clicks *index.Clicks, rec record) {
+	switch rec.Type {
+	case recordAdd, recordAddBatch:
+		for idx := range rec.URLs {
+			store.Put(index.NewLink(rec.URLs[idx], rec.UserID))
+		}
+	case recordDelete:
+		for _, collection := range rec.Collections {
+			for _, urlID := range collection.URLIDs {
+				// Помечаем удаленными только URL, принадлежащие пользователю
+				if store.Owned(urlID, collection.UserID) {
+					store.MarkDeleted(urlID, rec.Time)
+				}
+			}
+		}
+	case recordSnapshot:
+		for idx := range rec.Links {
+			store.Put(rec.Links[idx])
+		}
+	case recordClicks:
+		clicks.Add(rec.Clicks)
+	case recordClickCounts:
+		clicks.AddCounts(rec.ClickCounts)
+	case recordVisitors:
+		// Объединение идемпотентно, поэтому повтор записи при чтении журнала безопасен
+		clicks.MergeVisitors(rec.Visitors)
+	case recordVisitorsDelta:
+		for _, delta := range rec.VisitorsDeltas {
+			clicks.ApplyVisitors(delta.URLID, delta.Day, delta.Registers)
+		}
+	case recordCountClick:
+		// Лимит проверен до записи в журнал
+		if link, ok := store.Get(rec.URLID); ok {
+			link.ClickCount++
+		}
+	case recordUTMTemplate:
+		store.SetUTMTemplate(rec.UserID, rec.UTM)
+	}
 }
 
 // Add Сохраняет URL
-func (r *fileRepository) Add(_ context.Context, urlID, url, userID string) error {
+func (r *fileRepository) Add(_ context.Context, url models.URL, userID string) error {
 	r.ma.Lock()
 	defer r.ma.Unlock()
 
 	// Проверяем не содержится ли в репозитории такой URL
-	if lastURLID, exist := r.urlExist(url); exist {
-		return internalErrors.NewNotUniqueURLErr(lastURLID, url, nil)
+	if lastURLID, exist := r.store.URLID(url.OriginalURL); exist {
+		return internalErrors.NewNotUniqueURLErr(lastURLID, url.OriginalURL, nil)
 	}
 
-	// Извлекаем коллекцию URL пользователя из хранилища, если нет, то создаем новую
-	userStore, ok := r.store[userID]
-	if !ok {
-		userStore = map[string]string{}
+	if _, exist := r.store.Get(url.ShortURL); exist {
+		return internalErrors.NewNotUniqueURLIDErr(url.ShortURL, nil)
 	}
 
-	// Сохраняем коллекцию URL пользователя в хранилище
-	userStore[urlID] = url
-	r.store[userID] = userStore
-
-	return r.save()
-}
-
-func (r *fileRepository) urlExist(url string) (string, bool) {
-	for _, userStore := range r.store {
-		for urlID, originalURL := range userStore {
-			if url == originalURL {
-				return urlID, true
-			}
-		}
-	}
+	// Время создания пишется в журнал, чтобы не меняться при восстановлении
+	url.CreatedAt = time.Now()
 
-	return "", false
+	return r.save(record{
+		Type:   recordAdd,
+		UserID: userID,
+		URLs:   []models.URL{url},
+	})
 }
 
 func (r *fileRepository) AddBatch(_ context.Context, urls []models.URL, userID string) error {
 	r.ma.Lock()
 	defer r.ma.Unlock()
 
-	// Извлекаем коллекцию URL пользователя из хранилища, если нет, то создаем новую
-	userStore, ok := r.store[userID]
-	if !ok {
-		userStore = map[string]string{}
+	// Пакет сохраняется целиком, либо не сохраняется вовсе
+	if lastURLID, url, exist := r.store.Conflict(urls); exist {
+		return internalErrors.NewNotUniqueURLErr(lastURLID, url, nil)
 	}
 
-	// Добавляем URL в коллекцию пользователя, избегая копирования
-	for idx := range urls {
-		userStore[urls[idx].ShortURL] = urls[idx].OriginalURL
+	if urlID, exist := r.store.TakenID(urls); exist {
+		return internalErrors.NewNotUniqueURLIDErr(urlID, nil)
 	}
 
-	// Сохраняем коллекцию URL пользователя в хранилище
-	r.store[userID] = userStore
+	now := time.Now()
+	batch := make([]models.URL, len(urls))
+	for idx := range urls {
+		batch[idx] = urls[idx]
+		batch[idx].CreatedAt = now
+	}
 
-	return r.save()
+	return r.save(record{
+		Type:   recordAddBatch,
+		UserID: userID,
+		URLs:   batch,
+	})
 }
 
-func (r *fileRepository) save() error {
-	file, err := os.OpenFile(r.filePath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+// save Дописывает запись в журнал и только после этого применяет ее к хранилищу
+func (r *fileRepository) save(rec record) error {
+	frame, err := encodeRecord(rec)
 	if err != nil {
-		return fmt.Errorf("open file error: %w", err)
+		return fmt.Errorf("serialize record error: %w", err)
 	}
 
-	defer func(file *os.File) {
-		_ = file.Close()
-	}(file)
-
-	data, err := marshal(r.store)
+	n, err := r.file.Write(frame)
 	if err != nil {
-		return fmt.Errorf("serialize url error: %w", err)
+		// Не оставляем оборванную запись в середине журнала
+		if n > 0 {
+			_ = r.file.Truncate(r.offset)
+		}
+		return fmt.Errorf("write record to file error: %w", err)
 	}
 
-	_, err = file.WriteString(string(data))
-	if err != nil {
-		return fmt.Errorf("write url to file error: %w", err)
-	}
+	r.offset += int64(n)
+	r.garbage++
+	applyRecord(r.store, r.clicks, rec)
 
 	return nil
 }
 
 // Get Возвращает URL
-func (r *fileRepository) Get(_ context.Context, urlID string) (string, error) {
+func (r *fileRepository) Get(_ context.Context, urlID string) (models.URL, error) {
 	r.ma.RLock()
 	defer r.ma.RUnlock()
 
-	for _, userStore := range r.store {
-		if url, ok := userStore[urlID]; ok {
-			return url, nil
-		}
+	link, ok := r.store.Get(urlID)
+	if !ok {
+		return models.URL{}, internalErrors.ErrURLNotFound
 	}
+	if link.Deleted() {
+		return models.URL{}, internalErrors.ErrURLDeleted
+	}
+
+	return link.URL(), nil
+}
+
+// CountClick Учитывает переход по ссылке, если лимит переходов не исчерпан
+func (r *fileRepository) CountClick(_ context.Context, urlID string) error {
+	r.ma.Lock()
+	defer r.ma.Unlock()
+
+	link, ok := r.store.Get(urlID)
+	if !ok {
+		return internalErrors.ErrURLNotFound
+	}
+	if link.Deleted() {
+		return internalErrors.ErrURLDeleted
+	}
+	if !link.ClicksLeft() {
+		return internalErrors.ErrClickLimit
+	}
+
+	return r.save(record{
+		Type:  recordCountClick,
+		URLID: urlID,
+	})
+}
+
+// SetUTMTemplate Сохраняет шаблон UTM-меток пользователя, nil удаляет шаблон
+func (r *fileRepository) SetUTMTemplate(_ context.Context, userID string, utm *models.UTM) error {
+	r.ma.Lock()
+	defer r.ma.Unlock()
 
-	return "", internalErrors.ErrURLNotFound
+	return r.save(record{
+		Type:   recordUTMTemplate,
+		UserID: userID,
+		UTM:    utm,
+	})
+}
+
+// GetUTMTemplate Возвращает шаблон UTM-меток пользователя, nil если шаблона нет
+func (r *fileRepository) GetUTMTemplate(_ context.Context, userID string) (*models.UTM, error) {
+	r.ma.RLock()
+	defer r.ma.RUnlock()
+
+	utm, _ := r.store.UTMTemplate(userID)
+
+	return utm, nil
 }
 
 // GetList Возвращает список всех сокращенных URL
@@ -155,45 +336,82 @@ func (r *fileRepository) GetList(_ context.Context, userID string) ([]models.URL
 	r.ma.RLock()
 	defer r.ma.RUnlock()
 
-	urls := make([]models.URL, 0)
+	return r.store.List(userID), nil
+}
 
-	userStore, ok := r.store[userID]
-	if !ok {
-		return urls, nil
-	}
+// GetByUser Возвращает действующую ссылку пользователя
+func (r *fileRepository) GetByUser(_ context.Context, urlID, userID string) (models.URL, error) {
+	r.ma.RLock()
+	defer r.ma.RUnlock()
 
-	for shortURL, originalURL := range userStore {
-		urls = append(urls, models.URL{
-			ShortURL:    shortURL,
-			OriginalURL: originalURL,
-		})
+	url, ok := r.store.UserURL(urlID, userID)
+	if !ok {
+		return models.URL{}, internalErrors.ErrURLNotFound
 	}
 
-	return urls, nil
+	return url, nil
 }
 
 // Delete Удаляет список URL указанного пользователя
-func (r *fileRepository) Delete(ctx context.Context, urlsBatch []models.UserCollection) error {
+func (r *fileRepository) Delete(_ context.Context, urlsBatch []models.UserCollection) error {
+	r.ma.Lock()
+	defer r.ma.Unlock()
+
+	return r.save(record{
+		Type:        recordDelete,
+		Collections: urlsBatch,
+		Time:        time.Now(),
+	})
+}
+
+// AddClicks Сохраняет переходы по ссылкам
+func (r *fileRepository) AddClicks(_ context.Context, clicks []models.Click) error {
+	r.ma.Lock()
+	defer r.ma.Unlock()
+
+	return r.save(record{
+		Type:   recordClicks,
+		Clicks: clicks,
+	})
+}
+
+// GetClickCounts Возвращает количества переходов по ссылке за минуты, начавшиеся в [from, to)
+func (r *fileRepository) GetClickCounts(_ context.Context, urlID string, from, to time.Time) ([]models.ClickCount, error) {
 	r.ma.RLock()
 	defer r.ma.RUnlock()
 
-	for _, collection := range urlsBatch {
-		// Извлекаем коллекцию URL пользователя из хранилища
-		userStore, ok := r.store[collection.UserID]
-		if !ok {
-			return nil
-		}
+	return r.clicks.Range(urlID, from, to), nil
+}
 
-		// Удаляем указанные URL из репозитория
-		for _, urlID := range collection.URLIDs {
-			delete(userStore, urlID)
-		}
+// MergeVisitors Объединяет суточные оценки посетителей с сохраненными
+func (r *fileRepository) MergeVisitors(_ context.Context, visitors []models.DailyVisitors) error {
+	r.ma.Lock()
+	defer r.ma.Unlock()
 
-		// Сохраняем коллекцию URL пользователя в хранилище
-		r.store[collection.UserID] = userStore
+	// В журнал пишем только выросшие регистры, а не оценки целиком:
+	// полные оценки попадают в журнал только при компактизации
+	deltas := make([]visitorsDelta, 0, len(visitors))
+	for _, v := range visitors {
+		if regs := r.clicks.VisitorsDiff(v); len(regs) > 0 {
+			deltas = append(deltas, visitorsDelta{URLID: v.URLID, Day: v.Day.UTC(), Registers: regs})
+		}
 	}
+	if len(deltas) == 0 {
+		return nil
+	}
+
+	return r.save(record{
+		Type:           recordVisitorsDelta,
+		VisitorsDeltas: deltas,
+	})
+}
+
+// GetVisitors Возвращает суточные оценки посетителей ссылки за сутки, начавшиеся в [from, to)
+func (r *fileRepository) GetVisitors(_ context.Context, urlID string, from, to time.Time) ([]models.DailyVisitors, error) {
+	r.ma.RLock()
+	defer r.ma.RUnlock()
 
-	return r.save()
+	return r.clicks.Visitors(urlID, from, to), nil
 }
 
 // Ping Проверяет доступность базы данных
@@ -201,33 +419,238 @@ func (r *fileRepository) Ping(_ context.Context) error {
 	return nil
 }
 
-// Close Закрывает соединение
+// Close Останавливает компактизацию и закрывает журнал
+// Повторный вызов ничего не делает
 func (r *fileRepository) Close() error {
+	r.closeOnce.Do(func() {
+		close(r.doneCh)
+	})
+
+	r.ma.Lock()
+	defer r.ma.Unlock()
+
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+
+	if err := r.file.Sync(); err != nil {
+		return err
+	}
+
+	return r.file.Close()
+}
+
+func (r *fileRepository) openLog() error {
+	file, err := os.OpenFile(r.filePath, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	r.file = file
+	r.offset = info.Size()
+
 	return nil
 }
 
-func marshal(store map[string]map[string]string) ([]byte, error) {
-	var buff bytes.Buffer
-	encoder := gob.NewEncoder(&buff)
+// compacting Периодически переписывает журнал снимком текущего состояния
+func (r *fileRepository) compacting() {
+	ticker := time.NewTicker(compactInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			r.ma.RLock()
+			garbage := r.garbage
+			r.ma.RUnlock()
+
+			if garbage >= compactThreshold {
+				if err := r.compact(); err != nil {
+					logrus.WithError(err).WithField("filePath", r.filePath).Error("compact log error")
+				}
+			}
+		case <-r.doneCh:
+			return
+		}
+	}
+}
 
-	err := encoder.Encode(store)
+// compact Записывает снимок во временный файл и атомарно подменяет им журнал
+func (r *fileRepository) compact() error {
+	tmpPath := r.filePath + ".tmp"
+	defer func() {
+		_ = os.Remove(tmpPath)
+	}()
+
+	offset, garbage, err := r.writeSnapshot(tmpPath)
 	if err != nil {
-		return nil, err
+		return err
+	}
+
+	return r.replaceLog(tmpPath, offset, garbage)
+}
+
+// writeSnapshot Записывает снимок во временный файл.
+// Снимок собирается под блокировкой на чтение, запись на диск идет без блокировки.
+// Возвращает позицию журнала и число записей, которые покрывает снимок
+func (r *fileRepository) writeSnapshot(tmpPath string) (int64, int, error) {
+	r.ma.RLock()
+	snapshot, err := r.snapshot()
+	offset, garbage := r.offset, r.garbage
+	r.ma.RUnlock()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	tmp, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tmp.Close()
+
+	if _, err = tmp.Write(snapshot); err != nil {
+		return 0, 0, err
+	}
+	if err = tmp.Sync(); err != nil {
+		return 0, 0, err
+	}
+
+	return offset, garbage, nil
+}
+
+// replaceLog Дописывает к снимку записи, появившиеся в журнале после offset, и подменяет им журнал.
+// Блокировка на запись берется только на это время
+func (r *fileRepository) replaceLog(tmpPath string, offset int64, garbage int) error {
+	r.ma.Lock()
+	defer r.ma.Unlock()
+
+	if r.closed {
+		return errClosed
+	}
+
+	tmp, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	defer tmp.Close()
+
+	if tail := r.offset - offset; tail > 0 {
+		if err = copyTail(tmp, r.filePath, offset, tail); err != nil {
+			return err
+		}
+	}
+	if err = tmp.Sync(); err != nil {
+		return err
+	}
+	if err = os.Rename(tmpPath, r.filePath); err != nil {
+		return err
+	}
+
+	if r.file != nil {
+		_ = r.file.Close()
+	}
+	if err = r.openLog(); err != nil {
+		return err
+	}
+
+	r.garbage -= garbage
+	logrus.WithField("filePath", r.filePath).WithField("tail", r.garbage).Info("log compacted")
+
+	return nil
+}
+
+// snapshot Кодирует текущее состояние хранилища в записи журнала.
+// Вызывается под блокировкой на чтение
+func (r *fileRepository) snapshot() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(logMagic)
+
+	write := func(rec record) error {
+		frame, err := encodeRecord(rec)
+		if err != nil {
+			return err
+		}
+		buf.Write(frame)
+		return nil
 	}
 
-	return buff.Bytes(), nil
+	for _, userID := range r.store.UserIDs() {
+		if err := write(record{Type: recordSnapshot, Links: r.store.Links(userID)}); err != nil {
+			return nil, err
+		}
+	}
+
+	for userID, utm := range r.store.UTMTemplates() {
+		utm := utm
+		if err := write(record{Type: recordUTMTemplate, UserID: userID, UTM: &utm}); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, urlID := range r.clicks.URLIDs() {
+		counts := r.clicks.All(urlID)
+		for start := 0; start < len(counts); start += snapshotClicksSize {
+			end := start + snapshotClicksSize
+			if end > len(counts) {
+				end = len(counts)
+			}
+
+			if err := write(record{Type: recordClickCounts, ClickCounts: counts[start:end]}); err != nil {
+				return nil, err
+			}
+		}
+
+		if visitors := r.clicks.AllVisitors(urlID); len(visitors) > 0 {
+			if err := write(record{Type: recordVisitors, Visitors: visitors}); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// copyTail Копирует size байт журнала начиная с offset в конец w
+func copyTail(w io.Writer, filePath string, offset, size int64) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if _, err = file.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	_, err = io.CopyN(w, file, size)
+	return err
 }
 
-func unmarshal(data []byte) (map[string]map[string]string, error) {
-	store := map[string]map[string]string{}
+// unmarshal Декодирует файл старого формата
+func unmarshal(data []byte) (*index.Index, error) {
+	legacy := map[string]map[string]string{}
 
 	buff := bytes.NewBuffer(data)
 	decoder := gob.NewDecoder(buff)
 
-	err := decoder.Decode(&store)
+	err := decoder.Decode(&legacy)
 	if err != nil {
 		return nil, err
 	}
 
+	store := index.New()
+	for userID, userStore := range legacy {
+		for urlID, url := range userStore {
+			store.Put(index.Link{URLID: urlID, OriginalURL: url, UserID: userID})
+		}
+	}
+
 	return store, nil
 }
@@ -1,13 +1,20 @@
 package file
 
 import (
+	"bytes"
 	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
 	"os"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/bgoldovsky/shortener/internal/app/hll"
 	"github.com/bgoldovsky/shortener/internal/app/models"
 	internalErrors "github.com/bgoldovsky/shortener/internal/app/repositories/urls/errors"
 )
@@ -28,7 +35,7 @@ func TestFileRepo_Add(t *testing.T) {
 		_ = os.Remove(filePath)
 	}()
 
-	err = repo.Add(ctx, "qwerty", url, defaultUserID)
+	err = repo.Add(ctx, models.URL{ShortURL: "qwerty", OriginalURL: url}, defaultUserID)
 
 	assert.NoError(t, err)
 }
@@ -44,10 +51,10 @@ func TestFileRepo_Add_Conflict(t *testing.T) {
 		_ = os.Remove(filePath)
 	}()
 
-	err = repo.Add(ctx, "qwerty", url, defaultUserID)
+	err = repo.Add(ctx, models.URL{ShortURL: "qwerty", OriginalURL: url}, defaultUserID)
 	require.NoError(t, err)
 
-	err = repo.Add(ctx, "qwerty", url, defaultUserID)
+	err = repo.Add(ctx, models.URL{ShortURL: "qwerty", OriginalURL: url}, defaultUserID)
 	require.Error(t, err)
 
 	assert.IsType(t, &internalErrors.NotUniqueURLErr{}, err)
@@ -64,13 +71,13 @@ func TestFileRepo_Get(t *testing.T) {
 		_ = os.Remove(filePath)
 	}()
 
-	err = repo.Add(ctx, "qwerty", url, defaultUserID)
+	err = repo.Add(ctx, models.URL{ShortURL: "qwerty", OriginalURL: url}, defaultUserID)
 	require.NoError(t, err)
 
 	act, err := repo.Get(ctx, "qwerty")
 
 	assert.NoError(t, err)
-	assert.Equal(t, "avito.ru", act)
+	assert.Equal(t, "avito.ru", act.OriginalURL)
 }
 
 func TestFileRepo_Empty(t *testing.T) {
@@ -86,7 +93,7 @@ func TestFileRepo_Empty(t *testing.T) {
 	act, err := repo.Get(ctx, "qwerty")
 
 	assert.Error(t, err, "url not found")
-	assert.Equal(t, "", act)
+	assert.Equal(t, models.URL{}, act)
 }
 
 func TestFileRepo_Get_RestoreData(t *testing.T) {
@@ -99,10 +106,10 @@ func TestFileRepo_Get_RestoreData(t *testing.T) {
 		_ = os.Remove(filePath)
 	}()
 
-	err = repo.Add(ctx, "qwerty", "avito.ru", defaultUserID)
+	err = repo.Add(ctx, models.URL{ShortURL: "qwerty", OriginalURL: "avito.ru"}, defaultUserID)
 	require.NoError(t, err)
 
-	err = repo.Add(ctx, "ytrewq", "yandex.ru", defaultUserID)
+	err = repo.Add(ctx, models.URL{ShortURL: "ytrewq", OriginalURL: "yandex.ru"}, defaultUserID)
 	require.NoError(t, err)
 
 	repo, err = NewRepository(filePath)
@@ -111,7 +118,112 @@ func TestFileRepo_Get_RestoreData(t *testing.T) {
 	act, err := repo.Get(ctx, "ytrewq")
 	require.NoError(t, err)
 
-	assert.Equal(t, "yandex.ru", act)
+	assert.Equal(t, "yandex.ru", act.OriginalURL)
+}
+
+func TestFileRepo_Get_RestoreExpiration(t *testing.T) {
+	ctx := context.Background()
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+
+	repo, err := NewRepository(filePath)
+	require.NoError(t, err)
+
+	defer func() {
+		_ = os.Remove(filePath)
+	}()
+
+	err = repo.Add(ctx, models.URL{ShortURL: "qwerty", OriginalURL: "avito.ru", ExpiresAt: &expiresAt}, defaultUserID)
+	require.NoError(t, err)
+
+	// Срок действия переживает и воспроизведение журнала, и его сжатие
+	for _, compact := range []bool{false, true} {
+		if compact {
+			err = repo.compact()
+			require.NoError(t, err)
+		}
+		require.NoError(t, repo.Close())
+
+		repo, err = NewRepository(filePath)
+		require.NoError(t, err)
+
+		act, err := repo.Get(ctx, "qwerty")
+		require.NoError(t, err)
+		require.NotNil(t, act.ExpiresAt)
+		assert.True(t, expiresAt.Equal(*act.ExpiresAt))
+	}
+}
+
+func TestFileRepo_CountClick_RestoreData(t *testing.T) {
+	ctx := context.Background()
+
+	repo, err := NewRepository(filePath)
+	require.NoError(t, err)
+
+	defer func() {
+		_ = os.Remove(filePath)
+	}()
+
+	err = repo.Add(ctx, models.URL{ShortURL: "qwerty", OriginalURL: "avito.ru", MaxClicks: 2}, defaultUserID)
+	require.NoError(t, err)
+	require.NoError(t, repo.CountClick(ctx, "qwerty"))
+
+	// Учтенные переходы переживают и воспроизведение журнала, и его сжатие
+	for _, compact := range []bool{false, true} {
+		if compact {
+			err = repo.compact()
+			require.NoError(t, err)
+		}
+		require.NoError(t, repo.Close())
+
+		repo, err = NewRepository(filePath)
+		require.NoError(t, err)
+
+		act, err := repo.Get(ctx, "qwerty")
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), act.ClickCount)
+	}
+
+	require.NoError(t, repo.CountClick(ctx, "qwerty"))
+	assert.ErrorIs(t, repo.CountClick(ctx, "qwerty"), internalErrors.ErrClickLimit)
+	require.NoError(t, repo.Close())
+}
+
+func TestFileRepo_UTMTemplate_RestoreData(t *testing.T) {
+	ctx := context.Background()
+
+	repo, err := NewRepository(filePath)
+	require.NoError(t, err)
+
+	defer func() {
+		_ = os.Remove(filePath)
+	}()
+
+	template := &models.UTM{Source: "newsletter", Medium: "email"}
+	require.NoError(t, repo.SetUTMTemplate(ctx, defaultUserID, template))
+	require.NoError(t, repo.SetUTMTemplate(ctx, "user456", &models.UTM{Source: "ads"}))
+	require.NoError(t, repo.SetUTMTemplate(ctx, "user456", nil))
+
+	// Шаблоны переживают и воспроизведение журнала, и его сжатие
+	for _, compact := range []bool{false, true} {
+		if compact {
+			err = repo.compact()
+			require.NoError(t, err)
+		}
+		require.NoError(t, repo.Close())
+
+		repo, err = NewRepository(filePath)
+		require.NoError(t, err)
+
+		act, err := repo.GetUTMTemplate(ctx, defaultUserID)
+		require.NoError(t, err)
+		assert.Equal(t, template, act)
+
+		act, err = repo.GetUTMTemplate(ctx, "user456")
+		require.NoError(t, err)
+		assert.Nil(t, act)
+	}
+
+	require.NoError(t, repo.Close())
 }
 
 func TestFileRepo_GetList_Success(t *testing.T) {
@@ -124,10 +236,10 @@ func TestFileRepo_GetList_Success(t *testing.T) {
 		_ = os.Remove(filePath)
 	}()
 
-	err = repo.Add(ctx, "qwerty", "avito.ru", defaultUserID)
+	err = repo.Add(ctx, models.URL{ShortURL: "qwerty", OriginalURL: "avito.ru"}, defaultUserID)
 	require.NoError(t, err)
 
-	err = repo.Add(ctx, "ytrewq", "yandex.ru", defaultUserID)
+	err = repo.Add(ctx, models.URL{ShortURL: "ytrewq", OriginalURL: "yandex.ru"}, defaultUserID)
 	require.NoError(t, err)
 
 	repo, err = NewRepository(filePath)
@@ -151,10 +263,10 @@ func TestFileRepository_Delete(t *testing.T) {
 
 	urlIDs := []string{"qwerty", "ytrewq"}
 
-	err = repo.Add(ctx, urlIDs[0], "avito.ru", defaultUserID)
+	err = repo.Add(ctx, models.URL{ShortURL: urlIDs[0], OriginalURL: "avito.ru"}, defaultUserID)
 	require.NoError(t, err)
 
-	err = repo.Add(ctx, urlIDs[1], "yandex.ru", defaultUserID)
+	err = repo.Add(ctx, models.URL{ShortURL: urlIDs[1], OriginalURL: "yandex.ru"}, defaultUserID)
 	require.NoError(t, err)
 
 	repo, err = NewRepository(filePath)
@@ -172,6 +284,54 @@ func TestFileRepository_Delete(t *testing.T) {
 	assert.Empty(t, act)
 }
 
+func TestFileRepository_Delete_RestoreData(t *testing.T) {
+	ctx := context.Background()
+
+	repo, err := NewRepository(filePath)
+	require.NoError(t, err)
+
+	defer func() {
+		_ = os.Remove(filePath)
+	}()
+
+	err = repo.Add(ctx, models.URL{ShortURL: "qwerty", OriginalURL: "avito.ru"}, defaultUserID)
+	require.NoError(t, err)
+
+	err = repo.Delete(ctx, []models.UserCollection{{UserID: defaultUserID, URLIDs: []string{"qwerty"}}})
+	require.NoError(t, err)
+
+	_, err = repo.Get(ctx, "qwerty")
+	require.Equal(t, internalErrors.ErrURLDeleted, err)
+
+	// Удаленный URL можно сократить повторно
+	err = repo.Add(ctx, models.URL{ShortURL: "ytrewq", OriginalURL: "avito.ru"}, defaultUserID)
+	require.NoError(t, err)
+	require.NoError(t, repo.Close())
+
+	repo, err = NewRepository(filePath)
+	require.NoError(t, err)
+
+	_, err = repo.Get(ctx, "qwerty")
+	assert.Equal(t, internalErrors.ErrURLDeleted, err)
+
+	// Пометка удаления переживает компактизацию журнала
+	err = repo.compact()
+	require.NoError(t, err)
+	require.NoError(t, repo.Close())
+
+	repo, err = NewRepository(filePath)
+	require.NoError(t, err)
+
+	_, err = repo.Get(ctx, "qwerty")
+	assert.Equal(t, internalErrors.ErrURLDeleted, err)
+
+	act, err := repo.GetList(ctx, defaultUserID)
+	require.NoError(t, err)
+	require.Len(t, act, 1)
+	assert.Equal(t, "ytrewq", act[0].ShortURL)
+	assert.Equal(t, "avito.ru", act[0].OriginalURL)
+}
+
 func TestFileRepo_GetList_NotFound(t *testing.T) {
 	ctx := context.Background()
 
@@ -182,10 +342,10 @@ func TestFileRepo_GetList_NotFound(t *testing.T) {
 		_ = os.Remove(filePath)
 	}()
 
-	err = repo.Add(ctx, "qwerty", "avito.ru", defaultUserID)
+	err = repo.Add(ctx, models.URL{ShortURL: "qwerty", OriginalURL: "avito.ru"}, defaultUserID)
 	require.NoError(t, err)
 
-	err = repo.Add(ctx, "ytrewq", "yandex.ru", defaultUserID)
+	err = repo.Add(ctx, models.URL{ShortURL: "ytrewq", OriginalURL: "yandex.ru"}, defaultUserID)
 	require.NoError(t, err)
 
 	repo, err = NewRepository(filePath)
@@ -210,3 +370,370 @@ func TestFileRepo_Ping(t *testing.T) {
 	err = repo.Ping(ctx)
 	assert.NoError(t, err)
 }
+
+func TestFileRepo_RestoreData_TornRecord(t *testing.T) {
+	ctx := context.Background()
+
+	repo, err := NewRepository(filePath)
+	require.NoError(t, err)
+
+	defer func() {
+		_ = os.Remove(filePath)
+	}()
+
+	err = repo.Add(ctx, models.URL{ShortURL: "qwerty", OriginalURL: "avito.ru"}, defaultUserID)
+	require.NoError(t, err)
+
+	err = repo.Add(ctx, models.URL{ShortURL: "ytrewq", OriginalURL: "yandex.ru"}, defaultUserID)
+	require.NoError(t, err)
+	require.NoError(t, repo.Close())
+
+	// Имитируем падение посреди записи последней записи журнала
+	info, err := os.Stat(filePath)
+	require.NoError(t, err)
+	require.NoError(t, os.Truncate(filePath, info.Size()-3))
+
+	repo, err = NewRepository(filePath)
+	require.NoError(t, err)
+
+	act, err := repo.Get(ctx, "qwerty")
+	require.NoError(t, err)
+	assert.Equal(t, "avito.ru", act.OriginalURL)
+
+	_, err = repo.Get(ctx, "ytrewq")
+	assert.Equal(t, internalErrors.ErrURLNotFound, err)
+
+	// После обрезки журнала новые записи снова восстанавливаются
+	err = repo.Add(ctx, models.URL{ShortURL: "asdfgh", OriginalURL: "ozon.ru"}, defaultUserID)
+	require.NoError(t, err)
+	require.NoError(t, repo.Close())
+
+	repo, err = NewRepository(filePath)
+	require.NoError(t, err)
+
+	act, err = repo.Get(ctx, "asdfgh")
+	require.NoError(t, err)
+	assert.Equal(t, "ozon.ru", act.OriginalURL)
+}
+
+func TestFileRepo_RestoreData_CorruptRecord(t *testing.T) {
+	add, err := encodeRecord(record{Type: recordAdd, UserID: defaultUserID, URLs: []models.URL{{ShortURL: "qwerty", OriginalURL: "avito.ru"}}})
+	require.NoError(t, err)
+	last, err := encodeRecord(record{Type: recordAdd, UserID: defaultUserID, URLs: []models.URL{{ShortURL: "ytrewq", OriginalURL: "yandex.ru"}}})
+	require.NoError(t, err)
+	unknown, err := encodeRecord(record{Type: recordTypesEnd + 10})
+	require.NoError(t, err)
+
+	flipped := append([]byte(nil), add...)
+	flipped[frameHeaderSize+1] ^= 0xff
+
+	tests := []struct {
+		name  string
+		frame []byte
+	}{
+		{name: "checksum mismatch", frame: flipped},
+		{name: "unknown record type", frame: unknown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				_ = os.Remove(filePath)
+			}()
+
+			data := append([]byte(logMagic), add...)
+			data = append(data, tt.frame...)
+			data = append(data, last...)
+			require.NoError(t, os.WriteFile(filePath, data, 0600))
+
+			// Испорченная запись посреди журнала не обрезает записи после нее
+			_, err := NewRepository(filePath)
+			require.Error(t, err)
+			assert.True(t, errors.Is(err, errCorruptRecord))
+
+			act, err := os.ReadFile(filePath)
+			require.NoError(t, err)
+			assert.Equal(t, data, act)
+		})
+	}
+}
+
+func TestFileRepo_Compact(t *testing.T) {
+	ctx := context.Background()
+	start := time.Now()
+
+	repo, err := NewRepository(filePath)
+	require.NoError(t, err)
+
+	defer func() {
+		_ = os.Remove(filePath)
+	}()
+
+	err = repo.AddBatch(ctx, []models.URL{
+		{ShortURL: "qwerty", OriginalURL: "avito.ru"},
+		{ShortURL: "ytrewq", OriginalURL: "yandex.ru"},
+	}, defaultUserID)
+	require.NoError(t, err)
+
+	err = repo.Delete(ctx, []models.UserCollection{{UserID: defaultUserID, URLIDs: []string{"qwerty"}}})
+	require.NoError(t, err)
+
+	before, err := os.Stat(filePath)
+	require.NoError(t, err)
+
+	err = repo.compact()
+	require.NoError(t, err)
+
+	after, err := os.Stat(filePath)
+	require.NoError(t, err)
+	assert.True(t, after.Size() < before.Size())
+
+	err = repo.Add(ctx, models.URL{ShortURL: "asdfgh", OriginalURL: "ozon.ru"}, defaultUserID)
+	require.NoError(t, err)
+	require.NoError(t, repo.Close())
+
+	reopened := time.Now()
+	repo, err = NewRepository(filePath)
+	require.NoError(t, err)
+
+	act, err := repo.GetList(ctx, defaultUserID)
+	require.NoError(t, err)
+	require.Len(t, act, 2)
+
+	// Время создания восстанавливается из журнала и снимка, а не назначается заново
+	originals := map[string]string{}
+	for _, url := range act {
+		originals[url.ShortURL] = url.OriginalURL
+		assert.False(t, url.CreatedAt.Before(start), url.ShortURL)
+		assert.True(t, url.CreatedAt.Before(reopened), url.ShortURL)
+	}
+	assert.Equal(t, map[string]string{"ytrewq": "yandex.ru", "asdfgh": "ozon.ru"}, originals)
+}
+
+func TestFileRepo_Compact_WritesDuringSnapshot(t *testing.T) {
+	ctx := context.Background()
+	tmpPath := filePath + ".tmp"
+
+	repo, err := NewRepository(filePath)
+	require.NoError(t, err)
+
+	defer func() {
+		_ = os.Remove(filePath)
+		_ = os.Remove(tmpPath)
+	}()
+
+	err = repo.Add(ctx, models.URL{ShortURL: "qwerty", OriginalURL: "avito.ru"}, defaultUserID)
+	require.NoError(t, err)
+
+	offset, garbage, err := repo.writeSnapshot(tmpPath)
+	require.NoError(t, err)
+
+	// Запись, сделанная после снимка, но до подмены журнала, не теряется
+	err = repo.Add(ctx, models.URL{ShortURL: "ytrewq", OriginalURL: "yandex.ru"}, defaultUserID)
+	require.NoError(t, err)
+
+	act, err := repo.Get(ctx, "qwerty")
+	require.NoError(t, err)
+	assert.Equal(t, "avito.ru", act.OriginalURL)
+
+	err = repo.replaceLog(tmpPath, offset, garbage)
+	require.NoError(t, err)
+	assert.Equal(t, 1, repo.garbage)
+	require.NoError(t, repo.Close())
+
+	repo, err = NewRepository(filePath)
+	require.NoError(t, err)
+	defer func() {
+		_ = repo.Close()
+	}()
+
+	list, err := repo.GetList(ctx, defaultUserID)
+	require.NoError(t, err)
+	assert.Len(t, list, 2)
+}
+
+func TestFileRepo_Close_Twice(t *testing.T) {
+	repo, err := NewRepository(filePath)
+	require.NoError(t, err)
+
+	defer func() {
+		_ = os.Remove(filePath)
+	}()
+
+	require.NoError(t, repo.Close())
+	assert.NoError(t, repo.Close())
+}
+
+func TestFileRepo_RestoreData_Legacy(t *testing.T) {
+	ctx := context.Background()
+
+	var buff bytes.Buffer
+	err := gob.NewEncoder(&buff).Encode(map[string]map[string]string{
+		defaultUserID: {"qwerty": "avito.ru"},
+	})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filePath, buff.Bytes(), 0600))
+
+	defer func() {
+		_ = os.Remove(filePath)
+	}()
+
+	repo, err := NewRepository(filePath)
+	require.NoError(t, err)
+
+	act, err := repo.Get(ctx, "qwerty")
+	require.NoError(t, err)
+	assert.Equal(t, "avito.ru", act.OriginalURL)
+	require.NoError(t, repo.Close())
+
+	data, err := os.ReadFile(filePath)
+	require.NoError(t, err)
+	assert.True(t, bytes.HasPrefix(data, []byte(logMagic)))
+}
+
+var benchmarkSizes = []int{1_000, 1_000_000}
+
+func fillRepo(b *testing.B, repo *fileRepository, size int) {
+	ctx := context.Background()
+	batch := make([]models.URL, 0, 10_000)
+
+	for i := 0; i < size; i++ {
+		id := strconv.Itoa(i)
+		batch = append(batch, models.URL{ShortURL: id, OriginalURL: "https://bench.ru/" + id})
+
+		if len(batch) == cap(batch) || i == size-1 {
+			err := repo.AddBatch(ctx, batch, "user"+strconv.Itoa(i%1_000))
+			require.NoError(b, err)
+			batch = batch[:0]
+		}
+	}
+}
+
+func BenchmarkFileRepo_Add(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		b.Run(fmt.Sprintf("links=%d", size), func(b *testing.B) {
+			ctx := context.Background()
+
+			repo, err := NewRepository(filePath)
+			require.NoError(b, err)
+
+			defer func() {
+				_ = repo.Close()
+				_ = os.Remove(filePath)
+			}()
+
+			fillRepo(b, repo, size)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				id := strconv.Itoa(size + i)
+				_ = repo.Add(ctx, models.URL{ShortURL: id, OriginalURL: "https://bench.ru/" + id}, defaultUserID)
+			}
+		})
+	}
+}
+
+func BenchmarkFileRepo_Get(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		b.Run(fmt.Sprintf("links=%d", size), func(b *testing.B) {
+			ctx := context.Background()
+
+			repo, err := NewRepository(filePath)
+			require.NoError(b, err)
+
+			defer func() {
+				_ = repo.Close()
+				_ = os.Remove(filePath)
+			}()
+
+			fillRepo(b, repo, size)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				_, _ = repo.Get(ctx, strconv.Itoa(i%size))
+			}
+		})
+	}
+}
+
+func TestFileRepo_GetClickCounts_RestoreAfterCompact(t *testing.T) {
+	ctx := context.Background()
+	base := time.Date(2022, 5, 1, 12, 0, 0, 0, time.UTC)
+	day := base.Truncate(time.Hour * 24)
+
+	repo, err := NewRepository(filePath)
+	require.NoError(t, err)
+
+	defer func() {
+		_ = os.Remove(filePath)
+	}()
+
+	err = repo.AddClicks(ctx, []models.Click{
+		{URLID: "qwerty", Time: base, UserAgent: "curl/7.79"},
+		{URLID: "qwerty", Time: base.Add(time.Second)},
+		{URLID: "qwerty", Time: base.Add(time.Minute)},
+	})
+	require.NoError(t, err)
+
+	sketch := hll.New()
+	sketch.Add(hll.Hash("10.0.0.1"))
+	err = repo.MergeVisitors(ctx, []models.DailyVisitors{{URLID: "qwerty", Day: day, Sketch: sketch}})
+	require.NoError(t, err)
+
+	exp := []models.ClickCount{
+		{URLID: "qwerty", Minute: base, Count: 2},
+		{URLID: "qwerty", Minute: base.Add(time.Minute), Count: 1},
+	}
+
+	// Переходы и посетители переживают и повторное чтение журнала, и компактизацию
+	for _, compact := range []bool{false, true} {
+		if compact {
+			err = repo.compact()
+			require.NoError(t, err)
+		}
+		require.NoError(t, repo.Close())
+
+		repo, err = NewRepository(filePath)
+		require.NoError(t, err)
+
+		act, err := repo.GetClickCounts(ctx, "qwerty", base, base.Add(time.Hour))
+		require.NoError(t, err)
+		assert.Equal(t, exp, act)
+
+		visitors, err := repo.GetVisitors(ctx, "qwerty", day, day.Add(time.Hour*24))
+		require.NoError(t, err)
+		require.Len(t, visitors, 1)
+		assert.Equal(t, uint64(1), visitors[0].Sketch.Count())
+	}
+	require.NoError(t, repo.Close())
+}
+
+func TestFileRepo_MergeVisitors_Delta(t *testing.T) {
+	ctx := context.Background()
+	day := time.Date(2022, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	repo, err := NewRepository(filePath)
+	require.NoError(t, err)
+
+	defer func() {
+		_ = os.Remove(filePath)
+		_ = repo.Close()
+	}()
+
+	sketch := hll.New()
+	sketch.Add(hll.Hash("10.0.0.1"))
+	visitors := []models.DailyVisitors{{URLID: "qwerty", Day: day, Sketch: sketch}}
+
+	full, err := encodeRecord(record{Type: recordVisitors, Visitors: visitors})
+	require.NoError(t, err)
+
+	// В журнал попадают только выросшие регистры, а не оценка целиком
+	offset := repo.offset
+	require.NoError(t, repo.MergeVisitors(ctx, visitors))
+	assert.Less(t, repo.offset-offset, int64(len(full))/2)
+
+	// Объединение, которое ничего не меняет, не пишется в журнал
+	offset = repo.offset
+	require.NoError(t, repo.MergeVisitors(ctx, visitors))
+	assert.Equal(t, offset, repo.offset)
+}
@@ -0,0 +1,152 @@
+package file
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"time"
+
+	"github.com/bgoldovsky/shortener/internal/app/hll"
+	"github.com/bgoldovsky/shortener/internal/app/models"
+	"github.com/bgoldovsky/shortener/internal/app/repositories/urls/index"
+)
+
+// Формат журнала: заголовок logMagic, за которым следуют кадры вида
+// [длина payload uint32][crc32 payload uint32][payload в gob]
+const (
+	logMagic        = "SHRTLOG1"
+	frameHeaderSize = 8
+	maxRecordSize   = 64 << 20
+)
+
+var (
+	// errTornRecord Запись оборвана концом файла: падение во время записи, ее можно отбросить
+	errTornRecord = errors.New("torn log record")
+	// errCorruptRecord Запись целиком на месте, но не читается: за ней могут быть целые записи
+	errCorruptRecord = errors.New("corrupt log record")
+)
+
+type recordType uint8
+
+const (
+	recordAdd recordType = iota + 1
+	recordAddBatch
+	recordDelete
+	recordSnapshot
+	recordClicks
+	recordVisitors
+	recordCountClick
+	recordUTMTemplate
+	recordClickCounts
+	recordVisitorsDelta
+
+	// recordTypesEnd Граница известных типов записей, новые типы добавляются перед ней
+	recordTypesEnd
+)
+
+// record Одна мутация хранилища
+type record struct {
+	Type        recordType
+	UserID      string
+	URLs        []models.URL
+	Collections []models.UserCollection
+	Links       []index.Link
+	Clicks      []models.Click
+	Visitors    []models.DailyVisitors
+	Time        time.Time
+	URLID       string
+	UTM         *models.UTM
+
+	ClickCounts    []models.ClickCount
+	VisitorsDeltas []visitorsDelta
+}
+
+// visitorsDelta Регистры суточной оценки посетителей ссылки, выросшие при объединении
+type visitorsDelta struct {
+	URLID     string
+	Day       time.Time
+	Registers []hll.Register
+}
+
+func encodeRecord(rec record) ([]byte, error) {
+	var payload bytes.Buffer
+	if err := gob.NewEncoder(&payload).Encode(rec); err != nil {
+		return nil, err
+	}
+
+	frame := make([]byte, frameHeaderSize+payload.Len())
+	binary.BigEndian.PutUint32(frame[0:4], uint32(payload.Len()))
+	binary.BigEndian.PutUint32(frame[4:8], crc32.ChecksumIEEE(payload.Bytes()))
+	copy(frame[frameHeaderSize:], payload.Bytes())
+
+	return frame, nil
+}
+
+func decodeRecord(r io.Reader) (record, int64, error) {
+	var rec record
+
+	header := make([]byte, frameHeaderSize)
+	n, err := io.ReadFull(r, header)
+	if err == io.EOF {
+		return rec, 0, io.EOF
+	}
+	if err == io.ErrUnexpectedEOF {
+		return rec, int64(n), errTornRecord
+	}
+	if err != nil {
+		return rec, int64(n), err
+	}
+
+	size := binary.BigEndian.Uint32(header[0:4])
+	sum := binary.BigEndian.Uint32(header[4:8])
+	if size > maxRecordSize {
+		return rec, frameHeaderSize, fmt.Errorf("%w: record size %d exceeds limit", errCorruptRecord, size)
+	}
+
+	payload := make([]byte, size)
+	if _, err = io.ReadFull(r, payload); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return rec, frameHeaderSize, errTornRecord
+		}
+		return rec, frameHeaderSize, err
+	}
+
+	if crc32.ChecksumIEEE(payload) != sum {
+		return rec, frameHeaderSize, fmt.Errorf("%w: checksum mismatch", errCorruptRecord)
+	}
+
+	if err = gob.NewDecoder(bytes.NewReader(payload)).Decode(&rec); err != nil {
+		return rec, frameHeaderSize, fmt.Errorf("%w: %v", errCorruptRecord, err)
+	}
+	if rec.Type == 0 || rec.Type >= recordTypesEnd {
+		return rec, frameHeaderSize, fmt.Errorf("%w: unknown record type %d", errCorruptRecord, rec.Type)
+	}
+
+	return rec, int64(frameHeaderSize) + int64(size), nil
+}
+
+// replay Применяет записи журнала к хранилищу, возвращает количество записей и смещение конца последней целой записи
+func replay(r io.Reader, apply func(rec record)) (int, int64, error) {
+	reader := bufio.NewReader(r)
+	offset := int64(len(logMagic))
+	count := 0
+
+	for {
+		rec, n, err := decodeRecord(reader)
+		if err == io.EOF {
+			return count, offset, nil
+		}
+		if err != nil {
+			return count, offset, err
+		}
+
+		apply(rec)
+		offset += n
+		count++
+	}
+}
@@ -0,0 +1,192 @@
+package index
+
+import (
+	"sort"
+	"time"
+
+	"github.com/bgoldovsky/shortener/internal/app/hll"
+	"github.com/bgoldovsky/shortener/internal/app/models"
+)
+
+// Clicks Переходы по ссылкам для репозиториев, хранящих данные в памяти.
+// Переходы хранятся не по одному, а количествами по минутам, поэтому память растет
+// с числом минут с переходами, а не с числом переходов.
+// Не потокобезопасен: вызывающий держит свою блокировку на все время работы
+type Clicks struct {
+	counts   map[string][]models.ClickCount       // urlID -> количества по минутам в порядке времени
+	visitors map[string]map[time.Time]*hll.Sketch // urlID -> начало суток -> посетители
+}
+
+func NewClicks() *Clicks {
+	return &Clicks{
+		counts:   map[string][]models.ClickCount{},
+		visitors: map[string]map[time.Time]*hll.Sketch{},
+	}
+}
+
+// Add Учитывает переходы в количествах за минуту
+func (c *Clicks) Add(clicks []models.Click) {
+	for _, click := range clicks {
+		c.add(models.ClickCount{
+			URLID:   click.URLID,
+			Minute:  click.Time.UTC().Truncate(time.Minute),
+			Bot:     click.Bot,
+			Country: click.Country,
+			City:    click.City,
+			Target:  click.Target,
+			Count:   1,
+		})
+	}
+}
+
+// AddCounts Учитывает готовые количества переходов
+func (c *Clicks) AddCounts(counts []models.ClickCount) {
+	for _, count := range counts {
+		count.Minute = count.Minute.UTC()
+		c.add(count)
+	}
+}
+
+// add Прибавляет количество к минуте с теми же признаками, сохраняя порядок по времени
+func (c *Clicks) add(count models.ClickCount) {
+	urlCounts := c.counts[count.URLID]
+
+	// Переходы почти всегда приходят по порядку, поэтому ищем место с конца
+	idx := len(urlCounts)
+	for idx > 0 && urlCounts[idx-1].Minute.After(count.Minute) {
+		idx--
+	}
+
+	for i := idx - 1; i >= 0 && urlCounts[i].Minute.Equal(count.Minute); i-- {
+		if sameGroup(urlCounts[i], count) {
+			urlCounts[i].Count += count.Count
+			return
+		}
+	}
+
+	urlCounts = append(urlCounts, models.ClickCount{})
+	copy(urlCounts[idx+1:], urlCounts[idx:])
+	urlCounts[idx] = count
+	c.counts[count.URLID] = urlCounts
+}
+
+// sameGroup Проверяет, что количества относятся к переходам с одинаковыми признаками
+func sameGroup(a, b models.ClickCount) bool {
+	return a.Bot == b.Bot && a.Country == b.Country && a.City == b.City && a.Target == b.Target
+}
+
+// Range Возвращает количества переходов по ссылке за минуты, начавшиеся в [from, to)
+func (c *Clicks) Range(urlID string, from, to time.Time) []models.ClickCount {
+	urlCounts := c.counts[urlID]
+
+	start := sort.Search(len(urlCounts), func(i int) bool {
+		return !urlCounts[i].Minute.Before(from)
+	})
+	end := sort.Search(len(urlCounts), func(i int) bool {
+		return !urlCounts[i].Minute.Before(to)
+	})
+	if start >= end {
+		return []models.ClickCount{}
+	}
+
+	res := make([]models.ClickCount, end-start)
+	copy(res, urlCounts[start:end])
+
+	return res
+}
+
+// All Возвращает все количества переходов по ссылке
+func (c *Clicks) All(urlID string) []models.ClickCount {
+	return c.counts[urlID]
+}
+
+// MergeVisitors Объединяет суточные оценки посетителей с сохраненными
+func (c *Clicks) MergeVisitors(visitors []models.DailyVisitors) {
+	for _, v := range visitors {
+		days, ok := c.visitors[v.URLID]
+		if !ok {
+			days = map[time.Time]*hll.Sketch{}
+			c.visitors[v.URLID] = days
+		}
+
+		day := v.Day.UTC()
+		sketch, ok := days[day]
+		if !ok {
+			sketch = hll.New()
+			days[day] = sketch
+		}
+		sketch.Merge(v.Sketch)
+	}
+}
+
+// Visitors Возвращает копии суточных оценок посетителей ссылки за сутки, начавшиеся в [from, to), по порядку
+func (c *Clicks) Visitors(urlID string, from, to time.Time) []models.DailyVisitors {
+	res := make([]models.DailyVisitors, 0)
+	for day, sketch := range c.visitors[urlID] {
+		if day.Before(from) || !day.Before(to) {
+			continue
+		}
+
+		copied := hll.New()
+		copied.Merge(sketch)
+		res = append(res, models.DailyVisitors{URLID: urlID, Day: day, Sketch: copied})
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Day.Before(res[j].Day)
+	})
+
+	return res
+}
+
+// VisitorsDiff Возвращает регистры, которые изменит объединение суточной оценки с сохраненной
+func (c *Clicks) VisitorsDiff(v models.DailyVisitors) []hll.Register {
+	sketch, ok := c.visitors[v.URLID][v.Day.UTC()]
+	if !ok {
+		sketch = hll.New()
+	}
+
+	return sketch.Diff(v.Sketch)
+}
+
+// ApplyVisitors Поднимает регистры суточной оценки посетителей ссылки
+func (c *Clicks) ApplyVisitors(urlID string, day time.Time, regs []hll.Register) {
+	days, ok := c.visitors[urlID]
+	if !ok {
+		days = map[time.Time]*hll.Sketch{}
+		c.visitors[urlID] = days
+	}
+
+	day = day.UTC()
+	sketch, ok := days[day]
+	if !ok {
+		sketch = hll.New()
+		days[day] = sketch
+	}
+	sketch.Apply(regs)
+}
+
+// AllVisitors Возвращает все суточные оценки посетителей ссылки
+func (c *Clicks) AllVisitors(urlID string) []models.DailyVisitors {
+	res := make([]models.DailyVisitors, 0, len(c.visitors[urlID]))
+	for day, sketch := range c.visitors[urlID] {
+		res = append(res, models.DailyVisitors{URLID: urlID, Day: day, Sketch: sketch})
+	}
+
+	return res
+}
+
+// URLIDs Возвращает идентификаторы всех ссылок, по которым были переходы
+func (c *Clicks) URLIDs() []string {
+	urlIDs := make([]string, 0, len(c.counts))
+	for urlID := range c.counts {
+		urlIDs = append(urlIDs, urlID)
+	}
+	for urlID := range c.visitors {
+		if _, ok := c.counts[urlID]; !ok {
+			urlIDs = append(urlIDs, urlID)
+		}
+	}
+
+	return urlIDs
+}
@@ -0,0 +1,62 @@
+package index
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bgoldovsky/shortener/internal/app/hll"
+	"github.com/bgoldovsky/shortener/internal/app/models"
+)
+
+func TestClicks_Range(t *testing.T) {
+	base := time.Date(2022, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	c := NewClicks()
+	c.Add([]models.Click{
+		{URLID: "qwerty", Time: base.Add(time.Minute * 2)},
+		{URLID: "qwerty", Time: base.Add(time.Second * 10), Country: "RU"},
+		{URLID: "ytrewq", Time: base},
+		{URLID: "qwerty", Time: base.Add(time.Minute)},
+		{URLID: "qwerty", Time: base.Add(time.Second * 30), Country: "RU"},
+		{URLID: "qwerty", Time: base.Add(time.Second * 40), Bot: true},
+	})
+
+	// Переходы с одинаковыми признаками за одну минуту хранятся одним количеством
+	act := c.Range("qwerty", base, base.Add(time.Minute*2))
+	assert.Equal(t, []models.ClickCount{
+		{URLID: "qwerty", Minute: base, Country: "RU", Count: 2},
+		{URLID: "qwerty", Minute: base, Bot: true, Count: 1},
+		{URLID: "qwerty", Minute: base.Add(time.Minute), Count: 1},
+	}, act)
+
+	c.AddCounts([]models.ClickCount{{URLID: "qwerty", Minute: base, Country: "RU", Count: 3}})
+	assert.Equal(t, int64(5), c.Range("qwerty", base, base.Add(time.Minute))[0].Count)
+
+	assert.Len(t, c.All("qwerty"), 4)
+	assert.Empty(t, c.Range("qwerty", base.Add(time.Hour), base.Add(time.Hour*2)))
+	assert.Empty(t, c.Range("unknown", base, base.Add(time.Hour)))
+	assert.ElementsMatch(t, []string{"qwerty", "ytrewq"}, c.URLIDs())
+}
+
+func TestClicks_ApplyVisitors(t *testing.T) {
+	day := time.Date(2022, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	sketch := hll.New()
+	for i := 0; i < 100; i++ {
+		sketch.Add(hll.Hash(fmt.Sprint(i)))
+	}
+	v := models.DailyVisitors{URLID: "qwerty", Day: day, Sketch: sketch}
+
+	c := NewClicks()
+	diff := c.VisitorsDiff(v)
+	assert.NotEmpty(t, diff)
+
+	c.ApplyVisitors("qwerty", day, diff)
+	assert.Equal(t, sketch.Count(), c.Visitors("qwerty", day, day.Add(time.Hour*24))[0].Sketch.Count())
+
+	// После применения разницы повторное объединение ничего не меняет
+	assert.Empty(t, c.VisitorsDiff(v))
+}
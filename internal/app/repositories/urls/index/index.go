@@ -0,0 +1,289 @@
+package index
+
+import (
+	"time"
+
+	"github.com/bgoldovsky/shortener/internal/app/models"
+)
+
+// Link Сокращенная ссылка в индексе
+type Link struct {
+	URLID       string     // Идентификатор сокращенного URL
+	OriginalURL string     // Исходный URL
+	UserID      string     // Идентификатор владельца
+	DeletedAt   time.Time  // Время удаления, нулевое для действующей ссылки
+	ExpiresAt   *time.Time // Время, после которого ссылка перестает работать
+	// Код ответа перенаправления, ноль - код по умолчанию
+	RedirectType int
+	Interstitial bool      // Всегда показывать страницу предпросмотра
+	CreatedAt    time.Time // Время создания
+	PasswordHash string    // Хэш пароля, пустой для открытой ссылки
+	NotBefore    *time.Time
+	MaxClicks    int64 // Сколько переходов разрешено, ноль - без ограничения
+	ClickCount   int64 // Сколько переходов учтено
+	Targets      []models.Target
+	Sticky       bool
+	Rules        []models.Rule
+	Passthrough  bool
+	UTM          *models.UTM
+}
+
+// NewLink Создает ссылку пользователя из модели. Время создания берется из модели,
+// чтобы при чтении журнала оно не менялось
+func NewLink(url models.URL, userID string) Link {
+	return Link{
+		URLID:        url.ShortURL,
+		OriginalURL:  url.OriginalURL,
+		UserID:       userID,
+		ExpiresAt:    url.ExpiresAt,
+		RedirectType: url.RedirectType,
+		Interstitial: url.Interstitial,
+		CreatedAt:    url.CreatedAt,
+		PasswordHash: url.PasswordHash,
+		NotBefore:    url.NotBefore,
+		MaxClicks:    url.MaxClicks,
+		ClickCount:   url.ClickCount,
+		Targets:      url.Targets,
+		Sticky:       url.Sticky,
+		Rules:        url.Rules,
+		Passthrough:  url.Passthrough,
+		UTM:          url.UTM,
+	}
+}
+
+// URL Возвращает модель ссылки
+func (l *Link) URL() models.URL {
+	return models.URL{
+		ShortURL:     l.URLID,
+		OriginalURL:  l.OriginalURL,
+		ExpiresAt:    l.ExpiresAt,
+		RedirectType: l.RedirectType,
+		Interstitial: l.Interstitial,
+		CreatedAt:    l.CreatedAt,
+		PasswordHash: l.PasswordHash,
+		NotBefore:    l.NotBefore,
+		MaxClicks:    l.MaxClicks,
+		ClickCount:   l.ClickCount,
+		Targets:      l.Targets,
+		Sticky:       l.Sticky,
+		Rules:        l.Rules,
+		Passthrough:  l.Passthrough,
+		UTM:          l.UTM,
+	}
+}
+
+// ClicksLeft Проверяет, что лимит переходов по ссылке не исчерпан
+func (l *Link) ClicksLeft() bool {
+	return l.MaxClicks == 0 || l.ClickCount < l.MaxClicks
+}
+
+// Deleted Проверяет, удалена ли ссылка
+func (l *Link) Deleted() bool {
+	return !l.DeletedAt.IsZero()
+}
+
+// Index Индексы ссылок для репозиториев, хранящих данные в памяти.
+// Не потокобезопасен: вызывающий держит свою блокировку на все время работы с индексом
+type Index struct {
+	links map[string]*Link            // urlID -> ссылка
+	urls  map[string]string           // originalURL -> urlID
+	users map[string]map[string]*Link // userID -> urlID -> ссылка
+	utm   map[string]models.UTM       // userID -> шаблон UTM-меток
+}
+
+func New() *Index {
+	return &Index{
+		links: map[string]*Link{},
+		urls:  map[string]string{},
+		users: map[string]map[string]*Link{},
+		utm:   map[string]models.UTM{},
+	}
+}
+
+// Get Возвращает ссылку по идентификатору
+func (i *Index) Get(urlID string) (*Link, bool) {
+	link, ok := i.links[urlID]
+	return link, ok
+}
+
+// URLID Возвращает идентификатор ссылки по исходному URL
+func (i *Index) URLID(originalURL string) (string, bool) {
+	urlID, ok := i.urls[originalURL]
+	return urlID, ok
+}
+
+// Conflict Ищет в пакете URL, который уже сохранен или повторяется в самом пакете
+func (i *Index) Conflict(urls []models.URL) (string, string, bool) {
+	batch := make(map[string]string, len(urls))
+
+	for idx := range urls {
+		originalURL := urls[idx].OriginalURL
+		if urlID, ok := i.urls[originalURL]; ok {
+			return urlID, originalURL, true
+		}
+		if urlID, ok := batch[originalURL]; ok {
+			return urlID, originalURL, true
+		}
+		batch[originalURL] = urls[idx].ShortURL
+	}
+
+	return "", "", false
+}
+
+// TakenID Ищет в пакете идентификатор, который уже занят или повторяется в самом пакете.
+// Удаленные ссылки продолжают занимать свой идентификатор
+func (i *Index) TakenID(urls []models.URL) (string, bool) {
+	batch := make(map[string]struct{}, len(urls))
+
+	for idx := range urls {
+		urlID := urls[idx].ShortURL
+		if _, ok := i.links[urlID]; ok {
+			return urlID, true
+		}
+		if _, ok := batch[urlID]; ok {
+			return urlID, true
+		}
+		batch[urlID] = struct{}{}
+	}
+
+	return "", false
+}
+
+// Put Сохраняет ссылку, заменяя существующую с тем же идентификатором
+func (i *Index) Put(link Link) {
+	i.Remove(link.URLID)
+
+	l := &link
+	i.links[l.URLID] = l
+	if !l.Deleted() {
+		i.urls[l.OriginalURL] = l.URLID
+	}
+
+	userLinks, ok := i.users[l.UserID]
+	if !ok {
+		userLinks = map[string]*Link{}
+		i.users[l.UserID] = userLinks
+	}
+	userLinks[l.URLID] = l
+}
+
+// Remove Удаляет ссылку из всех индексов
+func (i *Index) Remove(urlID string) {
+	link, ok := i.links[urlID]
+	if !ok {
+		return
+	}
+
+	delete(i.links, urlID)
+	if i.urls[link.OriginalURL] == urlID {
+		delete(i.urls, link.OriginalURL)
+	}
+
+	userLinks := i.users[link.UserID]
+	delete(userLinks, urlID)
+	if len(userLinks) == 0 {
+		delete(i.users, link.UserID)
+	}
+}
+
+// MarkDeleted Помечает ссылку удаленной, освобождая исходный URL для повторного сокращения
+func (i *Index) MarkDeleted(urlID string, deletedAt time.Time) {
+	link, ok := i.links[urlID]
+	if !ok || link.Deleted() {
+		return
+	}
+
+	link.DeletedAt = deletedAt
+	if i.urls[link.OriginalURL] == urlID {
+		delete(i.urls, link.OriginalURL)
+	}
+}
+
+// Owned Проверяет, что ссылка принадлежит пользователю
+func (i *Index) Owned(urlID, userID string) bool {
+	_, ok := i.users[userID][urlID]
+	return ok
+}
+
+// UserURL Возвращает действующую ссылку пользователя
+func (i *Index) UserURL(urlID, userID string) (models.URL, bool) {
+	link, ok := i.users[userID][urlID]
+	if !ok || link.Deleted() {
+		return models.URL{}, false
+	}
+
+	return link.URL(), true
+}
+
+// List Возвращает действующие ссылки пользователя
+func (i *Index) List(userID string) []models.URL {
+	userLinks := i.users[userID]
+	urls := make([]models.URL, 0, len(userLinks))
+
+	for _, link := range userLinks {
+		if link.Deleted() {
+			continue
+		}
+
+		urls = append(urls, link.URL())
+	}
+
+	return urls
+}
+
+// Links Возвращает все ссылки пользователя, включая удаленные
+func (i *Index) Links(userID string) []Link {
+	userLinks := i.users[userID]
+	links := make([]Link, 0, len(userLinks))
+
+	for _, link := range userLinks {
+		links = append(links, *link)
+	}
+
+	return links
+}
+
+// UserIDs Возвращает идентификаторы всех пользователей, у которых есть ссылки
+func (i *Index) UserIDs() []string {
+	userIDs := make([]string, 0, len(i.users))
+	for userID := range i.users {
+		userIDs = append(userIDs, userID)
+	}
+
+	return userIDs
+}
+
+// Len Возвращает количество ссылок, включая удаленные
+func (i *Index) Len() int {
+	return len(i.links)
+}
+
+// SetUTMTemplate Сохраняет шаблон UTM-меток пользователя, nil удаляет шаблон
+func (i *Index) SetUTMTemplate(userID string, utm *models.UTM) {
+	if utm == nil {
+		delete(i.utm, userID)
+		return
+	}
+
+	i.utm[userID] = *utm
+}
+
+// UTMTemplate Возвращает шаблон UTM-меток пользователя
+func (i *Index) UTMTemplate(userID string) (*models.UTM, bool) {
+	utm, ok := i.utm[userID]
+	if !ok {
+		return nil, false
+	}
+
+	return &utm, true
+}
+
+// UTMTemplates Возвращает шаблоны UTM-меток всех пользователей
+func (i *Index) UTMTemplates() map[string]models.UTM {
+	templates := make(map[string]models.UTM, len(i.utm))
+	for userID, utm := range i.utm {
+		templates[userID] = utm
+	}
+
+	return templates
+}
@@ -0,0 +1,119 @@
+package index
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bgoldovsky/shortener/internal/app/models"
+)
+
+func TestIndex_Put(t *testing.T) {
+	idx := New()
+	idx.Put(Link{URLID: "qwerty", OriginalURL: "avito.ru", UserID: "user1"})
+
+	link, ok := idx.Get("qwerty")
+	assert.True(t, ok)
+	assert.Equal(t, "avito.ru", link.OriginalURL)
+
+	urlID, ok := idx.URLID("avito.ru")
+	assert.True(t, ok)
+	assert.Equal(t, "qwerty", urlID)
+
+	assert.True(t, idx.Owned("qwerty", "user1"))
+	assert.False(t, idx.Owned("qwerty", "user2"))
+}
+
+func TestIndex_Put_Replace(t *testing.T) {
+	idx := New()
+	idx.Put(Link{URLID: "qwerty", OriginalURL: "avito.ru", UserID: "user1"})
+	idx.Put(Link{URLID: "qwerty", OriginalURL: "yandex.ru", UserID: "user2"})
+
+	_, ok := idx.URLID("avito.ru")
+	assert.False(t, ok)
+	assert.Empty(t, idx.List("user1"))
+	assert.Equal(t, []models.URL{{ShortURL: "qwerty", OriginalURL: "yandex.ru"}}, idx.List("user2"))
+	assert.Equal(t, 1, idx.Len())
+}
+
+func TestIndex_Remove(t *testing.T) {
+	idx := New()
+	idx.Put(Link{URLID: "qwerty", OriginalURL: "avito.ru", UserID: "user1"})
+	idx.Remove("qwerty")
+
+	_, ok := idx.Get("qwerty")
+	assert.False(t, ok)
+
+	_, ok = idx.URLID("avito.ru")
+	assert.False(t, ok)
+
+	assert.Empty(t, idx.UserIDs())
+	assert.Equal(t, 0, idx.Len())
+}
+
+func TestIndex_MarkDeleted(t *testing.T) {
+	idx := New()
+	idx.Put(Link{URLID: "qwerty", OriginalURL: "avito.ru", UserID: "user1"})
+	idx.MarkDeleted("qwerty", time.Now())
+
+	link, ok := idx.Get("qwerty")
+	assert.True(t, ok)
+	assert.True(t, link.Deleted())
+
+	_, ok = idx.URLID("avito.ru")
+	assert.False(t, ok)
+
+	assert.Empty(t, idx.List("user1"))
+	assert.Len(t, idx.Links("user1"), 1)
+}
+
+func TestIndex_Conflict(t *testing.T) {
+	tests := []struct {
+		name   string
+		urls   []models.URL
+		urlID  string
+		url    string
+		exists bool
+	}{
+		{
+			name: "no conflict",
+			urls: []models.URL{
+				{ShortURL: "xyz", OriginalURL: "yandex.ru"},
+				{ShortURL: "zyx", OriginalURL: "ozon.ru"},
+			},
+		},
+		{
+			name: "stored url",
+			urls: []models.URL{
+				{ShortURL: "xyz", OriginalURL: "avito.ru"},
+			},
+			urlID:  "qwerty",
+			url:    "avito.ru",
+			exists: true,
+		},
+		{
+			name: "duplicate in batch",
+			urls: []models.URL{
+				{ShortURL: "xyz", OriginalURL: "yandex.ru"},
+				{ShortURL: "zyx", OriginalURL: "yandex.ru"},
+			},
+			urlID:  "xyz",
+			url:    "yandex.ru",
+			exists: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idx := New()
+			idx.Put(Link{URLID: "qwerty", OriginalURL: "avito.ru", UserID: "user1"})
+
+			urlID, url, exists := idx.Conflict(tt.urls)
+
+			assert.Equal(t, tt.exists, exists)
+			assert.Equal(t, tt.urlID, urlID)
+			assert.Equal(t, tt.url, url)
+		})
+	}
+}
@@ -2,91 +2,135 @@ package inmemory
 
 import (
 	"context"
+	"net/url"
 	"sync"
+	"time"
 
 	"github.com/bgoldovsky/shortener/internal/app/models"
+	"github.com/bgoldovsky/shortener/internal/app/repositories/urls"
 	internalErrors "github.com/bgoldovsky/shortener/internal/app/repositories/urls/errors"
+	"github.com/bgoldovsky/shortener/internal/app/repositories/urls/index"
 )
 
 type inmemoryRepository struct {
-	store map[string]map[string]string
-	ma    sync.RWMutex
+	store     *index.Index
+	sequences map[string]int64
+	clicks    *index.Clicks
+	ma        sync.RWMutex
+}
+
+func init() {
+	urls.Register("memory", func(_ *url.URL) (urls.Repository, error) {
+		return NewRepository(), nil
+	})
 }
 
 func NewRepository() *inmemoryRepository {
 	return &inmemoryRepository{
-		store: map[string]map[string]string{},
+		store:     index.New(),
+		sequences: map[string]int64{},
+		clicks:    index.NewClicks(),
 	}
 }
 
 // Add Сохраняет URL
-func (r *inmemoryRepository) Add(_ context.Context, urlID, url, userID string) error {
+func (r *inmemoryRepository) Add(_ context.Context, url models.URL, userID string) error {
 	r.ma.Lock()
 	defer r.ma.Unlock()
 
 	// Проверяем не содержится ли в репозитории такой URL
-	if lastURLID, exist := r.urlExist(url); exist {
+	if lastURLID, exist := r.store.URLID(url.OriginalURL); exist {
+		return internalErrors.NewNotUniqueURLErr(lastURLID, url.OriginalURL, nil)
+	}
+
+	if _, exist := r.store.Get(url.ShortURL); exist {
+		return internalErrors.NewNotUniqueURLIDErr(url.ShortURL, nil)
+	}
+
+	url.CreatedAt = time.Now()
+	r.store.Put(index.NewLink(url, userID))
+
+	return nil
+}
+
+func (r *inmemoryRepository) AddBatch(_ context.Context, urls []models.URL, userID string) error {
+	r.ma.Lock()
+	defer r.ma.Unlock()
+
+	// Пакет сохраняется целиком, либо не сохраняется вовсе
+	if lastURLID, url, exist := r.store.Conflict(urls); exist {
 		return internalErrors.NewNotUniqueURLErr(lastURLID, url, nil)
 	}
 
-	// Извлекаем коллекцию URL пользователя из хранилища, если нет, то создаем новую
-	userStore, ok := r.store[userID]
-	if !ok {
-		userStore = map[string]string{}
+	if urlID, exist := r.store.TakenID(urls); exist {
+		return internalErrors.NewNotUniqueURLIDErr(urlID, nil)
 	}
 
-	// Сохраняем коллекцию URL пользователя в хранилище
-	userStore[urlID] = url
-	r.store[userID] = userStore
+	now := time.Now()
+	for idx := range urls {
+		url := urls[idx]
+		url.CreatedAt = now
+		r.store.Put(index.NewLink(url, userID))
+	}
 
 	return nil
 }
 
-func (r *inmemoryRepository) urlExist(url string) (string, bool) {
-	for _, userStore := range r.store {
-		for urlID, originalURL := range userStore {
-			if url == originalURL {
-				return urlID, true
-			}
-		}
+// Get Возвращает URL
+func (r *inmemoryRepository) Get(_ context.Context, urlID string) (models.URL, error) {
+	r.ma.RLock()
+	defer r.ma.RUnlock()
+
+	link, ok := r.store.Get(urlID)
+	if !ok {
+		return models.URL{}, internalErrors.ErrURLNotFound
+	}
+	if link.Deleted() {
+		return models.URL{}, internalErrors.ErrURLDeleted
 	}
 
-	return "", false
+	return link.URL(), nil
 }
 
-func (r *inmemoryRepository) AddBatch(_ context.Context, urls []models.URL, userID string) error {
+// CountClick Учитывает переход по ссылке, если лимит переходов не исчерпан
+func (r *inmemoryRepository) CountClick(_ context.Context, urlID string) error {
 	r.ma.Lock()
 	defer r.ma.Unlock()
 
-	// Извлекаем коллекцию URL пользователя из хранилища, если нет, то создаем новую
-	userStore, ok := r.store[userID]
+	link, ok := r.store.Get(urlID)
 	if !ok {
-		userStore = map[string]string{}
+		return internalErrors.ErrURLNotFound
 	}
-
-	// Добавляем URL в коллекцию пользователя, избегая копирования
-	for idx := range urls {
-		userStore[urls[idx].ShortURL] = urls[idx].OriginalURL
+	if link.Deleted() {
+		return internalErrors.ErrURLDeleted
+	}
+	if !link.ClicksLeft() {
+		return internalErrors.ErrClickLimit
 	}
 
-	// Сохраняем коллекцию URL пользователя в хранилище
-	r.store[userID] = userStore
+	link.ClickCount++
 
 	return nil
 }
 
-// Get Возвращает URL
-func (r *inmemoryRepository) Get(_ context.Context, urlID string) (string, error) {
+// SetUTMTemplate Сохраняет шаблон UTM-меток пользователя, nil удаляет шаблон
+func (r *inmemoryRepository) SetUTMTemplate(_ context.Context, userID string, utm *models.UTM) error {
+	r.ma.Lock()
+	defer r.ma.Unlock()
+
+	r.store.SetUTMTemplate(userID, utm)
+
+	return nil
+}
+
+// GetUTMTemplate Возвращает шаблон UTM-меток пользователя, nil если шаблона нет
+func (r *inmemoryRepository) GetUTMTemplate(_ context.Context, userID string) (*models.UTM, error) {
 	r.ma.RLock()
 	defer r.ma.RUnlock()
 
-	for _, userStore := range r.store {
-		if url, ok := userStore[urlID]; ok {
-			return url, nil
-		}
-	}
+	utm, _ := r.store.UTMTemplate(userID)
 
-	return "", internalErrors.ErrURLNotFound
+	return utm, nil
 }
 
 // GetList Возвращает список всех сокращенных URL
@@ -94,47 +138,88 @@ func (r *inmemoryRepository) GetList(_ context.Context, userID string) ([]models
 	r.ma.RLock()
 	defer r.ma.RUnlock()
 
-	urls := make([]models.URL, 0)
+	return r.store.List(userID), nil
+}
 
-	userStore, ok := r.store[userID]
-	if !ok {
-		return urls, nil
-	}
+// GetByUser Возвращает действующую ссылку пользователя
+func (r *inmemoryRepository) GetByUser(_ context.Context, urlID, userID string) (models.URL, error) {
+	r.ma.RLock()
+	defer r.ma.RUnlock()
 
-	for shortURL, originalURL := range userStore {
-		urls = append(urls, models.URL{
-			ShortURL:    shortURL,
-			OriginalURL: originalURL,
-		})
+	url, ok := r.store.UserURL(urlID, userID)
+	if !ok {
+		return models.URL{}, internalErrors.ErrURLNotFound
 	}
 
-	return urls, nil
+	return url, nil
 }
 
 // Delete Удаляет список URL указанного пользователя
 func (r *inmemoryRepository) Delete(_ context.Context, urlsBatch []models.UserCollection) error {
-	r.ma.RLock()
-	defer r.ma.RUnlock()
+	r.ma.Lock()
+	defer r.ma.Unlock()
 
-	for _, collection := range urlsBatch {
-		// Извлекаем коллекцию URL пользователя из хранилища
-		userStore, ok := r.store[collection.UserID]
-		if !ok {
-			return nil
-		}
+	now := time.Now()
 
-		// Удаляем указанные URL из репозитория
+	for _, collection := range urlsBatch {
 		for _, urlID := range collection.URLIDs {
-			delete(userStore, urlID)
+			// Помечаем удаленными только URL, принадлежащие пользователю
+			if r.store.Owned(urlID, collection.UserID) {
+				r.store.MarkDeleted(urlID, now)
+			}
 		}
-
-		// Сохраняем коллекцию URL пользователя в хранилище
-		r.store[collection.UserID] = userStore
 	}
 
 	return nil
 }
 
+// AddClicks Сохраняет переходы по ссылкам
+func (r *inmemoryRepository) AddClicks(_ context.Context, clicks []models.Click) error {
+	r.ma.Lock()
+	defer r.ma.Unlock()
+
+	r.clicks.Add(clicks)
+
+	return nil
+}
+
+// GetClickCounts Возвращает количества переходов по ссылке за минуты, начавшиеся в [from, to)
+func (r *inmemoryRepository) GetClickCounts(_ context.Context, urlID string, from, to time.Time) ([]models.ClickCount, error) {
+	r.ma.RLock()
+	defer r.ma.RUnlock()
+
+	return r.clicks.Range(urlID, from, to), nil
+}
+
+// MergeVisitors Объединяет суточные оценки посетителей с сохраненными
+func (r *inmemoryRepository) MergeVisitors(_ context.Context, visitors []models.DailyVisitors) error {
+	r.ma.Lock()
+	defer r.ma.Unlock()
+
+	r.clicks.MergeVisitors(visitors)
+
+	return nil
+}
+
+// GetVisitors Возвращает суточные оценки посетителей ссылки за сутки, начавшиеся в [from, to)
+func (r *inmemoryRepository) GetVisitors(_ context.Context, urlID string, from, to time.Time) ([]models.DailyVisitors, error) {
+	r.ma.RLock()
+	defer r.ma.RUnlock()
+
+	return r.clicks.Visitors(urlID, from, to), nil
+}
+
+// Lease Резервирует диапазон [start, start+size) счетчика name
+func (r *inmemoryRepository) Lease(_ context.Context, name string, size int64) (int64, error) {
+	r.ma.Lock()
+	defer r.ma.Unlock()
+
+	start := r.sequences[name]
+	r.sequences[name] = start + size
+
+	return start, nil
+}
+
 // Ping Проверяет доступность базы данных
 func (r *inmemoryRepository) Ping(_ context.Context) error {
 	return nil
@@ -2,6 +2,8 @@ package inmemory
 
 import (
 	"context"
+	"fmt"
+	"strconv"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -21,7 +23,7 @@ func TestInmemoryRepo_Add(t *testing.T) {
 
 	repo := NewRepository()
 
-	err := repo.Add(ctx, "qwerty", url, defaultUserID)
+	err := repo.Add(ctx, models.URL{ShortURL: "qwerty", OriginalURL: url}, defaultUserID)
 
 	assert.NoError(t, err)
 }
@@ -32,10 +34,10 @@ func TestInmemoryRepo_Add_Conflict(t *testing.T) {
 
 	repo := NewRepository()
 
-	err := repo.Add(ctx, "qwerty", url, defaultUserID)
+	err := repo.Add(ctx, models.URL{ShortURL: "qwerty", OriginalURL: url}, defaultUserID)
 	require.NoError(t, err)
 
-	err = repo.Add(ctx, "qwerty", url, defaultUserID)
+	err = repo.Add(ctx, models.URL{ShortURL: "qwerty", OriginalURL: url}, defaultUserID)
 	require.Error(t, err)
 
 	assert.IsType(t, &internalErrors.NotUniqueURLErr{}, err)
@@ -47,13 +49,13 @@ func TestInmemoryRepo_Get(t *testing.T) {
 
 	repo := NewRepository()
 
-	err := repo.Add(ctx, "qwerty", url, defaultUserID)
+	err := repo.Add(ctx, models.URL{ShortURL: "qwerty", OriginalURL: url}, defaultUserID)
 	require.NoError(t, err)
 
 	act, err := repo.Get(ctx, "qwerty")
 
 	assert.NoError(t, err)
-	assert.Equal(t, "avito.ru", act)
+	assert.Equal(t, "avito.ru", act.OriginalURL)
 }
 
 func TestInmemoryRepo_Empty(t *testing.T) {
@@ -63,7 +65,7 @@ func TestInmemoryRepo_Empty(t *testing.T) {
 	act, err := repo.Get(ctx, "qwerty")
 
 	assert.Error(t, err, "url not found")
-	assert.Equal(t, "", act)
+	assert.Equal(t, models.URL{}, act)
 }
 
 func TestInmemoryRepo_GetList_Success(t *testing.T) {
@@ -71,10 +73,10 @@ func TestInmemoryRepo_GetList_Success(t *testing.T) {
 
 	repo := NewRepository()
 
-	err := repo.Add(ctx, "qwerty", "avito.ru", defaultUserID)
+	err := repo.Add(ctx, models.URL{ShortURL: "qwerty", OriginalURL: "avito.ru"}, defaultUserID)
 	require.NoError(t, err)
 
-	err = repo.Add(ctx, "ytrewq", "yandex.ru", defaultUserID)
+	err = repo.Add(ctx, models.URL{ShortURL: "ytrewq", OriginalURL: "yandex.ru"}, defaultUserID)
 	require.NoError(t, err)
 
 	act, err := repo.GetList(ctx, defaultUserID)
@@ -90,10 +92,10 @@ func TestInmemoryRepository_Delete(t *testing.T) {
 
 	urlIDs := []string{"qwerty", "ytrewq"}
 
-	err := repo.Add(ctx, urlIDs[0], "avito.ru", defaultUserID)
+	err := repo.Add(ctx, models.URL{ShortURL: urlIDs[0], OriginalURL: "avito.ru"}, defaultUserID)
 	require.NoError(t, err)
 
-	err = repo.Add(ctx, urlIDs[1], "yandex.ru", defaultUserID)
+	err = repo.Add(ctx, models.URL{ShortURL: urlIDs[1], OriginalURL: "yandex.ru"}, defaultUserID)
 	require.NoError(t, err)
 
 	act, err := repo.GetList(ctx, defaultUserID)
@@ -108,15 +110,59 @@ func TestInmemoryRepository_Delete(t *testing.T) {
 	assert.Empty(t, act)
 }
 
+func TestInmemoryRepository_Delete_Get(t *testing.T) {
+	ctx := context.Background()
+
+	repo := NewRepository()
+
+	err := repo.Add(ctx, models.URL{ShortURL: "qwerty", OriginalURL: "avito.ru"}, defaultUserID)
+	require.NoError(t, err)
+
+	err = repo.Delete(ctx, []models.UserCollection{{UserID: "fake", URLIDs: []string{"qwerty"}}})
+	require.NoError(t, err)
+
+	act, err := repo.Get(ctx, "qwerty")
+	require.NoError(t, err)
+	require.Equal(t, "avito.ru", act.OriginalURL)
+
+	err = repo.Delete(ctx, []models.UserCollection{{UserID: defaultUserID, URLIDs: []string{"qwerty"}}})
+	require.NoError(t, err)
+
+	act, err = repo.Get(ctx, "qwerty")
+	assert.Equal(t, internalErrors.ErrURLDeleted, err)
+	assert.Equal(t, models.URL{}, act)
+}
+
+func TestInmemoryRepository_Delete_AddAgain(t *testing.T) {
+	ctx := context.Background()
+
+	repo := NewRepository()
+
+	err := repo.Add(ctx, models.URL{ShortURL: "qwerty", OriginalURL: "avito.ru"}, defaultUserID)
+	require.NoError(t, err)
+
+	err = repo.Delete(ctx, []models.UserCollection{{UserID: defaultUserID, URLIDs: []string{"qwerty"}}})
+	require.NoError(t, err)
+
+	err = repo.Add(ctx, models.URL{ShortURL: "ytrewq", OriginalURL: "avito.ru"}, defaultUserID)
+	require.NoError(t, err)
+
+	act, err := repo.GetList(ctx, defaultUserID)
+	require.NoError(t, err)
+	require.Len(t, act, 1)
+	assert.Equal(t, "ytrewq", act[0].ShortURL)
+	assert.Equal(t, "avito.ru", act[0].OriginalURL)
+}
+
 func TestInmemoryRepo_GetList_NotFound(t *testing.T) {
 	ctx := context.Background()
 
 	repo := NewRepository()
 
-	err := repo.Add(ctx, "qwerty", "avito.ru", defaultUserID)
+	err := repo.Add(ctx, models.URL{ShortURL: "qwerty", OriginalURL: "avito.ru"}, defaultUserID)
 	require.NoError(t, err)
 
-	err = repo.Add(ctx, "ytrewq", "yandex.ru", defaultUserID)
+	err = repo.Add(ctx, models.URL{ShortURL: "ytrewq", OriginalURL: "yandex.ru"}, defaultUserID)
 	require.NoError(t, err)
 
 	act, err := repo.GetList(ctx, "fake")
@@ -125,6 +171,28 @@ func TestInmemoryRepo_GetList_NotFound(t *testing.T) {
 	assert.Len(t, act, 0)
 }
 
+func TestInmemoryRepo_Lease(t *testing.T) {
+	ctx := context.Background()
+	repo := NewRepository()
+
+	tests := []struct {
+		name string
+		size int64
+		exp  int64
+	}{
+		{name: "urls", size: 100, exp: 0},
+		{name: "urls", size: 100, exp: 100},
+		{name: "other", size: 10, exp: 0},
+		{name: "urls", size: 1, exp: 200},
+	}
+
+	for _, tt := range tests {
+		act, err := repo.Lease(ctx, tt.name, tt.size)
+		require.NoError(t, err)
+		assert.Equal(t, tt.exp, act)
+	}
+}
+
 func TestInmemoryRepo_Ping(t *testing.T) {
 	ctx := context.Background()
 
@@ -133,3 +201,52 @@ func TestInmemoryRepo_Ping(t *testing.T) {
 	err := repo.Ping(ctx)
 	assert.NoError(t, err)
 }
+
+var benchmarkSizes = []int{1_000, 1_000_000}
+
+func fillRepo(b *testing.B, repo *inmemoryRepository, size int) {
+	ctx := context.Background()
+	batch := make([]models.URL, 0, 10_000)
+
+	for i := 0; i < size; i++ {
+		id := strconv.Itoa(i)
+		batch = append(batch, models.URL{ShortURL: id, OriginalURL: "https://bench.ru/" + id})
+
+		if len(batch) == cap(batch) || i == size-1 {
+			err := repo.AddBatch(ctx, batch, "user"+strconv.Itoa(i%1_000))
+			require.NoError(b, err)
+			batch = batch[:0]
+		}
+	}
+}
+
+func BenchmarkInmemoryRepo_Add(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		b.Run(fmt.Sprintf("links=%d", size), func(b *testing.B) {
+			ctx := context.Background()
+			repo := NewRepository()
+			fillRepo(b, repo, size)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				id := strconv.Itoa(size + i)
+				_ = repo.Add(ctx, models.URL{ShortURL: id, OriginalURL: "https://bench.ru/" + id}, defaultUserID)
+			}
+		})
+	}
+}
+
+func BenchmarkInmemoryRepo_Get(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		b.Run(fmt.Sprintf("links=%d", size), func(b *testing.B) {
+			ctx := context.Background()
+			repo := NewRepository()
+			fillRepo(b, repo, size)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				_, _ = repo.Get(ctx, strconv.Itoa(i%size))
+			}
+		})
+	}
+}
@@ -3,19 +3,31 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"net/url"
 	"time"
 
 	sq "github.com/Masterminds/squirrel"
 	"github.com/jackc/pgerrcode"
 	"github.com/lib/pq"
 
+	changelog "github.com/bgoldovsky/shortener/db"
+	"github.com/bgoldovsky/shortener/internal/app/hll"
+	"github.com/bgoldovsky/shortener/internal/app/migrations"
 	"github.com/bgoldovsky/shortener/internal/app/models"
+	"github.com/bgoldovsky/shortener/internal/app/repositories/urls"
 	internalErrors "github.com/bgoldovsky/shortener/internal/app/repositories/urls/errors"
 )
 
-const timeout = time.Second * 3
+const (
+	timeout        = time.Second * 3
+	migrateTimeout = time.Minute
+	urlUniqueIndex = "urls_url_active_idx"
+	idPrimaryKey   = "urls_pkey"
+)
 
 var statement = sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
 
@@ -32,6 +44,15 @@ type postgresRepository struct {
 	db database
 }
 
+func init() {
+	opener := func(storageURL *url.URL) (urls.Repository, error) {
+		return NewRepository(storageURL.String())
+	}
+
+	urls.Register("postgres", opener)
+	urls.Register("postgresql", opener)
+}
+
 func NewRepository(dsn string) (*postgresRepository, error) {
 	db, err := sql.Open("postgres", dsn)
 	if err != nil {
@@ -43,31 +64,29 @@ func NewRepository(dsn string) (*postgresRepository, error) {
 	db.SetConnMaxIdleTime(time.Second * 30)
 	db.SetConnMaxLifetime(time.Minute * 2)
 
-	query := `create table if not exists urls 
-(
-    id varchar(10) not null primary key,
-    url varchar(500) not null unique,
-    user_id varchar(10) not null,
-    created_at timestamp with time zone default now() not null,
-    deleted_at  timestamp with time zone default null
-);`
-
-	_, err = db.Exec(query)
+	migrator, err := migrations.NewMigrator(db, changelog.Changelog)
 	if err != nil {
 		return nil, err
 	}
 
+	ctx, cancel := context.WithTimeout(context.Background(), migrateTimeout)
+	defer cancel()
+
+	if err = migrator.Up(ctx); err != nil {
+		return nil, fmt.Errorf("migrate database error: %w", err)
+	}
+
 	return &postgresRepository{
 		db: db,
 	}, nil
 }
 
 // Add Сохраняет URL
-func (r *postgresRepository) Add(ctx context.Context, urlID, url, userID string) error {
+func (r *postgresRepository) Add(ctx context.Context, url models.URL, userID string) error {
 	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
-	query, args, err := buildAddQuery(urlID, url, userID)
+	query, args, err := buildAddQuery(url, userID)
 	if err != nil {
 		return fmt.Errorf("build add url query error: %w", err)
 	}
@@ -75,17 +94,21 @@ func (r *postgresRepository) Add(ctx context.Context, urlID, url, userID string)
 	_, err = r.db.ExecContext(ctx, query, args...)
 	if err != nil {
 		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == pgerrcode.UniqueViolation && pqErr.Constraint == idPrimaryKey {
+			return internalErrors.NewNotUniqueURLIDErr(url.ShortURL, err)
+		}
 		if errors.As(err, &pqErr) && pqErr.Code == pgerrcode.UniqueViolation {
-			query, args, err = buildGetIDQuery(url)
+			query, args, err = buildGetIDQuery(url.OriginalURL)
 			if err != nil {
 				return fmt.Errorf("build get url id query error: %w", err)
 			}
 
+			var urlID string
 			err = r.db.QueryRowContext(ctx, query, args...).Scan(&urlID)
 			if err != nil {
 				return err
 			}
-			err = internalErrors.NewNotUniqueURLErr(urlID, url, err)
+			err = internalErrors.NewNotUniqueURLErr(urlID, url.OriginalURL, err)
 			return err
 		}
 
@@ -95,11 +118,12 @@ func (r *postgresRepository) Add(ctx context.Context, urlID, url, userID string)
 	return nil
 }
 
-func buildAddQuery(urlID, url, userID string) (sql string, args []interface{}, err error) {
+func buildAddQuery(url models.URL, userID string) (sql string, args []interface{}, err error) {
 	q := statement.
 		Insert("urls").
-		Columns("id,url,user_id").
-		Values(urlID, url, userID)
+		Columns("id,url,user_id,expires_at,redirect_type,interstitial,password_hash,not_before,max_clicks,targets,sticky,rules,passthrough,utm").
+		Values(url.ShortURL, url.OriginalURL, userID, url.ExpiresAt, url.RedirectType, url.Interstitial, nullString(url.PasswordHash),
+			url.NotBefore, url.MaxClicks, targets(url.Targets), url.Sticky, rules(url.Rules), url.Passthrough, utm{url.UTM})
 
 	return q.ToSql()
 }
@@ -128,7 +152,7 @@ func (r *postgresRepository) AddBatch(ctx context.Context, urls []models.URL, us
 		_ = tx.Rollback()
 	}(tx)
 
-	stmt, err := tx.PrepareContext(ctx, `insert into urls(id,url,user_id) values ($1,$2,$3);`)
+	stmt, err := tx.PrepareContext(ctx, `insert into urls(id,url,user_id,expires_at,redirect_type,interstitial,password_hash,not_before,max_clicks,targets,sticky,rules,passthrough,utm) values ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14);`)
 	if err != nil {
 		return err
 	}
@@ -138,7 +162,17 @@ func (r *postgresRepository) AddBatch(ctx context.Context, urls []models.URL, us
 	}(stmt)
 
 	for idx := range urls {
-		if _, err = stmt.ExecContext(ctx, urls[idx].ShortURL, urls[idx].OriginalURL, userID); err != nil {
+		if _, err = stmt.ExecContext(ctx, urls[idx].ShortURL, urls[idx].OriginalURL, userID, urls[idx].ExpiresAt, urls[idx].RedirectType, urls[idx].Interstitial, nullString(urls[idx].PasswordHash), urls[idx].NotBefore, urls[idx].MaxClicks,
+			targets(urls[idx].Targets), urls[idx].Sticky, rules(urls[idx].Rules), urls[idx].Passthrough, utm{urls[idx].UTM}); err != nil {
+			var pqErr *pq.Error
+			if errors.As(err, &pqErr) && pqErr.Code == pgerrcode.UniqueViolation && pqErr.Constraint == urlUniqueIndex {
+				_ = tx.Rollback()
+				return r.notUniqueBatchErr(ctx, urls, idx, err)
+			}
+			if errors.As(err, &pqErr) && pqErr.Code == pgerrcode.UniqueViolation && pqErr.Constraint == idPrimaryKey {
+				return internalErrors.NewNotUniqueURLIDErr(urls[idx].ShortURL, err)
+			}
+
 			return err
 		}
 	}
@@ -146,36 +180,97 @@ func (r *postgresRepository) AddBatch(ctx context.Context, urls []models.URL, us
 	return tx.Commit()
 }
 
+// notUniqueBatchErr Находит идентификатор, под которым уже сокращен конфликтующий URL пакета
+func (r *postgresRepository) notUniqueBatchErr(ctx context.Context, urls []models.URL, idx int, err error) error {
+	url := urls[idx].OriginalURL
+
+	// URL повторяется в самом пакете
+	for prev := 0; prev < idx; prev++ {
+		if urls[prev].OriginalURL == url {
+			return internalErrors.NewNotUniqueURLErr(urls[prev].ShortURL, url, err)
+		}
+	}
+
+	query, args, buildErr := buildGetIDQuery(url)
+	if buildErr != nil {
+		return fmt.Errorf("build get url id query error: %w", buildErr)
+	}
+
+	var urlID string
+	if scanErr := r.db.QueryRowContext(ctx, query, args...).Scan(&urlID); scanErr != nil {
+		return scanErr
+	}
+
+	return internalErrors.NewNotUniqueURLErr(urlID, url, err)
+}
+
 // Get Возвращает URL
-func (r *postgresRepository) Get(ctx context.Context, urlID string) (string, error) {
+func (r *postgresRepository) Get(ctx context.Context, urlID string) (models.URL, error) {
 	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
 	query, args, err := buildGetQuery(urlID)
 	if err != nil {
-		return "", fmt.Errorf("build get url query error: %w", err)
+		return models.URL{}, fmt.Errorf("build get url query error: %w", err)
 	}
 
 	var (
-		url       sql.NullString
-		deletedAt sql.NullTime
+		url          sql.NullString
+		expiresAt    sql.NullTime
+		deletedAt    sql.NullTime
+		redirectType int
+		interstitial bool
+		createdAt    time.Time
+		passwordHash sql.NullString
+		notBefore    sql.NullTime
+		maxClicks    int64
+		clickCount   int64
+		urlTargets   targets
+		sticky       bool
+		urlRules     rules
+		passthrough  bool
+		urlUTM       utm
 	)
 
-	_ = r.db.QueryRowContext(ctx, query, args...).Scan(&url, &deletedAt)
+	err = r.db.QueryRowContext(ctx, query, args...).Scan(&url, &expiresAt, &deletedAt, &redirectType, &interstitial, &createdAt, &passwordHash,
+		&notBefore, &maxClicks, &clickCount, &urlTargets, &sticky, &urlRules, &passthrough, &urlUTM)
+	// Отсутствие ссылки кэшируется, поэтому только его нельзя путать со сбоем базы
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.URL{}, internalErrors.ErrURLNotFound
+	}
+	if err != nil {
+		return models.URL{}, fmt.Errorf("get url error: %w", err)
+	}
 	if deletedAt.Valid {
-		return "", internalErrors.ErrURLDeleted
+		return models.URL{}, internalErrors.ErrURLDeleted
 	}
 	if !url.Valid {
-		return "", internalErrors.ErrURLNotFound
+		return models.URL{}, internalErrors.ErrURLNotFound
 	}
 
-	return url.String, nil
+	return models.URL{
+		ShortURL:     urlID,
+		OriginalURL:  url.String,
+		ExpiresAt:    nullTime(expiresAt),
+		RedirectType: redirectType,
+		Interstitial: interstitial,
+		CreatedAt:    createdAt,
+		PasswordHash: passwordHash.String,
+		NotBefore:    nullTime(notBefore),
+		MaxClicks:    maxClicks,
+		ClickCount:   clickCount,
+		Targets:      urlTargets,
+		Sticky:       sticky,
+		Rules:        urlRules,
+		Passthrough:  passthrough,
+		UTM:          urlUTM.value,
+	}, nil
 
 }
 
 func buildGetQuery(urlID string) (sql string, args []interface{}, err error) {
 	q := statement.
-		Select("url", "deleted_at").
+		Select("url", "expires_at", "deleted_at", "redirect_type", "interstitial", "created_at", "password_hash", "not_before", "max_clicks", "click_count", "targets", "sticky", "rules", "passthrough", "utm").
 		From("urls").
 		Where(sq.And{
 			sq.Eq{"id": urlID},
@@ -195,15 +290,17 @@ func (r *postgresRepository) GetList(ctx context.Context, userID string) ([]mode
 	}
 
 	res := make([]models.URL, 0)
-	rows, _ := r.db.QueryContext(ctx, query, args...)
-	err = rows.Err()
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 
+	defer func(rows *sql.Rows) {
+		_ = rows.Close()
+	}(rows)
+
 	for rows.Next() {
-		var url models.URL
-		err = rows.Scan(&url.ShortURL, &url.OriginalURL)
+		url, err := scanUserURL(rows.Scan)
 		if err != nil {
 			return nil, err
 		}
@@ -211,14 +308,74 @@ func (r *postgresRepository) GetList(ctx context.Context, userID string) ([]mode
 		res = append(res, url)
 	}
 
-	return res, nil
+	return res, rows.Err()
+}
+
+// userURLColumns Колонки ссылки пользователя в порядке scanUserURL
+const userURLColumns = "id, url, expires_at, redirect_type, interstitial, created_at, password_hash, not_before, max_clicks, click_count, targets, sticky, rules, passthrough, utm"
+
+// scanUserURL Читает ссылку из колонок userURLColumns
+func scanUserURL(scan func(dest ...interface{}) error) (models.URL, error) {
+	var (
+		url          models.URL
+		expiresAt    sql.NullTime
+		passwordHash sql.NullString
+		notBefore    sql.NullTime
+		urlUTM       utm
+	)
+	err := scan(&url.ShortURL, &url.OriginalURL, &expiresAt, &url.RedirectType, &url.Interstitial, &url.CreatedAt, &passwordHash,
+		&notBefore, &url.MaxClicks, &url.ClickCount, (*targets)(&url.Targets), &url.Sticky, (*rules)(&url.Rules), &url.Passthrough, &urlUTM)
+	if err != nil {
+		return models.URL{}, err
+	}
+
+	url.ExpiresAt = nullTime(expiresAt)
+	url.PasswordHash = passwordHash.String
+	url.NotBefore = nullTime(notBefore)
+	url.UTM = urlUTM.value
+
+	return url, nil
 }
 
 func buildGetListQuery(userID string) (sql string, args []interface{}, err error) {
 	q := statement.
-		Select("id, url").
+		Select(userURLColumns).
+		From("urls").
+		Where(sq.And{
+			sq.Eq{"user_id": userID},
+			sq.Eq{"deleted_at": nil},
+		})
+
+	return q.ToSql()
+}
+
+// GetByUser Возвращает действующую ссылку пользователя
+func (r *postgresRepository) GetByUser(ctx context.Context, urlID, userID string) (models.URL, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	query, args, err := buildGetByUserQuery(urlID, userID)
+	if err != nil {
+		return models.URL{}, fmt.Errorf("build get user url query error: %w", err)
+	}
+
+	url, err := scanUserURL(r.db.QueryRowContext(ctx, query, args...).Scan)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.URL{}, internalErrors.ErrURLNotFound
+	}
+	if err != nil {
+		return models.URL{}, fmt.Errorf("get user url error: %w", err)
+	}
+
+	return url, nil
+}
+
+func buildGetByUserQuery(urlID, userID string) (sql string, args []interface{}, err error) {
+	q := statement.
+		Select(userURLColumns).
 		From("urls").
 		Where(sq.And{
+			sq.Eq{"id": urlID},
 			sq.Eq{"user_id": userID},
 			sq.Eq{"deleted_at": nil},
 		})
@@ -226,6 +383,236 @@ func buildGetListQuery(userID string) (sql string, args []interface{}, err error
 	return q.ToSql()
 }
 
+// CountClick Учитывает переход по ссылке, если лимит переходов не исчерпан.
+// Проверка лимита входит в условие обновления, поэтому параллельные переходы его не превысят
+func (r *postgresRepository) CountClick(ctx context.Context, urlID string) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	query, args, err := buildCountClickQuery(urlID)
+	if err != nil {
+		return fmt.Errorf("build count click query error: %w", err)
+	}
+
+	res, err := r.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("count click error: %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("count click error: %w", err)
+	}
+	if affected > 0 {
+		return nil
+	}
+
+	// Ничего не обновили: выясняем причину. Сбой базы возвращается как есть, а не как отсутствие ссылки
+	_, err = r.Get(ctx, urlID)
+	if errors.Is(err, internalErrors.ErrURLNotFound) || errors.Is(err, internalErrors.ErrURLDeleted) {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("count click error: %w", err)
+	}
+
+	return internalErrors.ErrClickLimit
+}
+
+func buildCountClickQuery(urlID string) (sql string, args []interface{}, err error) {
+	q := statement.
+		Update("urls").
+		Set("click_count", sq.Expr("click_count + 1")).
+		Where(sq.And{
+			sq.Eq{"id": urlID},
+			sq.Eq{"deleted_at": nil},
+			sq.Or{
+				sq.Eq{"max_clicks": 0},
+				sq.Expr("click_count < max_clicks"),
+			},
+		})
+
+	return q.ToSql()
+}
+
+// targets Адреса назначения ссылки в колонке jsonb, null для ссылки с одним адресом
+type targets []models.Target
+
+type target struct {
+	URL    string `json:"url"`
+	Weight int    `json:"weight"`
+}
+
+func (t targets) Value() (driver.Value, error) {
+	if len(t) == 0 {
+		return nil, nil
+	}
+
+	res := make([]target, len(t))
+	for idx := range t {
+		res[idx] = target{URL: t[idx].URL, Weight: t[idx].Weight}
+	}
+
+	return json.Marshal(res)
+}
+
+func (t *targets) Scan(src interface{}) error {
+	*t = nil
+
+	data, ok := src.([]byte)
+	if src == nil || ok && len(data) == 0 {
+		return nil
+	}
+	if !ok {
+		return fmt.Errorf("unexpected targets type %T", src)
+	}
+
+	var res []target
+	if err := json.Unmarshal(data, &res); err != nil {
+		return fmt.Errorf("deserialize targets error: %w", err)
+	}
+
+	for idx := range res {
+		*t = append(*t, models.Target{URL: res[idx].URL, Weight: res[idx].Weight})
+	}
+
+	return nil
+}
+
+// rules Правила перенаправления ссылки в колонке jsonb, null для ссылки без правил
+type rules []models.Rule
+
+type rule struct {
+	Platforms []string          `json:"platforms,omitempty"`
+	Languages []string          `json:"languages,omitempty"`
+	Query     map[string]string `json:"query,omitempty"`
+	Hours     *timeWindow       `json:"hours,omitempty"`
+	Target    string            `json:"target"`
+}
+
+type timeWindow struct {
+	From int `json:"from"`
+	To   int `json:"to"`
+}
+
+func (r rules) Value() (driver.Value, error) {
+	if len(r) == 0 {
+		return nil, nil
+	}
+
+	res := make([]rule, len(r))
+	for idx := range r {
+		res[idx] = rule{
+			Platforms: r[idx].Platforms,
+			Languages: r[idx].Languages,
+			Query:     r[idx].Query,
+			Target:    r[idx].Target,
+		}
+		if hours := r[idx].Hours; hours != nil {
+			res[idx].Hours = &timeWindow{From: hours.From, To: hours.To}
+		}
+	}
+
+	return json.Marshal(res)
+}
+
+func (r *rules) Scan(src interface{}) error {
+	*r = nil
+
+	data, ok := src.([]byte)
+	if src == nil || ok && len(data) == 0 {
+		return nil
+	}
+	if !ok {
+		return fmt.Errorf("unexpected rules type %T", src)
+	}
+
+	var res []rule
+	if err := json.Unmarshal(data, &res); err != nil {
+		return fmt.Errorf("deserialize rules error: %w", err)
+	}
+
+	for idx := range res {
+		item := models.Rule{
+			Platforms: res[idx].Platforms,
+			Languages: res[idx].Languages,
+			Query:     res[idx].Query,
+			Target:    res[idx].Target,
+		}
+		if hours := res[idx].Hours; hours != nil {
+			item.Hours = &models.TimeWindow{From: hours.From, To: hours.To}
+		}
+		*r = append(*r, item)
+	}
+
+	return nil
+}
+
+// utm Метки кампании ссылки в колонке jsonb, null для ссылки без меток
+type utm struct {
+	value *models.UTM
+}
+
+type utmFields struct {
+	Source   string `json:"source,omitempty"`
+	Medium   string `json:"medium,omitempty"`
+	Campaign string `json:"campaign,omitempty"`
+	Term     string `json:"term,omitempty"`
+	Content  string `json:"content,omitempty"`
+}
+
+func (u utm) Value() (driver.Value, error) {
+	if u.value == nil {
+		return nil, nil
+	}
+
+	return json.Marshal(utmFields{
+		Source:   u.value.Source,
+		Medium:   u.value.Medium,
+		Campaign: u.value.Campaign,
+		Term:     u.value.Term,
+		Content:  u.value.Content,
+	})
+}
+
+func (u *utm) Scan(src interface{}) error {
+	u.value = nil
+
+	data, ok := src.([]byte)
+	if src == nil || ok && len(data) == 0 {
+		return nil
+	}
+	if !ok {
+		return fmt.Errorf("unexpected utm type %T", src)
+	}
+
+	var res utmFields
+	if err := json.Unmarshal(data, &res); err != nil {
+		return fmt.Errorf("deserialize utm error: %w", err)
+	}
+
+	u.value = &models.UTM{
+		Source:   res.Source,
+		Medium:   res.Medium,
+		Campaign: res.Campaign,
+		Term:     res.Term,
+		Content:  res.Content,
+	}
+
+	return nil
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+func nullTime(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
 // Delete Удаляет список URL указанного пользователя
 func (r *postgresRepository) Delete(ctx context.Context, urlsBatch []models.UserCollection) error {
 	tx, err := r.db.Begin()
@@ -259,6 +646,240 @@ func (r *postgresRepository) Delete(ctx context.Context, urlsBatch []models.User
 	return tx.Commit()
 }
 
+// AddClicks Сохраняет переходы по ссылкам
+func (r *postgresRepository) AddClicks(ctx context.Context, clicks []models.Click) error {
+	if len(clicks) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	query, args, err := buildAddClicksQuery(clicks)
+	if err != nil {
+		return fmt.Errorf("build add clicks query error: %w", err)
+	}
+
+	_, err = r.db.ExecContext(ctx, query, args...)
+
+	return err
+}
+
+func buildAddClicksQuery(clicks []models.Click) (sql string, args []interface{}, err error) {
+	q := statement.
+		Insert("clicks").
+		Columns("url_id,clicked_at,referrer,user_agent,ip,accept_language,bot,country,city,target")
+
+	for idx := range clicks {
+		q = q.Values(clicks[idx].URLID, clicks[idx].Time, clicks[idx].Referrer, clicks[idx].UserAgent,
+			clicks[idx].IP, clicks[idx].AcceptLanguage, clicks[idx].Bot, clicks[idx].Country, clicks[idx].City, clicks[idx].Target)
+	}
+
+	return q.ToSql()
+}
+
+// GetClickCounts Возвращает количества переходов по ссылке за минуты, начавшиеся в [from, to).
+// Переходы складываются по минутам в базе
+func (r *postgresRepository) GetClickCounts(ctx context.Context, urlID string, from, to time.Time) ([]models.ClickCount, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	query, args, err := buildGetClickCountsQuery(urlID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("build get click counts query error: %w", err)
+	}
+
+	res := make([]models.ClickCount, 0)
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func(rows *sql.Rows) {
+		_ = rows.Close()
+	}(rows)
+
+	for rows.Next() {
+		count := models.ClickCount{URLID: urlID}
+		err = rows.Scan(&count.Minute, &count.Bot, &count.Country, &count.City, &count.Target, &count.Count)
+		if err != nil {
+			return nil, err
+		}
+
+		count.Minute = count.Minute.UTC()
+		res = append(res, count)
+	}
+
+	return res, rows.Err()
+}
+
+func buildGetClickCountsQuery(urlID string, from, to time.Time) (sql string, args []interface{}, err error) {
+	q := statement.
+		Select("date_trunc('minute', clicked_at) as minute, bot, country, city, target, count(*)").
+		From("clicks").
+		Where(sq.And{
+			sq.Eq{"url_id": urlID},
+			sq.GtOrEq{"clicked_at": from},
+			sq.Lt{"clicked_at": to},
+		}).
+		GroupBy("minute", "bot", "country", "city", "target").
+		OrderBy("minute")
+
+	return q.ToSql()
+}
+
+// MergeVisitors Объединяет суточные оценки посетителей с сохраненными.
+// Строки блокируются до конца транзакции, чтобы конкурентные объединения не потеряли друг друга
+func (r *postgresRepository) MergeVisitors(ctx context.Context, visitors []models.DailyVisitors) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	for _, v := range visitors {
+		if _, err = tx.ExecContext(ctx, `insert into visitors(url_id, day, sketch) values ($1, $2, $3)
+on conflict (url_id, day) do nothing;`, v.URLID, v.Day, []byte{}); err != nil {
+			return err
+		}
+
+		var data []byte
+		err = tx.QueryRowContext(ctx, `select sketch from visitors where url_id=$1 and day=$2 for update;`,
+			v.URLID, v.Day).Scan(&data)
+		if err != nil {
+			return err
+		}
+
+		// Пустая оценка означает, что строку только что вставили
+		sketch := hll.New()
+		if len(data) > 0 {
+			if err = sketch.UnmarshalBinary(data); err != nil {
+				return fmt.Errorf("deserialize visitors error: %w", err)
+			}
+		}
+		sketch.Merge(v.Sketch)
+
+		if data, err = sketch.MarshalBinary(); err != nil {
+			return fmt.Errorf("serialize visitors error: %w", err)
+		}
+		if _, err = tx.ExecContext(ctx, `update visitors set sketch=$3 where url_id=$1 and day=$2;`,
+			v.URLID, v.Day, data); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetVisitors Возвращает суточные оценки посетителей ссылки за сутки, начавшиеся в [from, to)
+func (r *postgresRepository) GetVisitors(ctx context.Context, urlID string, from, to time.Time) ([]models.DailyVisitors, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	query, args, err := buildGetVisitorsQuery(urlID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("build get visitors query error: %w", err)
+	}
+
+	res := make([]models.DailyVisitors, 0)
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func(rows *sql.Rows) {
+		_ = rows.Close()
+	}(rows)
+
+	for rows.Next() {
+		var (
+			day  time.Time
+			data []byte
+		)
+		if err = rows.Scan(&day, &data); err != nil {
+			return nil, err
+		}
+
+		sketch := hll.New()
+		if err = sketch.UnmarshalBinary(data); err != nil {
+			return nil, fmt.Errorf("deserialize visitors error: %w", err)
+		}
+
+		res = append(res, models.DailyVisitors{URLID: urlID, Day: day.UTC(), Sketch: sketch})
+	}
+
+	return res, rows.Err()
+}
+
+func buildGetVisitorsQuery(urlID string, from, to time.Time) (sql string, args []interface{}, err error) {
+	q := statement.
+		Select("day, sketch").
+		From("visitors").
+		Where(sq.And{
+			sq.Eq{"url_id": urlID},
+			sq.GtOrEq{"day": from},
+			sq.Lt{"day": to},
+		}).
+		OrderBy("day")
+
+	return q.ToSql()
+}
+
+// SetUTMTemplate Сохраняет шаблон UTM-меток пользователя, nil удаляет шаблон
+func (r *postgresRepository) SetUTMTemplate(ctx context.Context, userID string, template *models.UTM) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if template == nil {
+		_, err := r.db.ExecContext(ctx, `delete from utm_templates where user_id = $1;`, userID)
+		return err
+	}
+
+	_, err := r.db.ExecContext(ctx, `insert into utm_templates(user_id, utm) values ($1, $2)
+on conflict (user_id) do update set utm = excluded.utm;`, userID, utm{template})
+
+	return err
+}
+
+// GetUTMTemplate Возвращает шаблон UTM-меток пользователя, nil если шаблона нет
+func (r *postgresRepository) GetUTMTemplate(ctx context.Context, userID string) (*models.UTM, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var template utm
+	err := r.db.QueryRowContext(ctx, `select utm from utm_templates where user_id = $1;`, userID).Scan(&template)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get utm template error: %w", err)
+	}
+
+	return template.value, nil
+}
+
+// Lease Резервирует диапазон [start, start+size) счетчика name одним атомарным запросом
+func (r *postgresRepository) Lease(ctx context.Context, name string, size int64) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var start int64
+	err := r.db.QueryRowContext(ctx, `insert into id_sequences(name, next) values ($1, $2::bigint)
+on conflict (name) do update set next = id_sequences.next + excluded.next
+returning next - $2::bigint;`, name, size).Scan(&start)
+	if err != nil {
+		return 0, fmt.Errorf("lease %s sequence error: %w", name, err)
+	}
+
+	return start, nil
+}
+
 // Ping Проверяет доступность базы данных
 func (r *postgresRepository) Ping(ctx context.Context) error {
 	ctx, cancel := context.WithTimeout(ctx, timeout)
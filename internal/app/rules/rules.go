@@ -0,0 +1,156 @@
+package rules
+
+import (
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bgoldovsky/shortener/internal/app/models"
+)
+
+// Платформы клиента
+const (
+	IOS     = "ios"
+	Android = "android"
+	Desktop = "desktop"
+)
+
+// MinutesPerDay Граница минут в интервале времени суток
+const MinutesPerDay = 24 * 60
+
+// iosMarkers Признаки iOS в User-Agent. iPadOS в режиме компьютера не отличить от macOS
+var iosMarkers = []string{"iphone", "ipad", "ipod"}
+
+// Request Признаки запроса, по которым выбирается правило
+type Request struct {
+	UserAgent      string
+	AcceptLanguage string
+	Query          url.Values
+	Time           time.Time
+}
+
+// Match Возвращает номер первого правила, которому удовлетворяет запрос
+func Match(rules []models.Rule, req Request) (int, bool) {
+	platform := Platform(req.UserAgent)
+	language := Language(req.AcceptLanguage)
+	minute := req.Time.UTC().Hour()*60 + req.Time.UTC().Minute()
+
+	for idx := range rules {
+		if matches(&rules[idx], platform, language, req.Query, minute) {
+			return idx, true
+		}
+	}
+
+	return 0, false
+}
+
+func matches(rule *models.Rule, platform, language string, query url.Values, minute int) bool {
+	if len(rule.Platforms) > 0 && !contains(rule.Platforms, platform) {
+		return false
+	}
+
+	if len(rule.Languages) > 0 && !contains(rule.Languages, language) {
+		return false
+	}
+
+	for name, value := range rule.Query {
+		if query.Get(name) != value {
+			return false
+		}
+	}
+
+	if rule.Hours != nil && !inWindow(*rule.Hours, minute) {
+		return false
+	}
+
+	return true
+}
+
+func inWindow(window models.TimeWindow, minute int) bool {
+	if window.From <= window.To {
+		return minute >= window.From && minute < window.To
+	}
+
+	return minute >= window.From || minute < window.To
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Platform Определяет платформу клиента по User-Agent. Все, что не iOS и не Android, считается компьютером
+func Platform(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+
+	for _, marker := range iosMarkers {
+		if strings.Contains(ua, marker) {
+			return IOS
+		}
+	}
+
+	if strings.Contains(ua, "android") {
+		return Android
+	}
+
+	return Desktop
+}
+
+// ValidPlatform Проверяет, что платформа известна
+func ValidPlatform(platform string) bool {
+	return platform == IOS || platform == Android || platform == Desktop
+}
+
+// Language Возвращает основной язык самого предпочтительного варианта Accept-Language, например ru для ru-RU
+func Language(acceptLanguage string) string {
+	type option struct {
+		language string
+		quality  float64
+	}
+
+	options := make([]option, 0)
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		fields := strings.Split(part, ";")
+
+		tag := strings.TrimSpace(fields[0])
+		if tag == "" || tag == "*" {
+			continue
+		}
+		if dash := strings.IndexByte(tag, '-'); dash >= 0 {
+			tag = tag[:dash]
+		}
+
+		quality := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if !strings.HasPrefix(param, "q=") {
+				continue
+			}
+			if q, err := strconv.ParseFloat(param[2:], 64); err == nil {
+				quality = q
+			}
+		}
+
+		if quality > 0 {
+			options = append(options, option{language: strings.ToLower(tag), quality: quality})
+		}
+	}
+
+	if len(options) == 0 {
+		return ""
+	}
+
+	// При равном весе побеждает указанный раньше
+	sort.SliceStable(options, func(i, j int) bool {
+		return options[i].quality > options[j].quality
+	})
+
+	return options[0].language
+}
@@ -0,0 +1,91 @@
+package rules
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bgoldovsky/shortener/internal/app/models"
+)
+
+const (
+	iPhoneUA  = "Mozilla/5.0 (iPhone; CPU iPhone OS 15_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/15.5 Mobile/15E148 Safari/604.1"
+	androidUA = "Mozilla/5.0 (Linux; Android 12; Pixel 6) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/103.0.0.0 Mobile Safari/537.36"
+	desktopUA = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/103.0.0.0 Safari/537.36"
+)
+
+func TestPlatform(t *testing.T) {
+	tests := []struct {
+		userAgent string
+		exp       string
+	}{
+		{userAgent: iPhoneUA, exp: IOS},
+		{userAgent: "Mozilla/5.0 (iPad; CPU OS 15_5 like Mac OS X)", exp: IOS},
+		{userAgent: androidUA, exp: Android},
+		{userAgent: desktopUA, exp: Desktop},
+		{userAgent: "", exp: Desktop},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.exp, Platform(tt.userAgent), tt.userAgent)
+	}
+}
+
+func TestLanguage(t *testing.T) {
+	tests := []struct {
+		acceptLanguage string
+		exp            string
+	}{
+		{acceptLanguage: "ru-RU,ru;q=0.9,en-US;q=0.8,en;q=0.7", exp: "ru"},
+		{acceptLanguage: "en;q=0.5, de-DE", exp: "de"},
+		{acceptLanguage: "fr, en", exp: "fr"},
+		{acceptLanguage: "*, en;q=0.1", exp: "en"},
+		{acceptLanguage: "de;q=0, en;q=0.1", exp: "en"},
+		{acceptLanguage: "EN-gb", exp: "en"},
+		{acceptLanguage: "", exp: ""},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.exp, Language(tt.acceptLanguage), tt.acceptLanguage)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	rules := []models.Rule{
+		{Platforms: []string{IOS}, Target: "https://apps.apple.com/app"},
+		{Platforms: []string{Android}, Languages: []string{"ru"}, Target: "https://play.google.com/app?hl=ru"},
+		{Platforms: []string{Android}, Target: "https://play.google.com/app"},
+		{Query: map[string]string{"utm_source": "email"}, Target: "https://avito.ru/email"},
+		{Hours: &models.TimeWindow{From: 22 * 60, To: 6 * 60}, Target: "https://avito.ru/night"},
+	}
+	noon := time.Date(2022, 5, 1, 12, 0, 0, 0, time.UTC)
+	night := time.Date(2022, 5, 1, 23, 30, 0, 0, time.UTC)
+	morning := time.Date(2022, 5, 1, 5, 59, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		req     Request
+		exp     int
+		matched bool
+	}{
+		{name: "ios", req: Request{UserAgent: iPhoneUA, AcceptLanguage: "ru", Time: noon}, exp: 0, matched: true},
+		{name: "android in russian", req: Request{UserAgent: androidUA, AcceptLanguage: "ru-RU,en;q=0.5", Time: noon}, exp: 1, matched: true},
+		{name: "android in english", req: Request{UserAgent: androidUA, AcceptLanguage: "en-US", Time: noon}, exp: 2, matched: true},
+		{name: "query", req: Request{UserAgent: desktopUA, Query: url.Values{"utm_source": {"email"}}, Time: noon}, exp: 3, matched: true},
+		{name: "query mismatch", req: Request{UserAgent: desktopUA, Query: url.Values{"utm_source": {"ads"}}, Time: noon}},
+		{name: "night across midnight", req: Request{UserAgent: desktopUA, Time: night}, exp: 4, matched: true},
+		{name: "window end is exclusive", req: Request{UserAgent: desktopUA, Time: morning.Add(time.Minute)}},
+		{name: "early morning", req: Request{UserAgent: desktopUA, Time: morning}, exp: 4, matched: true},
+		{name: "time in other zone", req: Request{UserAgent: desktopUA, Time: noon.In(time.FixedZone("MSK", 3*3600)).Add(11 * time.Hour)}, exp: 4, matched: true},
+		{name: "fallback", req: Request{UserAgent: desktopUA, Time: noon}},
+	}
+
+	for _, tt := range tests {
+		idx, ok := Match(rules, tt.req)
+
+		assert.Equal(t, tt.matched, ok, tt.name)
+		assert.Equal(t, tt.exp, idx, tt.name)
+	}
+}
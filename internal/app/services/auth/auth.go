@@ -3,8 +3,6 @@ package auth
 
 import "github.com/sirupsen/logrus"
 
-const idLength = 8
-
 type generator interface {
 	RandomString(n int64) (string, error)
 }
@@ -17,18 +15,21 @@ type hasher interface {
 type service struct {
 	hasher    hasher
 	generator generator
+	idLength  int64
 }
 
-func NewService(generator generator, hasher hasher) *service {
+// NewService Создает сервис аутентификации. Изменение idLength делает недействительными выданные ранее токены
+func NewService(generator generator, hasher hasher, idLength int64) *service {
 	return &service{
 		generator: generator,
 		hasher:    hasher,
+		idLength:  idLength,
 	}
 }
 
 // SignUp Регистрирует пользователя в системе, возвращая userID и подписанный токен
 func (s *service) SignUp() (string, string, error) {
-	userID, err := s.generator.RandomString(idLength)
+	userID, err := s.generator.RandomString(s.idLength)
 	if err != nil {
 		logrus.WithError(err).WithField("userID", userID).Error("generate userID error")
 		return userID, "", err
@@ -45,7 +46,7 @@ func (s *service) SignUp() (string, string, error) {
 
 // SignIn Аутентифицирует пользователя по токену и возвращает его userID
 func (s *service) SignIn(token string) (string, error) {
-	userID, err := s.hasher.Validate(token, idLength)
+	userID, err := s.hasher.Validate(token, s.idLength)
 	if err != nil {
 		logrus.WithError(err).WithField("token", token).Error("validate userID sign error")
 		return "", err
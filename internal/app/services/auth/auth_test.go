@@ -10,6 +10,8 @@ import (
 	mockUrls "github.com/bgoldovsky/shortener/internal/app/services/auth/mocks"
 )
 
+const idLength int64 = 8
+
 func TestService_SignUp(t *testing.T) {
 	tests := []struct {
 		name   string
@@ -35,12 +37,12 @@ func TestService_SignUp(t *testing.T) {
 
 	for _, tt := range tests {
 		genMock := mockUrls.NewMockgenerator(ctrl)
-		genMock.EXPECT().RandomString(int64(idLength)).Return(tt.userID, nil)
+		genMock.EXPECT().RandomString(idLength).Return(tt.userID, nil)
 
 		hasherMock := mockUrls.NewMockhasher(ctrl)
 		hasherMock.EXPECT().Sign(tt.userID).Return(tt.token, tt.err)
 
-		s := NewService(genMock, hasherMock)
+		s := NewService(genMock, hasherMock, idLength)
 		actUserID, actToken, err := s.SignUp()
 
 		assert.Equal(t, tt.err, err)
@@ -76,9 +78,9 @@ func TestService_SignIn(t *testing.T) {
 		genMock := mockUrls.NewMockgenerator(ctrl)
 
 		hasherMock := mockUrls.NewMockhasher(ctrl)
-		hasherMock.EXPECT().Validate(tt.token, int64(idLength)).Return(tt.userID, tt.err)
+		hasherMock.EXPECT().Validate(tt.token, idLength).Return(tt.userID, tt.err)
 
-		s := NewService(genMock, hasherMock)
+		s := NewService(genMock, hasherMock, idLength)
 		act, err := s.SignIn(tt.token)
 
 		assert.Equal(t, tt.err, err)
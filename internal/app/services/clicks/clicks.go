@@ -0,0 +1,332 @@
+//go:generate mockgen -source=clicks.go -destination=mocks/mocks.go
+
+package clicks
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/bgoldovsky/shortener/internal/app/hll"
+	"github.com/bgoldovsky/shortener/internal/app/models"
+	internalErrors "github.com/bgoldovsky/shortener/internal/app/repositories/urls/errors"
+)
+
+const (
+	batchSize     = 500
+	flushInterval = time.Second
+	flushTimeout  = time.Second * 5
+
+	// maxBuckets Ограничивает размер ответа статистики
+	maxBuckets = 1000
+
+	day = time.Hour * 24
+)
+
+var (
+	ErrURLNotFound   = errors.New("url not found")
+	ErrInvalidPeriod = errors.New("invalid period")
+)
+
+type clicksRepository interface {
+	AddClicks(ctx context.Context, clicks []models.Click) error
+	GetClickCounts(ctx context.Context, urlID string, from, to time.Time) ([]models.ClickCount, error)
+	MergeVisitors(ctx context.Context, visitors []models.DailyVisitors) error
+	GetVisitors(ctx context.Context, urlID string, from, to time.Time) ([]models.DailyVisitors, error)
+	GetByUser(ctx context.Context, urlID, userID string) (models.URL, error)
+}
+
+type geo interface {
+	Resolve(ip string) models.Location
+}
+
+type service struct {
+	// Счетчик идет первым ради выравнивания атомарных операций на 32-битных платформах
+	dropped int64
+
+	clicksRepo clicksRepository
+	geo        geo
+	clicksCh   chan models.Click
+	doneCh     <-chan struct{}
+}
+
+func NewService(clicksRepo clicksRepository, geo geo, clicksCh chan models.Click, doneCh <-chan struct{}) *service {
+	return &service{
+		clicksRepo: clicksRepo,
+		geo:        geo,
+		clicksCh:   clicksCh,
+		doneCh:     doneCh,
+	}
+}
+
+// Queue Ставит переход в очередь на сохранение. Не блокирует редирект:
+// при переполненной очереди переход отбрасывается
+func (s *service) Queue(click models.Click) {
+	select {
+	case s.clicksCh <- click:
+	default:
+		atomic.AddInt64(&s.dropped, 1)
+	}
+}
+
+// Run Запускает асинхронное сохранение переходов пачками
+func (s *service) Run() {
+	go func() {
+		ticker := time.NewTicker(flushInterval)
+		defer ticker.Stop()
+
+		batch := make([]models.Click, 0, batchSize)
+
+		for {
+			select {
+			case click := <-s.clicksCh:
+				batch = append(batch, click)
+				if len(batch) >= batchSize {
+					batch = s.flush(batch)
+				}
+			case <-ticker.C:
+				batch = s.flush(batch)
+			case <-s.doneCh:
+				s.flush(batch)
+				logrus.Info("clicks worker done")
+				return
+			}
+		}
+	}()
+}
+
+// flush Сохраняет накопленные переходы и возвращает опустошенный буфер
+func (s *service) flush(batch []models.Click) []models.Click {
+	if dropped := atomic.SwapInt64(&s.dropped, 0); dropped > 0 {
+		logrus.WithField("dropped", dropped).Warn("clicks queue is full, clicks dropped")
+	}
+
+	if len(batch) == 0 {
+		return batch
+	}
+
+	// Местоположение определяем здесь, а не при редиректе, чтобы не задерживать ответ
+	for idx := range batch {
+		location := s.geo.Resolve(batch[idx].IP)
+		batch[idx].Country = location.Country
+		batch[idx].City = location.City
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+	defer cancel()
+
+	if err := s.clicksRepo.AddClicks(ctx, batch); err != nil {
+		logrus.WithError(err).WithField("clicks", len(batch)).Error("save clicks error")
+	}
+
+	if err := s.clicksRepo.MergeVisitors(ctx, visitors(batch)); err != nil {
+		logrus.WithError(err).WithField("clicks", len(batch)).Error("save visitors error")
+	}
+
+	return batch[:0]
+}
+
+// visitors Строит суточные оценки посетителей-людей пачки. Посетитель определяется хэшем адреса и User-Agent
+func visitors(batch []models.Click) []models.DailyVisitors {
+	type key struct {
+		urlID string
+		day   time.Time
+	}
+
+	sketches := map[key]*hll.Sketch{}
+	res := make([]models.DailyVisitors, 0)
+
+	for idx := range batch {
+		if batch[idx].Bot {
+			continue
+		}
+
+		k := key{urlID: batch[idx].URLID, day: batch[idx].Time.UTC().Truncate(day)}
+		sketch, ok := sketches[k]
+		if !ok {
+			sketch = hll.New()
+			sketches[k] = sketch
+			res = append(res, models.DailyVisitors{URLID: k.urlID, Day: k.day, Sketch: sketch})
+		}
+
+		sketch.Add(hll.Hash(batch[idx].IP + "\x00" + batch[idx].UserAgent))
+	}
+
+	return res
+}
+
+// Stats Возвращает количество переходов по ссылке пользователя за период [from, to) с разбивкой по интервалам bucket
+func (s *service) Stats(ctx context.Context, urlID, userID string, from, to time.Time, bucket time.Duration) (models.ClickStats, error) {
+	if bucket <= 0 || !from.Before(to) || to.Sub(from)/bucket >= maxBuckets {
+		return models.ClickStats{}, ErrInvalidPeriod
+	}
+
+	link, err := s.owned(ctx, urlID, userID)
+	if err != nil {
+		return models.ClickStats{}, err
+	}
+
+	// Переходы хранятся количествами по минутам, поэтому берем все минуты, которые затрагивает период
+	fromMinute, toMinute := from.UTC().Truncate(time.Minute), to.UTC().Truncate(time.Minute)
+	if toMinute.Before(to) {
+		toMinute = toMinute.Add(time.Minute)
+	}
+
+	counts, err := s.clicksRepo.GetClickCounts(ctx, urlID, fromMinute, toMinute)
+	if err != nil {
+		logrus.WithError(err).WithField("urlID", urlID).Error("get clicks error")
+		return models.ClickStats{}, err
+	}
+
+	stats := aggregate(counts, from, to, bucket)
+	stats.Targets = targetBreakdown(counts, link.Targets)
+
+	// Оценки хранятся посуточно, поэтому берем все сутки, которые затрагивает период
+	days, err := s.clicksRepo.GetVisitors(ctx, urlID, from.UTC().Truncate(day), to)
+	if err != nil {
+		logrus.WithError(err).WithField("urlID", urlID).Error("get visitors error")
+		return models.ClickStats{}, err
+	}
+
+	countVisitors(&stats, days, bucket)
+
+	return stats, nil
+}
+
+// countVisitors Объединяет суточные оценки в оценку за период и заполняет суточные интервалы
+func countVisitors(stats *models.ClickStats, days []models.DailyVisitors, bucket time.Duration) {
+	total := hll.New()
+	byDay := make(map[time.Time]int64, len(days))
+
+	for _, d := range days {
+		total.Merge(d.Sketch)
+		byDay[d.Day.UTC()] = int64(d.Sketch.Count())
+	}
+	stats.Visitors = int64(total.Count())
+
+	if bucket != day {
+		return
+	}
+	for idx := range stats.Buckets {
+		stats.Buckets[idx].Visitors = byDay[stats.Buckets[idx].Start]
+	}
+}
+
+// owned Находит ссылку пользователя. Статистика чужих ссылок неотличима от несуществующих
+func (s *service) owned(ctx context.Context, urlID, userID string) (models.URL, error) {
+	link, err := s.clicksRepo.GetByUser(ctx, urlID, userID)
+	if errors.Is(err, internalErrors.ErrURLNotFound) {
+		return models.URL{}, ErrURLNotFound
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("urlID", urlID).WithField("userID", userID).Error("get user url error")
+		return models.URL{}, err
+	}
+
+	return link, nil
+}
+
+// aggregate Раскладывает количества переходов по интервалам, включая интервалы без переходов
+func aggregate(counts []models.ClickCount, from, to time.Time, bucket time.Duration) models.ClickStats {
+	start := from.UTC().Truncate(bucket)
+
+	buckets := make([]models.ClickBucket, 0, to.Sub(start)/bucket+1)
+	for t := start; t.Before(to); t = t.Add(bucket) {
+		buckets = append(buckets, models.ClickBucket{Start: t})
+	}
+
+	stats := models.ClickStats{
+		Buckets:   buckets,
+		Countries: geoBreakdown(counts, false),
+		Cities:    geoBreakdown(counts, true),
+	}
+
+	for idx := range counts {
+		count := counts[idx].Count
+		bot := counts[idx].Bot
+
+		stats.Total += count
+		if bot {
+			stats.Bots += count
+		} else {
+			stats.Humans += count
+		}
+
+		pos := int(counts[idx].Minute.Sub(start) / bucket)
+		if pos < 0 || pos >= len(buckets) {
+			continue
+		}
+
+		buckets[pos].Count += count
+		if bot {
+			buckets[pos].Bots += count
+		} else {
+			buckets[pos].Humans += count
+		}
+	}
+
+	return stats
+}
+
+// targetBreakdown Считает переходы по адресам ссылки в порядке адресов, включая адреса без переходов
+func targetBreakdown(counts []models.ClickCount, targets []models.Target) []models.TargetCount {
+	if len(targets) == 0 {
+		return nil
+	}
+
+	res := make([]models.TargetCount, len(targets))
+	positions := make(map[string]int, len(targets))
+	for idx, target := range targets {
+		res[idx] = models.TargetCount{URL: target.URL, Weight: target.Weight}
+		positions[target.URL] = idx
+	}
+
+	for idx := range counts {
+		pos, ok := positions[counts[idx].Target]
+		if !ok {
+			continue
+		}
+
+		res[pos].Count += counts[idx].Count
+		if counts[idx].Bot {
+			res[pos].Bots += counts[idx].Count
+		} else {
+			res[pos].Humans += counts[idx].Count
+		}
+	}
+
+	return res
+}
+
+// geoBreakdown Считает переходы по странам, либо по городам, начиная с самых частых
+func geoBreakdown(counts []models.ClickCount, byCity bool) []models.GeoCount {
+	byLocation := map[models.Location]int64{}
+	for idx := range counts {
+		location := models.Location{Country: counts[idx].Country}
+		if byCity {
+			location.City = counts[idx].City
+		}
+		byLocation[location] += counts[idx].Count
+	}
+
+	res := make([]models.GeoCount, 0, len(byLocation))
+	for location, count := range byLocation {
+		res = append(res, models.GeoCount{Country: location.Country, City: location.City, Count: count})
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Count != res[j].Count {
+			return res[i].Count > res[j].Count
+		}
+		if res[i].Country != res[j].Country {
+			return res[i].Country < res[j].Country
+		}
+		return res[i].City < res[j].City
+	})
+
+	return res
+}
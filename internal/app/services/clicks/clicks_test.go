@@ -0,0 +1,285 @@
+package clicks
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bgoldovsky/shortener/internal/app/models"
+	internalErrors "github.com/bgoldovsky/shortener/internal/app/repositories/urls/errors"
+	mocksClicks "github.com/bgoldovsky/shortener/internal/app/services/clicks/mocks"
+)
+
+const defaultUserID = "qwerty"
+
+func TestService_Queue_Full(t *testing.T) {
+	clicksCh := make(chan models.Click, 1)
+	s := NewService(nil, nil, clicksCh, nil)
+
+	s.Queue(models.Click{URLID: "first"})
+	s.Queue(models.Click{URLID: "second"})
+
+	assert.Len(t, clicksCh, 1)
+	assert.Equal(t, int64(1), s.dropped)
+}
+
+func TestService_Run_FlushOnDone(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clicks := []models.Click{{URLID: "qwerty", IP: "81.2.69.142"}, {URLID: "ytrewq", IP: "10.0.0.1"}}
+	saved := make(chan []models.Click, 1)
+
+	geoMock := mocksClicks.NewMockgeo(ctrl)
+	geoMock.EXPECT().Resolve("81.2.69.142").Return(models.Location{Country: "GB", City: "London"})
+	geoMock.EXPECT().Resolve("10.0.0.1").Return(models.Location{})
+
+	// Переходы сохраняются уже с местоположением
+	enriched := []models.Click{{URLID: "qwerty", IP: "81.2.69.142", Country: "GB", City: "London"}, {URLID: "ytrewq", IP: "10.0.0.1"}}
+
+	repoMock := mocksClicks.NewMockclicksRepository(ctrl)
+	repoMock.EXPECT().AddClicks(gomock.Any(), enriched).DoAndReturn(func(_ context.Context, batch []models.Click) error {
+		saved <- append([]models.Click(nil), batch...)
+		return nil
+	})
+	repoMock.EXPECT().MergeVisitors(gomock.Any(), gomock.Any()).Return(nil)
+
+	clicksCh := make(chan models.Click, 10)
+	doneCh := make(chan struct{})
+	s := NewService(repoMock, geoMock, clicksCh, doneCh)
+
+	for _, click := range clicks {
+		s.Queue(click)
+	}
+	s.Run()
+
+	// Ждем, пока воркер разберет очередь, иначе остановка может опередить чтение из канала
+	for len(clicksCh) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	close(doneCh)
+
+	select {
+	case act := <-saved:
+		assert.Equal(t, enriched, act)
+	case <-time.After(time.Second):
+		t.Fatal("clicks were not flushed")
+	}
+}
+
+func TestService_Stats(t *testing.T) {
+	from := time.Date(2022, 5, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(time.Hour * 72)
+
+	tests := []struct {
+		name   string
+		urlID  string
+		counts []models.ClickCount
+		exp    models.ClickStats
+		err    error
+	}{
+		{
+			name:  "success",
+			urlID: "qwerty",
+			counts: []models.ClickCount{
+				{URLID: "qwerty", Minute: from.Add(time.Hour), Country: "GB", City: "London", Count: 2},
+				{URLID: "qwerty", Minute: from.Add(time.Hour * 2), Bot: true, Count: 1},
+				{URLID: "qwerty", Minute: from.Add(time.Hour * 50), Country: "GB", City: "Leeds", Count: 1},
+			},
+			exp: models.ClickStats{
+				Total:  4,
+				Humans: 3,
+				Bots:   1,
+				Buckets: []models.ClickBucket{
+					{Start: from, Count: 3, Humans: 2, Bots: 1},
+					{Start: from.Add(time.Hour * 24), Count: 0},
+					{Start: from.Add(time.Hour * 48), Count: 1, Humans: 1},
+				},
+				Countries: []models.GeoCount{{Country: "GB", Count: 3}, {Count: 1}},
+				Cities:    []models.GeoCount{{Country: "GB", City: "London", Count: 2}, {Count: 1}, {Country: "GB", City: "Leeds", Count: 1}},
+			},
+		},
+		{
+			name:  "other user url",
+			urlID: "ytrewq",
+			err:   ErrURLNotFound,
+		},
+	}
+
+	ctx := context.Background()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	for _, tt := range tests {
+		repoMock := mocksClicks.NewMockclicksRepository(ctrl)
+		if tt.err == nil {
+			repoMock.EXPECT().GetByUser(ctx, tt.urlID, defaultUserID).Return(models.URL{ShortURL: tt.urlID}, nil)
+			repoMock.EXPECT().GetClickCounts(ctx, tt.urlID, from, to).Return(tt.counts, nil)
+			repoMock.EXPECT().GetVisitors(ctx, tt.urlID, from, to).Return(nil, nil)
+		} else {
+			repoMock.EXPECT().GetByUser(ctx, tt.urlID, defaultUserID).Return(models.URL{}, internalErrors.ErrURLNotFound)
+		}
+
+		s := NewService(repoMock, nil, nil, nil)
+		act, err := s.Stats(ctx, tt.urlID, defaultUserID, from, to, time.Hour*24)
+
+		assert.Equal(t, tt.err, err, tt.name)
+		assert.Equal(t, tt.exp, act, tt.name)
+	}
+}
+
+func TestService_Stats_Visitors(t *testing.T) {
+	from := time.Date(2022, 5, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(time.Hour * 48)
+	ctx := context.Background()
+
+	clicks := []models.Click{
+		{URLID: "qwerty", Time: from.Add(time.Hour), IP: "10.0.0.1", UserAgent: "curl/7.79"},
+		{URLID: "qwerty", Time: from.Add(time.Hour * 2), IP: "10.0.0.1", UserAgent: "curl/7.79"},
+		{URLID: "qwerty", Time: from.Add(time.Hour * 3), IP: "10.0.0.2", UserAgent: "curl/7.79"},
+		{URLID: "qwerty", Time: from.Add(time.Hour * 25), IP: "10.0.0.1", UserAgent: "curl/7.79"},
+		{URLID: "qwerty", Time: from.Add(time.Hour * 26), IP: "10.0.0.1", UserAgent: "Mozilla/5.0"},
+		{URLID: "qwerty", Time: from.Add(time.Hour * 27), IP: "10.0.0.3", UserAgent: "Slackbot", Bot: true},
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repoMock := mocksClicks.NewMockclicksRepository(ctrl)
+	repoMock.EXPECT().GetByUser(ctx, "qwerty", defaultUserID).Return(models.URL{ShortURL: "qwerty"}, nil)
+	repoMock.EXPECT().GetClickCounts(ctx, "qwerty", from, to).Return(countClicks(clicks), nil)
+	repoMock.EXPECT().GetVisitors(ctx, "qwerty", from, to).Return(visitors(clicks), nil)
+
+	s := NewService(repoMock, nil, nil, nil)
+	act, err := s.Stats(ctx, "qwerty", defaultUserID, from, to, time.Hour*24)
+	require.NoError(t, err)
+
+	// Один и тот же посетитель в разные сутки учитывается в периоде один раз, боты не учитываются
+	assert.Equal(t, int64(3), act.Visitors)
+	require.Len(t, act.Buckets, 2)
+	assert.Equal(t, int64(2), act.Buckets[0].Visitors)
+	assert.Equal(t, int64(2), act.Buckets[1].Visitors)
+}
+
+func TestService_Stats_Targets(t *testing.T) {
+	from := time.Date(2022, 5, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(time.Hour)
+	ctx := context.Background()
+
+	link := models.URL{
+		ShortURL: "qwerty",
+		Targets: []models.Target{
+			{URL: "https://avito.ru/a", Weight: 3},
+			{URL: "https://avito.ru/b", Weight: 1},
+			{URL: "https://avito.ru/c", Weight: 1},
+		},
+	}
+	clicks := []models.Click{
+		{URLID: "qwerty", Time: from, Target: "https://avito.ru/a"},
+		{URLID: "qwerty", Time: from, Target: "https://avito.ru/a", Bot: true},
+		{URLID: "qwerty", Time: from, Target: "https://avito.ru/b"},
+		// Переход до появления адресов не относится ни к одному из них
+		{URLID: "qwerty", Time: from},
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repoMock := mocksClicks.NewMockclicksRepository(ctrl)
+	repoMock.EXPECT().GetByUser(ctx, "qwerty", defaultUserID).Return(link, nil)
+	repoMock.EXPECT().GetClickCounts(ctx, "qwerty", from, to).Return(countClicks(clicks), nil)
+	repoMock.EXPECT().GetVisitors(ctx, "qwerty", from, to).Return(nil, nil)
+
+	s := NewService(repoMock, nil, nil, nil)
+	act, err := s.Stats(ctx, "qwerty", defaultUserID, from, to, time.Hour)
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(4), act.Total)
+	assert.Equal(t, []models.TargetCount{
+		{URL: "https://avito.ru/a", Weight: 3, Count: 2, Humans: 1, Bots: 1},
+		{URL: "https://avito.ru/b", Weight: 1, Count: 1, Humans: 1},
+		{URL: "https://avito.ru/c", Weight: 1},
+	}, act.Targets)
+}
+
+func TestService_Stats_MinuteBounds(t *testing.T) {
+	from := time.Date(2022, 5, 1, 12, 0, 30, 0, time.UTC)
+	to := from.Add(time.Minute * 2)
+	ctx := context.Background()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// Количества хранятся по минутам, поэтому период расширяется до целых минут
+	repoMock := mocksClicks.NewMockclicksRepository(ctrl)
+	repoMock.EXPECT().GetByUser(ctx, "qwerty", defaultUserID).Return(models.URL{ShortURL: "qwerty"}, nil)
+	repoMock.EXPECT().GetClickCounts(ctx, "qwerty", from.Truncate(time.Minute), to.Add(time.Second*30)).Return(nil, nil)
+	repoMock.EXPECT().GetVisitors(ctx, "qwerty", from.Truncate(time.Hour*24), to).Return(nil, nil)
+
+	s := NewService(repoMock, nil, nil, nil)
+	_, err := s.Stats(ctx, "qwerty", defaultUserID, from, to, time.Minute)
+	require.NoError(t, err)
+}
+
+func TestService_Stats_InvalidPeriod(t *testing.T) {
+	from := time.Date(2022, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		to     time.Time
+		bucket time.Duration
+	}{
+		{name: "empty period", to: from, bucket: time.Hour},
+		{name: "zero bucket", to: from.Add(time.Hour), bucket: 0},
+		{name: "too many buckets", to: from.Add(time.Hour * 24 * 365), bucket: time.Hour},
+	}
+
+	for _, tt := range tests {
+		s := NewService(nil, nil, nil, nil)
+		_, err := s.Stats(context.Background(), "qwerty", defaultUserID, from, tt.to, tt.bucket)
+
+		assert.Equal(t, ErrInvalidPeriod, err, tt.name)
+	}
+}
+
+func TestService_Stats_RepoErr(t *testing.T) {
+	ctx := context.Background()
+	from := time.Date(2022, 5, 1, 0, 0, 0, 0, time.UTC)
+	repoErr := errors.New("test err")
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repoMock := mocksClicks.NewMockclicksRepository(ctrl)
+	repoMock.EXPECT().GetByUser(ctx, "qwerty", defaultUserID).Return(models.URL{}, repoErr)
+
+	s := NewService(repoMock, nil, nil, nil)
+	_, err := s.Stats(ctx, "qwerty", defaultUserID, from, from.Add(time.Hour), time.Hour)
+
+	require.Error(t, err)
+	assert.Equal(t, repoErr, err)
+}
+
+// countClicks Представляет каждый переход отдельным количеством за его минуту
+func countClicks(clicks []models.Click) []models.ClickCount {
+	res := make([]models.ClickCount, len(clicks))
+	for idx, click := range clicks {
+		res[idx] = models.ClickCount{
+			URLID:   click.URLID,
+			Minute:  click.Time.Truncate(time.Minute),
+			Bot:     click.Bot,
+			Country: click.Country,
+			City:    click.City,
+			Target:  click.Target,
+			Count:   1,
+		}
+	}
+
+	return res
+}
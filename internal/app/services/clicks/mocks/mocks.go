@@ -0,0 +1,147 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: clicks.go
+
+// Package mock_clicks is a generated GoMock package.
+package mock_clicks
+
+import (
+	context "context"
+	reflect "reflect"
+	time "time"
+
+	models "github.com/bgoldovsky/shortener/internal/app/models"
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockclicksRepository is a mock of clicksRepository interface.
+type MockclicksRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockclicksRepositoryMockRecorder
+}
+
+// MockclicksRepositoryMockRecorder is the mock recorder for MockclicksRepository.
+type MockclicksRepositoryMockRecorder struct {
+	mock *MockclicksRepository
+}
+
+// NewMockclicksRepository creates a new mock instance.
+func NewMockclicksRepository(ctrl *gomock.Controller) *MockclicksRepository {
+	mock := &MockclicksRepository{ctrl: ctrl}
+	mock.recorder = &MockclicksRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockclicksRepository) EXPECT() *MockclicksRepositoryMockRecorder {
+	return m.recorder
+}
+
+// AddClicks mocks base method.
+func (m *MockclicksRepository) AddClicks(ctx context.Context, clicks []models.Click) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddClicks", ctx, clicks)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddClicks indicates an expected call of AddClicks.
+func (mr *MockclicksRepositoryMockRecorder) AddClicks(ctx, clicks interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddClicks", reflect.TypeOf((*MockclicksRepository)(nil).AddClicks), ctx, clicks)
+}
+
+// GetByUser mocks base method.
+func (m *MockclicksRepository) GetByUser(ctx context.Context, urlID, userID string) (models.URL, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetByUser", ctx, urlID, userID)
+	ret0, _ := ret[0].(models.URL)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetByUser indicates an expected call of GetByUser.
+func (mr *MockclicksRepositoryMockRecorder) GetByUser(ctx, urlID, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetByUser", reflect.TypeOf((*MockclicksRepository)(nil).GetByUser), ctx, urlID, userID)
+}
+
+// GetClickCounts mocks base method.
+func (m *MockclicksRepository) GetClickCounts(ctx context.Context, urlID string, from, to time.Time) ([]models.ClickCount, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetClickCounts", ctx, urlID, from, to)
+	ret0, _ := ret[0].([]models.ClickCount)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetClickCounts indicates an expected call of GetClickCounts.
+func (mr *MockclicksRepositoryMockRecorder) GetClickCounts(ctx, urlID, from, to interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetClickCounts", reflect.TypeOf((*MockclicksRepository)(nil).GetClickCounts), ctx, urlID, from, to)
+}
+
+// GetVisitors mocks base method.
+func (m *MockclicksRepository) GetVisitors(ctx context.Context, urlID string, from, to time.Time) ([]models.DailyVisitors, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetVisitors", ctx, urlID, from, to)
+	ret0, _ := ret[0].([]models.DailyVisitors)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetVisitors indicates an expected call of GetVisitors.
+func (mr *MockclicksRepositoryMockRecorder) GetVisitors(ctx, urlID, from, to interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetVisitors", reflect.TypeOf((*MockclicksRepository)(nil).GetVisitors), ctx, urlID, from, to)
+}
+
+// MergeVisitors mocks base method.
+func (m *MockclicksRepository) MergeVisitors(ctx context.Context, visitors []models.DailyVisitors) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MergeVisitors", ctx, visitors)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// MergeVisitors indicates an expected call of MergeVisitors.
+func (mr *MockclicksRepositoryMockRecorder) MergeVisitors(ctx, visitors interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MergeVisitors", reflect.TypeOf((*MockclicksRepository)(nil).MergeVisitors), ctx, visitors)
+}
+
+// Mockgeo is a mock of geo interface.
+type Mockgeo struct {
+	ctrl     *gomock.Controller
+	recorder *MockgeoMockRecorder
+}
+
+// MockgeoMockRecorder is the mock recorder for Mockgeo.
+type MockgeoMockRecorder struct {
+	mock *Mockgeo
+}
+
+// NewMockgeo creates a new mock instance.
+func NewMockgeo(ctrl *gomock.Controller) *Mockgeo {
+	mock := &Mockgeo{ctrl: ctrl}
+	mock.recorder = &MockgeoMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *Mockgeo) EXPECT() *MockgeoMockRecorder {
+	return m.recorder
+}
+
+// Resolve mocks base method.
+func (m *Mockgeo) Resolve(ip string) models.Location {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Resolve", ip)
+	ret0, _ := ret[0].(models.Location)
+	return ret0
+}
+
+// Resolve indicates an expected call of Resolve.
+func (mr *MockgeoMockRecorder) Resolve(ip interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Resolve", reflect.TypeOf((*Mockgeo)(nil).Resolve), ip)
+}
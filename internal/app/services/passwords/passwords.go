@@ -0,0 +1,134 @@
+package passwords
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/bgoldovsky/shortener/internal/app/models"
+)
+
+const (
+	// Сколько паролей можно проверить с одного адреса за окно
+	maxAttempts    = 5
+	attemptsWindow = time.Minute
+
+	// tokenTTL Сколько после ввода пароля ссылка открывается без него
+	tokenTTL = time.Hour
+
+	// sweepSize Размер таблицы попыток, после которого из нее удаляются истекшие окна
+	sweepSize = 10_000
+
+	// tokenPurpose Отделяет подписи токенов ссылок от других подписей тем же секретом
+	tokenPurpose = "unlock\x00"
+)
+
+var (
+	ErrWrongPassword   = errors.New("wrong password error")
+	ErrTooManyAttempts = errors.New("too many password attempts error")
+)
+
+type attempts struct {
+	count   int
+	resetAt time.Time
+}
+
+type service struct {
+	secret []byte
+
+	ma       sync.Mutex
+	attempts map[string]*attempts // ip -> попытки в текущем окне
+}
+
+func NewService(secret []byte) *service {
+	return &service{
+		secret:   secret,
+		attempts: map[string]*attempts{},
+	}
+}
+
+// Verify Проверяет пароль ссылки. Число проверок с одного адреса ограничено, чтобы пароль нельзя было подобрать;
+// при превышении возвращает ErrTooManyAttempts и время до следующей попытки
+func (s *service) Verify(link models.URL, ip, password string, now time.Time) (time.Duration, error) {
+	if wait := s.attempt(ip, now); wait > 0 {
+		return wait, ErrTooManyAttempts
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(link.PasswordHash), []byte(password)); err != nil {
+		return 0, ErrWrongPassword
+	}
+
+	return 0, nil
+}
+
+// attempt Учитывает попытку с адреса ip и возвращает, сколько ждать, если попытки в окне исчерпаны
+func (s *service) attempt(ip string, now time.Time) time.Duration {
+	s.ma.Lock()
+	defer s.ma.Unlock()
+
+	if len(s.attempts) >= sweepSize {
+		for key, a := range s.attempts {
+			if !now.Before(a.resetAt) {
+				delete(s.attempts, key)
+			}
+		}
+	}
+
+	a, ok := s.attempts[ip]
+	if !ok || !now.Before(a.resetAt) {
+		a = &attempts{resetAt: now.Add(attemptsWindow)}
+		s.attempts[ip] = a
+	}
+
+	if a.count >= maxAttempts {
+		return a.resetAt.Sub(now)
+	}
+	a.count++
+
+	return 0
+}
+
+// Token Выдает подписанный токен, по которому ссылка открывается без пароля до времени истечения.
+// Токен привязан к хэшу пароля, поэтому смена пароля отзывает выданные токены
+func (s *service) Token(link models.URL, now time.Time) (string, time.Time) {
+	expires := now.Add(tokenTTL).Truncate(time.Second)
+	expiresUnix := strconv.FormatInt(expires.Unix(), 10)
+
+	return expiresUnix + "." + base64.RawURLEncoding.EncodeToString(s.sign(link, expiresUnix)), expires
+}
+
+// Valid Проверяет подпись и срок действия токена ссылки
+func (s *service) Valid(link models.URL, token string, now time.Time) bool {
+	dot := strings.IndexByte(token, '.')
+	if dot < 0 {
+		return false
+	}
+	expiresUnix, sign := token[:dot], token[dot+1:]
+
+	expires, err := strconv.ParseInt(expiresUnix, 10, 64)
+	if err != nil || !now.Before(time.Unix(expires, 0)) {
+		return false
+	}
+
+	decoded, err := base64.RawURLEncoding.DecodeString(sign)
+	if err != nil {
+		return false
+	}
+
+	return hmac.Equal(decoded, s.sign(link, expiresUnix))
+}
+
+func (s *service) sign(link models.URL, expiresUnix string) []byte {
+	h := hmac.New(sha256.New, s.secret)
+	h.Write([]byte(tokenPurpose))
+	h.Write([]byte(link.ShortURL + "\x00" + expiresUnix + "\x00" + link.PasswordHash))
+
+	return h.Sum(nil)
+}
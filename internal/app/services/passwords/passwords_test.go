@@ -0,0 +1,86 @@
+package passwords
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/bgoldovsky/shortener/internal/app/models"
+)
+
+func protectedLink(t *testing.T, password string) models.URL {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	return models.URL{ShortURL: "qwerty", OriginalURL: "https://avito.ru", PasswordHash: string(hash)}
+}
+
+func TestService_Verify(t *testing.T) {
+	link := protectedLink(t, "secret")
+	now := time.Date(2022, 5, 1, 0, 0, 0, 0, time.UTC)
+	s := NewService([]byte("key"))
+
+	_, err := s.Verify(link, "10.0.0.1", "secret", now)
+	assert.NoError(t, err)
+
+	_, err = s.Verify(link, "10.0.0.1", "wrong", now)
+	assert.Equal(t, ErrWrongPassword, err)
+}
+
+func TestService_Verify_Throttling(t *testing.T) {
+	link := protectedLink(t, "secret")
+	now := time.Date(2022, 5, 1, 0, 0, 0, 0, time.UTC)
+	s := NewService([]byte("key"))
+
+	for i := 0; i < maxAttempts; i++ {
+		_, err := s.Verify(link, "10.0.0.1", "wrong", now)
+		assert.Equal(t, ErrWrongPassword, err)
+	}
+
+	// Исчерпавший попытки адрес не может проверить даже верный пароль до конца окна
+	wait, err := s.Verify(link, "10.0.0.1", "secret", now.Add(time.Second*10))
+	assert.Equal(t, ErrTooManyAttempts, err)
+	assert.Equal(t, attemptsWindow-time.Second*10, wait)
+
+	// Другие адреса не затронуты
+	_, err = s.Verify(link, "10.0.0.2", "secret", now)
+	assert.NoError(t, err)
+
+	_, err = s.Verify(link, "10.0.0.1", "secret", now.Add(attemptsWindow))
+	assert.NoError(t, err)
+}
+
+func TestService_Token(t *testing.T) {
+	link := protectedLink(t, "secret")
+	now := time.Date(2022, 5, 1, 0, 0, 0, 0, time.UTC)
+	s := NewService([]byte("key"))
+
+	token, expires := s.Token(link, now)
+	assert.Equal(t, now.Add(tokenTTL), expires)
+	assert.True(t, s.Valid(link, token, now.Add(tokenTTL-time.Second)))
+
+	other := link
+	other.ShortURL = "ytrewq"
+
+	tests := []struct {
+		name  string
+		link  models.URL
+		token string
+		now   time.Time
+	}{
+		{name: "expired", link: link, token: token, now: expires},
+		{name: "other link", link: other, token: token, now: now},
+		{name: "password changed", link: protectedLink(t, "secret"), token: token, now: now},
+		{name: "other secret", link: link, token: func() string { v, _ := NewService([]byte("other")).Token(link, now); return v }(), now: now},
+		{name: "tampered expiration", link: link, token: "9999999999" + token[len("1651366800"):], now: now},
+		{name: "garbage", link: link, token: "garbage", now: now},
+		{name: "empty", link: link, token: "", now: now},
+	}
+
+	for _, tt := range tests {
+		assert.False(t, s.Valid(tt.link, tt.token, tt.now), tt.name)
+	}
+}
@@ -0,0 +1,58 @@
+package urls
+
+import (
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// lengthTracker Длина случайных идентификаторов, которая растет, когда доля коллизий
+// среди последних window сгенерированных идентификаторов достигает threshold
+type lengthTracker struct {
+	ma         sync.Mutex
+	length     int64
+	maxLength  int64
+	window     int
+	threshold  float64
+	ids        int
+	collisions int
+}
+
+func newLengthTracker(length, maxLength int64, window int, threshold float64) *lengthTracker {
+	return &lengthTracker{
+		length:    length,
+		maxLength: maxLength,
+		window:    window,
+		threshold: threshold,
+	}
+}
+
+// Length Возвращает текущую длину идентификатора
+func (t *lengthTracker) Length() int64 {
+	t.ma.Lock()
+	defer t.ma.Unlock()
+
+	return t.length
+}
+
+// Observe Учитывает результат вставки ids идентификаторов, из которых collisions оказались заняты
+func (t *lengthTracker) Observe(ids, collisions int) {
+	t.ma.Lock()
+	defer t.ma.Unlock()
+
+	t.ids += ids
+	t.collisions += collisions
+	if t.ids < t.window {
+		return
+	}
+
+	if float64(t.collisions)/float64(t.ids) >= t.threshold && t.length < t.maxLength {
+		t.length++
+		logrus.WithField("length", t.length).
+			WithField("collisions", t.collisions).
+			WithField("ids", t.ids).
+			Warn("url id collision rate is high, id length increased")
+	}
+
+	t.ids, t.collisions = 0, 0
+}
@@ -0,0 +1,59 @@
+package urls
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLengthTracker_Observe(t *testing.T) {
+	tests := []struct {
+		name       string
+		ids        int
+		collisions int
+		exp        int64
+	}{
+		{
+			name:       "rare collisions",
+			ids:        100,
+			collisions: 0,
+			exp:        5,
+		},
+		{
+			name:       "window not filled",
+			ids:        5,
+			collisions: 5,
+			exp:        5,
+		},
+		{
+			name:       "frequent collisions",
+			ids:        10,
+			collisions: 1,
+			exp:        6,
+		},
+	}
+
+	for _, tt := range tests {
+		tracker := newLengthTracker(5, 6, 10, 0.1)
+
+		for i := 0; i < tt.ids; i++ {
+			collided := 0
+			if i < tt.collisions {
+				collided = 1
+			}
+			tracker.Observe(1, collided)
+		}
+
+		assert.Equal(t, tt.exp, tracker.Length(), tt.name)
+	}
+}
+
+func TestLengthTracker_MaxLength(t *testing.T) {
+	tracker := newLengthTracker(5, 6, 1, 0.1)
+
+	for i := 0; i < 10; i++ {
+		tracker.Observe(1, 1)
+	}
+
+	assert.Equal(t, int64(6), tracker.Length())
+}
@@ -36,17 +36,17 @@ func (m *MockurlsRepository) EXPECT() *MockurlsRepositoryMockRecorder {
 }
 
 // Add mocks base method.
-func (m *MockurlsRepository) Add(ctx context.Context, urlID, url, userID string) error {
+func (m *MockurlsRepository) Add(ctx context.Context, url models.URL, userID string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Add", ctx, urlID, url, userID)
+	ret := m.ctrl.Call(m, "Add", ctx, url, userID)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // Add indicates an expected call of Add.
-func (mr *MockurlsRepositoryMockRecorder) Add(ctx, urlID, url, userID interface{}) *gomock.Call {
+func (mr *MockurlsRepositoryMockRecorder) Add(ctx, url, userID interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Add", reflect.TypeOf((*MockurlsRepository)(nil).Add), ctx, urlID, url, userID)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Add", reflect.TypeOf((*MockurlsRepository)(nil).Add), ctx, url, userID)
 }
 
 // AddBatch mocks base method.
@@ -63,11 +63,25 @@ func (mr *MockurlsRepositoryMockRecorder) AddBatch(ctx, urls, userID interface{}
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddBatch", reflect.TypeOf((*MockurlsRepository)(nil).AddBatch), ctx, urls, userID)
 }
 
+// CountClick mocks base method.
+func (m *MockurlsRepository) CountClick(ctx context.Context, urlID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CountClick", ctx, urlID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CountClick indicates an expected call of CountClick.
+func (mr *MockurlsRepositoryMockRecorder) CountClick(ctx, urlID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountClick", reflect.TypeOf((*MockurlsRepository)(nil).CountClick), ctx, urlID)
+}
+
 // Get mocks base method.
-func (m *MockurlsRepository) Get(ctx context.Context, urlID string) (string, error) {
+func (m *MockurlsRepository) Get(ctx context.Context, urlID string) (models.URL, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "Get", ctx, urlID)
-	ret0, _ := ret[0].(string)
+	ret0, _ := ret[0].(models.URL)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
@@ -78,6 +92,21 @@ func (mr *MockurlsRepositoryMockRecorder) Get(ctx, urlID interface{}) *gomock.Ca
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockurlsRepository)(nil).Get), ctx, urlID)
 }
 
+// GetByUser mocks base method.
+func (m *MockurlsRepository) GetByUser(ctx context.Context, urlID, userID string) (models.URL, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetByUser", ctx, urlID, userID)
+	ret0, _ := ret[0].(models.URL)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetByUser indicates an expected call of GetByUser.
+func (mr *MockurlsRepositoryMockRecorder) GetByUser(ctx, urlID, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetByUser", reflect.TypeOf((*MockurlsRepository)(nil).GetByUser), ctx, urlID, userID)
+}
+
 // GetList mocks base method.
 func (m *MockurlsRepository) GetList(ctx context.Context, userID string) ([]models.URL, error) {
 	m.ctrl.T.Helper()
@@ -93,6 +122,35 @@ func (mr *MockurlsRepositoryMockRecorder) GetList(ctx, userID interface{}) *gomo
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetList", reflect.TypeOf((*MockurlsRepository)(nil).GetList), ctx, userID)
 }
 
+// GetUTMTemplate mocks base method.
+func (m *MockurlsRepository) GetUTMTemplate(ctx context.Context, userID string) (*models.UTM, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUTMTemplate", ctx, userID)
+	ret0, _ := ret[0].(*models.UTM)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUTMTemplate indicates an expected call of GetUTMTemplate.
+func (mr *MockurlsRepositoryMockRecorder) GetUTMTemplate(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUTMTemplate", reflect.TypeOf((*MockurlsRepository)(nil).GetUTMTemplate), ctx, userID)
+}
+
+// SetUTMTemplate mocks base method.
+func (m *MockurlsRepository) SetUTMTemplate(ctx context.Context, userID string, utm *models.UTM) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetUTMTemplate", ctx, userID, utm)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetUTMTemplate indicates an expected call of SetUTMTemplate.
+func (mr *MockurlsRepositoryMockRecorder) SetUTMTemplate(ctx, userID, utm interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetUTMTemplate", reflect.TypeOf((*MockurlsRepository)(nil).SetUTMTemplate), ctx, userID, utm)
+}
+
 // Mockgenerator is a mock of generator interface.
 type Mockgenerator struct {
 	ctrl     *gomock.Controller
@@ -3,10 +3,14 @@ package urls
 import (
 	"context"
 	"errors"
+	"net/http"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
 
 	"github.com/bgoldovsky/shortener/internal/app/models"
 	internalErrors "github.com/bgoldovsky/shortener/internal/app/repositories/urls/errors"
@@ -14,6 +18,9 @@ import (
 )
 
 const (
+	idLength     int64 = 5
+	redirectType       = http.StatusTemporaryRedirect
+
 	host          = "http://localhost:8080"
 	defaultUserID = "qwerty"
 )
@@ -51,10 +58,11 @@ func TestService_Shorten(t *testing.T) {
 		genMock.EXPECT().RandomString(idLength).Return(tt.urlID, nil)
 
 		repoMock := mockUrls.NewMockurlsRepository(ctrl)
-		repoMock.EXPECT().Add(ctx, tt.urlID, tt.url, defaultUserID).Return(tt.err)
+		repoMock.EXPECT().GetUTMTemplate(gomock.Any(), defaultUserID).Return(nil, nil).AnyTimes()
+		repoMock.EXPECT().Add(ctx, models.URL{ShortURL: tt.urlID, OriginalURL: tt.url}, defaultUserID).Return(tt.err)
 
-		s := NewService(repoMock, genMock, host)
-		act, err := s.Shorten(ctx, tt.url, defaultUserID)
+		s := NewService(repoMock, genMock, host, idLength, redirectType)
+		act, err := s.Shorten(ctx, models.OriginalURL{URL: tt.url}, defaultUserID)
 
 		assert.Equal(t, tt.err, err)
 		assert.Equal(t, tt.shortcut, act)
@@ -90,16 +98,346 @@ func TestService_Shorten_NotUniqueErr(t *testing.T) {
 		genMock.EXPECT().RandomString(idLength).Return(tt.urlID, nil)
 
 		repoMock := mockUrls.NewMockurlsRepository(ctrl)
-		repoMock.EXPECT().Add(ctx, tt.urlID, tt.url, defaultUserID).Return(tt.err)
+		repoMock.EXPECT().GetUTMTemplate(gomock.Any(), defaultUserID).Return(nil, nil).AnyTimes()
+		repoMock.EXPECT().Add(ctx, models.URL{ShortURL: tt.urlID, OriginalURL: tt.url}, defaultUserID).Return(tt.err)
 
-		s := NewService(repoMock, genMock, host)
-		act, err := s.Shorten(ctx, tt.url, defaultUserID)
+		s := NewService(repoMock, genMock, host, idLength, redirectType)
+		act, err := s.Shorten(ctx, models.OriginalURL{URL: tt.url}, defaultUserID)
 
 		assert.Equal(t, tt.expErr, err)
 		assert.Equal(t, tt.expURL, act)
 	}
 }
 
+func TestService_Shorten_RetryOnIDCollision(t *testing.T) {
+	ctx := context.Background()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	genMock := mockUrls.NewMockgenerator(ctrl)
+	repoMock := mockUrls.NewMockurlsRepository(ctrl)
+	repoMock.EXPECT().GetUTMTemplate(gomock.Any(), defaultUserID).Return(nil, nil).AnyTimes()
+	gomock.InOrder(
+		genMock.EXPECT().RandomString(idLength).Return("qwerty", nil),
+		repoMock.EXPECT().Add(ctx, models.URL{ShortURL: "qwerty", OriginalURL: "avito.ru"}, defaultUserID).
+			Return(internalErrors.NewNotUniqueURLIDErr("qwerty", nil)),
+		genMock.EXPECT().RandomString(idLength).Return("ytrewq", nil),
+		repoMock.EXPECT().Add(ctx, models.URL{ShortURL: "ytrewq", OriginalURL: "avito.ru"}, defaultUserID).Return(nil),
+	)
+
+	s := NewService(repoMock, genMock, host, idLength, redirectType)
+	act, err := s.Shorten(ctx, models.OriginalURL{URL: "avito.ru"}, defaultUserID)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "http://localhost:8080/ytrewq", act)
+}
+
+func TestService_Shorten_RetryLimit(t *testing.T) {
+	ctx := context.Background()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	idErr := internalErrors.NewNotUniqueURLIDErr("qwerty", nil)
+
+	genMock := mockUrls.NewMockgenerator(ctrl)
+	genMock.EXPECT().RandomString(idLength).Return("qwerty", nil).Times(maxAttempts)
+
+	repoMock := mockUrls.NewMockurlsRepository(ctrl)
+	repoMock.EXPECT().GetUTMTemplate(gomock.Any(), defaultUserID).Return(nil, nil).AnyTimes()
+	repoMock.EXPECT().Add(ctx, models.URL{ShortURL: "qwerty", OriginalURL: "avito.ru"}, defaultUserID).
+		Return(idErr).Times(maxAttempts)
+
+	s := NewService(repoMock, genMock, host, idLength, redirectType)
+	act, err := s.Shorten(ctx, models.OriginalURL{URL: "avito.ru"}, defaultUserID)
+
+	assert.Equal(t, idErr, err)
+	assert.Equal(t, "", act)
+}
+
+func TestService_Shorten_Alias(t *testing.T) {
+	tests := []struct {
+		name     string
+		alias    string
+		repoErr  error
+		callRepo bool
+		shortcut string
+		err      error
+	}{
+		{
+			name:     "success",
+			alias:    "spring-sale",
+			callRepo: true,
+			shortcut: "http://localhost:8080/spring-sale",
+		},
+		{
+			name:     "taken",
+			alias:    "spring-sale",
+			repoErr:  internalErrors.NewNotUniqueURLIDErr("spring-sale", nil),
+			callRepo: true,
+			err:      ErrAliasTaken,
+		},
+		{
+			name:  "too short",
+			alias: "ab",
+			err:   ErrInvalidAlias,
+		},
+		{
+			name:  "invalid chars",
+			alias: "spring sale!",
+			err:   ErrInvalidAlias,
+		},
+		{
+			name:  "reserved",
+			alias: "API",
+			err:   ErrInvalidAlias,
+		},
+	}
+
+	ctx := context.Background()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	for _, tt := range tests {
+		repoMock := mockUrls.NewMockurlsRepository(ctrl)
+		repoMock.EXPECT().GetUTMTemplate(gomock.Any(), defaultUserID).Return(nil, nil).AnyTimes()
+		if tt.callRepo {
+			repoMock.EXPECT().Add(ctx, models.URL{ShortURL: tt.alias, OriginalURL: "avito.ru"}, defaultUserID).Return(tt.repoErr)
+		}
+
+		// Генератор не вызывается, когда задан псевдоним
+		s := NewService(repoMock, mockUrls.NewMockgenerator(ctrl), host, idLength, redirectType)
+		act, err := s.Shorten(ctx, models.OriginalURL{URL: "avito.ru", Alias: tt.alias}, defaultUserID)
+
+		assert.True(t, errors.Is(err, tt.err), tt.name)
+		assert.Equal(t, tt.shortcut, act, tt.name)
+	}
+}
+
+func TestService_Shorten_Password(t *testing.T) {
+	ctx := context.Background()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	genMock := mockUrls.NewMockgenerator(ctrl)
+	genMock.EXPECT().RandomString(idLength).Return("qwerty", nil)
+
+	// В хранилище попадает только хэш пароля
+	repoMock := mockUrls.NewMockurlsRepository(ctrl)
+	repoMock.EXPECT().GetUTMTemplate(gomock.Any(), defaultUserID).Return(nil, nil).AnyTimes()
+	repoMock.EXPECT().Add(ctx, gomock.Any(), defaultUserID).DoAndReturn(func(_ context.Context, url models.URL, _ string) error {
+		assert.NotContains(t, url.PasswordHash, "secret")
+		assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(url.PasswordHash), []byte("secret")))
+		return nil
+	})
+
+	s := NewService(repoMock, genMock, host, idLength, redirectType)
+	act, err := s.Shorten(ctx, models.OriginalURL{URL: "avito.ru", Password: "secret"}, defaultUserID)
+	assert.NoError(t, err)
+	assert.Equal(t, "http://localhost:8080/qwerty", act)
+
+	for _, password := range []string{"abc", strings.Repeat("a", 73)} {
+		_, err = s.Shorten(ctx, models.OriginalURL{URL: "avito.ru", Password: password}, defaultUserID)
+		assert.True(t, errors.Is(err, ErrInvalidPassword), password)
+	}
+}
+
+func TestService_Shorten_Targets(t *testing.T) {
+	ctx := context.Background()
+	targets := []models.Target{
+		{URL: "https://avito.ru/a", Weight: 3},
+		{URL: "https://avito.ru/b", Weight: 1},
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	genMock := mockUrls.NewMockgenerator(ctrl)
+	genMock.EXPECT().RandomString(idLength).Return("qwerty", nil)
+
+	// Основным адресом ссылки становится первый
+	repoMock := mockUrls.NewMockurlsRepository(ctrl)
+	repoMock.EXPECT().GetUTMTemplate(gomock.Any(), defaultUserID).Return(nil, nil).AnyTimes()
+	repoMock.EXPECT().Add(ctx, models.URL{ShortURL: "qwerty", OriginalURL: targets[0].URL, Targets: targets, Sticky: true}, defaultUserID).Return(nil)
+
+	s := NewService(repoMock, genMock, host, idLength, redirectType)
+	act, err := s.Shorten(ctx, models.OriginalURL{Targets: targets, Sticky: true}, defaultUserID)
+	assert.NoError(t, err)
+	assert.Equal(t, "http://localhost:8080/qwerty", act)
+
+	tests := []struct {
+		name     string
+		original models.OriginalURL
+	}{
+		{name: "single target", original: models.OriginalURL{Targets: targets[:1]}},
+		{name: "too many targets", original: models.OriginalURL{Targets: make([]models.Target, maxTargets+1)}},
+		{name: "zero weight", original: models.OriginalURL{Targets: []models.Target{{URL: "https://avito.ru/a"}, {URL: "https://avito.ru/b", Weight: 1}}}},
+		{name: "weight too large", original: models.OriginalURL{Targets: []models.Target{{URL: "https://avito.ru/a", Weight: maxWeight + 1}, {URL: "https://avito.ru/b", Weight: 1}}}},
+		{name: "empty url", original: models.OriginalURL{Targets: []models.Target{{Weight: 1}, {URL: "https://avito.ru/b", Weight: 1}}}},
+		{name: "sticky without targets", original: models.OriginalURL{URL: "https://avito.ru", Sticky: true}},
+	}
+
+	for _, tt := range tests {
+		_, err = s.Shorten(ctx, tt.original, defaultUserID)
+		assert.True(t, errors.Is(err, ErrInvalidTargets), tt.name)
+	}
+}
+
+func TestService_Shorten_Rules(t *testing.T) {
+	ctx := context.Background()
+	rule := models.Rule{Platforms: []string{"ios"}, Target: "https://apps.apple.com/app"}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	genMock := mockUrls.NewMockgenerator(ctrl)
+	genMock.EXPECT().RandomString(idLength).Return("qwerty", nil)
+
+	repoMock := mockUrls.NewMockurlsRepository(ctrl)
+	repoMock.EXPECT().GetUTMTemplate(gomock.Any(), defaultUserID).Return(nil, nil).AnyTimes()
+	repoMock.EXPECT().Add(ctx, models.URL{ShortURL: "qwerty", OriginalURL: "https://avito.ru", Rules: []models.Rule{rule}}, defaultUserID).Return(nil)
+
+	s := NewService(repoMock, genMock, host, idLength, redirectType)
+	_, err := s.Shorten(ctx, models.OriginalURL{URL: "https://avito.ru", Rules: []models.Rule{rule}}, defaultUserID)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name  string
+		rules []models.Rule
+	}{
+		{name: "too many rules", rules: make([]models.Rule, maxRules+1)},
+		{name: "no target", rules: []models.Rule{{Platforms: []string{"ios"}}}},
+		{name: "no conditions", rules: []models.Rule{{Target: "https://avito.ru/a"}}},
+		{name: "unknown platform", rules: []models.Rule{{Platforms: []string{"symbian"}, Target: "https://avito.ru/a"}}},
+		{name: "hours out of range", rules: []models.Rule{{Hours: &models.TimeWindow{From: 0, To: 24 * 60}, Target: "https://avito.ru/a"}}},
+		{name: "empty hours", rules: []models.Rule{{Hours: &models.TimeWindow{From: 60, To: 60}, Target: "https://avito.ru/a"}}},
+	}
+
+	for _, tt := range tests {
+		_, err = s.Shorten(ctx, models.OriginalURL{URL: "https://avito.ru", Rules: tt.rules}, defaultUserID)
+		assert.True(t, errors.Is(err, ErrInvalidRules), tt.name)
+	}
+}
+
+func TestService_Shorten_UTM(t *testing.T) {
+	ctx := context.Background()
+	template := &models.UTM{Source: "newsletter", Medium: "email", Term: "default"}
+
+	tests := []struct {
+		name     string
+		utm      *models.UTM
+		template *models.UTM
+		exp      *models.UTM
+		err      bool
+	}{
+		{
+			name: "without template",
+			utm:  &models.UTM{Source: " newsletter ", Medium: "email", Campaign: "spring"},
+			exp:  &models.UTM{Source: "newsletter", Medium: "email", Campaign: "spring"},
+		},
+		{
+			name:     "filled from template",
+			utm:      &models.UTM{Campaign: "spring", Term: "shoes"},
+			template: template,
+			exp:      &models.UTM{Source: "newsletter", Medium: "email", Campaign: "spring", Term: "shoes"},
+		},
+		{
+			name:     "link overrides template",
+			utm:      &models.UTM{Source: "ads", Campaign: "spring"},
+			template: template,
+			exp:      &models.UTM{Source: "ads", Medium: "email", Campaign: "spring", Term: "default"},
+		},
+		{
+			name:     "campaign missing",
+			utm:      &models.UTM{},
+			template: template,
+			err:      true,
+		},
+		{
+			name: "no utm and no template",
+		},
+		{
+			name:     "no utm takes template",
+			template: &models.UTM{Source: "newsletter", Medium: "email", Campaign: "spring"},
+			exp:      &models.UTM{Source: "newsletter", Medium: "email", Campaign: "spring"},
+		},
+		{
+			name:     "no utm with incomplete template",
+			template: template,
+			err:      true,
+		},
+		{
+			name: "value too long",
+			utm:  &models.UTM{Source: "newsletter", Medium: "email", Campaign: strings.Repeat("a", maxUTMLength+1)},
+			err:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			genMock := mockUrls.NewMockgenerator(ctrl)
+			repoMock := mockUrls.NewMockurlsRepository(ctrl)
+			repoMock.EXPECT().GetUTMTemplate(ctx, defaultUserID).Return(tt.template, nil)
+			if !tt.err {
+				genMock.EXPECT().RandomString(idLength).Return("qwerty", nil)
+				repoMock.EXPECT().Add(ctx, models.URL{ShortURL: "qwerty", OriginalURL: "https://avito.ru", UTM: tt.exp}, defaultUserID).Return(nil)
+			}
+
+			s := NewService(repoMock, genMock, host, idLength, redirectType)
+			_, err := s.Shorten(ctx, models.OriginalURL{URL: "https://avito.ru", UTM: tt.utm}, defaultUserID)
+			if tt.err {
+				assert.True(t, errors.Is(err, ErrInvalidUTM))
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestService_SetUTMTemplate(t *testing.T) {
+	ctx := context.Background()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repoMock := mockUrls.NewMockurlsRepository(ctrl)
+	repoMock.EXPECT().SetUTMTemplate(ctx, defaultUserID, &models.UTM{Source: "newsletter"}).Return(nil)
+	repoMock.EXPECT().SetUTMTemplate(ctx, defaultUserID, nil).Return(nil)
+
+	s := NewService(repoMock, nil, host, idLength, redirectType)
+	assert.NoError(t, s.SetUTMTemplate(ctx, defaultUserID, &models.UTM{Source: " newsletter"}))
+	assert.NoError(t, s.SetUTMTemplate(ctx, defaultUserID, nil))
+
+	err := s.SetUTMTemplate(ctx, defaultUserID, &models.UTM{Medium: "  "})
+	assert.True(t, errors.Is(err, ErrInvalidUTM))
+}
+
+func TestService_GetUserURL(t *testing.T) {
+	ctx := context.Background()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repoMock := mockUrls.NewMockurlsRepository(ctrl)
+	repoMock.EXPECT().GetByUser(ctx, "qwerty", defaultUserID).Return(models.URL{ShortURL: "qwerty", OriginalURL: "https://avito.ru"}, nil)
+	repoMock.EXPECT().GetByUser(ctx, "ytrewq", defaultUserID).Return(models.URL{}, internalErrors.ErrURLNotFound)
+
+	s := NewService(repoMock, nil, host, idLength, redirectType)
+
+	act, err := s.GetUserURL(ctx, "qwerty", defaultUserID)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://avito.ru", act.OriginalURL)
+
+	_, err = s.GetUserURL(ctx, "ytrewq", defaultUserID)
+	assert.Equal(t, ErrURLNotFound, err)
+}
+
 func TestService_Expand(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -128,16 +466,208 @@ func TestService_Expand(t *testing.T) {
 
 	for _, tt := range tests {
 		repoMock := mockUrls.NewMockurlsRepository(ctrl)
-		repoMock.EXPECT().Get(ctx, tt.shortcut).Return(tt.url, tt.err)
+		repoMock.EXPECT().Get(ctx, tt.shortcut).Return(models.URL{ShortURL: tt.shortcut, OriginalURL: tt.url}, tt.err)
 
-		s := NewService(repoMock, nil, host)
+		s := NewService(repoMock, nil, host, idLength, redirectType)
 		act, err := s.Expand(ctx, tt.shortcut)
 
 		assert.Equal(t, tt.err, err)
-		assert.Equal(t, tt.url, act)
+		assert.Equal(t, tt.url, act.OriginalURL)
+	}
+}
+
+func TestService_Expand_Expired(t *testing.T) {
+	past := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name      string
+		expiresAt *time.Time
+		exp       string
+		err       error
+	}{
+		{
+			name:      "not expired",
+			expiresAt: &future,
+			exp:       "avito.ru",
+		},
+		{
+			name:      "expired",
+			expiresAt: &past,
+			exp:       "",
+			err:       ErrURLExpired,
+		},
+	}
+
+	ctx := context.Background()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	for _, tt := range tests {
+		repoMock := mockUrls.NewMockurlsRepository(ctrl)
+		repoMock.EXPECT().Get(ctx, "qwerty").Return(models.URL{ShortURL: "qwerty", OriginalURL: "avito.ru", ExpiresAt: tt.expiresAt}, nil)
+
+		s := NewService(repoMock, nil, host, idLength, redirectType)
+		act, err := s.Expand(ctx, "qwerty")
+
+		assert.Equal(t, tt.err, err)
+		assert.Equal(t, tt.exp, act.OriginalURL)
+	}
+}
+
+func TestService_Expand_Schedule(t *testing.T) {
+	past := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name string
+		url  models.URL
+		exp  string
+		err  error
+	}{
+		{
+			name: "started",
+			url:  models.URL{ShortURL: "qwerty", OriginalURL: "avito.ru", NotBefore: &past},
+			exp:  "avito.ru",
+		},
+		{
+			name: "not started",
+			url:  models.URL{ShortURL: "qwerty", OriginalURL: "avito.ru", NotBefore: &future},
+			err:  NewNotActiveErr(future),
+		},
+		{
+			name: "clicks left",
+			url:  models.URL{ShortURL: "qwerty", OriginalURL: "avito.ru", MaxClicks: 2, ClickCount: 1},
+			exp:  "avito.ru",
+		},
+		{
+			name: "click limit reached",
+			url:  models.URL{ShortURL: "qwerty", OriginalURL: "avito.ru", MaxClicks: 2, ClickCount: 2},
+			err:  ErrClickLimit,
+		},
+	}
+
+	ctx := context.Background()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	for _, tt := range tests {
+		repoMock := mockUrls.NewMockurlsRepository(ctrl)
+		repoMock.EXPECT().Get(ctx, "qwerty").Return(tt.url, nil)
+
+		s := NewService(repoMock, nil, host, idLength, redirectType)
+		act, err := s.Expand(ctx, "qwerty")
+
+		assert.Equal(t, tt.err, err, tt.name)
+		assert.Equal(t, tt.exp, act.OriginalURL, tt.name)
+	}
+}
+
+func TestService_CountClick(t *testing.T) {
+	tests := []struct {
+		name    string
+		repoErr error
+		err     error
+	}{
+		{
+			name: "counted",
+		},
+		{
+			name:    "limit reached",
+			repoErr: internalErrors.ErrClickLimit,
+			err:     ErrClickLimit,
+		},
+		{
+			name:    "deleted",
+			repoErr: internalErrors.ErrURLDeleted,
+			err:     ErrURLDeleted,
+		},
+		{
+			name:    "not found",
+			repoErr: internalErrors.ErrURLNotFound,
+			err:     ErrURLNotFound,
+		},
+	}
+
+	ctx := context.Background()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	for _, tt := range tests {
+		repoMock := mockUrls.NewMockurlsRepository(ctrl)
+		repoMock.EXPECT().CountClick(ctx, "qwerty").Return(tt.repoErr)
+
+		s := NewService(repoMock, nil, host, idLength, redirectType)
+		err := s.CountClick(ctx, "qwerty")
+
+		assert.Equal(t, tt.err, err, tt.name)
+	}
+}
+
+func TestService_Expand_RedirectType(t *testing.T) {
+	tests := []struct {
+		name         string
+		redirectType int
+		exp          int
+	}{
+		{
+			name:         "default",
+			redirectType: 0,
+			exp:          redirectType,
+		},
+		{
+			name:         "link",
+			redirectType: http.StatusMovedPermanently,
+			exp:          http.StatusMovedPermanently,
+		},
+	}
+
+	ctx := context.Background()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	for _, tt := range tests {
+		repoMock := mockUrls.NewMockurlsRepository(ctrl)
+		repoMock.EXPECT().Get(ctx, "qwerty").Return(models.URL{ShortURL: "qwerty", OriginalURL: "avito.ru", RedirectType: tt.redirectType}, nil)
+
+		s := NewService(repoMock, nil, host, idLength, redirectType)
+		act, err := s.Expand(ctx, "qwerty")
+
+		assert.NoError(t, err, tt.name)
+		assert.Equal(t, tt.exp, act.RedirectType, tt.name)
 	}
 }
 
+func TestService_Shorten_RedirectType(t *testing.T) {
+	ctx := context.Background()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	genMock := mockUrls.NewMockgenerator(ctrl)
+	genMock.EXPECT().RandomString(idLength).Return("qwerty", nil)
+
+	repoMock := mockUrls.NewMockurlsRepository(ctrl)
+	repoMock.EXPECT().GetUTMTemplate(gomock.Any(), defaultUserID).Return(nil, nil).AnyTimes()
+	repoMock.EXPECT().Add(ctx, models.URL{ShortURL: "qwerty", OriginalURL: "avito.ru", RedirectType: http.StatusPermanentRedirect}, defaultUserID).Return(nil)
+
+	s := NewService(repoMock, genMock, host, idLength, redirectType)
+	act, err := s.Shorten(ctx, models.OriginalURL{URL: "avito.ru", RedirectType: http.StatusPermanentRedirect}, defaultUserID)
+	assert.NoError(t, err)
+	assert.Equal(t, "http://localhost:8080/qwerty", act)
+
+	// Неподдерживаемый код отклоняется до обращения к генератору и хранилищу
+	_, err = s.Shorten(ctx, models.OriginalURL{URL: "avito.ru", RedirectType: http.StatusOK}, defaultUserID)
+	assert.True(t, errors.Is(err, ErrInvalidRedirectType))
+
+	_, err = s.ShortenBatch(ctx, []models.OriginalURL{{URL: "avito.ru", RedirectType: http.StatusNotModified}}, defaultUserID)
+	assert.True(t, errors.Is(err, ErrInvalidRedirectType))
+}
+
 func TestService_GetUrls(t *testing.T) {
 	tests := []struct {
 		name string
@@ -174,7 +704,7 @@ func TestService_GetUrls(t *testing.T) {
 		repoMock := mockUrls.NewMockurlsRepository(ctrl)
 		repoMock.EXPECT().GetList(ctx, defaultUserID).Return(tt.urls, tt.err)
 
-		s := NewService(repoMock, nil, host)
+		s := NewService(repoMock, nil, host, idLength, redirectType)
 		act, err := s.GetUrls(ctx, defaultUserID)
 
 		assert.Equal(t, tt.err, err)
@@ -263,6 +793,7 @@ func TestService_ShortenBatch(t *testing.T) {
 
 	for _, tt := range tests {
 		repoMock := mockUrls.NewMockurlsRepository(ctrl)
+		repoMock.EXPECT().GetUTMTemplate(gomock.Any(), defaultUserID).Return(nil, nil).AnyTimes()
 		repoMock.EXPECT().AddBatch(ctx, tt.urls, defaultUserID).Return(tt.err)
 
 		genMock := mockUrls.NewMockgenerator(ctrl)
@@ -270,10 +801,85 @@ func TestService_ShortenBatch(t *testing.T) {
 			genMock.EXPECT().RandomString(idLength).Return(url.ShortURL, nil)
 		}
 
-		s := NewService(repoMock, genMock, host)
+		s := NewService(repoMock, genMock, host, idLength, redirectType)
 		act, err := s.ShortenBatch(ctx, tt.originalURLs, defaultUserID)
 
 		assert.Equal(t, tt.err, err)
 		assert.Equal(t, tt.exp, act)
 	}
 }
+
+func TestService_ShortenBatch_UTM(t *testing.T) {
+	ctx := context.Background()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	genMock := mockUrls.NewMockgenerator(ctrl)
+	genMock.EXPECT().RandomString(idLength).Return("xyz", nil)
+	genMock.EXPECT().RandomString(idLength).Return("qwerty", nil)
+	genMock.EXPECT().RandomString(idLength).Return("asdfgh", nil)
+
+	// Шаблон читается один раз на весь пакет и достается целиком ссылке без меток
+	template := &models.UTM{Source: "newsletter", Medium: "email", Campaign: "default"}
+	repoMock := mockUrls.NewMockurlsRepository(ctrl)
+	repoMock.EXPECT().GetUTMTemplate(ctx, defaultUserID).Return(template, nil).Times(1)
+	repoMock.EXPECT().AddBatch(ctx, []models.URL{
+		{CorrelationID: "1", ShortURL: "xyz", OriginalURL: "https://avito.ru", UTM: &models.UTM{Source: "newsletter", Medium: "email", Campaign: "spring"}},
+		{CorrelationID: "2", ShortURL: "qwerty", OriginalURL: "https://yandex.ru", UTM: &models.UTM{Source: "ads", Medium: "email", Campaign: "summer"}},
+		{CorrelationID: "3", ShortURL: "asdfgh", OriginalURL: "https://google.com", UTM: template},
+	}, defaultUserID).Return(nil)
+
+	s := NewService(repoMock, genMock, host, idLength, redirectType)
+	_, err := s.ShortenBatch(ctx, []models.OriginalURL{
+		{CorrelationID: "1", URL: "https://avito.ru", UTM: &models.UTM{Campaign: "spring"}},
+		{CorrelationID: "2", URL: "https://yandex.ru", UTM: &models.UTM{Source: "ads", Campaign: "summer"}},
+		{CorrelationID: "3", URL: "https://google.com"},
+	}, defaultUserID)
+	assert.NoError(t, err)
+
+	// Без шаблона в метках ссылки не хватает обязательных
+	repoMock.EXPECT().GetUTMTemplate(ctx, "user456").Return(nil, nil)
+	_, err = s.ShortenBatch(ctx, []models.OriginalURL{{CorrelationID: "1", URL: "https://avito.ru", UTM: &models.UTM{Source: "ads"}}}, "user456")
+	assert.True(t, errors.Is(err, ErrInvalidUTM))
+
+	// Неполный шаблон проверяется и для ссылки без меток
+	repoMock.EXPECT().GetUTMTemplate(ctx, "user789").Return(&models.UTM{Source: "newsletter"}, nil)
+	_, err = s.ShortenBatch(ctx, []models.OriginalURL{{CorrelationID: "1", URL: "https://avito.ru"}}, "user789")
+	assert.True(t, errors.Is(err, ErrInvalidUTM))
+}
+
+func TestService_ShortenBatch_RetryOnIDCollision(t *testing.T) {
+	ctx := context.Background()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	genMock := mockUrls.NewMockgenerator(ctrl)
+	repoMock := mockUrls.NewMockurlsRepository(ctrl)
+	repoMock.EXPECT().GetUTMTemplate(gomock.Any(), defaultUserID).Return(nil, nil).AnyTimes()
+	gomock.InOrder(
+		genMock.EXPECT().RandomString(idLength).Return("qwerty", nil),
+		genMock.EXPECT().RandomString(idLength).Return("ytrewq", nil),
+		repoMock.EXPECT().AddBatch(ctx, gomock.Any(), defaultUserID).
+			Return(internalErrors.NewNotUniqueURLIDErr("ytrewq", nil)),
+		genMock.EXPECT().RandomString(idLength).Return("asdfgh", nil),
+		genMock.EXPECT().RandomString(idLength).Return("hgfdsa", nil),
+		repoMock.EXPECT().AddBatch(ctx, []models.URL{
+			{CorrelationID: "1", ShortURL: "asdfgh", OriginalURL: "https://avito.ru"},
+			{CorrelationID: "2", ShortURL: "hgfdsa", OriginalURL: "https://yandex.ru"},
+		}, defaultUserID).Return(nil),
+	)
+
+	s := NewService(repoMock, genMock, host, idLength, redirectType)
+	act, err := s.ShortenBatch(ctx, []models.OriginalURL{
+		{CorrelationID: "1", URL: "https://avito.ru"},
+		{CorrelationID: "2", URL: "https://yandex.ru"},
+	}, defaultUserID)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []models.URL{
+		{CorrelationID: "1", ShortURL: "http://localhost:8080/asdfgh", OriginalURL: "https://avito.ru"},
+		{CorrelationID: "2", ShortURL: "http://localhost:8080/hgfdsa", OriginalURL: "https://yandex.ru"},
+	}, act)
+}
@@ -5,26 +5,107 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
 
 	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
 
 	"github.com/bgoldovsky/shortener/internal/app/models"
 	internalErrors "github.com/bgoldovsky/shortener/internal/app/repositories/urls/errors"
+	linkRules "github.com/bgoldovsky/shortener/internal/app/rules"
 )
 
-const idLength int64 = 5
+const (
+	// maxIDLength Предел роста длины идентификатора при коллизиях, если начальная длина меньше
+	maxIDLength int64 = 16
+
+	// maxAttempts Сколько раз пробуем сохранить ссылку со свежим идентификатором при коллизиях
+	maxAttempts = 5
+
+	// Длина идентификатора растет, если занят хотя бы один из ста сгенерированных
+	collisionWindow    = 1000
+	collisionThreshold = 0.01
+
+	aliasMinLength = 3
+	aliasMaxLength = 64
+
+	// Длиннее bcrypt не различает
+	passwordMinLength = 4
+	passwordMaxLength = 72
+
+	// Ограничения ссылки с несколькими адресами
+	minTargets = 2
+	maxTargets = 10
+	maxWeight  = 1000
+
+	maxRules = 20
+
+	maxUTMLength = 256
+)
 
 var (
 	ErrURLNotFound  = errors.New("url not found error")
 	ErrURLDeleted   = errors.New("url has been deleted error")
+	ErrURLExpired   = errors.New("url has expired error")
+	ErrURLNotActive = errors.New("url is not active yet error")
+	ErrClickLimit   = errors.New("url click limit reached error")
 	ErrNotUniqueURL = errors.New("url not unique error")
+	ErrInvalidAlias = errors.New("alias not valid error")
+	ErrAliasTaken   = errors.New("alias already taken error")
+
+	ErrInvalidRedirectType = errors.New("redirect type not valid error")
+	ErrInvalidPassword     = errors.New("password not valid error")
+	ErrInvalidTargets      = errors.New("targets not valid error")
+	ErrInvalidRules        = errors.New("rules not valid error")
+	ErrInvalidUTM          = errors.New("utm not valid error")
 )
 
+// NotActiveErr Ссылка еще не начала работать, при проверке через errors.Is совпадает с ErrURLNotActive
+type NotActiveErr struct {
+	NotBefore time.Time // Время, с которого ссылка начнет работать
+}
+
+func NewNotActiveErr(notBefore time.Time) error {
+	return &NotActiveErr{NotBefore: notBefore}
+}
+
+func (e *NotActiveErr) Error() string {
+	return fmt.Sprintf("%v: not before %v", ErrURLNotActive, e.NotBefore.Format(time.RFC3339))
+}
+
+func (e *NotActiveErr) Unwrap() error {
+	return ErrURLNotActive
+}
+
+// redirectTypes Коды ответа, которыми можно перенаправлять по ссылке
+var redirectTypes = map[int]struct{}{
+	http.StatusMovedPermanently:  {},
+	http.StatusFound:             {},
+	http.StatusTemporaryRedirect: {},
+	http.StatusPermanentRedirect: {},
+}
+
+var aliasPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// reservedAliases Первые сегменты путей роутера, которые не могут быть псевдонимами
+var reservedAliases = map[string]struct{}{
+	"api":   {},
+	"ping":  {},
+	"debug": {},
+}
+
 type urlsRepository interface {
-	Add(ctx context.Context, urlID, url, userID string) error
+	Add(ctx context.Context, url models.URL, userID string) error
 	AddBatch(ctx context.Context, urls []models.URL, userID string) error
-	Get(ctx context.Context, urlID string) (string, error)
+	Get(ctx context.Context, urlID string) (models.URL, error)
 	GetList(ctx context.Context, userID string) ([]models.URL, error)
+	GetByUser(ctx context.Context, urlID, userID string) (models.URL, error)
+	CountClick(ctx context.Context, urlID string) error
+	SetUTMTemplate(ctx context.Context, userID string, utm *models.UTM) error
+	GetUTMTemplate(ctx context.Context, userID string) (*models.UTM, error)
 }
 
 type generator interface {
@@ -32,68 +113,339 @@ type generator interface {
 }
 
 type service struct {
-	urlsRepo  urlsRepository
-	generator generator
-	host      string
+	urlsRepo     urlsRepository
+	generator    generator
+	length       *lengthTracker
+	host         string
+	redirectType int
 }
 
-func NewService(urlsRepo urlsRepository, generator generator, host string) *service {
+func NewService(urlsRepo urlsRepository, generator generator, host string, idLength int64, redirectType int) *service {
+	maxLength := maxIDLength
+	if idLength > maxLength {
+		maxLength = idLength
+	}
+
 	return &service{
-		urlsRepo:  urlsRepo,
-		generator: generator,
-		host:      host,
+		urlsRepo:     urlsRepo,
+		generator:    generator,
+		length:       newLengthTracker(idLength, maxLength, collisionWindow, collisionThreshold),
+		host:         host,
+		redirectType: redirectType,
 	}
 }
 
 // Shorten Сокращает URL
-func (s *service) Shorten(ctx context.Context, url, userID string) (string, error) {
-	urlID, err := s.generator.RandomString(idLength)
+func (s *service) Shorten(ctx context.Context, original models.OriginalURL, userID string) (string, error) {
+	url := original.URL
+	links := []models.URL{{
+		ShortURL:     original.Alias,
+		OriginalURL:  url,
+		ExpiresAt:    original.ExpiresAt,
+		RedirectType: original.RedirectType,
+		Interstitial: original.Interstitial,
+		NotBefore:    original.NotBefore,
+		MaxClicks:    original.MaxClicks,
+		Targets:      original.Targets,
+		Sticky:       original.Sticky,
+		Rules:        original.Rules,
+		Passthrough:  original.Passthrough,
+	}}
+
+	err := validateRedirectType(original.RedirectType)
 	if err != nil {
-		logrus.WithError(err).
-			WithField("userID", userID).
-			WithField("url", url).
-			Error("generate urlID error")
 		return "", err
 	}
 
-	if err = s.urlsRepo.Add(ctx, urlID, url, userID); err != nil {
+	if err = validateTargets(original.Targets, original.Sticky); err != nil {
+		return "", err
+	}
+	if err = validateRules(original.Rules); err != nil {
+		return "", err
+	}
+	// Шаблон пользователя применяется и к ссылкам без своих меток
+	template, err := s.urlsRepo.GetUTMTemplate(ctx, userID)
+	if err != nil {
+		return "", fmt.Errorf("get utm template error: %w", err)
+	}
+	if links[0].UTM, err = linkUTM(original.UTM, template); err != nil {
+		return "", err
+	}
+	if links[0].Split() {
+		// Уникальность и список ссылок пользователя опираются на первый адрес
+		url = original.Targets[0].URL
+		links[0].OriginalURL = url
+	}
+
+	if original.Password != "" {
+		if links[0].PasswordHash, err = hashPassword(original.Password); err != nil {
+			return "", err
+		}
+	}
+
+	if original.Alias != "" {
+		if err = validateAlias(original.Alias); err != nil {
+			return "", err
+		}
+		err = s.urlsRepo.Add(ctx, links[0], userID)
+	} else {
+		err = s.allocate(links, func() error {
+			return s.urlsRepo.Add(ctx, links[0], userID)
+		})
+	}
+
+	if err != nil {
 		var uniqueErr *internalErrors.NotUniqueURLErr
 		if errors.As(err, &uniqueErr) {
 			return s.buildShortURL(uniqueErr.URLID), ErrNotUniqueURL
 		}
 
+		var idErr *internalErrors.NotUniqueURLIDErr
+		if original.Alias != "" && errors.As(err, &idErr) {
+			return "", ErrAliasTaken
+		}
+
 		logrus.WithError(err).
 			WithField("userID", userID).
-			WithField("urlID", urlID).
+			WithField("urlID", links[0].ShortURL).
 			WithField("url", url).
 			Error("add url error")
 		return "", err
 	}
 
-	return s.buildShortURL(urlID), nil
+	return s.buildShortURL(links[0].ShortURL), nil
+}
+
+// allocate Назначает ссылкам случайные идентификаторы и сохраняет их через add.
+// Пока репозиторий сообщает о занятом идентификаторе, повторяет попытку со свежими, но не более maxAttempts раз
+func (s *service) allocate(urls []models.URL, add func() error) error {
+	for attempt := 1; ; attempt++ {
+		length := s.length.Length()
+		for idx := range urls {
+			urlID, err := s.generator.RandomString(length)
+			if err != nil {
+				return fmt.Errorf("generate urlID error: %w", err)
+			}
+			urls[idx].ShortURL = urlID
+		}
+
+		err := add()
+
+		var idErr *internalErrors.NotUniqueURLIDErr
+		if !errors.As(err, &idErr) {
+			s.length.Observe(len(urls), 0)
+			return err
+		}
+
+		s.length.Observe(len(urls), 1)
+		if attempt >= maxAttempts {
+			return err
+		}
+
+		logrus.WithField("urlID", idErr.URLID).
+			WithField("attempt", attempt).
+			Warn("url id collision, retry with new id")
+	}
+}
+
+// validateAlias Проверяет длину и набор символов псевдонима и что он не совпадает с маршрутом сервиса
+func validateAlias(alias string) error {
+	if len(alias) < aliasMinLength || len(alias) > aliasMaxLength {
+		return fmt.Errorf("alias must be from %d to %d characters long: %w", aliasMinLength, aliasMaxLength, ErrInvalidAlias)
+	}
+
+	if !aliasPattern.MatchString(alias) {
+		return fmt.Errorf("alias may contain only latin letters, digits, '-' and '_': %w", ErrInvalidAlias)
+	}
+
+	if _, ok := reservedAliases[strings.ToLower(alias)]; ok {
+		return fmt.Errorf("alias %q is reserved: %w", alias, ErrInvalidAlias)
+	}
+
+	return nil
+}
+
+// validateRedirectType Проверяет, что код перенаправления не задан или поддерживается
+func validateRedirectType(redirectType int) error {
+	if redirectType == 0 {
+		return nil
+	}
+
+	if _, ok := redirectTypes[redirectType]; !ok {
+		return fmt.Errorf("redirect type must be one of 301, 302, 307 or 308: %w", ErrInvalidRedirectType)
+	}
+
+	return nil
+}
+
+// validateTargets Проверяет адреса ссылки с несколькими адресами и их веса
+func validateTargets(targets []models.Target, sticky bool) error {
+	if len(targets) == 0 {
+		if sticky {
+			return fmt.Errorf("sticky requires several targets: %w", ErrInvalidTargets)
+		}
+		return nil
+	}
+
+	if len(targets) < minTargets || len(targets) > maxTargets {
+		return fmt.Errorf("targets must contain from %d to %d urls: %w", minTargets, maxTargets, ErrInvalidTargets)
+	}
+
+	for _, target := range targets {
+		if target.URL == "" {
+			return fmt.Errorf("target url is empty: %w", ErrInvalidTargets)
+		}
+		if target.Weight < 1 || target.Weight > maxWeight {
+			return fmt.Errorf("target weight must be from 1 to %d: %w", maxWeight, ErrInvalidTargets)
+		}
+	}
+
+	return nil
+}
+
+// validateRules Проверяет правила перенаправления. Правило без условий подходит любому запросу
+// и делает недостижимыми следующие правила и адреса ссылки, поэтому не допускается
+func validateRules(rules []models.Rule) error {
+	if len(rules) > maxRules {
+		return fmt.Errorf("no more than %d rules can be specified: %w", maxRules, ErrInvalidRules)
+	}
+
+	for idx, rule := range rules {
+		if rule.Target == "" {
+			return fmt.Errorf("rule %d has no target: %w", idx, ErrInvalidRules)
+		}
+
+		if len(rule.Platforms) == 0 && len(rule.Languages) == 0 && len(rule.Query) == 0 && rule.Hours == nil {
+			return fmt.Errorf("rule %d has no conditions: %w", idx, ErrInvalidRules)
+		}
+
+		for _, platform := range rule.Platforms {
+			if !linkRules.ValidPlatform(platform) {
+				return fmt.Errorf("rule %d platform must be one of ios, android or desktop: %w", idx, ErrInvalidRules)
+			}
+		}
+
+		if hours := rule.Hours; hours != nil {
+			if hours.From < 0 || hours.From >= linkRules.MinutesPerDay || hours.To < 0 || hours.To >= linkRules.MinutesPerDay ||
+				hours.From == hours.To {
+				return fmt.Errorf("rule %d hours are not valid: %w", idx, ErrInvalidRules)
+			}
+		}
+	}
+
+	return nil
+}
+
+// linkUTM Дополняет метки ссылки полями шаблона пользователя и проверяет результат.
+// Пустые метки ссылки берут шаблон целиком, ссылка без меток получает шаблон, если он есть
+func linkUTM(utm, template *models.UTM) (*models.UTM, error) {
+	if utm == nil {
+		if template == nil {
+			return nil, nil
+		}
+		utm = &models.UTM{}
+	}
+
+	res := normalizeUTM(*utm)
+	if template != nil {
+		if res.Source == "" {
+			res.Source = template.Source
+		}
+		if res.Medium == "" {
+			res.Medium = template.Medium
+		}
+		if res.Campaign == "" {
+			res.Campaign = template.Campaign
+		}
+		if res.Term == "" {
+			res.Term = template.Term
+		}
+		if res.Content == "" {
+			res.Content = template.Content
+		}
+	}
+
+	if err := validateUTMLength(res); err != nil {
+		return nil, err
+	}
+
+	if res.Source == "" || res.Medium == "" || res.Campaign == "" {
+		return nil, fmt.Errorf("utm source, medium and campaign are required: %w", ErrInvalidUTM)
+	}
+
+	return &res, nil
+}
+
+// normalizeUTM Убирает случайные пробелы по краям меток
+func normalizeUTM(utm models.UTM) models.UTM {
+	return models.UTM{
+		Source:   strings.TrimSpace(utm.Source),
+		Medium:   strings.TrimSpace(utm.Medium),
+		Campaign: strings.TrimSpace(utm.Campaign),
+		Term:     strings.TrimSpace(utm.Term),
+		Content:  strings.TrimSpace(utm.Content),
+	}
+}
+
+func validateUTMLength(utm models.UTM) error {
+	for _, value := range []string{utm.Source, utm.Medium, utm.Campaign, utm.Term, utm.Content} {
+		if len(value) > maxUTMLength {
+			return fmt.Errorf("utm values must not be longer than %d bytes: %w", maxUTMLength, ErrInvalidUTM)
+		}
+	}
+
+	return nil
+}
+
+// hashPassword Проверяет длину пароля и возвращает его медленный хэш
+func hashPassword(password string) (string, error) {
+	if len(password) < passwordMinLength || len(password) > passwordMaxLength {
+		return "", fmt.Errorf("password must be from %d to %d bytes long: %w", passwordMinLength, passwordMaxLength, ErrInvalidPassword)
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("hash password error: %w", err)
+	}
+
+	return string(hash), nil
 }
 
 // ShortenBatch Сокращает несколько URL
 func (s *service) ShortenBatch(ctx context.Context, originalURLs []models.OriginalURL, userID string) ([]models.URL, error) {
+	// Шаблон читаем один раз на пакет: он применяется и к ссылкам без своих меток
+	template, err := s.urlsRepo.GetUTMTemplate(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("get utm template error: %w", err)
+	}
+
 	urls := make([]models.URL, len(originalURLs))
 	for idx := range urls {
-		urlID, err := s.generator.RandomString(idLength)
-		if err != nil {
-			logrus.WithError(err).
-				WithField("userID", userID).
-				WithField("originalURLs", originalURLs).
-				Error("generate urlID error")
+		if err := validateRedirectType(originalURLs[idx].RedirectType); err != nil {
 			return nil, err
 		}
 
+		utm, err := linkUTM(originalURLs[idx].UTM, template)
+		if err != nil {
+			return nil, fmt.Errorf("url %s: %w", originalURLs[idx].CorrelationID, err)
+		}
+
 		urls[idx] = models.URL{
 			CorrelationID: originalURLs[idx].CorrelationID,
-			ShortURL:      urlID,
 			OriginalURL:   originalURLs[idx].URL,
+			ExpiresAt:     originalURLs[idx].ExpiresAt,
+			RedirectType:  originalURLs[idx].RedirectType,
+			Interstitial:  originalURLs[idx].Interstitial,
+			NotBefore:     originalURLs[idx].NotBefore,
+			MaxClicks:     originalURLs[idx].MaxClicks,
+			Passthrough:   originalURLs[idx].Passthrough,
+			UTM:           utm,
 		}
 	}
 
-	err := s.urlsRepo.AddBatch(ctx, urls, userID)
+	err = s.allocate(urls, func() error {
+		return s.urlsRepo.AddBatch(ctx, urls, userID)
+	})
 	if err != nil {
 		logrus.WithError(err).
 			WithField("userID", userID).
@@ -110,20 +462,73 @@ func (s *service) ShortenBatch(ctx context.Context, originalURLs []models.Origin
 	return urls, nil
 }
 
-// Expand Возвращает полный URL по идентификатору сокращенного
-func (s *service) Expand(ctx context.Context, urlID string) (string, error) {
+// Expand Возвращает ссылку по идентификатору сокращенного URL.
+// Если код перенаправления у ссылки не задан, подставляет код по умолчанию
+func (s *service) Expand(ctx context.Context, urlID string) (models.URL, error) {
 	url, err := s.urlsRepo.Get(ctx, urlID)
 	if err != nil {
 		if errors.Is(err, internalErrors.ErrURLNotFound) {
-			return "", ErrURLNotFound
+			return models.URL{}, ErrURLNotFound
 		}
 
 		if errors.Is(err, internalErrors.ErrURLDeleted) {
-			return "", ErrURLDeleted
+			return models.URL{}, ErrURLDeleted
 		}
 
 		logrus.WithError(err).WithField("urlID", urlID).Error("get url error")
-		return "", err
+		return models.URL{}, err
+	}
+
+	now := time.Now()
+	if url.Expired(now) {
+		return models.URL{}, ErrURLExpired
+	}
+
+	if !url.Started(now) {
+		return models.URL{}, NewNotActiveErr(*url.NotBefore)
+	}
+
+	// Окончательно лимит проверяет CountClick, здесь лишь не показываем исчерпанную ссылку
+	if url.Limited() && url.ClickCount >= url.MaxClicks {
+		return models.URL{}, ErrClickLimit
+	}
+
+	if url.RedirectType == 0 {
+		url.RedirectType = s.redirectType
+	}
+
+	return url, nil
+}
+
+// CountClick Учитывает переход по ссылке с ограничением числа переходов
+func (s *service) CountClick(ctx context.Context, urlID string) error {
+	err := s.urlsRepo.CountClick(ctx, urlID)
+	if err == nil {
+		return nil
+	}
+
+	switch {
+	case errors.Is(err, internalErrors.ErrClickLimit):
+		return ErrClickLimit
+	case errors.Is(err, internalErrors.ErrURLNotFound):
+		return ErrURLNotFound
+	case errors.Is(err, internalErrors.ErrURLDeleted):
+		return ErrURLDeleted
+	}
+
+	logrus.WithError(err).WithField("urlID", urlID).Error("count click error")
+	return err
+}
+
+// GetUserURL Возвращает ссылку пользователя. Чужие ссылки неотличимы от несуществующих
+func (s *service) GetUserURL(ctx context.Context, urlID, userID string) (models.URL, error) {
+	url, err := s.urlsRepo.GetByUser(ctx, urlID, userID)
+	if errors.Is(err, internalErrors.ErrURLNotFound) {
+		return models.URL{}, ErrURLNotFound
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("urlID", urlID).WithField("userID", userID).Error("get user url error")
+		return models.URL{}, err
 	}
 
 	return url, nil
@@ -147,3 +552,37 @@ func (s *service) GetUrls(ctx context.Context, userID string) ([]models.URL, err
 func (s *service) buildShortURL(id string) string {
 	return fmt.Sprintf("%s/%s", s.host, id)
 }
+
+// SetUTMTemplate Сохраняет шаблон UTM-меток пользователя, nil удаляет шаблон.
+// Шаблон может задавать только часть меток, недостающие указываются в ссылке
+func (s *service) SetUTMTemplate(ctx context.Context, userID string, utm *models.UTM) error {
+	if utm != nil {
+		template := normalizeUTM(*utm)
+		if template == (models.UTM{}) {
+			return fmt.Errorf("utm template must not be empty: %w", ErrInvalidUTM)
+		}
+		if err := validateUTMLength(template); err != nil {
+			return err
+		}
+		utm = &template
+	}
+
+	err := s.urlsRepo.SetUTMTemplate(ctx, userID, utm)
+	if err != nil {
+		logrus.WithError(err).WithField("userID", userID).Error("set utm template error")
+		return err
+	}
+
+	return nil
+}
+
+// GetUTMTemplate Возвращает шаблон UTM-меток пользователя, nil если шаблона нет
+func (s *service) GetUTMTemplate(ctx context.Context, userID string) (*models.UTM, error) {
+	utm, err := s.urlsRepo.GetUTMTemplate(ctx, userID)
+	if err != nil {
+		logrus.WithError(err).WithField("userID", userID).Error("get utm template error")
+		return nil, err
+	}
+
+	return utm, nil
+}
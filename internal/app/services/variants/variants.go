@@ -0,0 +1,95 @@
+package variants
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bgoldovsky/shortener/internal/app/models"
+)
+
+const (
+	// stickyTTL Сколько посетитель попадает на однажды выбранный адрес
+	stickyTTL = time.Hour * 24 * 30
+
+	// tokenPurpose Отделяет подписи выбранных адресов от других подписей тем же секретом
+	tokenPurpose = "variant\x00"
+)
+
+type service struct {
+	secret []byte
+
+	ma  sync.Mutex
+	rnd *rand.Rand
+}
+
+func NewService(secret []byte) *service {
+	return &service{
+		secret: secret,
+		rnd:    rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Pick Выбирает адрес ссылки случайно, пропорционально весам, и возвращает его номер
+func (s *service) Pick(link models.URL) int {
+	total := 0
+	for _, target := range link.Targets {
+		total += target.Weight
+	}
+	if total <= 0 {
+		return 0
+	}
+
+	s.ma.Lock()
+	n := s.rnd.Intn(total)
+	s.ma.Unlock()
+
+	for idx, target := range link.Targets {
+		if n < target.Weight {
+			return idx
+		}
+		n -= target.Weight
+	}
+
+	return 0
+}
+
+// Token Выдает подписанный токен выбранного адреса и время, до которого его стоит помнить.
+// Токен привязан к самому адресу, поэтому после смены адресов ссылки он перестает действовать
+func (s *service) Token(link models.URL, idx int, now time.Time) (string, time.Time) {
+	return strconv.Itoa(idx) + "." + base64.RawURLEncoding.EncodeToString(s.sign(link, idx)), now.Add(stickyTTL)
+}
+
+// Variant Проверяет подпись токена и возвращает номер выбранного адреса
+func (s *service) Variant(link models.URL, token string) (int, bool) {
+	dot := strings.IndexByte(token, '.')
+	if dot < 0 {
+		return 0, false
+	}
+	variant, sign := token[:dot], token[dot+1:]
+
+	idx, err := strconv.Atoi(variant)
+	if err != nil || idx < 0 || idx >= len(link.Targets) {
+		return 0, false
+	}
+
+	decoded, err := base64.RawURLEncoding.DecodeString(sign)
+	if err != nil || !hmac.Equal(decoded, s.sign(link, idx)) {
+		return 0, false
+	}
+
+	return idx, true
+}
+
+func (s *service) sign(link models.URL, idx int) []byte {
+	h := hmac.New(sha256.New, s.secret)
+	h.Write([]byte(tokenPurpose))
+	h.Write([]byte(link.ShortURL + "\x00" + strconv.Itoa(idx) + "\x00" + link.Targets[idx].URL))
+
+	return h.Sum(nil)
+}
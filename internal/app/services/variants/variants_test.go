@@ -0,0 +1,84 @@
+package variants
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bgoldovsky/shortener/internal/app/models"
+)
+
+func splitLink() models.URL {
+	return models.URL{
+		ShortURL:    "qwerty",
+		OriginalURL: "https://avito.ru/a",
+		Targets: []models.Target{
+			{URL: "https://avito.ru/a", Weight: 3},
+			{URL: "https://avito.ru/b", Weight: 1},
+		},
+	}
+}
+
+func TestService_Pick(t *testing.T) {
+	s := NewService([]byte("key"))
+	s.rnd = rand.New(rand.NewSource(1))
+
+	link := splitLink()
+	counts := make([]int, len(link.Targets))
+	for i := 0; i < 4000; i++ {
+		counts[s.Pick(link)]++
+	}
+
+	// Доли переходов следуют весам 3:1
+	assert.InDelta(t, 3000, counts[0], 150)
+	assert.InDelta(t, 1000, counts[1], 150)
+}
+
+func TestService_Pick_ZeroWeight(t *testing.T) {
+	s := NewService([]byte("key"))
+
+	link := splitLink()
+	link.Targets[0].Weight = 0
+	for i := 0; i < 100; i++ {
+		assert.Equal(t, 1, s.Pick(link))
+	}
+}
+
+func TestService_Token(t *testing.T) {
+	now := time.Date(2022, 5, 1, 0, 0, 0, 0, time.UTC)
+	s := NewService([]byte("key"))
+	link := splitLink()
+
+	token, expires := s.Token(link, 1, now)
+	assert.Equal(t, now.Add(stickyTTL), expires)
+
+	idx, ok := s.Variant(link, token)
+	assert.True(t, ok)
+	assert.Equal(t, 1, idx)
+
+	other := link
+	other.ShortURL = "ytrewq"
+	changed := splitLink()
+	changed.Targets[1].URL = "https://avito.ru/c"
+
+	tests := []struct {
+		name  string
+		link  models.URL
+		token string
+	}{
+		{name: "other link", link: other, token: token},
+		{name: "changed target", link: changed, token: token},
+		{name: "other secret", link: link, token: func() string { t, _ := NewService([]byte("other")).Token(link, 1, now); return t }()},
+		{name: "forged variant", link: link, token: "0" + token[1:]},
+		{name: "out of range", link: link, token: "5" + token[1:]},
+		{name: "no signature", link: link, token: "1"},
+		{name: "garbage", link: link, token: "x.y"},
+	}
+
+	for _, tt := range tests {
+		_, ok = s.Variant(tt.link, tt.token)
+		assert.False(t, ok, tt.name)
+	}
+}
@@ -3,23 +3,87 @@ package config
 import (
 	"errors"
 	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultCacheSize        = 10_000
+	defaultCacheTTL         = time.Minute
+	defaultCacheNegativeTTL = time.Second * 5
+
+	IDGeneratorRandom    = "random"
+	IDGeneratorSequence  = "sequence"
+	IDGeneratorSnowflake = "snowflake"
+
+	defaultIDAlphabet   = "letters"
+	defaultIDLength     = 5
+	defaultUserIDLength = 8
+	maxIDLength         = 64
+
+	defaultRedirectType = http.StatusTemporaryRedirect
 )
 
 type appConfig struct {
-	ServerAddress   string
-	BaseURL         string
-	FileStoragePath string
-	DatabaseDSN     string
-	Secret          []byte
+	ServerAddress string
+	BaseURL       string
+	StorageURL    string
+	Secret        []byte
+
+	CacheSize        int
+	CacheTTL         time.Duration
+	CacheNegativeTTL time.Duration
+
+	IDGenerator string
+	NodeID      int64
+	IDAlphabet  string
+	IDLength    int64
+	IDDenyList  string
+
+	UserIDLength int64
+
+	RedirectType int
+	TemplatesDir string
+
+	BotPatterns string
+
+	GeoIPDatabase  string
+	TrustedProxies []string
+
+	// Адрес служебного сервера со счетчиками кэша, пустой - сервер не запускается
+	AdminAddress string
+
+	Args []string
 }
 
 func NewConfig() (*appConfig, error) {
 	serverAddress := getServerAddress()
 	baseURL := getBaseURL()
+	storageURL := getStorageURL()
 	fileStoragePath := getFileStoragePath()
+	boltStoragePath := getBoltStoragePath()
 	databaseDSN := getDatabaseDSN()
 	secret := getSecret()
+	cacheSize := getCacheSize()
+	cacheTTL := getCacheTTL()
+	cacheNegativeTTL := getCacheNegativeTTL()
+	idGenerator := getIDGenerator()
+	nodeID := getNodeID()
+	idAlphabet := getIDAlphabet()
+	idLength := getIDLength()
+	idDenyList := getIDDenyList()
+	userIDLength := getUserIDLength()
+	redirectType := getRedirectType()
+	templatesDir := getTemplatesDir()
+	botPatterns := getBotPatterns()
+	geoIPDatabase := getGeoIPDatabase()
+	trustedProxies := getTrustedProxies()
+	adminAddress := getAdminAddress()
 	flag.Parse()
 
 	if serverAddress == nil {
@@ -30,10 +94,18 @@ func NewConfig() (*appConfig, error) {
 		return nil, errors.New("base url not specified")
 	}
 
+	if storageURL == nil {
+		return nil, errors.New("storage url not specified")
+	}
+
 	if fileStoragePath == nil {
 		return nil, errors.New("file storage path not specified")
 	}
 
+	if boltStoragePath == nil {
+		return nil, errors.New("bolt storage path not specified")
+	}
+
 	if databaseDSN == nil {
 		return nil, errors.New("database dsn not specified")
 	}
@@ -42,15 +114,202 @@ func NewConfig() (*appConfig, error) {
 		return nil, errors.New("secret key not specified")
 	}
 
+	if *cacheSize < 0 || *cacheTTL < 0 || *cacheNegativeTTL < 0 {
+		return nil, errors.New("cache settings must not be negative")
+	}
+
+	switch *idGenerator {
+	case IDGeneratorRandom, IDGeneratorSequence, IDGeneratorSnowflake:
+	default:
+		return nil, fmt.Errorf("unknown id generator %q, supported: %s, %s, %s",
+			*idGenerator, IDGeneratorRandom, IDGeneratorSequence, IDGeneratorSnowflake)
+	}
+
+	if *idLength < 1 || *idLength > maxIDLength {
+		return nil, fmt.Errorf("id length must be between 1 and %d", maxIDLength)
+	}
+
+	if *userIDLength < 1 || *userIDLength > maxIDLength {
+		return nil, fmt.Errorf("user id length must be between 1 and %d", maxIDLength)
+	}
+
+	switch *redirectType {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+	default:
+		return nil, fmt.Errorf("unknown redirect type %d, supported: 301, 302, 307, 308", *redirectType)
+	}
+
+	storage, err := resolveStorageURL(*storageURL, *fileStoragePath, *boltStoragePath, *databaseDSN)
+	if err != nil {
+		return nil, err
+	}
+
 	return &appConfig{
-		ServerAddress:   *serverAddress,
-		BaseURL:         *baseURL,
-		FileStoragePath: *fileStoragePath,
-		DatabaseDSN:     *databaseDSN,
-		Secret:          []byte(*secret),
+		ServerAddress: *serverAddress,
+		BaseURL:       *baseURL,
+		StorageURL:    storage,
+		Secret:        []byte(*secret),
+		Args:          flag.Args(),
+
+		CacheSize:        *cacheSize,
+		CacheTTL:         *cacheTTL,
+		CacheNegativeTTL: *cacheNegativeTTL,
+
+		IDGenerator: *idGenerator,
+		NodeID:      *nodeID,
+		IDAlphabet:  *idAlphabet,
+		IDLength:    *idLength,
+		IDDenyList:  *idDenyList,
+
+		UserIDLength: *userIDLength,
+
+		RedirectType: *redirectType,
+		TemplatesDir: *templatesDir,
+
+		BotPatterns: *botPatterns,
+
+		GeoIPDatabase:  *geoIPDatabase,
+		TrustedProxies: splitList(*trustedProxies),
+
+		AdminAddress: *adminAddress,
 	}, nil
 }
 
+// resolveStorageURL Сводит STORAGE_URL и устаревшие настройки хранилища к одному адресу
+func resolveStorageURL(storageURL, fileStoragePath, boltStoragePath, databaseDSN string) (string, error) {
+	legacy := map[string]string{}
+	if fileStoragePath != "" {
+		legacy["FILE_STORAGE_PATH"] = (&url.URL{Scheme: "file", Path: fileStoragePath}).String()
+	}
+	if boltStoragePath != "" {
+		legacy["BOLT_STORAGE_PATH"] = (&url.URL{Scheme: "bolt", Path: boltStoragePath}).String()
+	}
+	if databaseDSN != "" {
+		dsn, err := databaseURL(databaseDSN)
+		if err != nil {
+			return "", fmt.Errorf("parse DATABASE_DSN error: %w", err)
+		}
+		legacy["DATABASE_DSN"] = dsn
+	}
+
+	names := make([]string, 0, len(legacy))
+	for _, name := range []string{"FILE_STORAGE_PATH", "BOLT_STORAGE_PATH", "DATABASE_DSN"} {
+		if _, ok := legacy[name]; ok {
+			names = append(names, name)
+		}
+	}
+
+	switch {
+	case storageURL != "" && len(names) > 0:
+		return "", fmt.Errorf("conflicting storage settings: STORAGE_URL and %s are both specified", strings.Join(names, ", "))
+	case len(names) > 1:
+		return "", fmt.Errorf("conflicting storage settings: %s are specified, use only one or STORAGE_URL", strings.Join(names, ", "))
+	case len(names) == 1:
+		return legacy[names[0]], nil
+	case storageURL == "":
+		return "memory://", nil
+	}
+
+	u, err := url.Parse(storageURL)
+	if err != nil {
+		return "", fmt.Errorf("parse STORAGE_URL error: %w", err)
+	}
+	if u.Scheme == "" {
+		return "", fmt.Errorf("STORAGE_URL %q has no scheme, expected e.g. memory://, file:///var/lib/shortener.db or postgres://...", u.Redacted())
+	}
+
+	return storageURL, nil
+}
+
+// databaseURL Приводит DSN вида "host=localhost port=5432 ..." к адресу postgres://
+func databaseURL(dsn string) (string, error) {
+	if strings.Contains(dsn, "://") {
+		return dsn, nil
+	}
+
+	params, err := parseKeyValueDSN(dsn)
+	if err != nil {
+		return "", err
+	}
+
+	u := url.URL{Scheme: "postgres", Host: params["host"]}
+	if port, ok := params["port"]; ok {
+		u.Host += ":" + port
+	}
+	if user, ok := params["user"]; ok {
+		if password, ok := params["password"]; ok {
+			u.User = url.UserPassword(user, password)
+		} else {
+			u.User = url.User(user)
+		}
+	}
+	if dbname, ok := params["dbname"]; ok {
+		u.Path = "/" + dbname
+	}
+
+	query := url.Values{}
+	for key, value := range params {
+		switch key {
+		case "host", "port", "user", "password", "dbname":
+		default:
+			query.Set(key, value)
+		}
+	}
+	u.RawQuery = query.Encode()
+
+	return u.String(), nil
+}
+
+// parseKeyValueDSN Разбирает DSN вида key=value key='quoted value'
+func parseKeyValueDSN(dsn string) (map[string]string, error) {
+	params := map[string]string{}
+	s := strings.TrimSpace(dsn)
+
+	for s != "" {
+		eq := strings.IndexByte(s, '=')
+		if eq <= 0 {
+			return nil, fmt.Errorf("invalid dsn parameter %q", s)
+		}
+
+		key := strings.TrimSpace(s[:eq])
+		s = strings.TrimLeft(s[eq+1:], " ")
+
+		var value strings.Builder
+		if strings.HasPrefix(s, "'") {
+			s = s[1:]
+			closed := false
+			for i := 0; i < len(s); i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+					value.WriteByte(s[i])
+					continue
+				}
+				if s[i] == '\'' {
+					s = s[i+1:]
+					closed = true
+					break
+				}
+				value.WriteByte(s[i])
+			}
+			if !closed {
+				return nil, fmt.Errorf("unterminated quoted value of %q", key)
+			}
+		} else {
+			end := strings.IndexByte(s, ' ')
+			if end < 0 {
+				end = len(s)
+			}
+			value.WriteString(s[:end])
+			s = s[end:]
+		}
+
+		params[key] = value.String()
+		s = strings.TrimSpace(s)
+	}
+
+	return params, nil
+}
+
 func getServerAddress() *string {
 	address := os.Getenv("SERVER_ADDRESS")
 	if address == "" {
@@ -69,16 +328,28 @@ func getBaseURL() *string {
 	return flag.String("b", url, "base url")
 }
 
+func getStorageURL() *string {
+	url := os.Getenv("STORAGE_URL")
+
+	return flag.String("storage", url, "storage url: memory://, file:///path, bolt:///path or postgres://...")
+}
+
 func getFileStoragePath() *string {
 	path := os.Getenv("FILE_STORAGE_PATH")
 
-	return flag.String("f", path, "file storage path")
+	return flag.String("f", path, "file storage path, deprecated in favour of -storage file:///path")
+}
+
+func getBoltStoragePath() *string {
+	path := os.Getenv("BOLT_STORAGE_PATH")
+
+	return flag.String("k", path, "bolt storage path, deprecated in favour of -storage bolt:///path")
 }
 
 func getDatabaseDSN() *string {
 	dsn := os.Getenv("DATABASE_DSN")
 
-	return flag.String("d", dsn, "data source name")
+	return flag.String("d", dsn, "data source name, deprecated in favour of -storage postgres://...")
 }
 
 func getSecret() *string {
@@ -89,3 +360,132 @@ func getSecret() *string {
 
 	return flag.String("s", url, "secret")
 }
+
+func getCacheSize() *int {
+	size, err := strconv.Atoi(os.Getenv("CACHE_SIZE"))
+	if err != nil {
+		size = defaultCacheSize
+	}
+
+	return flag.Int("cache-size", size, "max number of cached links, 0 disables cache")
+}
+
+func getCacheTTL() *time.Duration {
+	ttl, err := time.ParseDuration(os.Getenv("CACHE_TTL"))
+	if err != nil {
+		ttl = defaultCacheTTL
+	}
+
+	return flag.Duration("cache-ttl", ttl, "cached link ttl")
+}
+
+func getCacheNegativeTTL() *time.Duration {
+	ttl, err := time.ParseDuration(os.Getenv("CACHE_NEGATIVE_TTL"))
+	if err != nil {
+		ttl = defaultCacheNegativeTTL
+	}
+
+	return flag.Duration("cache-negative-ttl", ttl, "cached not found and deleted link ttl")
+}
+
+func getIDGenerator() *string {
+	kind := os.Getenv("ID_GENERATOR")
+	if kind == "" {
+		kind = IDGeneratorRandom
+	}
+
+	return flag.String("id-generator", kind, "short url id generator: random, sequence or snowflake")
+}
+
+func getNodeID() *int64 {
+	node, err := strconv.ParseInt(os.Getenv("NODE_ID"), 10, 64)
+	if err != nil {
+		node = 0
+	}
+
+	return flag.Int64("node-id", node, "unique instance number for snowflake ids")
+}
+
+func getIDAlphabet() *string {
+	alphabet := os.Getenv("ID_ALPHABET")
+	if alphabet == "" {
+		alphabet = defaultIDAlphabet
+	}
+
+	return flag.String("id-alphabet", alphabet, "short url id alphabet: letters, alphanumeric, lowercase, unambiguous or explicit characters")
+}
+
+func getIDLength() *int64 {
+	length, err := strconv.ParseInt(os.Getenv("ID_LENGTH"), 10, 64)
+	if err != nil {
+		length = defaultIDLength
+	}
+
+	return flag.Int64("id-length", length, "initial short url id length")
+}
+
+func getIDDenyList() *string {
+	path := os.Getenv("ID_DENY_LIST")
+
+	return flag.String("id-deny-list", path, "file with words short url ids must not contain, one per line")
+}
+
+func getUserIDLength() *int64 {
+	length, err := strconv.ParseInt(os.Getenv("USER_ID_LENGTH"), 10, 64)
+	if err != nil {
+		length = defaultUserIDLength
+	}
+
+	return flag.Int64("user-id-length", length, "user id length, changing it invalidates issued tokens")
+}
+
+func getRedirectType() *int {
+	code, err := strconv.Atoi(os.Getenv("REDIRECT_TYPE"))
+	if err != nil {
+		code = defaultRedirectType
+	}
+
+	return flag.Int("redirect-type", code, "default redirect status code for links without their own: 301, 302, 307 or 308")
+}
+
+func getTemplatesDir() *string {
+	dir := os.Getenv("TEMPLATES_DIR")
+
+	return flag.String("templates", dir, "directory with html templates overriding the embedded ones, e.g. preview.html")
+}
+
+func getBotPatterns() *string {
+	path := os.Getenv("BOT_PATTERNS")
+
+	return flag.String("bot-patterns", path, "file with bot user agent patterns, one regexp per line, reloaded on SIGHUP")
+}
+
+func getGeoIPDatabase() *string {
+	path := os.Getenv("GEOIP_DATABASE")
+
+	return flag.String("geoip-db", path, "local MaxMind city database (.mmdb), geo stats are disabled without it")
+}
+
+func getTrustedProxies() *string {
+	proxies := os.Getenv("TRUSTED_PROXIES")
+
+	return flag.String("trusted-proxies", proxies, "comma separated proxy addresses or CIDRs allowed to set X-Forwarded-For and X-Real-IP")
+}
+
+func getAdminAddress() *string {
+	address := os.Getenv("ADMIN_ADDRESS")
+
+	return flag.String("admin", address, "address of the admin server with cache stats, e.g. 127.0.0.1:8081, disabled if empty")
+}
+
+// splitList Разбирает список через запятую, пропуская пустые элементы
+func splitList(value string) []string {
+	var res []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			res = append(res, item)
+		}
+	}
+
+	return res
+}
@@ -1,33 +1,450 @@
 package handlers
 
-import "github.com/bgoldovsky/shortener/internal/app/models"
+import (
+	"encoding/base64"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bgoldovsky/shortener/internal/app/models"
+	"github.com/bgoldovsky/shortener/internal/app/rules"
+)
+
+const (
+	statsBucketDay     = "day"
+	defaultStatsPeriod = time.Hour * 24 * 30
+)
+
+var errPathTraversal = errors.New("path must not contain dot segments")
+
+var statsBuckets = map[string]time.Duration{
+	"minute":       time.Minute,
+	"hour":         time.Hour,
+	statsBucketDay: time.Hour * 24,
+}
 
 func toGetUrlsReply(model []models.URL) []GetUrlsReply {
 	reply := make([]GetUrlsReply, len(model))
 
 	for idx, m := range model {
 		reply[idx] = GetUrlsReply{
-			ShortURL:    m.ShortURL,
-			OriginalURL: m.OriginalURL,
+			ShortURL:     m.ShortURL,
+			OriginalURL:  m.OriginalURL,
+			EffectiveURL: toEffectiveURL(m),
+			ExpiresAt:    m.ExpiresAt,
+			RedirectType: m.RedirectType,
+			Interstitial: m.Interstitial,
+			Protected:    m.Protected(),
+			NotBefore:    m.NotBefore,
+			MaxClicks:    m.MaxClicks,
+			ClickCount:   m.ClickCount,
+			Targets:      toTargetsReply(m.Targets),
+			Sticky:       m.Sticky,
+			Rules:        toRulesReply(m.Rules),
+			Passthrough:  m.Passthrough,
+			UTM:          toUTMReply(m.UTM),
+		}
+	}
+
+	return reply
+}
+
+func toShortenRequest(model ShortenRequest, now time.Time) models.OriginalURL {
+	return models.OriginalURL{
+		URL:          model.URL,
+		Alias:        model.Alias,
+		ExpiresAt:    toExpiresAt(model.ExpiresAt, model.NotAfter, model.TTL, now),
+		RedirectType: model.RedirectType,
+		Interstitial: model.Interstitial,
+		Password:     model.Password,
+		NotBefore:    model.NotBefore,
+		MaxClicks:    model.MaxClicks,
+		Targets:      toTargets(model.Targets),
+		Sticky:       model.Sticky,
+		Rules:        toRules(model.Rules),
+		Passthrough:  model.Passthrough,
+		UTM:          toUTM(model.UTM),
+	}
+}
+
+func toRules(model []RuleRequest) []models.Rule {
+	if len(model) == 0 {
+		return nil
+	}
+
+	res := make([]models.Rule, len(model))
+	for idx, m := range model {
+		res[idx] = models.Rule{
+			Platforms: m.Platforms,
+			Languages: m.Languages,
+			Query:     m.Query,
+			Target:    m.Target,
+		}
+		if m.Hours != nil {
+			res[idx].Hours = &models.TimeWindow{From: int(m.Hours.From), To: int(m.Hours.To)}
+		}
+	}
+
+	return res
+}
+
+func toRulesReply(model []models.Rule) []RuleRequest {
+	if len(model) == 0 {
+		return nil
+	}
+
+	reply := make([]RuleRequest, len(model))
+	for idx, m := range model {
+		reply[idx] = RuleRequest{
+			Platforms: m.Platforms,
+			Languages: m.Languages,
+			Query:     m.Query,
+			Target:    m.Target,
+		}
+		if m.Hours != nil {
+			reply[idx].Hours = &HoursRequest{From: clock(m.Hours.From), To: clock(m.Hours.To)}
+		}
+	}
+
+	return reply
+}
+
+// toRuleRequest Признаки запроса для выбора правила перенаправления
+func toRuleRequest(r *http.Request, now time.Time) rules.Request {
+	return rules.Request{
+		UserAgent:      r.UserAgent(),
+		AcceptLanguage: r.Header.Get("Accept-Language"),
+		Query:          r.URL.Query(),
+		Time:           now,
+	}
+}
+
+func toDryRunReply(link models.URL, req rules.Request) DryRunReply {
+	reply := DryRunReply{
+		Platform: rules.Platform(req.UserAgent),
+		Language: rules.Language(req.AcceptLanguage),
+	}
+
+	if idx, ok := rules.Match(link.Rules, req); ok {
+		reply.Rule = &idx
+		reply.Target = link.Rules[idx].Target
+		return reply
+	}
+
+	if link.Split() {
+		reply.Targets = toTargetsReply(link.Targets)
+		return reply
+	}
+
+	reply.Target = link.OriginalURL
+
+	return reply
+}
+
+// toDryRunRequest Дополняет проверяемый запрос признаками самого запроса проверки
+func toDryRunRequest(model DryRunRequest, r *http.Request, now time.Time) rules.Request {
+	req := toRuleRequest(r, now)
+	req.Query = url.Values{}
+
+	if model.UserAgent != "" {
+		req.UserAgent = model.UserAgent
+	}
+	if model.AcceptLanguage != "" {
+		req.AcceptLanguage = model.AcceptLanguage
+	}
+	for name, value := range model.Query {
+		req.Query.Set(name, value)
+	}
+	if model.Time != nil {
+		req.Time = *model.Time
+	}
+
+	return req
+}
+
+func toTargets(model []TargetRequest) []models.Target {
+	if len(model) == 0 {
+		return nil
+	}
+
+	targets := make([]models.Target, len(model))
+	for idx, m := range model {
+		targets[idx] = models.Target{URL: m.URL, Weight: m.Weight}
+		if m.Weight == 0 {
+			targets[idx].Weight = 1
 		}
 	}
 
+	return targets
+}
+
+func toTargetsReply(model []models.Target) []TargetReply {
+	if len(model) == 0 {
+		return nil
+	}
+
+	reply := make([]TargetReply, len(model))
+	for idx, m := range model {
+		reply[idx] = TargetReply{URL: m.URL, Weight: m.Weight}
+	}
+
 	return reply
 }
 
-func toShortenBatchRequest(model []ShortenBatchRequest) []models.OriginalURL {
+func toShortenBatchRequest(model []ShortenBatchRequest, now time.Time) []models.OriginalURL {
 	reply := make([]models.OriginalURL, len(model))
 
 	for idx, m := range model {
 		reply[idx] = models.OriginalURL{
 			CorrelationID: m.CorrelationID,
 			URL:           m.OriginalURL,
+			ExpiresAt:     toExpiresAt(m.ExpiresAt, m.NotAfter, m.TTL, now),
+			RedirectType:  m.RedirectType,
+			Interstitial:  m.Interstitial,
+			NotBefore:     m.NotBefore,
+			MaxClicks:     m.MaxClicks,
+			Passthrough:   m.Passthrough,
+			UTM:           toUTM(m.UTM),
 		}
 	}
 
 	return reply
 }
 
+// toEffectiveURL Возвращает адрес перехода по ссылке вместе с метками кампании
+func toEffectiveURL(link models.URL) string {
+	effective, err := toUTMURL(link.OriginalURL, link.UTM)
+	if err != nil {
+		return link.OriginalURL
+	}
+
+	return effective
+}
+
+func toUTM(model *UTMRequest) *models.UTM {
+	if model == nil {
+		return nil
+	}
+
+	return &models.UTM{
+		Source:   model.Source,
+		Medium:   model.Medium,
+		Campaign: model.Campaign,
+		Term:     model.Term,
+		Content:  model.Content,
+	}
+}
+
+func toUTMReply(model *models.UTM) *UTMRequest {
+	if model == nil {
+		return nil
+	}
+
+	return &UTMRequest{
+		Source:   model.Source,
+		Medium:   model.Medium,
+		Campaign: model.Campaign,
+		Term:     model.Term,
+		Content:  model.Content,
+	}
+}
+
+// toUTMURL Дописывает метки кампании к адресу назначения.
+// Метки ссылки заменяют одноименные параметры адреса, пустые метки не дописываются.
+// Остальные параметры адреса не перекодируются и сохраняют порядок
+func toUTMURL(destination string, utm *models.UTM) (string, error) {
+	if utm == nil {
+		return destination, nil
+	}
+
+	target, err := url.Parse(destination)
+	if err != nil {
+		return "", err
+	}
+
+	var keys []string
+	values := url.Values{}
+	for _, param := range []struct{ key, value string }{
+		{key: "utm_source", value: utm.Source},
+		{key: "utm_medium", value: utm.Medium},
+		{key: "utm_campaign", value: utm.Campaign},
+		{key: "utm_term", value: utm.Term},
+		{key: "utm_content", value: utm.Content},
+	} {
+		if param.value != "" {
+			keys = append(keys, param.key)
+			values.Set(param.key, param.value)
+		}
+	}
+	target.RawQuery = replaceQuery(target.RawQuery, keys, values)
+
+	return target.String(), nil
+}
+
+// replaceQuery Заменяет в строке запроса параметры keys значениями из values.
+// Прочие пары остаются как были, включая порядок, экранирование и неразборчивые пары,
+// новые значения дописываются в конец в порядке keys
+func replaceQuery(rawQuery string, keys []string, values url.Values) string {
+	if len(keys) == 0 {
+		return rawQuery
+	}
+
+	replaced := make(map[string]struct{}, len(keys))
+	for _, key := range keys {
+		replaced[key] = struct{}{}
+	}
+
+	var pairs []string
+	if rawQuery != "" {
+		for _, pair := range strings.Split(rawQuery, "&") {
+			key := pair
+			if idx := strings.IndexByte(pair, '='); idx >= 0 {
+				key = pair[:idx]
+			}
+			if unescaped, err := url.QueryUnescape(key); err == nil {
+				key = unescaped
+			}
+			if _, ok := replaced[key]; ok {
+				continue
+			}
+			pairs = append(pairs, pair)
+		}
+	}
+
+	for _, key := range keys {
+		for _, value := range values[key] {
+			pairs = append(pairs, url.QueryEscape(key)+"="+url.QueryEscape(value))
+		}
+	}
+
+	return strings.Join(pairs, "&")
+}
+
+// toExpiresAt Переводит время жизни в секундах в абсолютное время истечения.
+// Из способов задать срок действия валидация пропускает не более одного
+func toExpiresAt(expiresAt, notAfter *time.Time, ttl int64, now time.Time) *time.Time {
+	if ttl > 0 {
+		t := now.Add(time.Duration(ttl) * time.Second)
+		return &t
+	}
+
+	if notAfter != nil {
+		return notAfter
+	}
+
+	return expiresAt
+}
+
+func toPreviewPage(link models.URL, continueURL string) previewPage {
+	page := previewPage{
+		Destination: link.OriginalURL,
+		CreatedAt:   link.CreatedAt,
+		ContinueURL: continueURL,
+	}
+
+	if destination, err := url.Parse(link.OriginalURL); err == nil {
+		page.Host = destination.Hostname()
+	}
+
+	return page
+}
+
+// toContinueURL Возвращает адрес перехода со страницы предпросмотра.
+// Путь и параметры запроса сохраняются, чтобы переход вел туда же, куда и без предпросмотра
+func toContinueURL(id, rest string, query url.Values) string {
+	values := make(url.Values, len(query)+1)
+	for key, value := range query {
+		values[key] = value
+	}
+	values.Del("preview")
+	values.Set("continue", "1")
+
+	return "/" + url.PathEscape(id) + rest + "?" + values.Encode()
+}
+
+// toRestPath Возвращает экранированную часть пути после идентификатора вместе с ведущим слэшем
+func toRestPath(r *http.Request) string {
+	path := strings.TrimPrefix(r.URL.EscapedPath(), "/")
+	if idx := strings.IndexByte(path, '/'); idx >= 0 {
+		return path[idx:]
+	}
+
+	return ""
+}
+
+// toPassthroughURL Дописывает к адресу назначения путь после идентификатора и параметры запроса.
+// Параметры запроса заменяют одноименные параметры адреса назначения, служебные параметры не передаются.
+// Остальные параметры адреса назначения не перекодируются и сохраняют порядок
+func toPassthroughURL(destination, rest string, query url.Values) (string, error) {
+	target, err := url.Parse(destination)
+	if err != nil {
+		return "", err
+	}
+
+	if rest != "" {
+		for _, segment := range strings.Split(rest, "/") {
+			segment, err = url.PathUnescape(segment)
+			if err != nil {
+				return "", err
+			}
+			if segment == "." || segment == ".." {
+				return "", errPathTraversal
+			}
+		}
+
+		escaped := strings.TrimSuffix(target.EscapedPath(), "/") + rest
+		if target.Path, err = url.PathUnescape(escaped); err != nil {
+			return "", err
+		}
+		target.RawPath = escaped
+	}
+
+	// Переданные параметры дописываются по алфавиту, чтобы адрес не зависел от обхода словаря
+	var keys []string
+	for key := range query {
+		if key == "preview" || key == "continue" {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	target.RawQuery = replaceQuery(target.RawQuery, keys, query)
+
+	return target.String(), nil
+}
+
+func toPasswordPage(r *http.Request, errorText string) passwordPage {
+	return passwordPage{
+		Action: r.URL.RequestURI(),
+		Error:  errorText,
+	}
+}
+
+// unlockCookieName Имя cookie открытой паролем ссылки, идентификатор кодируется,
+// так как в настраиваемом алфавите могут быть недопустимые в имени cookie символы
+func unlockCookieName(id string) string {
+	return "unlock_" + base64.RawURLEncoding.EncodeToString([]byte(id))
+}
+
+// variantCookieName Имя cookie с выбранным адресом ссылки с закреплением
+func variantCookieName(id string) string {
+	return "variant_" + base64.RawURLEncoding.EncodeToString([]byte(id))
+}
+
+// remoteIP Адрес клиента без порта
+func remoteIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return ip
+}
+
 func toShortenBatchReply(model []models.URL) []ShortenBatchReply {
 	reply := make([]ShortenBatchReply, len(model))
 
@@ -40,3 +457,117 @@ func toShortenBatchReply(model []models.URL) []ShortenBatchReply {
 
 	return reply
 }
+
+// toClick Собирает переход по ссылке из запроса
+func toClick(urlID string, r *http.Request, bot bool, now time.Time) models.Click {
+	return models.Click{
+		URLID:          urlID,
+		Time:           now,
+		Referrer:       r.Referer(),
+		UserAgent:      r.UserAgent(),
+		IP:             remoteIP(r),
+		AcceptLanguage: r.Header.Get("Accept-Language"),
+		Bot:            bot,
+	}
+}
+
+// parseStatsRequest Разбирает период статистики: по умолчанию последние 30 дней по дням
+func parseStatsRequest(query url.Values, now time.Time) (statsRequest, error) {
+	req := statsRequest{
+		To:         now,
+		BucketName: statsBucketDay,
+	}
+
+	if value := query.Get("to"); value != "" {
+		to, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return statsRequest{}, errors.New("to must be in RFC 3339 format")
+		}
+		req.To = to
+	}
+
+	req.From = req.To.Add(-defaultStatsPeriod)
+	if value := query.Get("from"); value != "" {
+		from, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return statsRequest{}, errors.New("from must be in RFC 3339 format")
+		}
+		req.From = from
+	}
+
+	if !req.From.Before(req.To) {
+		return statsRequest{}, errors.New("from must be before to")
+	}
+
+	if value := query.Get("bucket"); value != "" {
+		req.BucketName = value
+	}
+
+	bucket, ok := statsBuckets[req.BucketName]
+	if !ok {
+		return statsRequest{}, errors.New("bucket must be one of minute, hour or day")
+	}
+	req.Bucket = bucket
+
+	return req, nil
+}
+
+func toStatsReply(urlID string, req statsRequest, model models.ClickStats) StatsReply {
+	buckets := make([]StatsBucketReply, len(model.Buckets))
+	for idx, b := range model.Buckets {
+		buckets[idx] = StatsBucketReply{
+			Start:    b.Start,
+			Count:    b.Count,
+			Humans:   b.Humans,
+			Bots:     b.Bots,
+			Visitors: b.Visitors,
+		}
+	}
+
+	return StatsReply{
+		URLID:     urlID,
+		From:      req.From,
+		To:        req.To,
+		Bucket:    req.BucketName,
+		Total:     model.Total,
+		Humans:    model.Humans,
+		Bots:      model.Bots,
+		Visitors:  model.Visitors,
+		Buckets:   buckets,
+		Countries: toStatsGeoReply(model.Countries),
+		Cities:    toStatsGeoReply(model.Cities),
+		Targets:   toStatsTargetReply(model.Targets),
+	}
+}
+
+func toStatsTargetReply(model []models.TargetCount) []StatsTargetReply {
+	if len(model) == 0 {
+		return nil
+	}
+
+	reply := make([]StatsTargetReply, len(model))
+	for idx, m := range model {
+		reply[idx] = StatsTargetReply{
+			URL:    m.URL,
+			Weight: m.Weight,
+			Count:  m.Count,
+			Humans: m.Humans,
+			Bots:   m.Bots,
+		}
+	}
+
+	return reply
+}
+
+func toStatsGeoReply(model []models.GeoCount) []StatsGeoReply {
+	reply := make([]StatsGeoReply, len(model))
+	for idx, m := range model {
+		reply[idx] = StatsGeoReply{
+			Country: m.Country,
+			City:    m.City,
+			Count:   m.Count,
+		}
+	}
+
+	return reply
+}
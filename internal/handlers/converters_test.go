@@ -3,8 +3,12 @@ package handlers
 import (
 	"github.com/bgoldovsky/shortener/internal/app/models"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
+	"encoding/json"
+	"net/url"
 	"testing"
+	"time"
 )
 
 func TestToGetUrlsReply(t *testing.T) {
@@ -24,13 +28,51 @@ func TestToGetUrlsReply(t *testing.T) {
 				},
 			},
 			exp: []GetUrlsReply{
+				{
+					ShortURL:     "http://localhost:8080/xyz",
+					OriginalURL:  "https://avito.ru",
+					EffectiveURL: "https://avito.ru",
+				},
+				{
+					ShortURL:     "http://localhost:8080/qwerty",
+					OriginalURL:  "https://yandex.ru",
+					EffectiveURL: "https://yandex.ru",
+				},
+			},
+		},
+		{
+			model: []models.URL{
 				{
 					ShortURL:    "http://localhost:8080/xyz",
-					OriginalURL: "https://avito.ru",
+					OriginalURL: "https://avito.ru/a",
+					Targets:     []models.Target{{URL: "https://avito.ru/a", Weight: 3}, {URL: "https://avito.ru/b", Weight: 1}},
+					Sticky:      true,
 				},
+			},
+			exp: []GetUrlsReply{
 				{
-					ShortURL:    "http://localhost:8080/qwerty",
-					OriginalURL: "https://yandex.ru",
+					ShortURL:     "http://localhost:8080/xyz",
+					OriginalURL:  "https://avito.ru/a",
+					EffectiveURL: "https://avito.ru/a",
+					Targets:      []TargetReply{{URL: "https://avito.ru/a", Weight: 3}, {URL: "https://avito.ru/b", Weight: 1}},
+					Sticky:       true,
+				},
+			},
+		},
+		{
+			model: []models.URL{
+				{
+					ShortURL:    "http://localhost:8080/xyz",
+					OriginalURL: "https://avito.ru/sale?utm_source=typo&page=2",
+					UTM:         &models.UTM{Source: "newsletter", Medium: "email", Campaign: "spring sale"},
+				},
+			},
+			exp: []GetUrlsReply{
+				{
+					ShortURL:     "http://localhost:8080/xyz",
+					OriginalURL:  "https://avito.ru/sale?utm_source=typo&page=2",
+					EffectiveURL: "https://avito.ru/sale?page=2&utm_source=newsletter&utm_medium=email&utm_campaign=spring+sale",
+					UTM:          &UTMRequest{Source: "newsletter", Medium: "email", Campaign: "spring sale"},
 				},
 			},
 		},
@@ -51,6 +93,23 @@ func TestToGetUrlsReply(t *testing.T) {
 	}
 }
 
+func TestToRulesReply(t *testing.T) {
+	model := []models.Rule{
+		{Platforms: []string{"android"}, Hours: &models.TimeWindow{From: 22 * 60, To: 6*60 + 5}, Target: "https://avito.ru/night"},
+	}
+
+	act, err := json.Marshal(toRulesReply(model))
+	require.NoError(t, err)
+	assert.JSONEq(t, `[{"platforms":["android"],"hours":{"from":"22:00","to":"06:05"},"target":"https://avito.ru/night"}]`, string(act))
+
+	// Ответ разбирается обратно в те же правила
+	var req []RuleRequest
+	require.NoError(t, json.Unmarshal(act, &req))
+	assert.Equal(t, model, toRules(req))
+
+	assert.Nil(t, toRulesReply(nil))
+}
+
 func TestToShortenBatchRequest(t *testing.T) {
 	tests := []struct {
 		model []ShortenBatchRequest
@@ -89,7 +148,7 @@ func TestToShortenBatchRequest(t *testing.T) {
 	}
 
 	for _, tt := range tests {
-		act := toShortenBatchRequest(tt.model)
+		act := toShortenBatchRequest(tt.model, time.Now())
 
 		assert.Equal(t, tt.exp, act)
 	}
@@ -140,3 +199,193 @@ func TestToShortenBatchReply(t *testing.T) {
 		assert.Equal(t, tt.exp, act)
 	}
 }
+
+func TestToExpiresAt(t *testing.T) {
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	expiresAt := now.Add(time.Hour)
+	afterMinute := now.Add(time.Minute)
+
+	tests := []struct {
+		name      string
+		expiresAt *time.Time
+		notAfter  *time.Time
+		ttl       int64
+		exp       *time.Time
+	}{
+		{
+			name: "without expiration",
+			exp:  nil,
+		},
+		{
+			name:      "expires_at",
+			expiresAt: &expiresAt,
+			exp:       &expiresAt,
+		},
+		{
+			name:     "not_after",
+			notAfter: &expiresAt,
+			exp:      &expiresAt,
+		},
+		{
+			name: "ttl",
+			ttl:  60,
+			exp:  &afterMinute,
+		},
+	}
+
+	for _, tt := range tests {
+		act := toExpiresAt(tt.expiresAt, tt.notAfter, tt.ttl, now)
+
+		assert.Equal(t, tt.exp, act, tt.name)
+	}
+}
+
+func TestToPassthroughURL(t *testing.T) {
+	tests := []struct {
+		name        string
+		destination string
+		rest        string
+		query       url.Values
+		exp         string
+		err         bool
+	}{
+		{
+			name:        "without path and query",
+			destination: "https://avito.ru/docs",
+			exp:         "https://avito.ru/docs",
+		},
+		{
+			name:        "path",
+			destination: "https://avito.ru/docs/",
+			rest:        "/api/v2",
+			exp:         "https://avito.ru/docs/api/v2",
+		},
+		{
+			name:        "escaped path",
+			destination: "https://avito.ru/docs",
+			rest:        "/a%20b/c%2Fd",
+			exp:         "https://avito.ru/docs/a%20b/c%2Fd",
+		},
+		{
+			name:        "query merged",
+			destination: "https://avito.ru/docs?lang=ru&x=0#top",
+			rest:        "/api",
+			query:       url.Values{"x": {"1"}, "q": {"a&b"}, "preview": {"0"}, "continue": {"1"}},
+			exp:         "https://avito.ru/docs/api?lang=ru&q=a%26b&x=1#top",
+		},
+		{
+			name:        "unsorted destination query kept",
+			destination: "https://avito.ru/docs?z=9&lang=ru&x=0&b=a+b&y=%zz",
+			query:       url.Values{"x": {"1"}, "q": {"a&b"}, "a": {"1", "2"}},
+			exp:         "https://avito.ru/docs?z=9&lang=ru&b=a+b&y=%zz&a=1&a=2&q=a%26b&x=1",
+		},
+		{
+			name:        "only control params",
+			destination: "https://avito.ru/docs?b=2&a=1",
+			query:       url.Values{"continue": {"1"}},
+			exp:         "https://avito.ru/docs?b=2&a=1",
+		},
+		{
+			name:        "dot segments",
+			destination: "https://avito.ru/docs",
+			rest:        "/api/../../admin",
+			err:         true,
+		},
+		{
+			name:        "escaped dot segments",
+			destination: "https://avito.ru/docs",
+			rest:        "/%2e%2E/admin",
+			err:         true,
+		},
+	}
+
+	for _, tt := range tests {
+		act, err := toPassthroughURL(tt.destination, tt.rest, tt.query)
+		if tt.err {
+			assert.Error(t, err, tt.name)
+			continue
+		}
+
+		require.NoError(t, err, tt.name)
+		assert.Equal(t, tt.exp, act, tt.name)
+	}
+}
+
+func TestToUTMURL(t *testing.T) {
+	utm := &models.UTM{Source: "newsletter", Medium: "email", Campaign: "a&b=c", Content: "банер"}
+
+	// Параметры адреса сохраняют порядок и запись, заменяются только метки
+	act, err := toUTMURL("https://avito.ru/docs?x=1&utm_source=old&b=a+b&y=%zz&a=%2F#top", utm)
+	require.NoError(t, err)
+	assert.Equal(t, "https://avito.ru/docs?x=1&b=a+b&y=%zz&a=%2F&utm_source=newsletter&utm_medium=email&utm_campaign=a%26b%3Dc&utm_content=%D0%B1%D0%B0%D0%BD%D0%B5%D1%80#top", act)
+
+	act, err = toUTMURL("https://avito.ru/docs", utm)
+	require.NoError(t, err)
+	assert.Equal(t, "https://avito.ru/docs?utm_source=newsletter&utm_medium=email&utm_campaign=a%26b%3Dc&utm_content=%D0%B1%D0%B0%D0%BD%D0%B5%D1%80", act)
+
+	// Без меток адрес не перекодируется
+	act, err = toUTMURL("https://avito.ru/docs?b=2&a=1", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "https://avito.ru/docs?b=2&a=1", act)
+}
+
+func TestToContinueURL(t *testing.T) {
+	assert.Equal(t, "/xyz?continue=1", toContinueURL("xyz", "", url.Values{"preview": {"1"}}))
+	assert.Equal(t, "/xyz/api/v2?continue=1&x=1", toContinueURL("xyz", "/api/v2", url.Values{"x": {"1"}, "preview": {"1"}}))
+}
+
+func TestParseStatsRequest(t *testing.T) {
+	now := time.Date(2022, 5, 31, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		query   string
+		exp     statsRequest
+		wantErr bool
+	}{
+		{
+			name:  "defaults",
+			query: "",
+			exp:   statsRequest{From: now.Add(-defaultStatsPeriod), To: now, Bucket: time.Hour * 24, BucketName: "day"},
+		},
+		{
+			name:  "explicit",
+			query: "from=2022-05-31T00:00:00Z&to=2022-05-31T06:00:00Z&bucket=hour",
+			exp: statsRequest{
+				From:       time.Date(2022, 5, 31, 0, 0, 0, 0, time.UTC),
+				To:         time.Date(2022, 5, 31, 6, 0, 0, 0, time.UTC),
+				Bucket:     time.Hour,
+				BucketName: "hour",
+			},
+		},
+		{
+			name:    "invalid from",
+			query:   "from=yesterday",
+			wantErr: true,
+		},
+		{
+			name:    "from after to",
+			query:   "from=2022-06-01T00:00:00Z",
+			wantErr: true,
+		},
+		{
+			name:    "unknown bucket",
+			query:   "bucket=week",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		query, err := url.ParseQuery(tt.query)
+		require.NoError(t, err)
+
+		act, err := parseStatsRequest(query, now)
+		if tt.wantErr {
+			assert.Error(t, err, tt.name)
+			continue
+		}
+
+		assert.NoError(t, err, tt.name)
+		assert.Equal(t, tt.exp, act, tt.name)
+	}
+}
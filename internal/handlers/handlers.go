@@ -2,25 +2,44 @@
 package handlers
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/asaskevich/govalidator"
 	"github.com/go-chi/chi/v5"
 	"github.com/sirupsen/logrus"
 
 	"github.com/bgoldovsky/shortener/internal/app/models"
+	"github.com/bgoldovsky/shortener/internal/app/pages"
+	"github.com/bgoldovsky/shortener/internal/app/rules"
+	clicksSrv "github.com/bgoldovsky/shortener/internal/app/services/clicks"
+	passwordsSrv "github.com/bgoldovsky/shortener/internal/app/services/passwords"
 	urlsSrv "github.com/bgoldovsky/shortener/internal/app/services/urls"
 )
 
+// permanentRedirectMaxAge Сколько браузер может помнить постоянное перенаправление
+const permanentRedirectMaxAge = time.Hour * 24
+
+// maxPasswordFormSize Ограничение тела формы пароля
+const maxPasswordFormSize = 4 << 10
+
 type urlsService interface {
-	Shorten(ctx context.Context, url, userID string) (string, error)
+	Shorten(ctx context.Context, original models.OriginalURL, userID string) (string, error)
 	ShortenBatch(ctx context.Context, originalURLs []models.OriginalURL, userID string) ([]models.URL, error)
-	Expand(ctx context.Context, id string) (string, error)
+	Expand(ctx context.Context, id string) (models.URL, error)
+	CountClick(ctx context.Context, id string) error
 	GetUrls(ctx context.Context, userID string) ([]models.URL, error)
+	GetUserURL(ctx context.Context, id, userID string) (models.URL, error)
+	SetUTMTemplate(ctx context.Context, userID string, utm *models.UTM) error
+	GetUTMTemplate(ctx context.Context, userID string) (*models.UTM, error)
 }
 
 type auth interface {
@@ -35,19 +54,55 @@ type cleaner interface {
 	Queue(urls models.UserCollection)
 }
 
+type clicks interface {
+	Queue(click models.Click)
+	Stats(ctx context.Context, urlID, userID string, from, to time.Time, bucket time.Duration) (models.ClickStats, error)
+}
+
+type bots interface {
+	IsBot(r *http.Request) bool
+}
+
+type renderer interface {
+	Render(w io.Writer, name string, data interface{}) error
+}
+
+type passwords interface {
+	Verify(link models.URL, ip, password string, now time.Time) (time.Duration, error)
+	Token(link models.URL, now time.Time) (string, time.Time)
+	Valid(link models.URL, token string, now time.Time) bool
+}
+
+type variants interface {
+	Pick(link models.URL) int
+	Token(link models.URL, idx int, now time.Time) (string, time.Time)
+	Variant(link models.URL, token string) (int, bool)
+}
+
 type handler struct {
 	urlsService urlsService
 	auth        auth
 	infra       infra
 	cleaner     cleaner
+	clicks      clicks
+	bots        bots
+	renderer    renderer
+	passwords   passwords
+	variants    variants
 }
 
-func New(urlsService urlsService, auth auth, infra infra, cleaner cleaner) *handler {
+func New(urlsService urlsService, auth auth, infra infra, cleaner cleaner, clicks clicks, bots bots, renderer renderer, passwords passwords,
+	variants variants) *handler {
 	return &handler{
 		urlsService: urlsService,
 		auth:        auth,
 		infra:       infra,
 		cleaner:     cleaner,
+		clicks:      clicks,
+		bots:        bots,
+		renderer:    renderer,
+		passwords:   passwords,
+		variants:    variants,
 	}
 }
 
@@ -67,8 +122,13 @@ func (h *handler) ShortenV1(w http.ResponseWriter, r *http.Request) {
 	url := string(b)
 	statusCode := http.StatusCreated
 
-	shortcut, err := h.urlsService.Shorten(r.Context(), url, userID)
+	shortcut, err := h.urlsService.Shorten(r.Context(), models.OriginalURL{URL: url}, userID)
 	if err != nil {
+		// Неполный шаблон UTM-меток пользователя не дает сократить ссылку без меток
+		if errors.Is(err, urlsSrv.ErrInvalidUTM) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		if !errors.Is(err, urlsSrv.ErrNotUniqueURL) {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -110,11 +170,43 @@ func (h *handler) ShortenV2(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if req.URL == "" && len(req.Targets) == 0 {
+		http.Error(w, "request in not valid", http.StatusBadRequest)
+		return
+	}
+	if req.URL != "" && len(req.Targets) != 0 {
+		http.Error(w, "only one of url and targets can be specified", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	if err = validateExpiration(req.ExpiresAt, req.NotAfter, req.TTL, now); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err = validateSchedule(req.NotBefore, toExpiresAt(req.ExpiresAt, req.NotAfter, req.TTL, now), req.MaxClicks); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	userID := h.auth.UserID(r.Context())
 	statusCode := http.StatusCreated
 
-	shortcut, err := h.urlsService.Shorten(r.Context(), req.URL, userID)
+	shortcut, err := h.urlsService.Shorten(r.Context(), toShortenRequest(req, now), userID)
 	if err != nil {
+		if errors.Is(err, urlsSrv.ErrInvalidAlias) || errors.Is(err, urlsSrv.ErrInvalidRedirectType) ||
+			errors.Is(err, urlsSrv.ErrInvalidPassword) || errors.Is(err, urlsSrv.ErrInvalidTargets) ||
+			errors.Is(err, urlsSrv.ErrInvalidRules) || errors.Is(err, urlsSrv.ErrInvalidUTM) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Занятый псевдоним отличается от повторного URL отсутствием сокращенной ссылки в ответе
+		if errors.Is(err, urlsSrv.ErrAliasTaken) {
+			http.Error(w, "alias is already taken", http.StatusConflict)
+			return
+		}
+
 		if !errors.Is(err, urlsSrv.ErrNotUniqueURL) {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -165,18 +257,33 @@ func (h *handler) ShortenBatch(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	now := time.Now()
 	for idx := range req {
 		if ok, err := govalidator.ValidateStruct(req[idx]); err != nil || !ok {
 			http.Error(w, "element of url list not valid", http.StatusBadRequest)
 			return
 		}
+		if err = validateExpiration(req[idx].ExpiresAt, req[idx].NotAfter, req[idx].TTL, now); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		expiresAt := toExpiresAt(req[idx].ExpiresAt, req[idx].NotAfter, req[idx].TTL, now)
+		if err = validateSchedule(req[idx].NotBefore, expiresAt, req[idx].MaxClicks); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 	}
 
 	userID := h.auth.UserID(r.Context())
-	originalUrls := toShortenBatchRequest(req)
+	originalUrls := toShortenBatchRequest(req, now)
 
 	urls, err := h.urlsService.ShortenBatch(r.Context(), originalUrls, userID)
 	if err != nil {
+		if errors.Is(err, urlsSrv.ErrInvalidRedirectType) || errors.Is(err, urlsSrv.ErrInvalidUTM) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -202,7 +309,7 @@ func (h *handler) ShortenBatch(w http.ResponseWriter, r *http.Request) {
 
 // Expand Возвращает полный URL по идентификатору сокращенного
 func (h *handler) Expand(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
@@ -213,24 +320,367 @@ func (h *handler) Expand(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	url, err := h.urlsService.Expand(r.Context(), id)
+	link, err := h.urlsService.Expand(r.Context(), id)
 	if err != nil {
-		if errors.Is(err, urlsSrv.ErrURLNotFound) {
-			http.Error(w, "url not found", http.StatusNoContent)
+		writeExpandError(w, err)
+		return
+	}
+
+	// Путь после идентификатора есть только у ссылок, которые передают его дальше
+	rest := toRestPath(r)
+	if rest != "" && !link.Passthrough {
+		writeExpandError(w, urlsSrv.ErrURLNotFound)
+		return
+	}
+
+	now := time.Now()
+	if !h.unlocked(r, id, link, now) {
+		h.renderPage(w, http.StatusOK, id, pages.Password, toPasswordPage(r, ""))
+		return
+	}
+
+	stored := link
+	destination, variant := h.destination(r, id, link, now)
+	link.OriginalURL = destination
+
+	query := r.URL.Query()
+	if link.Passthrough {
+		link.OriginalURL, err = toPassthroughURL(destination, rest, query)
+		if err != nil {
+			http.Error(w, "invalid path", http.StatusBadRequest)
 			return
 		}
+	}
+
+	// Метки кампании дописываются последними и заменяют одноименные параметры
+	if link.OriginalURL, err = toUTMURL(link.OriginalURL, link.UTM); err != nil {
+		logrus.WithError(err).WithField("urlID", id).Error("build destination url error")
+		http.Error(w, "destination url is not valid", http.StatusInternalServerError)
+		return
+	}
+
+	// Владелец может требовать предпросмотр всегда, кнопка перехода на странице его пропускает
+	if isSet(query.Get("preview")) || link.Interstitial && !isSet(query.Get("continue")) {
+		h.renderPage(w, http.StatusOK, id, pages.Preview, toPreviewPage(link, toContinueURL(id, rest, query)))
+		return
+	}
 
-		if errors.Is(err, urlsSrv.ErrURLDeleted) {
-			http.Error(w, "url has been deleted", http.StatusGone)
+	// HEAD и боты не переходят по ссылке, а проверяют ее, поэтому лимит переходов не расходуют
+	bot := h.bots.IsBot(r)
+	if link.Limited() && r.Method == http.MethodGet && !bot {
+		if err = h.urlsService.CountClick(r.Context(), id); err != nil {
+			writeExpandError(w, err)
 			return
 		}
+	}
+
+	click := toClick(id, r, bot, now)
+	if variant.idx >= 0 {
+		click.Target = destination
+	}
+	h.clicks.Queue(click)
+
+	// Адрес закрепляется только при настоящем переходе, предпросмотр его не закрепляет
+	if variant.stick {
+		h.stickVariant(w, r, id, stored, variant.idx, now)
+	}
+
+	w.Header().Set("Cache-Control", redirectCacheControl(link, now))
+	w.Header().Set("Location", link.OriginalURL)
+	w.WriteHeader(link.RedirectType)
+}
+
+// Preview Показывает страницу с адресом назначения вместо перенаправления
+func (h *handler) Preview(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		http.Error(w, "id parameter is empty", http.StatusBadRequest)
+		return
+	}
+
+	link, err := h.urlsService.Expand(r.Context(), id)
+	if err != nil {
+		writeExpandError(w, err)
+		return
+	}
+
+	// Предпросмотр закрытой ссылки раскрыл бы адрес назначения
+	now := time.Now()
+	if !h.unlocked(r, id, link, now) {
+		h.renderPage(w, http.StatusOK, id, pages.Password, toPasswordPage(r, ""))
+		return
+	}
+
+	link.OriginalURL, _ = h.destination(r, id, link, now)
+	if link.OriginalURL, err = toUTMURL(link.OriginalURL, link.UTM); err != nil {
+		logrus.WithError(err).WithField("urlID", id).Error("build destination url error")
+		http.Error(w, "destination url is not valid", http.StatusInternalServerError)
+		return
+	}
+
+	h.renderPage(w, http.StatusOK, id, pages.Preview, toPreviewPage(link, toContinueURL(id, "", r.URL.Query())))
+}
+
+// Unlock Проверяет пароль закрытой ссылки и запоминает в cookie, что она открыта.
+// После этого возвращает на тот же адрес, где ссылка открывается обычным образом
+func (h *handler) Unlock(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		http.Error(w, "id parameter is empty", http.StatusBadRequest)
+		return
+	}
+
+	link, err := h.urlsService.Expand(r.Context(), id)
+	if err != nil {
+		writeExpandError(w, err)
+		return
+	}
+
+	if !link.Protected() {
+		http.Redirect(w, r, r.URL.RequestURI(), http.StatusSeeOther)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxPasswordFormSize)
+	if err = r.ParseForm(); err != nil {
+		http.Error(w, "request in not valid", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	wait, err := h.passwords.Verify(link, remoteIP(r), r.PostForm.Get("password"), now)
+	if errors.Is(err, passwordsSrv.ErrTooManyAttempts) {
+		w.Header().Set("Retry-After", strconv.FormatInt(int64(math.Ceil(wait.Seconds())), 10))
+		h.renderPage(w, http.StatusTooManyRequests, id, pages.Password, toPasswordPage(r, "Too many attempts, try again later"))
+		return
+	}
+	if err != nil {
+		h.renderPage(w, http.StatusForbidden, id, pages.Password, toPasswordPage(r, "Wrong password"))
+		return
+	}
+
+	token, expires := h.passwords.Token(link, now)
+	http.SetCookie(w, &http.Cookie{
+		Name:     unlockCookieName(id),
+		Value:    token,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	http.Redirect(w, r, r.URL.RequestURI(), http.StatusSeeOther)
+}
+
+// unlocked Проверяет, что ссылка открыта или пароль к ней уже введен
+func (h *handler) unlocked(r *http.Request, id string, link models.URL, now time.Time) bool {
+	if !link.Protected() {
+		return true
+	}
+
+	cookie, err := r.Cookie(unlockCookieName(id))
+	if err != nil {
+		return false
+	}
+
+	return h.passwords.Valid(link, cookie.Value, now)
+}
+
+// variant Адрес, выбранный из нескольких адресов ссылки
+type variant struct {
+	idx   int  // Номер адреса ссылки, -1 если адрес выбран правилом или у ссылки один адрес
+	stick bool // Адрес выбран заново, и его нужно закрепить в cookie
+}
+
+// destination Выбирает адрес назначения: по первому подошедшему правилу, иначе из адресов ссылки.
+// Возвращает также, какой адрес выбран из нескольких адресов ссылки
+func (h *handler) destination(r *http.Request, id string, link models.URL, now time.Time) (string, variant) {
+	if idx, ok := rules.Match(link.Rules, toRuleRequest(r, now)); ok {
+		return link.Rules[idx].Target, variant{idx: -1}
+	}
+
+	if !link.Split() {
+		return link.OriginalURL, variant{idx: -1}
+	}
+
+	v := h.target(r, id, link)
+	return link.Targets[v.idx].URL, v
+}
+
+// target Выбирает адрес ссылки с несколькими адресами. Адрес ссылки с закреплением выбирается при первом
+// переходе и запоминается в cookie, остальные ссылки выбирают его заново при каждом переходе
+func (h *handler) target(r *http.Request, id string, link models.URL) variant {
+	if link.Sticky {
+		if cookie, err := r.Cookie(variantCookieName(id)); err == nil {
+			if idx, ok := h.variants.Variant(link, cookie.Value); ok {
+				return variant{idx: idx}
+			}
+		}
+	}
+
+	return variant{idx: h.variants.Pick(link), stick: link.Sticky}
+}
+
+// stickVariant Запоминает в cookie выбранный адрес ссылки с закреплением
+func (h *handler) stickVariant(w http.ResponseWriter, r *http.Request, id string, link models.URL, idx int, now time.Time) {
+	token, expires := h.variants.Token(link, idx, now)
+	http.SetCookie(w, &http.Cookie{
+		Name:     variantCookieName(id),
+		Value:    token,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// renderPage Отдает страницу сервиса. Показ страницы не считается переходом по ссылке
+func (h *handler) renderPage(w http.ResponseWriter, statusCode int, id, name string, data interface{}) {
+	var page bytes.Buffer
+	if err := h.renderer.Render(&page, name, data); err != nil {
+		logrus.WithError(err).WithField("urlID", id).WithField("page", name).Error("render page error")
+		http.Error(w, "render page error", http.StatusInternalServerError)
+		return
+	}
 
+	w.Header().Set("content-type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.Header().Set("X-Robots-Tag", "noindex")
+	w.WriteHeader(statusCode)
+
+	if _, err := page.WriteTo(w); err != nil {
+		logrus.WithError(err).WithField("urlID", id).Error("write response error")
+	}
+}
+
+// Коды причин отказа в переходе, клиенты различают по ним исчерпанную, удаленную и просроченную ссылку
+const (
+	refusalURLDeleted   = "url_deleted"
+	refusalURLExpired   = "url_expired"
+	refusalClickLimit   = "click_limit_reached"
+	refusalURLNotActive = "url_not_active"
+)
+
+// writeExpandError Отвечает на ошибку получения ссылки для перехода.
+// Отказ в переходе по существующей ссылке описывается телом с кодом причины
+func writeExpandError(w http.ResponseWriter, err error) {
+	if errors.Is(err, urlsSrv.ErrURLNotFound) {
+		http.Error(w, "url not found", http.StatusNoContent)
+		return
+	}
+
+	var notActive *urlsSrv.NotActiveErr
+	switch {
+	case errors.Is(err, urlsSrv.ErrURLDeleted):
+		writeRefusal(w, http.StatusGone, RefusalReply{Error: refusalURLDeleted, Message: "url has been deleted"})
+	case errors.Is(err, urlsSrv.ErrURLExpired):
+		writeRefusal(w, http.StatusGone, RefusalReply{Error: refusalURLExpired, Message: "url has expired"})
+	case errors.Is(err, urlsSrv.ErrClickLimit):
+		writeRefusal(w, http.StatusGone, RefusalReply{Error: refusalClickLimit, Message: "url click limit reached"})
+	case errors.As(err, &notActive):
+		// Retry-After округляется вверх, чтобы повторный запрос не пришел раньше начала работы ссылки
+		notBefore := notActive.NotBefore.UTC()
+		retryAfter := (time.Until(notBefore) + time.Second - 1) / time.Second
+		if retryAfter < 1 {
+			retryAfter = 1
+		}
+		w.Header().Set("Retry-After", strconv.FormatInt(int64(retryAfter), 10))
+		writeRefusal(w, http.StatusForbidden, RefusalReply{Error: refusalURLNotActive, Message: "url is not active yet", NotBefore: &notBefore})
+	case errors.Is(err, urlsSrv.ErrURLNotActive):
+		writeRefusal(w, http.StatusForbidden, RefusalReply{Error: refusalURLNotActive, Message: "url is not active yet"})
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// writeRefusal Отвечает причиной отказа в переходе
+func writeRefusal(w http.ResponseWriter, statusCode int, resp RefusalReply) {
+	marshal, err := json.Marshal(&resp)
+	if err != nil {
+		logrus.WithError(err).WithField("resp", resp).Error("marshal response error")
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	w.Header().Set("Location", url)
-	w.WriteHeader(http.StatusTemporaryRedirect)
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(statusCode)
+
+	if _, err = w.Write(marshal); err != nil {
+		logrus.WithError(err).WithField("code", resp.Error).Error("write response error")
+	}
+}
+
+// isSet Проверяет флаг из параметров запроса: 1, t, true и т.п.
+func isSet(value string) bool {
+	set, err := strconv.ParseBool(value)
+	return err == nil && set
+}
+
+// redirectCacheControl Разрешает браузерам кэшировать постоянные перенаправления, но не дольше срока действия ссылки.
+// Временные перенаправления не кэшируются, чтобы каждый переход доходил до сервиса,
+// закрытые паролем - чтобы кэш не отдал адрес назначения без пароля,
+// с лимитом переходов - чтобы каждый переход был учтен,
+// с несколькими адресами и правилами - чтобы браузер не закрепил один адрес в обход выбора
+func redirectCacheControl(link models.URL, now time.Time) string {
+	permanent := link.RedirectType == http.StatusMovedPermanently || link.RedirectType == http.StatusPermanentRedirect
+	if !permanent || link.Protected() || link.Limited() || link.Split() || len(link.Rules) > 0 {
+		return "private, no-store"
+	}
+
+	maxAge := permanentRedirectMaxAge
+	if link.ExpiresAt != nil && link.ExpiresAt.Sub(now) < maxAge {
+		maxAge = link.ExpiresAt.Sub(now)
+	}
+
+	return fmt.Sprintf("public, max-age=%d", int64(maxAge.Seconds()))
+}
+
+// validateExpiration Проверяет, что срок действия задан не более чем одним способом и еще не истек
+func validateExpiration(expiresAt, notAfter *time.Time, ttl int64, now time.Time) error {
+	specified := 0
+	for _, set := range []bool{expiresAt != nil, notAfter != nil, ttl != 0} {
+		if set {
+			specified++
+		}
+	}
+	if specified > 1 {
+		return errors.New("only one of expires_at, not_after and ttl can be specified")
+	}
+	if notAfter != nil {
+		expiresAt = notAfter
+	}
+	if ttl < 0 {
+		return errors.New("ttl must be positive")
+	}
+	if expiresAt != nil && !expiresAt.After(now) {
+		return errors.New("expires_at must be in the future")
+	}
+
+	return nil
+}
+
+// validateSchedule Проверяет, что ссылка начинает работать раньше, чем истекает, и лимит переходов не отрицательный
+func validateSchedule(notBefore, expiresAt *time.Time, maxClicks int64) error {
+	if notBefore != nil && expiresAt != nil && !notBefore.Before(*expiresAt) {
+		return errors.New("not_before must be earlier than expiration")
+	}
+	if maxClicks < 0 {
+		return errors.New("max_clicks must not be negative")
+	}
+
+	return nil
 }
 
 // GetUrls Возвращает список всех сокращенных URL пользователя
@@ -271,6 +721,121 @@ func (h *handler) GetUrls(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// GetStats Возвращает статистику переходов по ссылке пользователя
+func (h *handler) GetStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		http.Error(w, "id parameter is empty", http.StatusBadRequest)
+		return
+	}
+
+	req, err := parseStatsRequest(r.URL.Query(), time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	userID := h.auth.UserID(r.Context())
+
+	stats, err := h.clicks.Stats(r.Context(), id, userID, req.From, req.To, req.Bucket)
+	if err != nil {
+		if errors.Is(err, clicksSrv.ErrURLNotFound) {
+			http.Error(w, "url not found", http.StatusNotFound)
+			return
+		}
+
+		if errors.Is(err, clicksSrv.ErrInvalidPeriod) {
+			http.Error(w, "period is too long for the bucket", http.StatusBadRequest)
+			return
+		}
+
+		http.Error(w, "get stats error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	resp := toStatsReply(id, req, stats)
+	marshal, err := json.Marshal(&resp)
+	if err != nil {
+		logrus.WithError(err).WithField("resp", resp).Error("marshal response error")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	_, err = w.Write(marshal)
+	if err != nil {
+		logrus.WithError(err).WithField("resp", resp).Error("write response error")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// DryRun Показывает владельцу, какое правило перенаправления сработает для запроса с заданными признаками
+func (h *handler) DryRun(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		http.Error(w, "id parameter is empty", http.StatusBadRequest)
+		return
+	}
+
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Пустое тело проверяет сам запрос проверки
+	req := DryRunRequest{}
+	if len(bytes.TrimSpace(b)) > 0 {
+		if err = json.Unmarshal(b, &req); err != nil {
+			http.Error(w, "request in not valid", http.StatusBadRequest)
+			return
+		}
+	}
+
+	userID := h.auth.UserID(r.Context())
+
+	link, err := h.urlsService.GetUserURL(r.Context(), id, userID)
+	if err != nil {
+		if errors.Is(err, urlsSrv.ErrURLNotFound) {
+			http.Error(w, "url not found", http.StatusNotFound)
+			return
+		}
+
+		http.Error(w, "get url error", http.StatusInternalServerError)
+		return
+	}
+
+	resp := toDryRunReply(link, toDryRunRequest(req, r, time.Now()))
+	marshal, err := json.Marshal(&resp)
+	if err != nil {
+		logrus.WithError(err).WithField("resp", resp).Error("marshal response error")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	_, err = w.Write(marshal)
+	if err != nil {
+		logrus.WithError(err).WithField("resp", resp).Error("write response error")
+		return
+	}
+}
+
 // DeleteUrls Удаляет список сокращенных URL пользователя
 func (h *handler) DeleteUrls(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodDelete {
@@ -303,6 +868,96 @@ func (h *handler) DeleteUrls(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusAccepted)
 }
 
+// GetUTMTemplate Возвращает шаблон меток кампании пользователя
+func (h *handler) GetUTMTemplate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := h.auth.UserID(r.Context())
+
+	utm, err := h.urlsService.GetUTMTemplate(r.Context(), userID)
+	if err != nil {
+		http.Error(w, "get utm template error", http.StatusInternalServerError)
+		return
+	}
+	if utm == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	resp := toUTMReply(utm)
+	marshal, err := json.Marshal(resp)
+	if err != nil {
+		logrus.WithError(err).WithField("resp", resp).Error("marshal response error")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	_, err = w.Write(marshal)
+	if err != nil {
+		logrus.WithError(err).WithField("resp", resp).Error("write response error")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// SetUTMTemplate Сохраняет шаблон меток кампании пользователя.
+// Метки шаблона дополняют метки новых ссылок, у которых заданы метки
+func (h *handler) SetUTMTemplate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	req := UTMRequest{}
+	if err = json.Unmarshal(b, &req); err != nil {
+		http.Error(w, "request in not valid", http.StatusBadRequest)
+		return
+	}
+
+	userID := h.auth.UserID(r.Context())
+
+	if err = h.urlsService.SetUTMTemplate(r.Context(), userID, toUTM(&req)); err != nil {
+		if errors.Is(err, urlsSrv.ErrInvalidUTM) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		http.Error(w, "set utm template error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DeleteUTMTemplate Удаляет шаблон меток кампании пользователя
+func (h *handler) DeleteUTMTemplate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := h.auth.UserID(r.Context())
+
+	if err := h.urlsService.SetUTMTemplate(r.Context(), userID, nil); err != nil {
+		http.Error(w, "delete utm template error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
 // Ping Проверяет доступность базы данных
 func (h *handler) Ping(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
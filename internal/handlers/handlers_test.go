@@ -3,10 +3,13 @@ package handlers
 import (
 	"bytes"
 	"context"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/golang/mock/gomock"
@@ -14,6 +17,8 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/bgoldovsky/shortener/internal/app/models"
+	clicksSrv "github.com/bgoldovsky/shortener/internal/app/services/clicks"
+	passwordsSrv "github.com/bgoldovsky/shortener/internal/app/services/passwords"
 	"github.com/bgoldovsky/shortener/internal/app/services/urls"
 	mockHandlers "github.com/bgoldovsky/shortener/internal/handlers/mocks"
 )
@@ -55,12 +60,12 @@ func TestHandler_ShortenV1_Success(t *testing.T) {
 			defer ctrl.Finish()
 
 			urlsSrvMock := mockHandlers.NewMockurlsService(ctrl)
-			urlsSrvMock.EXPECT().Shorten(ctx, tt.url, defaultUserID).Return(tt.shortcut, nil)
+			urlsSrvMock.EXPECT().Shorten(ctx, models.OriginalURL{URL: tt.url}, defaultUserID).Return(tt.shortcut, nil)
 
 			authMock := mockHandlers.NewMockauth(ctrl)
 			authMock.EXPECT().UserID(gomock.Any()).Return(defaultUserID)
 
-			httpHandler := New(urlsSrvMock, authMock, nil, nil)
+			httpHandler := New(urlsSrvMock, authMock, nil, nil, nil, nil, nil, nil, nil)
 
 			buffer := new(bytes.Buffer)
 			buffer.WriteString(tt.url)
@@ -87,6 +92,32 @@ func TestHandler_ShortenV1_Success(t *testing.T) {
 	}
 }
 
+func TestHandler_ShortenV1_InvalidUTM(t *testing.T) {
+	ctx := context.Background()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// Неполный шаблон UTM-меток пользователя - ошибка клиента, а не сервера
+	urlsSrvMock := mockHandlers.NewMockurlsService(ctrl)
+	urlsSrvMock.EXPECT().Shorten(ctx, models.OriginalURL{URL: "https://avito.ru"}, defaultUserID).
+		Return("", fmt.Errorf("utm source, medium and campaign are required: %w", urls.ErrInvalidUTM))
+
+	authMock := mockHandlers.NewMockauth(ctrl)
+	authMock.EXPECT().UserID(gomock.Any()).Return(defaultUserID)
+
+	httpHandler := New(urlsSrvMock, authMock, nil, nil, nil, nil, nil, nil, nil)
+
+	request := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString("https://avito.ru"))
+	w := httptest.NewRecorder()
+	http.HandlerFunc(httpHandler.ShortenV1).ServeHTTP(w, request)
+
+	result := w.Result()
+	defer result.Body.Close()
+
+	assert.Equal(t, http.StatusBadRequest, result.StatusCode)
+}
+
 func TestHandler_ShortenV2_Success(t *testing.T) {
 	type want struct {
 		contentType string
@@ -123,12 +154,12 @@ func TestHandler_ShortenV2_Success(t *testing.T) {
 			defer ctrl.Finish()
 
 			urlSrvMock := mockHandlers.NewMockurlsService(ctrl)
-			urlSrvMock.EXPECT().Shorten(ctx, tt.url, defaultUserID).Return(tt.shortcut, nil)
+			urlSrvMock.EXPECT().Shorten(ctx, models.OriginalURL{URL: tt.url}, defaultUserID).Return(tt.shortcut, nil)
 
 			authMock := mockHandlers.NewMockauth(ctrl)
 			authMock.EXPECT().UserID(gomock.Any()).Return(defaultUserID)
 
-			httpHandler := New(urlSrvMock, authMock, nil, nil)
+			httpHandler := New(urlSrvMock, authMock, nil, nil, nil, nil, nil, nil, nil)
 
 			buffer := new(bytes.Buffer)
 			buffer.WriteString(tt.body)
@@ -155,6 +186,114 @@ func TestHandler_ShortenV2_Success(t *testing.T) {
 	}
 }
 
+func TestHandler_ShortenV2_Targets(t *testing.T) {
+	ctx := context.Background()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// Вес по умолчанию делит переходы поровну
+	urlSrvMock := mockHandlers.NewMockurlsService(ctrl)
+	urlSrvMock.EXPECT().Shorten(ctx, models.OriginalURL{
+		Targets: []models.Target{{URL: "https://avito.ru/a", Weight: 3}, {URL: "https://avito.ru/b", Weight: 1}},
+		Sticky:  true,
+	}, defaultUserID).Return("http://localhost:8080/xyz", nil)
+
+	authMock := mockHandlers.NewMockauth(ctrl)
+	authMock.EXPECT().UserID(gomock.Any()).Return(defaultUserID)
+
+	httpHandler := New(urlSrvMock, authMock, nil, nil, nil, nil, nil, nil, nil)
+
+	body := bytes.NewBufferString(`{"targets":[{"url":"https://avito.ru/a","weight":3},{"url":"https://avito.ru/b"}],"sticky":true}`)
+	request := httptest.NewRequest(http.MethodPost, "/api/shorten", body)
+
+	w := httptest.NewRecorder()
+	http.HandlerFunc(httpHandler.ShortenV2).ServeHTTP(w, request)
+
+	result := w.Result()
+	require.NoError(t, result.Body.Close())
+	assert.Equal(t, http.StatusCreated, result.StatusCode)
+}
+
+func TestHandler_ShortenV2_Rules(t *testing.T) {
+	ctx := context.Background()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	urlSrvMock := mockHandlers.NewMockurlsService(ctrl)
+	urlSrvMock.EXPECT().Shorten(ctx, models.OriginalURL{
+		URL: "https://avito.ru",
+		Rules: []models.Rule{
+			{Platforms: []string{"ios"}, Target: "https://apps.apple.com/app"},
+			{Query: map[string]string{"utm_source": "email"}, Hours: &models.TimeWindow{From: 22 * 60, To: 6*60 + 30}, Target: "https://avito.ru/night"},
+		},
+	}, defaultUserID).Return("http://localhost:8080/xyz", nil)
+
+	authMock := mockHandlers.NewMockauth(ctrl)
+	authMock.EXPECT().UserID(gomock.Any()).Return(defaultUserID)
+
+	httpHandler := New(urlSrvMock, authMock, nil, nil, nil, nil, nil, nil, nil)
+
+	body := bytes.NewBufferString(`{"url":"https://avito.ru","rules":[` +
+		`{"platforms":["ios"],"target":"https://apps.apple.com/app"},` +
+		`{"query":{"utm_source":"email"},"hours":{"from":"22:00","to":"06:30"},"target":"https://avito.ru/night"}]}`)
+	request := httptest.NewRequest(http.MethodPost, "/api/shorten", body)
+
+	w := httptest.NewRecorder()
+	http.HandlerFunc(httpHandler.ShortenV2).ServeHTTP(w, request)
+
+	result := w.Result()
+	require.NoError(t, result.Body.Close())
+	assert.Equal(t, http.StatusCreated, result.StatusCode)
+
+	// Время суток проверяется при разборе запроса
+	for _, hours := range []string{`"24:00"`, `"9:00am"`, `540`} {
+		body = bytes.NewBufferString(`{"url":"https://avito.ru","rules":[{"hours":{"from":` + hours + `,"to":"18:00"},"target":"https://avito.ru/day"}]}`)
+		request = httptest.NewRequest(http.MethodPost, "/api/shorten", body)
+
+		w = httptest.NewRecorder()
+		http.HandlerFunc(New(nil, nil, nil, nil, nil, nil, nil, nil, nil).ShortenV2).ServeHTTP(w, request)
+
+		result = w.Result()
+		require.NoError(t, result.Body.Close())
+		assert.Equal(t, http.StatusBadRequest, result.StatusCode, hours)
+	}
+}
+
+func TestHandler_ShortenV2_UTM(t *testing.T) {
+	ctx := context.Background()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	utm := &models.UTM{Source: "newsletter", Campaign: "spring"}
+	urlSrvMock := mockHandlers.NewMockurlsService(ctrl)
+	gomock.InOrder(
+		urlSrvMock.EXPECT().Shorten(ctx, models.OriginalURL{URL: "https://avito.ru", UTM: utm}, defaultUserID).
+			Return("http://localhost:8080/xyz", nil),
+		urlSrvMock.EXPECT().Shorten(ctx, models.OriginalURL{URL: "https://avito.ru", UTM: utm}, defaultUserID).
+			Return("", fmt.Errorf("utm source, medium and campaign are required: %w", urls.ErrInvalidUTM)),
+	)
+
+	authMock := mockHandlers.NewMockauth(ctrl)
+	authMock.EXPECT().UserID(gomock.Any()).Return(defaultUserID).Times(2)
+
+	httpHandler := New(urlSrvMock, authMock, nil, nil, nil, nil, nil, nil, nil)
+
+	for _, statusCode := range []int{http.StatusCreated, http.StatusBadRequest} {
+		body := bytes.NewBufferString(`{"url":"https://avito.ru","utm":{"source":"newsletter","campaign":"spring"}}`)
+		request := httptest.NewRequest(http.MethodPost, "/api/shorten", body)
+
+		w := httptest.NewRecorder()
+		http.HandlerFunc(httpHandler.ShortenV2).ServeHTTP(w, request)
+
+		result := w.Result()
+		require.NoError(t, result.Body.Close())
+		assert.Equal(t, statusCode, result.StatusCode)
+	}
+}
+
 func TestHandler_ShortenV2_BadRequest(t *testing.T) {
 	type want struct {
 		contentType string
@@ -193,13 +332,109 @@ func TestHandler_ShortenV2_BadRequest(t *testing.T) {
 			},
 			request: "/api/shorten",
 		},
+		{
+			name:     "expires_at and ttl",
+			url:      "https://avito.ru",
+			body:     "{\"url\":\"https://avito.ru\",\"expires_at\":\"2100-01-01T00:00:00Z\",\"ttl\":60}",
+			shortcut: "http://localhost:8080/xyz",
+			want: want{
+				contentType: "text/plain; charset=utf-8",
+				statusCode:  400,
+				response:    "only one of expires_at, not_after and ttl can be specified\n",
+			},
+			request: "/api/shorten",
+		},
+		{
+			name:     "negative ttl",
+			url:      "https://avito.ru",
+			body:     "{\"url\":\"https://avito.ru\",\"ttl\":-1}",
+			shortcut: "http://localhost:8080/xyz",
+			want: want{
+				contentType: "text/plain; charset=utf-8",
+				statusCode:  400,
+				response:    "ttl must be positive\n",
+			},
+			request: "/api/shorten",
+		},
+		{
+			name:     "expires_at in the past",
+			url:      "https://avito.ru",
+			body:     "{\"url\":\"https://avito.ru\",\"expires_at\":\"2000-01-01T00:00:00Z\"}",
+			shortcut: "http://localhost:8080/xyz",
+			want: want{
+				contentType: "text/plain; charset=utf-8",
+				statusCode:  400,
+				response:    "expires_at must be in the future\n",
+			},
+			request: "/api/shorten",
+		},
+		{
+			name:     "expires_at and not_after",
+			url:      "https://avito.ru",
+			body:     "{\"url\":\"https://avito.ru\",\"expires_at\":\"2100-01-01T00:00:00Z\",\"not_after\":\"2100-01-01T00:00:00Z\"}",
+			shortcut: "http://localhost:8080/xyz",
+			want: want{
+				contentType: "text/plain; charset=utf-8",
+				statusCode:  400,
+				response:    "only one of expires_at, not_after and ttl can be specified\n",
+			},
+			request: "/api/shorten",
+		},
+		{
+			name:     "not_before after not_after",
+			url:      "https://avito.ru",
+			body:     "{\"url\":\"https://avito.ru\",\"not_before\":\"2100-01-02T00:00:00Z\",\"not_after\":\"2100-01-01T00:00:00Z\"}",
+			shortcut: "http://localhost:8080/xyz",
+			want: want{
+				contentType: "text/plain; charset=utf-8",
+				statusCode:  400,
+				response:    "not_before must be earlier than expiration\n",
+			},
+			request: "/api/shorten",
+		},
+		{
+			name:     "negative max_clicks",
+			url:      "https://avito.ru",
+			body:     "{\"url\":\"https://avito.ru\",\"max_clicks\":-1}",
+			shortcut: "http://localhost:8080/xyz",
+			want: want{
+				contentType: "text/plain; charset=utf-8",
+				statusCode:  400,
+				response:    "max_clicks must not be negative\n",
+			},
+			request: "/api/shorten",
+		},
+		{
+			name:     "url and targets",
+			url:      "https://avito.ru",
+			body:     "{\"url\":\"https://avito.ru\",\"targets\":[{\"url\":\"https://avito.ru/a\"},{\"url\":\"https://avito.ru/b\"}]}",
+			shortcut: "http://localhost:8080/xyz",
+			want: want{
+				contentType: "text/plain; charset=utf-8",
+				statusCode:  400,
+				response:    "only one of url and targets can be specified\n",
+			},
+			request: "/api/shorten",
+		},
+		{
+			name:     "target not valid",
+			url:      "https://avito.ru",
+			body:     "{\"targets\":[{\"url\":\"qwerty\"},{\"url\":\"https://avito.ru/b\"}]}",
+			shortcut: "http://localhost:8080/xyz",
+			want: want{
+				contentType: "text/plain; charset=utf-8",
+				statusCode:  400,
+				response:    "request in not valid\n",
+			},
+			request: "/api/shorten",
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			ctrl := gomock.NewController(t)
 			defer ctrl.Finish()
 
-			httpHandler := New(nil, nil, nil, nil)
+			httpHandler := New(nil, nil, nil, nil, nil, nil, nil, nil, nil)
 
 			buffer := new(bytes.Buffer)
 			buffer.WriteString(tt.body)
@@ -236,6 +471,7 @@ func TestHandler_ShortenV2_Conflict(t *testing.T) {
 		name     string
 		request  string
 		url      string
+		alias    string
 		body     string
 		shortcut string
 		err      error
@@ -254,6 +490,20 @@ func TestHandler_ShortenV2_Conflict(t *testing.T) {
 			},
 			request: "/api/shorten",
 		},
+		{
+			name:     "alias taken",
+			url:      "https://avito.ru",
+			alias:    "spring-sale",
+			body:     "{\"url\":\"https://avito.ru\",\"alias\":\"spring-sale\"}",
+			shortcut: "",
+			err:      urls.ErrAliasTaken,
+			want: want{
+				contentType: "text/plain; charset=utf-8",
+				statusCode:  409,
+				response:    "alias is already taken\n",
+			},
+			request: "/api/shorten",
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -263,12 +513,12 @@ func TestHandler_ShortenV2_Conflict(t *testing.T) {
 			defer ctrl.Finish()
 
 			urlSrvMock := mockHandlers.NewMockurlsService(ctrl)
-			urlSrvMock.EXPECT().Shorten(ctx, tt.url, defaultUserID).Return(tt.shortcut, tt.err)
+			urlSrvMock.EXPECT().Shorten(ctx, models.OriginalURL{URL: tt.url, Alias: tt.alias}, defaultUserID).Return(tt.shortcut, tt.err)
 
 			authMock := mockHandlers.NewMockauth(ctrl)
 			authMock.EXPECT().UserID(gomock.Any()).Return(defaultUserID)
 
-			httpHandler := New(urlSrvMock, authMock, nil, nil)
+			httpHandler := New(urlSrvMock, authMock, nil, nil, nil, nil, nil, nil, nil)
 
 			buffer := new(bytes.Buffer)
 			buffer.WriteString(tt.body)
@@ -301,26 +551,47 @@ func TestHandler_Expand_Success(t *testing.T) {
 		statusCode  int
 		response    string
 		location    string
+		cache       string
 	}
 	tests := []struct {
-		name     string
-		request  string
-		url      string
-		urlID    string
-		shortcut string
-		err      error
-		want     want
+		name         string
+		request      string
+		url          string
+		urlID        string
+		redirectType int
+		shortcut     string
+		err          error
+		want         want
 	}{
 		{
-			name:     "success",
-			url:      "https://avito.ru",
-			urlID:    "xyz",
-			shortcut: "http://localhost:8080/xyz",
-			err:      nil,
+			name:         "success",
+			url:          "https://avito.ru",
+			urlID:        "xyz",
+			redirectType: http.StatusTemporaryRedirect,
+			shortcut:     "http://localhost:8080/xyz",
+			err:          nil,
 			want: want{
 				contentType: "",
 				statusCode:  307,
 				response:    "",
+				location:    "https://avito.ru",
+				cache:       "private, no-store",
+			},
+			request: "/",
+		},
+		{
+			name:         "permanent",
+			url:          "https://avito.ru",
+			urlID:        "xyz",
+			redirectType: http.StatusMovedPermanently,
+			shortcut:     "http://localhost:8080/xyz",
+			err:          nil,
+			want: want{
+				contentType: "",
+				statusCode:  301,
+				response:    "",
+				location:    "https://avito.ru",
+				cache:       "public, max-age=86400",
 			},
 			request: "/",
 		},
@@ -331,11 +602,27 @@ func TestHandler_Expand_Success(t *testing.T) {
 			defer ctrl.Finish()
 
 			urlsSrvMock := mockHandlers.NewMockurlsService(ctrl)
-			urlsSrvMock.EXPECT().Expand(gomock.Any(), tt.urlID).Return(tt.url, tt.err)
+			urlsSrvMock.EXPECT().Expand(gomock.Any(), tt.urlID).Return(models.URL{ShortURL: tt.urlID, OriginalURL: tt.url, RedirectType: tt.redirectType}, tt.err)
+
+			clicksMock := mockHandlers.NewMockclicks(ctrl)
+			clicksMock.EXPECT().Queue(gomock.Any()).Do(func(click models.Click) {
+				assert.Equal(t, tt.urlID, click.URLID)
+				assert.Equal(t, "https://ya.ru/", click.Referrer)
+				assert.Equal(t, "curl/7.79", click.UserAgent)
+				assert.Equal(t, "ru-RU", click.AcceptLanguage)
+				assert.Equal(t, "192.0.2.1", click.IP)
+				assert.True(t, click.Bot)
+			})
 
-			httpHandler := New(urlsSrvMock, nil, nil, nil)
+			botsMock := mockHandlers.NewMockbots(ctrl)
+			botsMock.EXPECT().IsBot(gomock.Any()).Return(true)
+
+			httpHandler := New(urlsSrvMock, nil, nil, nil, clicksMock, botsMock, nil, nil, nil)
 
 			request := httptest.NewRequest(http.MethodGet, tt.request, nil)
+			request.Header.Set("Referer", "https://ya.ru/")
+			request.Header.Set("User-Agent", "curl/7.79")
+			request.Header.Set("Accept-Language", "ru-RU")
 			rctx := chi.NewRouteContext()
 			rctx.URLParams.Add("id", tt.urlID)
 
@@ -350,6 +637,8 @@ func TestHandler_Expand_Success(t *testing.T) {
 
 			assert.Equal(t, tt.want.statusCode, result.StatusCode)
 			assert.Equal(t, tt.want.contentType, result.Header.Get("Content-Type"))
+			assert.Equal(t, tt.want.location, result.Header.Get("Location"))
+			assert.Equal(t, tt.want.cache, result.Header.Get("Cache-Control"))
 
 			userResult, err := ioutil.ReadAll(result.Body)
 			require.NoError(t, err)
@@ -363,67 +652,966 @@ func TestHandler_Expand_Success(t *testing.T) {
 	}
 }
 
-func TestHandler_GetUrls_Success(t *testing.T) {
-	type want struct {
-		contentType string
-		statusCode  int
-		response    string
+func TestHandler_Expand_Refused(t *testing.T) {
+	limited := models.URL{ShortURL: "xyz", OriginalURL: "https://avito.ru", RedirectType: http.StatusFound, MaxClicks: 1}
+	notBefore := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name       string
+		method     string
+		link       models.URL
+		expandErr  error
+		countErr   error
+		bot        bool
+		counted    bool
+		status     int
+		response   string
+		retryAfter string
+	}{
+		{
+			name:       "not active yet",
+			method:     http.MethodGet,
+			expandErr:  urls.NewNotActiveErr(notBefore),
+			status:     http.StatusForbidden,
+			response:   `{"error":"url_not_active","message":"url is not active yet","not_before":"` + notBefore.UTC().Format(time.RFC3339Nano) + `"}`,
+			retryAfter: "3600",
+		},
+		{
+			name:      "deleted",
+			method:    http.MethodGet,
+			expandErr: urls.ErrURLDeleted,
+			status:    http.StatusGone,
+			response:  `{"error":"url_deleted","message":"url has been deleted"}`,
+		},
+		{
+			name:      "expired",
+			method:    http.MethodGet,
+			expandErr: urls.ErrURLExpired,
+			status:    http.StatusGone,
+			response:  `{"error":"url_expired","message":"url has expired"}`,
+		},
+		{
+			name:      "click limit reached before expand",
+			method:    http.MethodGet,
+			expandErr: urls.ErrClickLimit,
+			status:    http.StatusGone,
+			response:  `{"error":"click_limit_reached","message":"url click limit reached"}`,
+		},
+		{
+			name:     "click limit reached by concurrent click",
+			method:   http.MethodGet,
+			link:     limited,
+			countErr: urls.ErrClickLimit,
+			status:   http.StatusGone,
+			response: `{"error":"click_limit_reached","message":"url click limit reached"}`,
+		},
+		{
+			name:    "counted",
+			method:  http.MethodGet,
+			link:    limited,
+			counted: true,
+			status:  http.StatusFound,
+		},
+		{
+			name:    "head does not count",
+			method:  http.MethodHead,
+			link:    limited,
+			counted: true,
+			status:  http.StatusFound,
+		},
+		{
+			name:    "bot does not count",
+			method:  http.MethodGet,
+			link:    limited,
+			bot:     true,
+			counted: true,
+			status:  http.StatusFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			urlsSrvMock := mockHandlers.NewMockurlsService(ctrl)
+			urlsSrvMock.EXPECT().Expand(gomock.Any(), "xyz").Return(tt.link, tt.expandErr)
+			if tt.expandErr == nil && tt.method == http.MethodGet && !tt.bot {
+				urlsSrvMock.EXPECT().CountClick(gomock.Any(), "xyz").Return(tt.countErr)
+			}
+
+			clicksMock := mockHandlers.NewMockclicks(ctrl)
+			botsMock := mockHandlers.NewMockbots(ctrl)
+			if tt.expandErr == nil {
+				botsMock.EXPECT().IsBot(gomock.Any()).Return(tt.bot)
+			}
+			if tt.counted {
+				clicksMock.EXPECT().Queue(gomock.Any())
+			}
+
+			httpHandler := New(urlsSrvMock, nil, nil, nil, clicksMock, botsMock, nil, nil, nil)
+
+			request := httptest.NewRequest(tt.method, "/xyz", nil)
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("id", "xyz")
+			request = request.WithContext(context.WithValue(request.Context(), chi.RouteCtxKey, rctx))
+
+			w := httptest.NewRecorder()
+			http.HandlerFunc(httpHandler.Expand).ServeHTTP(w, request)
+
+			result := w.Result()
+			body, err := ioutil.ReadAll(result.Body)
+			require.NoError(t, err)
+			require.NoError(t, result.Body.Close())
+
+			assert.Equal(t, tt.status, result.StatusCode)
+			if tt.response != "" {
+				assert.Equal(t, "application/json", result.Header.Get("Content-Type"))
+				assert.JSONEq(t, tt.response, string(body))
+			}
+			assert.Equal(t, tt.retryAfter, result.Header.Get("Retry-After"))
+			if tt.counted {
+				assert.Equal(t, "https://avito.ru", result.Header.Get("Location"))
+				assert.Equal(t, "private, no-store", result.Header.Get("Cache-Control"))
+			}
+		})
 	}
+}
+
+func TestHandler_Expand_Split(t *testing.T) {
+	link := models.URL{
+		ShortURL:     "xyz",
+		OriginalURL:  "https://avito.ru/a",
+		RedirectType: http.StatusMovedPermanently,
+		Targets: []models.Target{
+			{URL: "https://avito.ru/a", Weight: 1},
+			{URL: "https://avito.ru/b", Weight: 1},
+		},
+	}
+	sticky := link
+	sticky.Sticky = true
+
 	tests := []struct {
-		name    string
-		request string
-		urls    []models.URL
-		err     error
-		want    want
+		name      string
+		link      models.URL
+		cookie    string
+		variant   int
+		validated bool
+		picked    bool
+		setCookie bool
+		location  string
 	}{
 		{
-			name: "success",
-			urls: []models.URL{
-				{
-					ShortURL:    "http://localhost:8080/xyz",
-					OriginalURL: "https://avito.ru",
-				},
-				{
-					ShortURL:    "http://localhost:8080/qwerty",
-					OriginalURL: "https://yandex.ru",
-				},
-			},
-			err: nil,
-			want: want{
-				contentType: "application/json",
-				statusCode:  200,
-				response:    "[{\"short_url\":\"http://localhost:8080/xyz\",\"original_url\":\"https://avito.ru\"},{\"short_url\":\"http://localhost:8080/qwerty\",\"original_url\":\"https://yandex.ru\"}]",
-			},
-			request: "/api/user/urls",
+			name:     "picked on every click",
+			link:     link,
+			picked:   true,
+			location: "https://avito.ru/b",
+		},
+		{
+			name:      "sticky first click",
+			link:      sticky,
+			picked:    true,
+			setCookie: true,
+			location:  "https://avito.ru/b",
+		},
+		{
+			name:      "sticky remembered",
+			link:      sticky,
+			cookie:    "0.sign",
+			variant:   0,
+			validated: true,
+			location:  "https://avito.ru/a",
+		},
+		{
+			name:      "sticky forged cookie",
+			link:      sticky,
+			cookie:    "0.forged",
+			picked:    true,
+			setCookie: true,
+			location:  "https://avito.ru/b",
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			ctx := context.Background()
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			urlsSrvMock := mockHandlers.NewMockurlsService(ctrl)
+			urlsSrvMock.EXPECT().Expand(gomock.Any(), "xyz").Return(tt.link, nil)
+
+			variantsMock := mockHandlers.NewMockvariants(ctrl)
+			if tt.cookie != "" {
+				variantsMock.EXPECT().Variant(tt.link, tt.cookie).Return(tt.variant, tt.validated)
+			}
+			if tt.picked {
+				variantsMock.EXPECT().Pick(tt.link).Return(1)
+			}
+			if tt.setCookie {
+				variantsMock.EXPECT().Token(tt.link, 1, gomock.Any()).Return("1.sign", time.Now().Add(time.Hour))
+			}
+
+			clicksMock := mockHandlers.NewMockclicks(ctrl)
+			clicksMock.EXPECT().Queue(gomock.Any()).Do(func(click models.Click) {
+				assert.Equal(t, tt.location, click.Target)
+			})
+
+			botsMock := mockHandlers.NewMockbots(ctrl)
+			botsMock.EXPECT().IsBot(gomock.Any()).Return(false)
+
+			httpHandler := New(urlsSrvMock, nil, nil, nil, clicksMock, botsMock, nil, nil, variantsMock)
+
+			request := httptest.NewRequest(http.MethodGet, "/xyz", nil)
+			if tt.cookie != "" {
+				request.AddCookie(&http.Cookie{Name: variantCookieName("xyz"), Value: tt.cookie})
+			}
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("id", "xyz")
+			request = request.WithContext(context.WithValue(request.Context(), chi.RouteCtxKey, rctx))
 
+			w := httptest.NewRecorder()
+			http.HandlerFunc(httpHandler.Expand).ServeHTTP(w, request)
+
+			result := w.Result()
+			require.NoError(t, result.Body.Close())
+
+			assert.Equal(t, http.StatusMovedPermanently, result.StatusCode)
+			assert.Equal(t, tt.location, result.Header.Get("Location"))
+			// Постоянное перенаправление не кэшируется, иначе браузер закрепил бы один адрес
+			assert.Equal(t, "private, no-store", result.Header.Get("Cache-Control"))
+
+			cookies := result.Cookies()
+			if !tt.setCookie {
+				assert.Empty(t, cookies)
+				return
+			}
+			require.Len(t, cookies, 1)
+			assert.Equal(t, variantCookieName("xyz"), cookies[0].Name)
+			assert.Equal(t, "1.sign", cookies[0].Value)
+			assert.True(t, cookies[0].HttpOnly)
+		})
+	}
+}
+
+func TestHandler_Expand_SplitPreview(t *testing.T) {
+	link := models.URL{
+		ShortURL:     "xyz",
+		OriginalURL:  "https://avito.ru/a",
+		RedirectType: http.StatusFound,
+		Interstitial: true,
+		Sticky:       true,
+		Targets: []models.Target{
+			{URL: "https://avito.ru/a", Weight: 1},
+			{URL: "https://avito.ru/b", Weight: 1},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		preview bool // Запрос на /{id}+
+		request string
+	}{
+		{name: "interstitial", request: "/xyz"},
+		{name: "preview query", request: "/xyz?preview=1"},
+		{name: "preview route", preview: true, request: "/xyz+"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
 			ctrl := gomock.NewController(t)
 			defer ctrl.Finish()
 
 			urlsSrvMock := mockHandlers.NewMockurlsService(ctrl)
-			urlsSrvMock.EXPECT().GetUrls(ctx, defaultUserID).Return(tt.urls, tt.err)
+			urlsSrvMock.EXPECT().Expand(gomock.Any(), "xyz").Return(link, nil)
 
-			authMock := mockHandlers.NewMockauth(ctrl)
-			authMock.EXPECT().UserID(gomock.Any()).Return(defaultUserID)
+			// Адрес выбирается для показа, но не закрепляется: cookie ставит только настоящий переход
+			variantsMock := mockHandlers.NewMockvariants(ctrl)
+			variantsMock.EXPECT().Pick(link).Return(1)
 
-			httpHandler := New(urlsSrvMock, authMock, nil, nil)
+			rendererMock := mockHandlers.NewMockrenderer(ctrl)
+			rendererMock.EXPECT().Render(gomock.Any(), "preview.html", gomock.Any()).Return(nil)
+
+			httpHandler := New(urlsSrvMock, nil, nil, nil, nil, nil, rendererMock, nil, variantsMock)
 
 			request := httptest.NewRequest(http.MethodGet, tt.request, nil)
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("id", "xyz")
+			request = request.WithContext(context.WithValue(request.Context(), chi.RouteCtxKey, rctx))
+
+			h := http.HandlerFunc(httpHandler.Expand)
+			if tt.preview {
+				h = httpHandler.Preview
+			}
 
 			w := httptest.NewRecorder()
-			h := http.HandlerFunc(httpHandler.GetUrls)
 			h.ServeHTTP(w, request)
 
 			result := w.Result()
+			require.NoError(t, result.Body.Close())
 
-			assert.Equal(t, tt.want.statusCode, result.StatusCode)
-			assert.Equal(t, tt.want.contentType, result.Header.Get("Content-Type"))
+			assert.Equal(t, http.StatusOK, result.StatusCode)
+			assert.Empty(t, result.Cookies())
+		})
+	}
+}
 
-			userResult, err := ioutil.ReadAll(result.Body)
+func TestHandler_Expand_Rules(t *testing.T) {
+	link := models.URL{
+		ShortURL:     "xyz",
+		OriginalURL:  "https://avito.ru",
+		RedirectType: http.StatusFound,
+		Rules: []models.Rule{
+			{Platforms: []string{"ios"}, Target: "https://apps.apple.com/app"},
+			{Platforms: []string{"android"}, Languages: []string{"ru"}, Target: "https://play.google.com/app?hl=ru"},
+			{Query: map[string]string{"utm_source": "email"}, Target: "https://avito.ru/email"},
+		},
+	}
+
+	tests := []struct {
+		name           string
+		path           string
+		userAgent      string
+		acceptLanguage string
+		location       string
+	}{
+		{name: "ios", path: "/xyz", userAgent: "Mozilla/5.0 (iPhone; CPU iPhone OS 15_5 like Mac OS X)", location: "https://apps.apple.com/app"},
+		{name: "android in russian", path: "/xyz", userAgent: "Mozilla/5.0 (Linux; Android 12)", acceptLanguage: "ru-RU,ru;q=0.9", location: "https://play.google.com/app?hl=ru"},
+		{name: "query", path: "/xyz?utm_source=email", userAgent: "Mozilla/5.0 (Linux; Android 12)", acceptLanguage: "en", location: "https://avito.ru/email"},
+		{name: "fallback", path: "/xyz", userAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64)", location: "https://avito.ru"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			urlsSrvMock := mockHandlers.NewMockurlsService(ctrl)
+			urlsSrvMock.EXPECT().Expand(gomock.Any(), "xyz").Return(link, nil)
+
+			clicksMock := mockHandlers.NewMockclicks(ctrl)
+			clicksMock.EXPECT().Queue(gomock.Any()).Do(func(click models.Click) {
+				assert.Empty(t, click.Target)
+			})
+
+			botsMock := mockHandlers.NewMockbots(ctrl)
+			botsMock.EXPECT().IsBot(gomock.Any()).Return(false)
+
+			httpHandler := New(urlsSrvMock, nil, nil, nil, clicksMock, botsMock, nil, nil, nil)
+
+			request := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			request.Header.Set("User-Agent", tt.userAgent)
+			request.Header.Set("Accept-Language", tt.acceptLanguage)
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("id", "xyz")
+			request = request.WithContext(context.WithValue(request.Context(), chi.RouteCtxKey, rctx))
+
+			w := httptest.NewRecorder()
+			http.HandlerFunc(httpHandler.Expand).ServeHTTP(w, request)
+
+			result := w.Result()
+			require.NoError(t, result.Body.Close())
+
+			assert.Equal(t, http.StatusFound, result.StatusCode)
+			assert.Equal(t, tt.location, result.Header.Get("Location"))
+		})
+	}
+}
+
+func TestHandler_Expand_Passthrough(t *testing.T) {
+	tests := []struct {
+		name        string
+		path        string
+		passthrough bool
+		statusCode  int
+		location    string
+	}{
+		{name: "path and query", path: "/xyz/api/v2?x=1", passthrough: true, statusCode: http.StatusFound, location: "https://avito.ru/docs/api/v2?lang=ru&x=1"},
+		{name: "without path", path: "/xyz", passthrough: true, statusCode: http.StatusFound, location: "https://avito.ru/docs?lang=ru"},
+		{name: "escaped path", path: "/xyz/a%20b", passthrough: true, statusCode: http.StatusFound, location: "https://avito.ru/docs/a%20b?lang=ru"},
+		{name: "dot segments", path: "/xyz/%2E%2E/admin", passthrough: true, statusCode: http.StatusBadRequest},
+		{name: "path without passthrough", path: "/xyz/api/v2", statusCode: http.StatusNoContent},
+		{name: "query without passthrough", path: "/xyz?x=1", statusCode: http.StatusFound, location: "https://avito.ru/docs?lang=ru"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			link := models.URL{
+				ShortURL:     "xyz",
+				OriginalURL:  "https://avito.ru/docs?lang=ru",
+				RedirectType: http.StatusFound,
+				Passthrough:  tt.passthrough,
+			}
+
+			urlsSrvMock := mockHandlers.NewMockurlsService(ctrl)
+			urlsSrvMock.EXPECT().Expand(gomock.Any(), "xyz").Return(link, nil)
+
+			clicksMock := mockHandlers.NewMockclicks(ctrl)
+			botsMock := mockHandlers.NewMockbots(ctrl)
+			if tt.statusCode == http.StatusFound {
+				clicksMock.EXPECT().Queue(gomock.Any())
+				botsMock.EXPECT().IsBot(gomock.Any()).Return(false)
+			}
+
+			httpHandler := New(urlsSrvMock, nil, nil, nil, clicksMock, botsMock, nil, nil, nil)
+
+			request := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("id", "xyz")
+			request = request.WithContext(context.WithValue(request.Context(), chi.RouteCtxKey, rctx))
+
+			w := httptest.NewRecorder()
+			http.HandlerFunc(httpHandler.Expand).ServeHTTP(w, request)
+
+			result := w.Result()
+			require.NoError(t, result.Body.Close())
+
+			assert.Equal(t, tt.statusCode, result.StatusCode)
+			assert.Equal(t, tt.location, result.Header.Get("Location"))
+		})
+	}
+}
+
+func TestHandler_Expand_UTM(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		link     models.URL
+		location string
+	}{
+		{
+			name:     "appended",
+			path:     "/xyz",
+			link:     models.URL{OriginalURL: "https://avito.ru/sale?page=2", UTM: &models.UTM{Source: "newsletter", Medium: "email", Campaign: "spring sale"}},
+			location: "https://avito.ru/sale?page=2&utm_source=newsletter&utm_medium=email&utm_campaign=spring+sale",
+		},
+		{
+			name:     "overrides passed through query",
+			path:     "/xyz/shoes?utm_source=other&size=42",
+			link:     models.URL{OriginalURL: "https://avito.ru/sale", Passthrough: true, UTM: &models.UTM{Source: "newsletter", Medium: "email", Campaign: "spring"}},
+			location: "https://avito.ru/sale/shoes?size=42&utm_source=newsletter&utm_medium=email&utm_campaign=spring",
+		},
+		{
+			name: "rule target",
+			path: "/xyz?from=email",
+			link: models.URL{
+				OriginalURL: "https://avito.ru",
+				Rules:       []models.Rule{{Query: map[string]string{"from": "email"}, Target: "https://avito.ru/email"}},
+				UTM:         &models.UTM{Source: "newsletter", Medium: "email", Campaign: "spring"},
+			},
+			location: "https://avito.ru/email?utm_source=newsletter&utm_medium=email&utm_campaign=spring",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			link := tt.link
+			link.ShortURL = "xyz"
+			link.RedirectType = http.StatusFound
+
+			urlsSrvMock := mockHandlers.NewMockurlsService(ctrl)
+			urlsSrvMock.EXPECT().Expand(gomock.Any(), "xyz").Return(link, nil)
+
+			clicksMock := mockHandlers.NewMockclicks(ctrl)
+			clicksMock.EXPECT().Queue(gomock.Any())
+
+			botsMock := mockHandlers.NewMockbots(ctrl)
+			botsMock.EXPECT().IsBot(gomock.Any()).Return(false)
+
+			httpHandler := New(urlsSrvMock, nil, nil, nil, clicksMock, botsMock, nil, nil, nil)
+
+			request := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("id", "xyz")
+			request = request.WithContext(context.WithValue(request.Context(), chi.RouteCtxKey, rctx))
+
+			w := httptest.NewRecorder()
+			http.HandlerFunc(httpHandler.Expand).ServeHTTP(w, request)
+
+			result := w.Result()
+			require.NoError(t, result.Body.Close())
+
+			assert.Equal(t, http.StatusFound, result.StatusCode)
+			assert.Equal(t, tt.location, result.Header.Get("Location"))
+		})
+	}
+}
+
+func TestHandler_DryRun(t *testing.T) {
+	link := models.URL{
+		ShortURL:    "xyz",
+		OriginalURL: "https://avito.ru",
+		Rules: []models.Rule{
+			{Platforms: []string{"ios"}, Target: "https://apps.apple.com/app"},
+			{Hours: &models.TimeWindow{From: 22 * 60, To: 6 * 60}, Target: "https://avito.ru/night"},
+		},
+	}
+	split := models.URL{
+		ShortURL:    "abc",
+		OriginalURL: "https://avito.ru/a",
+		Targets:     []models.Target{{URL: "https://avito.ru/a", Weight: 1}, {URL: "https://avito.ru/b", Weight: 1}},
+	}
+
+	tests := []struct {
+		name       string
+		id         string
+		link       models.URL
+		err        error
+		body       string
+		userAgent  string
+		statusCode int
+		response   string
+	}{
+		{
+			name:       "rule from request headers",
+			id:         "xyz",
+			link:       link,
+			userAgent:  "Mozilla/5.0 (iPad; CPU OS 15_5 like Mac OS X)",
+			body:       `{"time":"2022-05-01T12:00:00Z"}`,
+			statusCode: http.StatusOK,
+			response:   `{"platform":"ios","rule":0,"target":"https://apps.apple.com/app"}`,
+		},
+		{
+			name:       "rule from body",
+			id:         "xyz",
+			link:       link,
+			userAgent:  "Mozilla/5.0 (iPad; CPU OS 15_5 like Mac OS X)",
+			body:       `{"user_agent":"Mozilla/5.0 (X11; Linux x86_64)","accept_language":"ru-RU","time":"2022-05-01T23:00:00Z"}`,
+			statusCode: http.StatusOK,
+			response:   `{"platform":"desktop","language":"ru","rule":1,"target":"https://avito.ru/night"}`,
+		},
+		{
+			name:       "fallback",
+			id:         "xyz",
+			link:       link,
+			body:       `{"user_agent":"curl/7.79","time":"2022-05-01T12:00:00Z"}`,
+			statusCode: http.StatusOK,
+			response:   `{"platform":"desktop","rule":null,"target":"https://avito.ru"}`,
+		},
+		{
+			name:       "fallback to targets",
+			id:         "abc",
+			link:       split,
+			body:       `{"user_agent":"curl/7.79"}`,
+			statusCode: http.StatusOK,
+			response:   `{"platform":"desktop","rule":null,"targets":[{"url":"https://avito.ru/a","weight":1},{"url":"https://avito.ru/b","weight":1}]}`,
+		},
+		{
+			name:       "not owned",
+			id:         "xyz",
+			err:        urls.ErrURLNotFound,
+			statusCode: http.StatusNotFound,
+			response:   "url not found\n",
+		},
+		{
+			name:       "bad body",
+			id:         "xyz",
+			body:       `{"time":"noon"}`,
+			statusCode: http.StatusBadRequest,
+			response:   "request in not valid\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			urlsSrvMock := mockHandlers.NewMockurlsService(ctrl)
+			authMock := mockHandlers.NewMockauth(ctrl)
+			if tt.statusCode != http.StatusBadRequest {
+				authMock.EXPECT().UserID(gomock.Any()).Return(defaultUserID)
+				urlsSrvMock.EXPECT().GetUserURL(gomock.Any(), tt.id, defaultUserID).Return(tt.link, tt.err)
+			}
+
+			httpHandler := New(urlsSrvMock, authMock, nil, nil, nil, nil, nil, nil, nil)
+
+			request := httptest.NewRequest(http.MethodPost, "/api/user/urls/"+tt.id+"/dry-run", bytes.NewBufferString(tt.body))
+			request.Header.Set("User-Agent", tt.userAgent)
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("id", tt.id)
+			request = request.WithContext(context.WithValue(request.Context(), chi.RouteCtxKey, rctx))
+
+			w := httptest.NewRecorder()
+			http.HandlerFunc(httpHandler.DryRun).ServeHTTP(w, request)
+
+			result := w.Result()
+			body, err := ioutil.ReadAll(result.Body)
+			require.NoError(t, err)
+			require.NoError(t, result.Body.Close())
+
+			assert.Equal(t, tt.statusCode, result.StatusCode)
+			assert.Equal(t, tt.response, string(body))
+		})
+	}
+}
+
+func TestHandler_Preview(t *testing.T) {
+	createdAt := time.Date(2022, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	type want struct {
+		statusCode int
+		preview    bool
+		location   string
+	}
+	tests := []struct {
+		name         string
+		preview      bool // Запрос на /{id}+
+		request      string
+		interstitial bool
+		want         want
+	}{
+		{
+			name:    "preview route",
+			preview: true,
+			request: "/qwerty+",
+			want:    want{statusCode: http.StatusOK, preview: true},
+		},
+		{
+			name:    "preview query",
+			request: "/qwerty?preview=1",
+			want:    want{statusCode: http.StatusOK, preview: true},
+		},
+		{
+			name:         "interstitial",
+			request:      "/qwerty",
+			interstitial: true,
+			want:         want{statusCode: http.StatusOK, preview: true},
+		},
+		{
+			name:         "interstitial continue",
+			request:      "/qwerty?continue=1",
+			interstitial: true,
+			want:         want{statusCode: http.StatusTemporaryRedirect, location: "https://avito.ru/moskva"},
+		},
+		{
+			name:    "redirect",
+			request: "/qwerty?preview=0",
+			want:    want{statusCode: http.StatusTemporaryRedirect, location: "https://avito.ru/moskva"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			link := models.URL{
+				ShortURL:     "qwerty",
+				OriginalURL:  "https://avito.ru/moskva",
+				RedirectType: http.StatusTemporaryRedirect,
+				Interstitial: tt.interstitial,
+				CreatedAt:    createdAt,
+			}
+
+			urlsSrvMock := mockHandlers.NewMockurlsService(ctrl)
+			urlsSrvMock.EXPECT().Expand(gomock.Any(), "qwerty").Return(link, nil)
+
+			// Показ предпросмотра не считается переходом
+			clicksMock := mockHandlers.NewMockclicks(ctrl)
+			botsMock := mockHandlers.NewMockbots(ctrl)
+			rendererMock := mockHandlers.NewMockrenderer(ctrl)
+			if tt.want.preview {
+				rendererMock.EXPECT().Render(gomock.Any(), "preview.html", previewPage{
+					Destination: "https://avito.ru/moskva",
+					Host:        "avito.ru",
+					CreatedAt:   createdAt,
+					ContinueURL: "/qwerty?continue=1",
+				}).DoAndReturn(func(w io.Writer, _ string, _ interface{}) error {
+					_, err := w.Write([]byte("preview"))
+					return err
+				})
+			} else {
+				clicksMock.EXPECT().Queue(gomock.Any())
+				botsMock.EXPECT().IsBot(gomock.Any()).Return(false)
+			}
+
+			httpHandler := New(urlsSrvMock, nil, nil, nil, clicksMock, botsMock, rendererMock, nil, nil)
+
+			request := httptest.NewRequest(http.MethodGet, tt.request, nil)
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("id", "qwerty")
+			request = request.WithContext(context.WithValue(request.Context(), chi.RouteCtxKey, rctx))
+
+			h := http.HandlerFunc(httpHandler.Expand)
+			if tt.preview {
+				h = httpHandler.Preview
+			}
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, request)
+
+			result := w.Result()
+			body, err := ioutil.ReadAll(result.Body)
+			require.NoError(t, err)
+			require.NoError(t, result.Body.Close())
+
+			assert.Equal(t, tt.want.statusCode, result.StatusCode)
+			assert.Equal(t, tt.want.location, result.Header.Get("Location"))
+			if tt.want.preview {
+				assert.Equal(t, "text/html; charset=utf-8", result.Header.Get("Content-Type"))
+				assert.Equal(t, "private, no-store", result.Header.Get("Cache-Control"))
+				assert.Equal(t, "preview", string(body))
+			}
+		})
+	}
+}
+
+func TestHandler_Expand_Protected(t *testing.T) {
+	link := models.URL{
+		ShortURL:     "qwerty",
+		OriginalURL:  "https://avito.ru",
+		RedirectType: http.StatusTemporaryRedirect,
+		PasswordHash: "hash",
+	}
+
+	tests := []struct {
+		name       string
+		preview    bool
+		cookie     string
+		valid      bool
+		statusCode int
+	}{
+		{name: "no cookie", statusCode: http.StatusOK},
+		{name: "invalid cookie", cookie: "forged", statusCode: http.StatusOK},
+		{name: "valid cookie", cookie: "token", valid: true, statusCode: http.StatusTemporaryRedirect},
+		{name: "preview without cookie", preview: true, statusCode: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			urlsSrvMock := mockHandlers.NewMockurlsService(ctrl)
+			urlsSrvMock.EXPECT().Expand(gomock.Any(), "qwerty").Return(link, nil)
+
+			passwordsMock := mockHandlers.NewMockpasswords(ctrl)
+			if tt.cookie != "" {
+				passwordsMock.EXPECT().Valid(link, tt.cookie, gomock.Any()).Return(tt.valid)
+			}
+
+			clicksMock := mockHandlers.NewMockclicks(ctrl)
+			botsMock := mockHandlers.NewMockbots(ctrl)
+			rendererMock := mockHandlers.NewMockrenderer(ctrl)
+			if tt.valid {
+				clicksMock.EXPECT().Queue(gomock.Any())
+				botsMock.EXPECT().IsBot(gomock.Any()).Return(false)
+			} else {
+				// Ни адрес назначения, ни предпросмотр не раскрываются без пароля
+				rendererMock.EXPECT().Render(gomock.Any(), "password.html", gomock.Any()).Return(nil)
+			}
+
+			httpHandler := New(urlsSrvMock, nil, nil, nil, clicksMock, botsMock, rendererMock, passwordsMock, nil)
+
+			request := httptest.NewRequest(http.MethodGet, "/qwerty", nil)
+			if tt.cookie != "" {
+				request.AddCookie(&http.Cookie{Name: "unlock_cXdlcnR5", Value: tt.cookie})
+			}
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("id", "qwerty")
+			request = request.WithContext(context.WithValue(request.Context(), chi.RouteCtxKey, rctx))
+
+			h := http.HandlerFunc(httpHandler.Expand)
+			if tt.preview {
+				h = httpHandler.Preview
+			}
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, request)
+
+			result := w.Result()
+			require.NoError(t, result.Body.Close())
+
+			assert.Equal(t, tt.statusCode, result.StatusCode)
+			if !tt.valid {
+				assert.Empty(t, result.Header.Get("Location"))
+			}
+		})
+	}
+}
+
+func TestHandler_Unlock(t *testing.T) {
+	link := models.URL{ShortURL: "qwerty", OriginalURL: "https://avito.ru", PasswordHash: "hash"}
+	expires := time.Now().Add(time.Hour).Truncate(time.Second)
+
+	type want struct {
+		statusCode int
+		location   string
+		page       passwordPage
+		retryAfter string
+		cookie     bool
+	}
+	tests := []struct {
+		name      string
+		link      models.URL
+		verifyErr error
+		wait      time.Duration
+		want      want
+	}{
+		{
+			name: "success",
+			link: link,
+			want: want{statusCode: http.StatusSeeOther, location: "/qwerty?continue=1", cookie: true},
+		},
+		{
+			name:      "wrong password",
+			link:      link,
+			verifyErr: passwordsSrv.ErrWrongPassword,
+			want:      want{statusCode: http.StatusForbidden, page: passwordPage{Action: "/qwerty?continue=1", Error: "Wrong password"}},
+		},
+		{
+			name:      "too many attempts",
+			link:      link,
+			verifyErr: passwordsSrv.ErrTooManyAttempts,
+			wait:      time.Millisecond * 41500,
+			want: want{
+				statusCode: http.StatusTooManyRequests,
+				page:       passwordPage{Action: "/qwerty?continue=1", Error: "Too many attempts, try again later"},
+				retryAfter: "42",
+			},
+		},
+		{
+			name: "not protected",
+			link: models.URL{ShortURL: "qwerty", OriginalURL: "https://avito.ru"},
+			want: want{statusCode: http.StatusSeeOther, location: "/qwerty?continue=1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			urlsSrvMock := mockHandlers.NewMockurlsService(ctrl)
+			urlsSrvMock.EXPECT().Expand(gomock.Any(), "qwerty").Return(tt.link, nil)
+
+			passwordsMock := mockHandlers.NewMockpasswords(ctrl)
+			rendererMock := mockHandlers.NewMockrenderer(ctrl)
+			if tt.link.Protected() {
+				passwordsMock.EXPECT().Verify(tt.link, "192.0.2.1", "secret", gomock.Any()).Return(tt.wait, tt.verifyErr)
+			}
+			if tt.want.cookie {
+				passwordsMock.EXPECT().Token(tt.link, gomock.Any()).Return("token", expires)
+			}
+			if tt.want.page.Error != "" {
+				rendererMock.EXPECT().Render(gomock.Any(), "password.html", tt.want.page).Return(nil)
+			}
+
+			httpHandler := New(urlsSrvMock, nil, nil, nil, nil, nil, rendererMock, passwordsMock, nil)
+
+			request := httptest.NewRequest(http.MethodPost, "/qwerty?continue=1", bytes.NewBufferString("password=secret"))
+			request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("id", "qwerty")
+			request = request.WithContext(context.WithValue(request.Context(), chi.RouteCtxKey, rctx))
+
+			w := httptest.NewRecorder()
+			http.HandlerFunc(httpHandler.Unlock).ServeHTTP(w, request)
+
+			result := w.Result()
+			require.NoError(t, result.Body.Close())
+
+			assert.Equal(t, tt.want.statusCode, result.StatusCode)
+			assert.Equal(t, tt.want.location, result.Header.Get("Location"))
+			assert.Equal(t, tt.want.retryAfter, result.Header.Get("Retry-After"))
+
+			cookies := result.Cookies()
+			if !tt.want.cookie {
+				assert.Empty(t, cookies)
+				return
+			}
+			require.Len(t, cookies, 1)
+			assert.Equal(t, "unlock_cXdlcnR5", cookies[0].Name)
+			assert.Equal(t, "token", cookies[0].Value)
+			assert.True(t, cookies[0].HttpOnly)
+			assert.True(t, expires.Equal(cookies[0].Expires))
+		})
+	}
+}
+
+func TestRedirectCacheControl(t *testing.T) {
+	now := time.Date(2022, 5, 1, 0, 0, 0, 0, time.UTC)
+	soon := now.Add(time.Minute * 10)
+	later := now.Add(time.Hour * 24 * 7)
+
+	tests := []struct {
+		name string
+		link models.URL
+		exp  string
+	}{
+		{name: "found", link: models.URL{RedirectType: http.StatusFound}, exp: "private, no-store"},
+		{name: "temporary", link: models.URL{RedirectType: http.StatusTemporaryRedirect}, exp: "private, no-store"},
+		{name: "permanent", link: models.URL{RedirectType: http.StatusPermanentRedirect}, exp: "public, max-age=86400"},
+		{name: "permanent expires later", link: models.URL{RedirectType: http.StatusMovedPermanently, ExpiresAt: &later}, exp: "public, max-age=86400"},
+		{name: "permanent expires soon", link: models.URL{RedirectType: http.StatusMovedPermanently, ExpiresAt: &soon}, exp: "public, max-age=600"},
+		{name: "permanent protected", link: models.URL{RedirectType: http.StatusPermanentRedirect, PasswordHash: "hash"}, exp: "private, no-store"},
+		{name: "permanent limited", link: models.URL{RedirectType: http.StatusPermanentRedirect, MaxClicks: 10}, exp: "private, no-store"},
+		{name: "permanent with rules", link: models.URL{RedirectType: http.StatusPermanentRedirect, Rules: []models.Rule{{Platforms: []string{"ios"}}}}, exp: "private, no-store"},
+		{name: "permanent split", link: models.URL{RedirectType: http.StatusPermanentRedirect, Targets: []models.Target{{URL: "a"}, {URL: "b"}}}, exp: "private, no-store"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.exp, redirectCacheControl(tt.link, now), tt.name)
+	}
+}
+
+func TestHandler_GetUrls_Success(t *testing.T) {
+	type want struct {
+		contentType string
+		statusCode  int
+		response    string
+	}
+	tests := []struct {
+		name    string
+		request string
+		urls    []models.URL
+		err     error
+		want    want
+	}{
+		{
+			name: "success",
+			urls: []models.URL{
+				{
+					ShortURL:    "http://localhost:8080/xyz",
+					OriginalURL: "https://avito.ru",
+				},
+				{
+					ShortURL:    "http://localhost:8080/qwerty",
+					OriginalURL: "https://yandex.ru",
+				},
+			},
+			err: nil,
+			want: want{
+				contentType: "application/json",
+				statusCode:  200,
+				response:    "[{\"short_url\":\"http://localhost:8080/xyz\",\"original_url\":\"https://avito.ru\",\"effective_url\":\"https://avito.ru\"},{\"short_url\":\"http://localhost:8080/qwerty\",\"original_url\":\"https://yandex.ru\",\"effective_url\":\"https://yandex.ru\"}]",
+			},
+			request: "/api/user/urls",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			urlsSrvMock := mockHandlers.NewMockurlsService(ctrl)
+			urlsSrvMock.EXPECT().GetUrls(ctx, defaultUserID).Return(tt.urls, tt.err)
+
+			authMock := mockHandlers.NewMockauth(ctrl)
+			authMock.EXPECT().UserID(gomock.Any()).Return(defaultUserID)
+
+			httpHandler := New(urlsSrvMock, authMock, nil, nil, nil, nil, nil, nil, nil)
+
+			request := httptest.NewRequest(http.MethodGet, tt.request, nil)
+
+			w := httptest.NewRecorder()
+			h := http.HandlerFunc(httpHandler.GetUrls)
+			h.ServeHTTP(w, request)
+
+			result := w.Result()
+
+			assert.Equal(t, tt.want.statusCode, result.StatusCode)
+			assert.Equal(t, tt.want.contentType, result.Header.Get("Content-Type"))
+
+			userResult, err := ioutil.ReadAll(result.Body)
 			require.NoError(t, err)
 			err = result.Body.Close()
 			require.NoError(t, err)
@@ -435,6 +1623,158 @@ func TestHandler_GetUrls_Success(t *testing.T) {
 	}
 }
 
+func TestHandler_GetStats(t *testing.T) {
+	from := time.Date(2022, 5, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(time.Hour * 48)
+
+	type want struct {
+		statusCode int
+		response   string
+	}
+	tests := []struct {
+		name      string
+		request   string
+		callStats bool
+		stats     models.ClickStats
+		err       error
+		want      want
+	}{
+		{
+			name:      "success",
+			request:   "/api/user/urls/xyz/stats?from=2022-05-01T00:00:00Z&to=2022-05-03T00:00:00Z",
+			callStats: true,
+			stats: models.ClickStats{
+				Total:    3,
+				Humans:   2,
+				Bots:     1,
+				Visitors: 2,
+				Buckets: []models.ClickBucket{
+					{Start: from, Count: 1, Humans: 1, Visitors: 1},
+					{Start: from.Add(time.Hour * 24), Count: 2, Humans: 1, Bots: 1, Visitors: 2},
+				},
+				Countries: []models.GeoCount{{Country: "GB", Count: 2}, {Count: 1}},
+				Cities:    []models.GeoCount{{Country: "GB", City: "London", Count: 2}, {Count: 1}},
+			},
+			want: want{
+				statusCode: http.StatusOK,
+				response: `{"url_id":"xyz","from":"2022-05-01T00:00:00Z","to":"2022-05-03T00:00:00Z","bucket":"day","total":3,"humans":2,"bots":1,"visitors":2,` +
+					`"buckets":[{"start":"2022-05-01T00:00:00Z","count":1,"humans":1,"bots":0,"visitors":1},` +
+					`{"start":"2022-05-02T00:00:00Z","count":2,"humans":1,"bots":1,"visitors":2}],` +
+					`"countries":[{"country":"GB","count":2},{"country":"","count":1}],` +
+					`"cities":[{"country":"GB","city":"London","count":2},{"country":"","count":1}]}`,
+			},
+		},
+		{
+			name:      "other user url",
+			request:   "/api/user/urls/xyz/stats?from=2022-05-01T00:00:00Z&to=2022-05-03T00:00:00Z",
+			callStats: true,
+			err:       clicksSrv.ErrURLNotFound,
+			want: want{
+				statusCode: http.StatusNotFound,
+				response:   "url not found\n",
+			},
+		},
+		{
+			name:    "unknown bucket",
+			request: "/api/user/urls/xyz/stats?bucket=week",
+			want: want{
+				statusCode: http.StatusBadRequest,
+				response:   "bucket must be one of minute, hour or day\n",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			authMock := mockHandlers.NewMockauth(ctrl)
+			clicksMock := mockHandlers.NewMockclicks(ctrl)
+			if tt.callStats {
+				authMock.EXPECT().UserID(gomock.Any()).Return(defaultUserID)
+				clicksMock.EXPECT().Stats(gomock.Any(), "xyz", defaultUserID, from, to, time.Hour*24).Return(tt.stats, tt.err)
+			}
+
+			httpHandler := New(nil, authMock, nil, nil, clicksMock, nil, nil, nil, nil)
+
+			request := httptest.NewRequest(http.MethodGet, tt.request, nil)
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("id", "xyz")
+			request = request.WithContext(context.WithValue(request.Context(), chi.RouteCtxKey, rctx))
+
+			w := httptest.NewRecorder()
+			h := http.HandlerFunc(httpHandler.GetStats)
+			h.ServeHTTP(w, request)
+
+			result := w.Result()
+
+			assert.Equal(t, tt.want.statusCode, result.StatusCode)
+
+			userResult, err := ioutil.ReadAll(result.Body)
+			require.NoError(t, err)
+			err = result.Body.Close()
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.want.response, string(userResult))
+		})
+	}
+}
+
+func TestHandler_UTMTemplate(t *testing.T) {
+	ctx := context.Background()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	template := &models.UTM{Source: "newsletter", Medium: "email"}
+	urlSrvMock := mockHandlers.NewMockurlsService(ctrl)
+	gomock.InOrder(
+		urlSrvMock.EXPECT().GetUTMTemplate(ctx, defaultUserID).Return(nil, nil),
+		urlSrvMock.EXPECT().SetUTMTemplate(ctx, defaultUserID, template).Return(nil),
+		urlSrvMock.EXPECT().GetUTMTemplate(ctx, defaultUserID).Return(template, nil),
+		urlSrvMock.EXPECT().SetUTMTemplate(ctx, defaultUserID, &models.UTM{}).
+			Return(fmt.Errorf("utm template must not be empty: %w", urls.ErrInvalidUTM)),
+		urlSrvMock.EXPECT().SetUTMTemplate(ctx, defaultUserID, nil).Return(nil),
+	)
+
+	authMock := mockHandlers.NewMockauth(ctrl)
+	authMock.EXPECT().UserID(gomock.Any()).Return(defaultUserID).AnyTimes()
+
+	httpHandler := New(urlSrvMock, authMock, nil, nil, nil, nil, nil, nil, nil)
+
+	tests := []struct {
+		name       string
+		method     string
+		body       string
+		handler    http.HandlerFunc
+		statusCode int
+		response   string
+	}{
+		{name: "no template", method: http.MethodGet, handler: httpHandler.GetUTMTemplate, statusCode: http.StatusNoContent},
+		{name: "set", method: http.MethodPut, body: `{"source":"newsletter","medium":"email"}`, handler: httpHandler.SetUTMTemplate, statusCode: http.StatusNoContent},
+		{name: "get", method: http.MethodGet, handler: httpHandler.GetUTMTemplate, statusCode: http.StatusOK, response: `{"source":"newsletter","medium":"email"}`},
+		{name: "set empty", method: http.MethodPut, body: `{}`, handler: httpHandler.SetUTMTemplate, statusCode: http.StatusBadRequest},
+		{name: "set malformed", method: http.MethodPut, body: `{"source":1}`, handler: httpHandler.SetUTMTemplate, statusCode: http.StatusBadRequest},
+		{name: "delete", method: http.MethodDelete, handler: httpHandler.DeleteUTMTemplate, statusCode: http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		request := httptest.NewRequest(tt.method, "/api/user/utm", bytes.NewBufferString(tt.body))
+
+		w := httptest.NewRecorder()
+		tt.handler.ServeHTTP(w, request)
+
+		result := w.Result()
+		body, err := io.ReadAll(result.Body)
+		require.NoError(t, err)
+		require.NoError(t, result.Body.Close())
+
+		assert.Equal(t, tt.statusCode, result.StatusCode, tt.name)
+		if tt.response != "" {
+			assert.JSONEq(t, tt.response, string(body), tt.name)
+		}
+	}
+}
+
 func TestHandler_Ping(t *testing.T) {
 	type want struct {
 		statusCode int
@@ -472,7 +1812,7 @@ func TestHandler_Ping(t *testing.T) {
 			infraMock := mockHandlers.NewMockinfra(ctrl)
 			infraMock.EXPECT().Ping(ctx).Return(tt.success)
 
-			httpHandler := New(nil, nil, infraMock, nil)
+			httpHandler := New(nil, nil, infraMock, nil, nil, nil, nil, nil, nil)
 
 			request := httptest.NewRequest(http.MethodGet, tt.request, nil)
 
@@ -540,7 +1880,7 @@ func TestHandler_ShortenBatch_Success(t *testing.T) {
 			urlsSrvMock := mockHandlers.NewMockurlsService(ctrl)
 			urlsSrvMock.EXPECT().ShortenBatch(ctx, tt.originalURLs, defaultUserID).Return(tt.urls, tt.err)
 
-			httpHandler := New(urlsSrvMock, authMock, nil, nil)
+			httpHandler := New(urlsSrvMock, authMock, nil, nil, nil, nil, nil, nil, nil)
 
 			buffer := new(bytes.Buffer)
 			buffer.WriteString(tt.body)
@@ -610,7 +1950,7 @@ func TestHandler_ShortenBatch_BadRequest(t *testing.T) {
 			ctrl := gomock.NewController(t)
 			defer ctrl.Finish()
 
-			httpHandler := New(nil, nil, nil, nil)
+			httpHandler := New(nil, nil, nil, nil, nil, nil, nil, nil, nil)
 
 			buffer := new(bytes.Buffer)
 			buffer.WriteString(tt.body)
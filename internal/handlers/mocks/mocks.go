@@ -6,7 +6,10 @@ package mock_handlers
 
 import (
 	context "context"
+	io "io"
+	http "net/http"
 	reflect "reflect"
+	time "time"
 
 	models "github.com/bgoldovsky/shortener/internal/app/models"
 	gomock "github.com/golang/mock/gomock"
@@ -35,11 +38,25 @@ func (m *MockurlsService) EXPECT() *MockurlsServiceMockRecorder {
 	return m.recorder
 }
 
+// CountClick mocks base method.
+func (m *MockurlsService) CountClick(ctx context.Context, id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CountClick", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CountClick indicates an expected call of CountClick.
+func (mr *MockurlsServiceMockRecorder) CountClick(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountClick", reflect.TypeOf((*MockurlsService)(nil).CountClick), ctx, id)
+}
+
 // Expand mocks base method.
-func (m *MockurlsService) Expand(ctx context.Context, id string) (string, error) {
+func (m *MockurlsService) Expand(ctx context.Context, id string) (models.URL, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "Expand", ctx, id)
-	ret0, _ := ret[0].(string)
+	ret0, _ := ret[0].(models.URL)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
@@ -50,6 +67,21 @@ func (mr *MockurlsServiceMockRecorder) Expand(ctx, id interface{}) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Expand", reflect.TypeOf((*MockurlsService)(nil).Expand), ctx, id)
 }
 
+// GetUTMTemplate mocks base method.
+func (m *MockurlsService) GetUTMTemplate(ctx context.Context, userID string) (*models.UTM, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUTMTemplate", ctx, userID)
+	ret0, _ := ret[0].(*models.UTM)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUTMTemplate indicates an expected call of GetUTMTemplate.
+func (mr *MockurlsServiceMockRecorder) GetUTMTemplate(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUTMTemplate", reflect.TypeOf((*MockurlsService)(nil).GetUTMTemplate), ctx, userID)
+}
+
 // GetUrls mocks base method.
 func (m *MockurlsService) GetUrls(ctx context.Context, userID string) ([]models.URL, error) {
 	m.ctrl.T.Helper()
@@ -65,19 +97,48 @@ func (mr *MockurlsServiceMockRecorder) GetUrls(ctx, userID interface{}) *gomock.
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUrls", reflect.TypeOf((*MockurlsService)(nil).GetUrls), ctx, userID)
 }
 
+// GetUserURL mocks base method.
+func (m *MockurlsService) GetUserURL(ctx context.Context, id, userID string) (models.URL, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserURL", ctx, id, userID)
+	ret0, _ := ret[0].(models.URL)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserURL indicates an expected call of GetUserURL.
+func (mr *MockurlsServiceMockRecorder) GetUserURL(ctx, id, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserURL", reflect.TypeOf((*MockurlsService)(nil).GetUserURL), ctx, id, userID)
+}
+
+// SetUTMTemplate mocks base method.
+func (m *MockurlsService) SetUTMTemplate(ctx context.Context, userID string, utm *models.UTM) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetUTMTemplate", ctx, userID, utm)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetUTMTemplate indicates an expected call of SetUTMTemplate.
+func (mr *MockurlsServiceMockRecorder) SetUTMTemplate(ctx, userID, utm interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetUTMTemplate", reflect.TypeOf((*MockurlsService)(nil).SetUTMTemplate), ctx, userID, utm)
+}
+
 // Shorten mocks base method.
-func (m *MockurlsService) Shorten(ctx context.Context, url, userID string) (string, error) {
+func (m *MockurlsService) Shorten(ctx context.Context, original models.OriginalURL, userID string) (string, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Shorten", ctx, url, userID)
+	ret := m.ctrl.Call(m, "Shorten", ctx, original, userID)
 	ret0, _ := ret[0].(string)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // Shorten indicates an expected call of Shorten.
-func (mr *MockurlsServiceMockRecorder) Shorten(ctx, url, userID interface{}) *gomock.Call {
+func (mr *MockurlsServiceMockRecorder) Shorten(ctx, original, userID interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Shorten", reflect.TypeOf((*MockurlsService)(nil).Shorten), ctx, url, userID)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Shorten", reflect.TypeOf((*MockurlsService)(nil).Shorten), ctx, original, userID)
 }
 
 // ShortenBatch mocks base method.
@@ -203,3 +264,261 @@ func (mr *MockcleanerMockRecorder) Queue(urls interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Queue", reflect.TypeOf((*Mockcleaner)(nil).Queue), urls)
 }
+
+// Mockclicks is a mock of clicks interface.
+type Mockclicks struct {
+	ctrl     *gomock.Controller
+	recorder *MockclicksMockRecorder
+}
+
+// MockclicksMockRecorder is the mock recorder for Mockclicks.
+type MockclicksMockRecorder struct {
+	mock *Mockclicks
+}
+
+// NewMockclicks creates a new mock instance.
+func NewMockclicks(ctrl *gomock.Controller) *Mockclicks {
+	mock := &Mockclicks{ctrl: ctrl}
+	mock.recorder = &MockclicksMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *Mockclicks) EXPECT() *MockclicksMockRecorder {
+	return m.recorder
+}
+
+// Queue mocks base method.
+func (m *Mockclicks) Queue(click models.Click) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Queue", click)
+}
+
+// Queue indicates an expected call of Queue.
+func (mr *MockclicksMockRecorder) Queue(click interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Queue", reflect.TypeOf((*Mockclicks)(nil).Queue), click)
+}
+
+// Stats mocks base method.
+func (m *Mockclicks) Stats(ctx context.Context, urlID, userID string, from, to time.Time, bucket time.Duration) (models.ClickStats, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Stats", ctx, urlID, userID, from, to, bucket)
+	ret0, _ := ret[0].(models.ClickStats)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Stats indicates an expected call of Stats.
+func (mr *MockclicksMockRecorder) Stats(ctx, urlID, userID, from, to, bucket interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Stats", reflect.TypeOf((*Mockclicks)(nil).Stats), ctx, urlID, userID, from, to, bucket)
+}
+
+// Mockbots is a mock of bots interface.
+type Mockbots struct {
+	ctrl     *gomock.Controller
+	recorder *MockbotsMockRecorder
+}
+
+// MockbotsMockRecorder is the mock recorder for Mockbots.
+type MockbotsMockRecorder struct {
+	mock *Mockbots
+}
+
+// NewMockbots creates a new mock instance.
+func NewMockbots(ctrl *gomock.Controller) *Mockbots {
+	mock := &Mockbots{ctrl: ctrl}
+	mock.recorder = &MockbotsMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *Mockbots) EXPECT() *MockbotsMockRecorder {
+	return m.recorder
+}
+
+// IsBot mocks base method.
+func (m *Mockbots) IsBot(r *http.Request) bool {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IsBot", r)
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// IsBot indicates an expected call of IsBot.
+func (mr *MockbotsMockRecorder) IsBot(r interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsBot", reflect.TypeOf((*Mockbots)(nil).IsBot), r)
+}
+
+// Mockrenderer is a mock of renderer interface.
+type Mockrenderer struct {
+	ctrl     *gomock.Controller
+	recorder *MockrendererMockRecorder
+}
+
+// MockrendererMockRecorder is the mock recorder for Mockrenderer.
+type MockrendererMockRecorder struct {
+	mock *Mockrenderer
+}
+
+// NewMockrenderer creates a new mock instance.
+func NewMockrenderer(ctrl *gomock.Controller) *Mockrenderer {
+	mock := &Mockrenderer{ctrl: ctrl}
+	mock.recorder = &MockrendererMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *Mockrenderer) EXPECT() *MockrendererMockRecorder {
+	return m.recorder
+}
+
+// Render mocks base method.
+func (m *Mockrenderer) Render(w io.Writer, name string, data interface{}) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Render", w, name, data)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Render indicates an expected call of Render.
+func (mr *MockrendererMockRecorder) Render(w, name, data interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Render", reflect.TypeOf((*Mockrenderer)(nil).Render), w, name, data)
+}
+
+// Mockpasswords is a mock of passwords interface.
+type Mockpasswords struct {
+	ctrl     *gomock.Controller
+	recorder *MockpasswordsMockRecorder
+}
+
+// MockpasswordsMockRecorder is the mock recorder for Mockpasswords.
+type MockpasswordsMockRecorder struct {
+	mock *Mockpasswords
+}
+
+// NewMockpasswords creates a new mock instance.
+func NewMockpasswords(ctrl *gomock.Controller) *Mockpasswords {
+	mock := &Mockpasswords{ctrl: ctrl}
+	mock.recorder = &MockpasswordsMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *Mockpasswords) EXPECT() *MockpasswordsMockRecorder {
+	return m.recorder
+}
+
+// Token mocks base method.
+func (m *Mockpasswords) Token(link models.URL, now time.Time) (string, time.Time) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Token", link, now)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(time.Time)
+	return ret0, ret1
+}
+
+// Token indicates an expected call of Token.
+func (mr *MockpasswordsMockRecorder) Token(link, now interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Token", reflect.TypeOf((*Mockpasswords)(nil).Token), link, now)
+}
+
+// Valid mocks base method.
+func (m *Mockpasswords) Valid(link models.URL, token string, now time.Time) bool {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Valid", link, token, now)
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// Valid indicates an expected call of Valid.
+func (mr *MockpasswordsMockRecorder) Valid(link, token, now interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Valid", reflect.TypeOf((*Mockpasswords)(nil).Valid), link, token, now)
+}
+
+// Verify mocks base method.
+func (m *Mockpasswords) Verify(link models.URL, ip, password string, now time.Time) (time.Duration, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Verify", link, ip, password, now)
+	ret0, _ := ret[0].(time.Duration)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Verify indicates an expected call of Verify.
+func (mr *MockpasswordsMockRecorder) Verify(link, ip, password, now interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Verify", reflect.TypeOf((*Mockpasswords)(nil).Verify), link, ip, password, now)
+}
+
+// Mockvariants is a mock of variants interface.
+type Mockvariants struct {
+	ctrl     *gomock.Controller
+	recorder *MockvariantsMockRecorder
+}
+
+// MockvariantsMockRecorder is the mock recorder for Mockvariants.
+type MockvariantsMockRecorder struct {
+	mock *Mockvariants
+}
+
+// NewMockvariants creates a new mock instance.
+func NewMockvariants(ctrl *gomock.Controller) *Mockvariants {
+	mock := &Mockvariants{ctrl: ctrl}
+	mock.recorder = &MockvariantsMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *Mockvariants) EXPECT() *MockvariantsMockRecorder {
+	return m.recorder
+}
+
+// Pick mocks base method.
+func (m *Mockvariants) Pick(link models.URL) int {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Pick", link)
+	ret0, _ := ret[0].(int)
+	return ret0
+}
+
+// Pick indicates an expected call of Pick.
+func (mr *MockvariantsMockRecorder) Pick(link interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Pick", reflect.TypeOf((*Mockvariants)(nil).Pick), link)
+}
+
+// Token mocks base method.
+func (m *Mockvariants) Token(link models.URL, idx int, now time.Time) (string, time.Time) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Token", link, idx, now)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(time.Time)
+	return ret0, ret1
+}
+
+// Token indicates an expected call of Token.
+func (mr *MockvariantsMockRecorder) Token(link, idx, now interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Token", reflect.TypeOf((*Mockvariants)(nil).Token), link, idx, now)
+}
+
+// Variant mocks base method.
+func (m *Mockvariants) Variant(link models.URL, token string) (int, bool) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Variant", link, token)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(bool)
+	return ret0, ret1
+}
+
+// Variant indicates an expected call of Variant.
+func (mr *MockvariantsMockRecorder) Variant(link, token interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Variant", reflect.TypeOf((*Mockvariants)(nil).Variant), link, token)
+}
@@ -1,7 +1,88 @@
 package handlers
 
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
 type ShortenRequest struct {
-	URL string `json:"url" valid:"url,required"`
+	URL       string     `json:"url" valid:"url"`
+	Alias     string     `json:"alias,omitempty"` // Желаемый идентификатор вместо случайного
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	TTL       int64      `json:"ttl,omitempty"` // Время жизни ссылки в секундах
+	// Код перенаправления: 301, 302, 307 или 308, по умолчанию из настроек сервиса
+	RedirectType int `json:"redirect_type,omitempty"`
+	// Показывать страницу предпросмотра перед каждым переходом
+	Interstitial bool `json:"interstitial,omitempty"`
+	// Пароль для перехода, хранится только его медленный хэш
+	Password string `json:"password,omitempty"`
+	// Окно работы ссылки, not_after - синоним expires_at
+	NotBefore *time.Time `json:"not_before,omitempty"`
+	NotAfter  *time.Time `json:"not_after,omitempty"`
+	// Сколько переходов разрешено, по умолчанию без ограничения
+	MaxClicks int64 `json:"max_clicks,omitempty"`
+	// Адреса назначения вместо url, переходы распределяются между ними по весам
+	Targets []TargetRequest `json:"targets,omitempty"`
+	// Посетитель всегда попадает на однажды выбранный адрес
+	Sticky bool `json:"sticky,omitempty"`
+	// Правила перенаправления по признакам запроса, проверяются по порядку.
+	// Если не подошло ни одно, переход идет на url или targets
+	Rules []RuleRequest `json:"rules,omitempty"`
+	// Дописывать путь после идентификатора и параметры запроса к адресу назначения
+	Passthrough bool `json:"passthrough,omitempty"`
+	// Метки кампании, дописываются к адресу назначения при переходе.
+	// Незаданные метки берутся из шаблона пользователя
+	UTM *UTMRequest `json:"utm,omitempty"`
+}
+
+// UTMRequest Метки кампании utm_source, utm_medium, utm_campaign, utm_term и utm_content
+type UTMRequest struct {
+	Source   string `json:"source,omitempty"`
+	Medium   string `json:"medium,omitempty"`
+	Campaign string `json:"campaign,omitempty"`
+	Term     string `json:"term,omitempty"`
+	Content  string `json:"content,omitempty"`
+}
+
+type RuleRequest struct {
+	Platforms []string          `json:"platforms,omitempty"` // ios, android, desktop
+	Languages []string          `json:"languages,omitempty"` // Основной язык из Accept-Language, например ru
+	Query     map[string]string `json:"query,omitempty"`
+	Hours     *HoursRequest     `json:"hours,omitempty"` // Время суток по UTC
+	Target    string            `json:"target" valid:"url,required"`
+}
+
+type HoursRequest struct {
+	From clock `json:"from"`
+	To   clock `json:"to"` // Не входит в интервал, интервал может переходить через полночь
+}
+
+// clock Время суток в формате ЧЧ:ММ, хранится в минутах от полуночи
+type clock int
+
+func (c clock) MarshalJSON() ([]byte, error) {
+	return json.Marshal(fmt.Sprintf("%02d:%02d", int(c)/60, int(c)%60))
+}
+
+func (c *clock) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return fmt.Errorf("time of day must be in HH:MM format: %w", err)
+	}
+	*c = clock(t.Hour()*60 + t.Minute())
+
+	return nil
+}
+
+type TargetRequest struct {
+	URL    string `json:"url" valid:"url,required"`
+	Weight int    `json:"weight,omitempty"` // По умолчанию 1, то есть поровну между адресами
 }
 
 type ShortenReply struct {
@@ -9,8 +90,17 @@ type ShortenReply struct {
 }
 
 type ShortenBatchRequest struct {
-	CorrelationID string `json:"correlation_id" valid:"required"`
-	OriginalURL   string `json:"original_url" valid:"url,required"`
+	CorrelationID string      `json:"correlation_id" valid:"required"`
+	OriginalURL   string      `json:"original_url" valid:"url,required"`
+	ExpiresAt     *time.Time  `json:"expires_at,omitempty"`
+	TTL           int64       `json:"ttl,omitempty"` // Время жизни ссылки в секундах
+	RedirectType  int         `json:"redirect_type,omitempty"`
+	Interstitial  bool        `json:"interstitial,omitempty"`
+	NotBefore     *time.Time  `json:"not_before,omitempty"`
+	NotAfter      *time.Time  `json:"not_after,omitempty"`
+	MaxClicks     int64       `json:"max_clicks,omitempty"`
+	Passthrough   bool        `json:"passthrough,omitempty"`
+	UTM           *UTMRequest `json:"utm,omitempty"`
 }
 
 type ShortenBatchReply struct {
@@ -21,4 +111,111 @@ type ShortenBatchReply struct {
 type GetUrlsReply struct {
 	ShortURL    string `json:"short_url"`
 	OriginalURL string `json:"original_url"`
+	// Адрес вместе с метками кампании, на который ведет переход без правил
+	EffectiveURL string     `json:"effective_url"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	// Не указывается, если ссылка перенаправляет с кодом по умолчанию
+	RedirectType int        `json:"redirect_type,omitempty"`
+	Interstitial bool       `json:"interstitial,omitempty"`
+	Protected    bool       `json:"password_protected,omitempty"`
+	NotBefore    *time.Time `json:"not_before,omitempty"`
+	// Счетчик переходов ведется только для ссылок с ограничением
+	MaxClicks  int64 `json:"max_clicks,omitempty"`
+	ClickCount int64 `json:"click_count,omitempty"`
+	// Адреса ссылки с несколькими адресами, original_url совпадает с первым
+	Targets     []TargetReply `json:"targets,omitempty"`
+	Sticky      bool          `json:"sticky,omitempty"`
+	Rules       []RuleRequest `json:"rules,omitempty"`
+	Passthrough bool          `json:"passthrough,omitempty"`
+	UTM         *UTMRequest   `json:"utm,omitempty"`
+}
+
+type TargetReply struct {
+	URL    string `json:"url"`
+	Weight int    `json:"weight"`
+}
+
+// DryRunRequest Признаки проверяемого запроса, незаданные берутся из самого запроса проверки
+type DryRunRequest struct {
+	UserAgent      string            `json:"user_agent,omitempty"`
+	AcceptLanguage string            `json:"accept_language,omitempty"`
+	Query          map[string]string `json:"query,omitempty"`
+	Time           *time.Time        `json:"time,omitempty"`
+}
+
+type DryRunReply struct {
+	Platform string `json:"platform"`
+	Language string `json:"language,omitempty"`
+	// Номер сработавшего правила с нуля, null, если не подошло ни одно
+	Rule    *int          `json:"rule"`
+	Target  string        `json:"target,omitempty"`
+	Targets []TargetReply `json:"targets,omitempty"` // Адреса, между которыми распределится переход без правила
+}
+
+// RefusalReply Причина отказа в переходе по ссылке
+type RefusalReply struct {
+	Error   string `json:"error"` // Код причины, не меняется между версиями
+	Message string `json:"message"`
+	// Время, с которого ссылка начнет работать, только для url_not_active
+	NotBefore *time.Time `json:"not_before,omitempty"`
+}
+
+// previewPage Данные страницы предпросмотра ссылки
+type previewPage struct {
+	Destination string    // Исходный URL
+	Host        string    // Хост исходного URL, пустой, если его не удалось разобрать
+	CreatedAt   time.Time // Время создания ссылки, нулевое, если неизвестно
+	ContinueURL string    // Переход по ссылке в обход предпросмотра
+}
+
+// passwordPage Данные формы пароля закрытой ссылки
+type passwordPage struct {
+	Action string // Адрес отправки формы
+	Error  string // Причина повторного запроса пароля
+}
+
+// statsRequest Период и шаг статистики переходов
+type statsRequest struct {
+	From       time.Time
+	To         time.Time
+	Bucket     time.Duration
+	BucketName string
+}
+
+type StatsReply struct {
+	URLID     string             `json:"url_id"`
+	From      time.Time          `json:"from"`
+	To        time.Time          `json:"to"`
+	Bucket    string             `json:"bucket"`
+	Total     int64              `json:"total"`
+	Humans    int64              `json:"humans"`
+	Bots      int64              `json:"bots"`
+	Visitors  int64              `json:"visitors"` // Оценка уникальных посетителей-людей за сутки, затронутые периодом
+	Buckets   []StatsBucketReply `json:"buckets"`
+	Countries []StatsGeoReply    `json:"countries"`
+	Cities    []StatsGeoReply    `json:"cities"`
+	// Только для ссылок с несколькими адресами
+	Targets []StatsTargetReply `json:"targets,omitempty"`
+}
+
+type StatsTargetReply struct {
+	URL    string `json:"url"`
+	Weight int    `json:"weight"`
+	Count  int64  `json:"count"`
+	Humans int64  `json:"humans"`
+	Bots   int64  `json:"bots"`
+}
+
+type StatsGeoReply struct {
+	Country string `json:"country"` // Пустой, если местоположение не определено
+	City    string `json:"city,omitempty"`
+	Count   int64  `json:"count"`
+}
+
+type StatsBucketReply struct {
+	Start    time.Time `json:"start"`
+	Count    int64     `json:"count"`
+	Humans   int64     `json:"humans"`
+	Bots     int64     `json:"bots"`
+	Visitors int64     `json:"visitors,omitempty"` // Только для суточных интервалов
 }
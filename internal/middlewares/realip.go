@@ -0,0 +1,103 @@
+package middlewares
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+type realIP struct {
+	trusted []*net.IPNet
+}
+
+// NewRealIP Создает middleware, которое доверяет заголовкам X-Forwarded-For и X-Real-IP
+// только от прокси из списка trusted: адресов и подсетей в нотации CIDR
+func NewRealIP(trusted []string) (*realIP, error) {
+	nets := make([]*net.IPNet, 0, len(trusted))
+	for _, value := range trusted {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", value)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, ipNet, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", value, err)
+		}
+		nets = append(nets, ipNet)
+	}
+
+	return &realIP{
+		trusted: nets,
+	}, nil
+}
+
+// RealIP Подменяет RemoteAddr адресом клиента, если запрос пришел от доверенного прокси
+func (m *realIP) RealIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ip := m.clientIP(r); ip != "" {
+			r.RemoteAddr = net.JoinHostPort(ip, "0")
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// clientIP Возвращает адрес клиента из заголовков доверенного прокси, либо пустую строку
+func (m *realIP) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !m.isTrusted(net.ParseIP(host)) {
+		return ""
+	}
+
+	// Идем справа налево: левые элементы мог подставить сам клиент
+	if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+		hops := strings.Split(strings.Join(forwarded, ","), ",")
+		for idx := len(hops) - 1; idx >= 0; idx-- {
+			ip := net.ParseIP(strings.TrimSpace(hops[idx]))
+			if ip == nil {
+				return ""
+			}
+			if idx == 0 || !m.isTrusted(ip) {
+				return ip.String()
+			}
+		}
+	}
+
+	if ip := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP"))); ip != nil {
+		return ip.String()
+	}
+
+	return ""
+}
+
+func (m *realIP) isTrusted(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+
+	for _, ipNet := range m.trusted {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
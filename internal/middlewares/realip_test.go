@@ -0,0 +1,93 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRealIP(t *testing.T) {
+	tests := []struct {
+		name          string
+		remoteAddr    string
+		forwardedFor  []string
+		realIP        string
+		expRemoteAddr string
+	}{
+		{
+			name:          "direct client",
+			remoteAddr:    "203.0.113.5:4321",
+			expRemoteAddr: "203.0.113.5:4321",
+		},
+		{
+			name:          "untrusted proxy headers are ignored",
+			remoteAddr:    "203.0.113.5:4321",
+			forwardedFor:  []string{"198.51.100.7"},
+			realIP:        "198.51.100.8",
+			expRemoteAddr: "203.0.113.5:4321",
+		},
+		{
+			name:          "trusted proxy",
+			remoteAddr:    "10.0.0.2:4321",
+			forwardedFor:  []string{"198.51.100.7"},
+			expRemoteAddr: "198.51.100.7:0",
+		},
+		{
+			name:          "spoofed hop before trusted chain",
+			remoteAddr:    "10.0.0.2:4321",
+			forwardedFor:  []string{"1.1.1.1, 198.51.100.7", "192.168.1.1"},
+			expRemoteAddr: "198.51.100.7:0",
+		},
+		{
+			name:          "all hops trusted",
+			remoteAddr:    "10.0.0.2:4321",
+			forwardedFor:  []string{"10.0.0.9, 192.168.1.1"},
+			expRemoteAddr: "10.0.0.9:0",
+		},
+		{
+			name:          "x-real-ip from trusted proxy",
+			remoteAddr:    "192.168.1.1:4321",
+			realIP:        "2001:db8::1",
+			expRemoteAddr: "[2001:db8::1]:0",
+		},
+		{
+			name:          "garbage header",
+			remoteAddr:    "10.0.0.2:4321",
+			forwardedFor:  []string{"unknown"},
+			expRemoteAddr: "10.0.0.2:4321",
+		},
+	}
+
+	m, err := NewRealIP([]string{"10.0.0.0/8", "192.168.1.1"})
+	require.NoError(t, err)
+
+	for _, tt := range tests {
+		var act string
+		h := m.RealIP(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			act = r.RemoteAddr
+		}))
+
+		r := httptest.NewRequest(http.MethodGet, "/qwerty", nil)
+		r.RemoteAddr = tt.remoteAddr
+		for _, value := range tt.forwardedFor {
+			r.Header.Add("X-Forwarded-For", value)
+		}
+		if tt.realIP != "" {
+			r.Header.Set("X-Real-IP", tt.realIP)
+		}
+
+		h.ServeHTTP(httptest.NewRecorder(), r)
+		assert.Equal(t, tt.expRemoteAddr, act, tt.name)
+	}
+}
+
+func TestNewRealIP_Invalid(t *testing.T) {
+	_, err := NewRealIP([]string{"10.0.0.0/33"})
+	assert.Error(t, err)
+
+	_, err = NewRealIP([]string{"localhost"})
+	assert.Error(t, err)
+}